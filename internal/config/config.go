@@ -6,8 +6,17 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// DNSBLZone DNS黑名单
+type DNSBLZone struct {
+	Zone   string `yaml:"zone" json:"zone"`     // 黑名单域名，如 zen.spamhaus.org
+	Type   string `yaml:"type" json:"type"`     // ip: 查询客户端IP（默认）; domain: 查询HELO域名
+	Action string `yaml:"action" json:"action"` // reject: 拒收未认证的邮件; score: 计入垃圾邮件评分（默认）
+}
+
 // YAMLConfig YAML配置文件结构
 type YAMLConfig struct {
 	Server struct {
@@ -26,6 +35,9 @@ type YAMLConfig struct {
 			Port       int `yaml:"port"`
 			SecurePort int `yaml:"secure_port"`
 		} `yaml:"pop3"`
+		ManageSieve struct {
+			Port int `yaml:"port"`
+		} `yaml:"managesieve"`
 	} `yaml:"server"`
 
 	Admin struct {
@@ -54,15 +66,76 @@ type YAMLConfig struct {
 		EnableHTTPS    bool   `yaml:"enable_https"`
 		SSLCert        string `yaml:"ssl_cert"`
 		SSLKey         string `yaml:"ssl_key"`
+		CertDir        string `yaml:"cert_dir"`
+
+		DisablePlaintextAuth bool   `yaml:"disable_plaintext_auth"`
+		DKIMKeySecret        string `yaml:"dkim_key_secret"`
+
+		ACME struct {
+			Enabled         bool   `yaml:"enabled"`
+			DirectoryURL    string `yaml:"directory_url"`
+			Email           string `yaml:"email"`
+			CAFile          string `yaml:"ca_file"`
+			RenewBeforeDays int    `yaml:"renew_before_days"`
+			HTTPPort        int    `yaml:"http_port"`
+		} `yaml:"acme"`
 	} `yaml:"security"`
 
 	Email struct {
-		MaxSize             int  `yaml:"max_size"`
-		MaxMailboxesPerUser int  `yaml:"max_mailboxes_per_user"`
-		RetentionDays       int  `yaml:"retention_days"`
-		EnableForwarding    bool `yaml:"enable_forwarding"`
+		MaxSize             int     `yaml:"max_size"`
+		MaxMailboxesPerUser int     `yaml:"max_mailboxes_per_user"`
+		RetentionDays       int     `yaml:"retention_days"`
+		EnableForwarding    bool    `yaml:"enable_forwarding"`
+		AttachmentPath      string  `yaml:"attachment_path"`
+		QueueWorkers        int     `yaml:"queue_workers"`
+		QueueLifetimeHours  int     `yaml:"queue_lifetime_hours"`
+		SubaddressSeparator *string `yaml:"subaddress_separator"`
+
+		InboundAuth struct {
+			Enabled           *bool  `yaml:"enabled"`
+			LocalDomainPolicy string `yaml:"local_domain_policy"`
+			EnforceDMARC      *bool  `yaml:"enforce_dmarc"`
+		} `yaml:"inbound_auth"`
+
+		Forward struct {
+			MaxHops          int `yaml:"max_hops"`
+			MaxReceived      int `yaml:"max_received"`
+			RateLimitPerHour int `yaml:"rate_limit_per_hour"`
+		} `yaml:"forward"`
 	} `yaml:"email"`
 
+	Spam struct {
+		JunkThreshold   float64            `yaml:"junk_threshold"`
+		RejectThreshold float64            `yaml:"reject_threshold"`
+		Weights         map[string]float64 `yaml:"weights"`
+	} `yaml:"spam"`
+
+	DNSBL struct {
+		Zones        []DNSBLZone `yaml:"zones"`
+		CacheMinutes int         `yaml:"cache_minutes"`
+		Resolver     string      `yaml:"resolver"`
+	} `yaml:"dnsbl"`
+
+	Greylist struct {
+		Enabled        bool `yaml:"enabled"`
+		DelayMinutes   int  `yaml:"delay_minutes"`
+		RetryHours     int  `yaml:"retry_hours"`
+		LifetimeDays   int  `yaml:"lifetime_days"`
+		IPv4PrefixBits int  `yaml:"ipv4_prefix"`
+		IPv6PrefixBits int  `yaml:"ipv6_prefix"`
+	} `yaml:"greylist"`
+
+	Sieve struct {
+		MaxScripts    int `yaml:"max_scripts"`
+		MaxScriptSize int `yaml:"max_script_size"`
+		MaxRedirects  int `yaml:"max_redirects"`
+	} `yaml:"sieve"`
+
+	SRS struct {
+		Secret     string `yaml:"secret"`
+		MaxAgeDays int    `yaml:"max_age_days"`
+	} `yaml:"srs"`
+
 	Logging struct {
 		Level     string `yaml:"level"`
 		ToFile    bool   `yaml:"to_file"`
@@ -91,7 +164,10 @@ type Config struct {
 	SMTPPort587     string // SMTP提交端口
 	SMTPPort465     string // SMTPS端口
 	IMAPPort        string
+	IMAPSPort       string // IMAPS端口（隐式TLS，空或0表示不启用）
 	POP3Port        string
+	POP3SPort       string // POP3S端口（隐式TLS，空或0表示不启用）
+	ManageSievePort string // ManageSieve端口（空或0表示不启用）
 	DatabasePath    string
 	SessionKey      string
 	Domain          string
@@ -111,7 +187,10 @@ func Load() *Config {
 			SMTPPort587:     strconv.Itoa(yamlConfig.Server.SMTP.Port587),
 			SMTPPort465:     strconv.Itoa(yamlConfig.Server.SMTP.Port465),
 			IMAPPort:        strconv.Itoa(yamlConfig.Server.IMAP.Port),
+			IMAPSPort:       strconv.Itoa(yamlConfig.Server.IMAP.SecurePort),
 			POP3Port:        strconv.Itoa(yamlConfig.Server.POP3.Port),
+			POP3SPort:       strconv.Itoa(yamlConfig.Server.POP3.SecurePort),
+			ManageSievePort: strconv.Itoa(yamlConfig.Server.ManageSieve.Port),
 			DatabasePath:    yamlConfig.Database.Path,
 			SessionKey:      yamlConfig.Security.SessionKey,
 			Domain:          yamlConfig.Domain.Default,
@@ -126,7 +205,10 @@ func Load() *Config {
 		SMTPPort587:     getEnv("SMTP_PORT_587", "587"), // SMTP提交端口
 		SMTPPort465:     getEnv("SMTP_PORT_465", "465"), // SMTPS端口
 		IMAPPort:        getEnv("IMAP_PORT", "143"),
+		IMAPSPort:       getEnv("IMAPS_PORT", "993"),
 		POP3Port:        getEnv("POP3_PORT", "110"),
+		POP3SPort:       getEnv("POP3S_PORT", "995"),
+		ManageSievePort: getEnv("MANAGESIEVE_PORT", "4190"),
 		DatabasePath:    getEnv("DATABASE_PATH", "./miko_email.db"),
 		SessionKey:      getEnv("SESSION_KEY", "miko-email-secret-key-change-in-production"),
 		Domain:          getEnv("DOMAIN", "localhost"),
@@ -201,3 +283,380 @@ func GetAdminCredentials() (username, password, email string, enabled bool) {
 		getEnv("ADMIN_EMAIL", "admin@localhost"),
 		getEnvBool("ADMIN_ENABLED", true)
 }
+
+// GetAttachmentPath 获取附件存储目录
+func GetAttachmentPath() string {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Email.AttachmentPath != "" {
+		return GlobalYAMLConfig.Email.AttachmentPath
+	}
+	return getEnv("ATTACHMENT_PATH", "./attachments")
+}
+
+// IsAttachmentsEnabled 是否启用邮件附件
+func IsAttachmentsEnabled() bool {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Features.EnableAttachments
+	}
+	return getEnvBool("ENABLE_ATTACHMENTS", true)
+}
+
+// GetMaxEmailSize 获取单封邮件的最大字节数
+func GetMaxEmailSize() int64 {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Email.MaxSize > 0 {
+		return int64(GlobalYAMLConfig.Email.MaxSize) * 1024 * 1024
+	}
+	return 25 * 1024 * 1024
+}
+
+// GetMaxMailboxesPerUser 获取普通用户最多可以拥有的邮箱数量（别名和群组也计入）
+func GetMaxMailboxesPerUser() int {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Email.MaxMailboxesPerUser > 0 {
+		return GlobalYAMLConfig.Email.MaxMailboxesPerUser
+	}
+	if n, err := strconv.Atoi(getEnv("MAX_MAILBOXES_PER_USER", "")); err == nil && n > 0 {
+		return n
+	}
+	return 10
+}
+
+// GetQueueWorkers 获取出站队列的投递协程数量
+func GetQueueWorkers() int {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Email.QueueWorkers > 0 {
+		return GlobalYAMLConfig.Email.QueueWorkers
+	}
+	if n, err := strconv.Atoi(getEnv("QUEUE_WORKERS", "")); err == nil && n > 0 {
+		return n
+	}
+	return 4
+}
+
+// GetQueueLifetime 获取出站邮件的最长重试时间，超过后退信
+func GetQueueLifetime() time.Duration {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Email.QueueLifetimeHours > 0 {
+		return time.Duration(GlobalYAMLConfig.Email.QueueLifetimeHours) * time.Hour
+	}
+	return 5 * 24 * time.Hour
+}
+
+// GetSMTPHostname 获取对外投递时使用的主机名（EHLO），未配置时返回空
+func GetSMTPHostname() string {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Domain.SMTPHostname
+	}
+	return getEnv("SMTP_HOSTNAME", "")
+}
+
+// GetSubaddressSeparator 获取子地址分隔符（RFC 5233，如 user+tag@domain，默认 "+"）
+// 可以配置多个字符，任一字符都作为分隔符；配置为空字符串时不支持子地址
+func GetSubaddressSeparator() string {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Email.SubaddressSeparator != nil {
+		return *GlobalYAMLConfig.Email.SubaddressSeparator
+	}
+	return getEnv("SUBADDRESS_SEPARATOR", "+")
+}
+
+// IsInboundAuthEnabled 是否对外部投递到本地邮箱的邮件验证SPF/DKIM/DMARC（默认启用）
+func IsInboundAuthEnabled() bool {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Email.InboundAuth.Enabled != nil {
+		return *GlobalYAMLConfig.Email.InboundAuth.Enabled
+	}
+	return getEnvBool("INBOUND_AUTH_ENABLED", true)
+}
+
+// GetLocalDomainDMARCPolicy 获取From为本系统域名但DMARC未通过时的处理方式：reject/quarantine/none（默认reject）
+func GetLocalDomainDMARCPolicy() string {
+	policy := getEnv("LOCAL_DOMAIN_DMARC_POLICY", "reject")
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Email.InboundAuth.LocalDomainPolicy != "" {
+		policy = GlobalYAMLConfig.Email.InboundAuth.LocalDomainPolicy
+	}
+	switch policy {
+	case "reject", "quarantine", "none":
+		return policy
+	}
+	return "reject"
+}
+
+// IsDMARCEnforced 是否执行外部发件域名发布的DMARC策略（默认执行，关闭后只记录结果）
+func IsDMARCEnforced() bool {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Email.InboundAuth.EnforceDMARC != nil {
+		return *GlobalYAMLConfig.Email.InboundAuth.EnforceDMARC
+	}
+	return getEnvBool("ENFORCE_DMARC", true)
+}
+
+// IsSpamFilterEnabled 是否对收到的邮件进行垃圾邮件评分
+func IsSpamFilterEnabled() bool {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Features.EnableSpamFilter
+	}
+	return getEnvBool("ENABLE_SPAM_FILTER", false)
+}
+
+// GetSpamThresholds 获取全局垃圾邮件阈值：得分达到 junk 放入垃圾邮件，达到 reject 拒收（0表示不拒收）
+func GetSpamThresholds() (junk, reject float64) {
+	junk, reject = 5, 10
+	if GlobalYAMLConfig != nil {
+		if GlobalYAMLConfig.Spam.JunkThreshold > 0 {
+			junk = GlobalYAMLConfig.Spam.JunkThreshold
+		}
+		if GlobalYAMLConfig.Spam.RejectThreshold > 0 {
+			reject = GlobalYAMLConfig.Spam.RejectThreshold
+		}
+	}
+	return junk, reject
+}
+
+// GetSpamWeights 获取配置文件中覆盖的规则分数
+func GetSpamWeights() map[string]float64 {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Spam.Weights
+	}
+	return nil
+}
+
+// GetDNSBLZones 获取DNS黑名单列表（环境变量 DNSBL_ZONES 格式为 zone[:type[:action]]，逗号分隔）
+func GetDNSBLZones() []DNSBLZone {
+	var zones []DNSBLZone
+	if GlobalYAMLConfig != nil {
+		zones = append(zones, GlobalYAMLConfig.DNSBL.Zones...)
+	} else if env := getEnv("DNSBL_ZONES", ""); env != "" {
+		for _, item := range strings.Split(env, ",") {
+			parts := strings.Split(strings.TrimSpace(item), ":")
+			zone := DNSBLZone{Zone: parts[0]}
+			if len(parts) > 1 {
+				zone.Type = parts[1]
+			}
+			if len(parts) > 2 {
+				zone.Action = parts[2]
+			}
+			zones = append(zones, zone)
+		}
+	}
+
+	result := make([]DNSBLZone, 0, len(zones))
+	for _, zone := range zones {
+		zone.Zone = strings.Trim(strings.ToLower(strings.TrimSpace(zone.Zone)), ".")
+		if zone.Zone == "" {
+			continue
+		}
+		if zone.Type != "domain" {
+			zone.Type = "ip"
+		}
+		if zone.Action != "reject" {
+			zone.Action = "score"
+		}
+		result = append(result, zone)
+	}
+	return result
+}
+
+// GetDNSBLCacheTTL 获取DNS黑名单查询结果的缓存时间，默认30分钟
+func GetDNSBLCacheTTL() time.Duration {
+	minutes := 0
+	if GlobalYAMLConfig != nil {
+		minutes = GlobalYAMLConfig.DNSBL.CacheMinutes
+	} else if v, err := strconv.Atoi(getEnv("DNSBL_CACHE_MINUTES", "")); err == nil {
+		minutes = v
+	}
+	if minutes <= 0 {
+		minutes = 30
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// GetDNSBLResolver 获取查询DNS黑名单使用的DNS服务器（host:port），为空时使用系统解析器
+func GetDNSBLResolver() string {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.DNSBL.Resolver
+	}
+	return getEnv("DNSBL_RESOLVER", "")
+}
+
+// IsGreylistEnabled 是否对外部投递启用灰名单
+func IsGreylistEnabled() bool {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Greylist.Enabled
+	}
+	return getEnvBool("ENABLE_GREYLIST", false)
+}
+
+// GetGreylistTimes 获取灰名单的时间设置：首次投递后需要等待的时间（默认5分钟）、
+// 等待重试的最长时间（默认24小时）、通过后免检的时间（默认36天，每次投递后延长）
+func GetGreylistTimes() (delay, retry, lifetime time.Duration) {
+	delayMinutes, retryHours, lifetimeDays := 5, 24, 36
+	if GlobalYAMLConfig != nil {
+		if GlobalYAMLConfig.Greylist.DelayMinutes > 0 {
+			delayMinutes = GlobalYAMLConfig.Greylist.DelayMinutes
+		}
+		if GlobalYAMLConfig.Greylist.RetryHours > 0 {
+			retryHours = GlobalYAMLConfig.Greylist.RetryHours
+		}
+		if GlobalYAMLConfig.Greylist.LifetimeDays > 0 {
+			lifetimeDays = GlobalYAMLConfig.Greylist.LifetimeDays
+		}
+	}
+	return time.Duration(delayMinutes) * time.Minute,
+		time.Duration(retryHours) * time.Hour,
+		time.Duration(lifetimeDays) * 24 * time.Hour
+}
+
+// GetGreylistPrefixes 获取灰名单按网段合并客户端IP时的前缀长度，默认IPv4为24、IPv6为64
+func GetGreylistPrefixes() (ipv4, ipv6 int) {
+	ipv4, ipv6 = 24, 64
+	if GlobalYAMLConfig != nil {
+		if bits := GlobalYAMLConfig.Greylist.IPv4PrefixBits; bits > 0 && bits <= 32 {
+			ipv4 = bits
+		}
+		if bits := GlobalYAMLConfig.Greylist.IPv6PrefixBits; bits > 0 && bits <= 128 {
+			ipv6 = bits
+		}
+	}
+	return ipv4, ipv6
+}
+
+// GetForwardLimits 获取转发规则的限制：转发次数（X-Forward-Hops）上限（默认5）、
+// Received头数量上限（默认30），超过时不再转发；每条规则每小时最多转发次数（默认100）
+func GetForwardLimits() (maxHops, maxReceived, ratePerHour int) {
+	maxHops, maxReceived, ratePerHour = 5, 30, 100
+	if GlobalYAMLConfig != nil {
+		if GlobalYAMLConfig.Email.Forward.MaxHops > 0 {
+			maxHops = GlobalYAMLConfig.Email.Forward.MaxHops
+		}
+		if GlobalYAMLConfig.Email.Forward.MaxReceived > 0 {
+			maxReceived = GlobalYAMLConfig.Email.Forward.MaxReceived
+		}
+		if GlobalYAMLConfig.Email.Forward.RateLimitPerHour > 0 {
+			ratePerHour = GlobalYAMLConfig.Email.Forward.RateLimitPerHour
+		}
+	}
+	return maxHops, maxReceived, ratePerHour
+}
+
+// GetSieveLimits 获取Sieve脚本的限制：每个邮箱最多的脚本数（默认10）、
+// 单个脚本的最大字节数（默认64KB）、每封邮件最多执行的redirect数（默认4）
+func GetSieveLimits() (maxScripts int, maxScriptSize int64, maxRedirects int) {
+	maxScripts, maxScriptKB, maxRedirects := 10, 64, 4
+	if GlobalYAMLConfig != nil {
+		if GlobalYAMLConfig.Sieve.MaxScripts > 0 {
+			maxScripts = GlobalYAMLConfig.Sieve.MaxScripts
+		}
+		if GlobalYAMLConfig.Sieve.MaxScriptSize > 0 {
+			maxScriptKB = GlobalYAMLConfig.Sieve.MaxScriptSize
+		}
+		if GlobalYAMLConfig.Sieve.MaxRedirects > 0 {
+			maxRedirects = GlobalYAMLConfig.Sieve.MaxRedirects
+		}
+	}
+	return maxScripts, int64(maxScriptKB) * 1024, maxRedirects
+}
+
+// GetSRSSecret 获取SRS地址哈希的密钥，未配置时使用数据库目录下的 srs_secret.key（首次启动时随机生成）
+// 配置为默认密钥时返回错误，此时不使用SRS
+func GetSRSSecret() (string, error) {
+	configured := ""
+	if GlobalYAMLConfig != nil {
+		configured = GlobalYAMLConfig.SRS.Secret
+	}
+	return configuredSecret("srs.secret", configured, "SRS_SECRET", "srs_secret.key")
+}
+
+// GetSRSMaxAgeDays 获取SRS地址的有效天数，默认21天
+func GetSRSMaxAgeDays() int {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.SRS.MaxAgeDays > 0 {
+		return GlobalYAMLConfig.SRS.MaxAgeDays
+	}
+	return 21
+}
+
+// GetDKIMKeySecret 获取加密数据库中DKIM私钥的密钥，未配置时使用数据库目录下的 dkim_key_secret.key（首次启动时随机生成）
+// 配置为默认密钥时返回错误，此时不能生成或导入密钥
+func GetDKIMKeySecret() (string, error) {
+	configured := ""
+	if GlobalYAMLConfig != nil {
+		configured = GlobalYAMLConfig.Security.DKIMKeySecret
+	}
+	return configuredSecret("security.dkim_key_secret", configured, "DKIM_KEY_SECRET", "dkim_key_secret.key")
+}
+
+// IsPlaintextAuthDisabled 是否禁止在未加密的连接上认证（IMAP返回LOGINDISABLED，POP3拒绝USER/PASS）
+func IsPlaintextAuthDisabled() bool {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Security.DisablePlaintextAuth
+	}
+	return getEnvBool("DISABLE_PLAINTEXT_AUTH", false)
+}
+
+// GetTLSCertFiles 获取默认TLS证书和私钥文件路径
+func GetTLSCertFiles() (certFile, keyFile string) {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Security.SSLCert, GlobalYAMLConfig.Security.SSLKey
+	}
+	return getEnv("SSL_CERT", ""), getEnv("SSL_KEY", "")
+}
+
+// GetCertDir 获取按域名存放证书的目录（<目录>/<域名>/fullchain.pem 和 privkey.pem）
+func GetCertDir() string {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Security.CertDir != "" {
+		return GlobalYAMLConfig.Security.CertDir
+	}
+	return getEnv("CERT_DIR", "./certs")
+}
+
+// IsHTTPSEnabled Web服务是否使用HTTPS
+func IsHTTPSEnabled() bool {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Security.EnableHTTPS
+	}
+	return getEnvBool("ENABLE_HTTPS", false)
+}
+
+// IsACMEEnabled 是否启用ACME自动申请证书
+func IsACMEEnabled() bool {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Security.ACME.Enabled
+	}
+	return getEnvBool("ACME_ENABLED", false)
+}
+
+// GetACMEDirectoryURL 获取ACME目录地址（默认Let's Encrypt正式环境）
+func GetACMEDirectoryURL() string {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Security.ACME.DirectoryURL != "" {
+		return GlobalYAMLConfig.Security.ACME.DirectoryURL
+	}
+	return getEnv("ACME_DIRECTORY_URL", "https://acme-v02.api.letsencrypt.org/directory")
+}
+
+// GetACMEEmail 获取ACME账户联系邮箱
+func GetACMEEmail() string {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Security.ACME.Email
+	}
+	return getEnv("ACME_EMAIL", "")
+}
+
+// GetACMECAFile 获取访问ACME目录时额外信任的CA证书文件（用于Pebble等测试环境）
+func GetACMECAFile() string {
+	if GlobalYAMLConfig != nil {
+		return GlobalYAMLConfig.Security.ACME.CAFile
+	}
+	return getEnv("ACME_CA_FILE", "")
+}
+
+// GetACMERenewBefore 获取证书到期前多久开始续期
+func GetACMERenewBefore() time.Duration {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Security.ACME.RenewBeforeDays > 0 {
+		return time.Duration(GlobalYAMLConfig.Security.ACME.RenewBeforeDays) * 24 * time.Hour
+	}
+	return 30 * 24 * time.Hour
+}
+
+// GetACMEHTTPPort 获取为HTTP-01验证额外监听的HTTP端口（空表示不额外监听）
+func GetACMEHTTPPort() string {
+	if GlobalYAMLConfig != nil {
+		if GlobalYAMLConfig.Security.ACME.HTTPPort > 0 {
+			return strconv.Itoa(GlobalYAMLConfig.Security.ACME.HTTPPort)
+		}
+		return ""
+	}
+	return getEnv("ACME_HTTP_PORT", "")
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 配置示例中公开的密钥，不能用于SRS和DKIM私钥加密
+var defaultSecrets = []string{
+	"miko-email-secret-key-change-in-production",
+	"miko-email-jwt-secret-key",
+}
+
+var (
+	secretMu    sync.Mutex
+	secretCache = make(map[string]string)
+)
+
+// IsDefaultSecret 检查密钥是否为空或配置示例中的默认值
+func IsDefaultSecret(secret string) bool {
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return true
+	}
+	for _, s := range defaultSecrets {
+		if secret == s {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredSecret 返回配置的密钥，未配置时读取（首次启动时生成）数据库目录下的密钥文件
+func configuredSecret(name, configured, envKey, fileName string) (string, error) {
+	if configured == "" {
+		configured = getEnv(envKey, "")
+	}
+	if configured != "" {
+		if IsDefaultSecret(configured) {
+			return "", fmt.Errorf("%s 不能使用默认密钥", name)
+		}
+		return configured, nil
+	}
+	return loadOrCreateSecret(filepath.Join(filepath.Dir(getDatabasePath()), fileName))
+}
+
+// loadOrCreateSecret 读取密钥文件，文件不存在时生成32字节随机密钥并保存（仅所有者可读写）
+func loadOrCreateSecret(path string) (string, error) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+
+	if secret, ok := secretCache[path]; ok {
+		return secret, nil
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		secret := strings.TrimSpace(string(data))
+		if IsDefaultSecret(secret) {
+			return "", fmt.Errorf("密钥文件 %s 为空或使用默认密钥", path)
+		}
+		secretCache[path] = secret
+		return secret, nil
+	case !os.IsNotExist(err):
+		return "", fmt.Errorf("读取密钥文件 %s 失败: %v", path, err)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成密钥失败: %v", err)
+	}
+	secret := hex.EncodeToString(buf)
+	// O_EXCL 避免覆盖同时生成的密钥文件
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("保存密钥文件 %s 失败: %v", path, err)
+	}
+	if _, err := f.WriteString(secret + "\n"); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("保存密钥文件 %s 失败: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("保存密钥文件 %s 失败: %v", path, err)
+	}
+	secretCache[path] = secret
+	return secret, nil
+}
+
+// getDatabasePath 获取数据库文件路径
+func getDatabasePath() string {
+	if GlobalYAMLConfig != nil && GlobalYAMLConfig.Database.Path != "" {
+		return GlobalYAMLConfig.Database.Path
+	}
+	return getEnv("DATABASE_PATH", "./miko_email.db")
+}
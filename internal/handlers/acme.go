@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"miko-email/internal/config"
+	"miko-email/internal/result"
+	"miko-email/internal/svc"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ACMEHandler struct {
+	svcCtx *svc.ServiceContext
+}
+
+func NewACMEHandler(svcCtx *svc.ServiceContext) *ACMEHandler {
+	return &ACMEHandler{
+		svcCtx: svcCtx,
+	}
+}
+
+// HTTPChallenge 响应ACME的HTTP-01验证请求
+func (h *ACMEHandler) HTTPChallenge(c *gin.Context) {
+	keyAuth, ok := h.svcCtx.ACME.HTTPChallengeResponse(c.Param("token"))
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Content-Type", "text/plain")
+	c.String(http.StatusOK, keyAuth)
+}
+
+// GetCertificates 获取ACME证书状态列表
+func (h *ACMEHandler) GetCertificates(c *gin.Context) {
+	certs, err := h.svcCtx.AcmeModel.ListCertificates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取证书列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("", gin.H{
+		"enabled":       config.IsACMEEnabled(),
+		"directory_url": config.GetACMEDirectoryURL(),
+		"certificates":  certs,
+	}))
+}
+
+// RequestCertificate 立即为域名申请（或续期）证书
+func (h *ACMEHandler) RequestCertificate(c *gin.Context) {
+	domainID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("域名ID格式错误"))
+		return
+	}
+
+	if !config.IsACMEEnabled() {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("未启用ACME自动证书"))
+		return
+	}
+
+	domain, err := h.svcCtx.DomainModel.GetById(domainID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, result.ErrorSimpleResult("域名不存在"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取域名失败"))
+		return
+	}
+	if !domain.IsActive {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("域名未激活"))
+		return
+	}
+
+	h.svcCtx.ACME.Request(domain.Name)
+	c.JSON(http.StatusOK, result.SimpleResult("已开始申请证书: "+svc.ACMEHostname(domain.Name)))
+}
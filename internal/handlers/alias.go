@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"miko-email/internal/result"
+	"miko-email/internal/services/mailbox"
+	"miko-email/internal/svc"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AliasHandler struct {
+	mailboxService *mailbox.Service
+	svcCtx         *svc.ServiceContext
+}
+
+func NewAliasHandler(mailboxService *mailbox.Service, svcCtx *svc.ServiceContext) *AliasHandler {
+	return &AliasHandler{
+		mailboxService: mailboxService,
+		svcCtx:         svcCtx,
+	}
+}
+
+type CreateAliasRequest struct {
+	Prefix    string   `json:"prefix" binding:"required"`
+	DomainID  int64    `json:"domain_id" binding:"required"`
+	Type      string   `json:"type" binding:"required"` // alias/group
+	MailboxID int64    `json:"mailbox_id"`              // 别名投递的邮箱ID
+	Members   []string `json:"members"`                 // 群组成员
+}
+
+type UpdateAliasRequest struct {
+	MailboxID int64    `json:"mailbox_id"`
+	Members   []string `json:"members"`
+}
+
+type UpdateAliasStatusRequest struct {
+	Status string `json:"status" binding:"required"` // active/suspended
+}
+
+// GetAliases 获取当前用户的别名和群组
+func (h *AliasHandler) GetAliases(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	isAdmin := c.GetBool("is_admin")
+
+	aliases, err := h.mailboxService.GetAliases(userID, isAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取别名列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SuccessResult(aliases))
+}
+
+// CreateAlias 创建别名或群组
+func (h *AliasHandler) CreateAlias(c *gin.Context) {
+	var req CreateAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("请求参数错误"))
+		return
+	}
+
+	if !isValidEmailPrefix(req.Prefix) {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("别名前缀格式不正确"))
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	isAdmin := c.GetBool("is_admin")
+
+	alias, err := h.mailboxService.CreateAlias(userID, isAdmin, req.Prefix, req.DomainID, &mailbox.AliasRequest{
+		Type:      req.Type,
+		MailboxID: req.MailboxID,
+		Members:   req.Members,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("别名创建成功", alias))
+}
+
+// UpdateAlias 修改别名投递的邮箱或群组成员
+func (h *AliasHandler) UpdateAlias(c *gin.Context) {
+	aliasID, ok := h.parseAliasId(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("请求参数错误"))
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	isAdmin := c.GetBool("is_admin")
+
+	alias, err := h.mailboxService.UpdateAlias(aliasID, userID, isAdmin, &mailbox.AliasRequest{
+		MailboxID: req.MailboxID,
+		Members:   req.Members,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("别名更新成功", alias))
+}
+
+// DeleteAlias 删除别名或群组
+func (h *AliasHandler) DeleteAlias(c *gin.Context) {
+	aliasID, ok := h.parseAliasId(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	isAdmin := c.GetBool("is_admin")
+
+	if err := h.mailboxService.DeleteAlias(aliasID, userID, isAdmin); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("别名删除成功"))
+}
+
+// 管理员别名管理接口
+
+// GetAllAliases 获取所有别名和群组（管理员）
+func (h *AliasHandler) GetAllAliases(c *gin.Context) {
+	aliases, err := h.mailboxService.GetAllAliases()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取别名列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SuccessResult(aliases))
+}
+
+// UpdateAliasStatus 启用或停用别名（管理员）
+func (h *AliasHandler) UpdateAliasStatus(c *gin.Context) {
+	aliasID, ok := h.parseAliasId(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateAliasStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("请求参数错误"))
+		return
+	}
+	if req.Status != "active" && req.Status != "suspended" {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("状态值无效"))
+		return
+	}
+
+	if err := h.mailboxService.UpdateAliasStatus(aliasID, req.Status == "active"); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("别名状态更新成功"))
+}
+
+// DeleteAliasAdmin 删除别名或群组（管理员）
+func (h *AliasHandler) DeleteAliasAdmin(c *gin.Context) {
+	aliasID, ok := h.parseAliasId(c)
+	if !ok {
+		return
+	}
+
+	if err := h.mailboxService.DeleteAliasAdmin(aliasID); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("别名删除成功"))
+}
+
+func (h *AliasHandler) parseAliasId(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("别名ID格式错误"))
+		return 0, false
+	}
+	return id, true
+}
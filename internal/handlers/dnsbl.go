@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"miko-email/internal/config"
+	"miko-email/internal/result"
+	"miko-email/internal/svc"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DNSBLHandler struct {
+	svcCtx *svc.ServiceContext
+}
+
+func NewDNSBLHandler(svcCtx *svc.ServiceContext) *DNSBLHandler {
+	return &DNSBLHandler{
+		svcCtx: svcCtx,
+	}
+}
+
+// GetDNSBL 获取DNS黑名单配置和缓存的查询结果
+// all: 为 true 时返回所有缓存结果，否则只返回已列入黑名单的
+func (h *DNSBLHandler) GetDNSBL(c *gin.Context) {
+	entries := h.svcCtx.DNSBL.Entries(c.Query("all") != "true")
+
+	var listed, rejected int64
+	for _, entry := range entries {
+		if entry.Listed {
+			listed++
+		}
+		rejected += entry.Rejected
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("获取成功", gin.H{
+		"zones":         config.GetDNSBLZones(),
+		"cache_minutes": int(config.GetDNSBLCacheTTL().Minutes()),
+		"resolver":      config.GetDNSBLResolver(),
+		"listed":        listed,
+		"rejected":      rejected,
+		"list":          entries,
+	}))
+}
+
+type CheckDNSBLRequest struct {
+	Target string `json:"target" binding:"required"`
+}
+
+// CheckDNSBL 查询IP或域名是否在已配置的黑名单中
+func (h *DNSBLHandler) CheckDNSBL(c *gin.Context) {
+	var req CheckDNSBLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorReqParam)
+		return
+	}
+
+	target := strings.TrimSpace(req.Target)
+	var listings []svc.DNSBLListing
+	if ip := net.ParseIP(target); ip != nil {
+		listings = h.svcCtx.DNSBL.CheckIP(ip)
+	} else {
+		listings = h.svcCtx.DNSBL.CheckDomain(target)
+	}
+	if listings == nil {
+		listings = []svc.DNSBLListing{}
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("查询完成", gin.H{
+		"target":   target,
+		"listed":   len(listings) > 0,
+		"listings": listings,
+	}))
+}
@@ -1,16 +1,22 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"miko-email/internal/config"
 	"miko-email/internal/model"
 	"miko-email/internal/result"
 	"miko-email/internal/services/dkim"
 	"miko-email/internal/services/domain"
+	"miko-email/internal/services/spam"
 	"miko-email/internal/svc"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
+	"gorm.io/gorm"
 )
 
 type DomainHandler struct {
@@ -97,6 +103,9 @@ func (h *DomainHandler) CreateDomain(c *gin.Context) {
 		return
 	}
 
+	// 启用ACME时在后台为 mail.<域名> 申请证书
+	h.svcCtx.ACME.Request(domain.Name)
+
 	c.JSON(http.StatusOK, result.DataResult("域名创建成功", domain))
 }
 
@@ -131,6 +140,304 @@ func (h *DomainHandler) UpdateDomain(c *gin.Context) {
 	c.JSON(http.StatusOK, result.SimpleResult("域名更新成功"))
 }
 
+type UpdateDKIMHeadersRequest struct {
+	Headers []string `json:"headers"`
+}
+
+// UpdateDKIMHeaders 更新域名DKIM签名的邮件头
+func (h *DomainHandler) UpdateDKIMHeaders(c *gin.Context) {
+	domainID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("域名ID格式错误"))
+		return
+	}
+
+	var req UpdateDKIMHeadersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorReqParam)
+		return
+	}
+
+	domain, err := h.domainService.UpdateDKIMHeaders(domainID, req.Headers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("DKIM设置已更新", domain))
+}
+
+type UpdateSpamSettingsRequest struct {
+	JunkThreshold   float64            `json:"junk_threshold"`
+	RejectThreshold float64            `json:"reject_threshold"`
+	Weights         map[string]float64 `json:"weights"`
+}
+
+// UpdateSpamSettings 更新域名的垃圾邮件阈值和规则分数
+func (h *DomainHandler) UpdateSpamSettings(c *gin.Context) {
+	domainID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("域名ID格式错误"))
+		return
+	}
+
+	var req UpdateSpamSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorReqParam)
+		return
+	}
+
+	domain, err := h.domainService.UpdateSpamSettings(domainID, &spam.Settings{
+		JunkThreshold:   req.JunkThreshold,
+		RejectThreshold: req.RejectThreshold,
+		Weights:         req.Weights,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("垃圾邮件设置已更新", domain))
+}
+
+type UpdateCatchAllRequest struct {
+	Mailbox string `json:"mailbox"`
+}
+
+// UpdateCatchAll 设置域名的 catch-all 邮箱
+func (h *DomainHandler) UpdateCatchAll(c *gin.Context) {
+	domainID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("域名ID格式错误"))
+		return
+	}
+
+	var req UpdateCatchAllRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorReqParam)
+		return
+	}
+
+	domain, err := h.domainService.UpdateCatchAll(domainID, req.Mailbox)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("catch-all设置已更新", domain))
+}
+
+type UpdateGreylistRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// UpdateGreylist 设置域名是否启用灰名单
+func (h *DomainHandler) UpdateGreylist(c *gin.Context) {
+	domainID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("域名ID格式错误"))
+		return
+	}
+
+	var req UpdateGreylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorReqParam)
+		return
+	}
+
+	domain, err := h.domainService.UpdateGreylist(domainID, req.Enabled)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("灰名单设置已更新", domain))
+}
+
+type UpdateSRSRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// UpdateSRS 设置域名转发外部邮件时是否使用SRS改写信封发件人
+func (h *DomainHandler) UpdateSRS(c *gin.Context) {
+	domainID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("域名ID格式错误"))
+		return
+	}
+
+	var req UpdateSRSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorReqParam)
+		return
+	}
+
+	domain, err := h.domainService.UpdateSRS(domainID, req.Enabled)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("SRS设置已更新", domain))
+}
+
+// GetSpamRules 获取垃圾邮件规则及全局配置的分数和阈值
+func (h *DomainHandler) GetSpamRules(c *gin.Context) {
+	globalWeights := config.GetSpamWeights()
+	rules := make([]gin.H, 0, len(spam.DefaultWeights))
+	for _, name := range spam.RuleNames() {
+		weight, ok := globalWeights[name]
+		if !ok {
+			weight = spam.DefaultWeights[name]
+		}
+		rules = append(rules, gin.H{
+			"name":           name,
+			"default_weight": spam.DefaultWeights[name],
+			"weight":         weight,
+		})
+	}
+
+	junk, reject := config.GetSpamThresholds()
+	c.JSON(http.StatusOK, result.DataResult("获取成功", gin.H{
+		"enabled":          config.IsSpamFilterEnabled(),
+		"junk_threshold":   junk,
+		"reject_threshold": reject,
+		"rules":            rules,
+	}))
+}
+
+// GetDKIMKeys 获取域名的所有DKIM密钥（包括已停用的）
+func (h *DomainHandler) GetDKIMKeys(c *gin.Context) {
+	domain, ok := h.getDomainParam(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.dkimService.Keys(domain)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取DKIM密钥失败: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("", keys))
+}
+
+type CreateDKIMKeyRequest struct {
+	Algorithm  string     `json:"algorithm"`   // rsa/ed25519，默认rsa
+	Selector   string     `json:"selector"`    // 为空时自动生成
+	ActivateAt *time.Time `json:"activate_at"` // 开始签名的时间，为空时立即生效
+}
+
+// CreateDKIMKey 为域名生成新的DKIM密钥
+func (h *DomainHandler) CreateDKIMKey(c *gin.Context) {
+	domain, ok := h.getDomainParam(c)
+	if !ok {
+		return
+	}
+
+	var req CreateDKIMKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorReqParam)
+		return
+	}
+
+	activateAt := time.Now()
+	if req.ActivateAt != nil {
+		activateAt = *req.ActivateAt
+	}
+
+	key, err := h.dkimService.GenerateKey(domain, req.Algorithm, req.Selector, activateAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("DKIM密钥已生成，请先发布DNS记录", key))
+}
+
+type ActivateDKIMKeyRequest struct {
+	ActivateAt *time.Time `json:"activate_at"` // 为空时立即生效
+}
+
+// ActivateDKIMKey 设置DKIM密钥开始签名的时间
+func (h *DomainHandler) ActivateDKIMKey(c *gin.Context) {
+	domain, ok := h.getDomainParam(c)
+	if !ok {
+		return
+	}
+	keyID, err := strconv.ParseInt(c.Param("kid"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("密钥ID格式错误"))
+		return
+	}
+
+	var req ActivateDKIMKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, result.ErrorReqParam)
+		return
+	}
+
+	activateAt := time.Now()
+	if req.ActivateAt != nil {
+		activateAt = *req.ActivateAt
+	}
+
+	key, err := h.dkimService.ActivateKey(domain, keyID, activateAt)
+	if err != nil {
+		h.dkimKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("DKIM密钥启用时间已更新", key))
+}
+
+// RetireDKIMKey 停用DKIM密钥
+func (h *DomainHandler) RetireDKIMKey(c *gin.Context) {
+	domain, ok := h.getDomainParam(c)
+	if !ok {
+		return
+	}
+	keyID, err := strconv.ParseInt(c.Param("kid"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("密钥ID格式错误"))
+		return
+	}
+
+	if err := h.dkimService.RetireKey(domain, keyID); err != nil {
+		h.dkimKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("DKIM密钥已停用，可以删除对应的DNS记录"))
+}
+
+func (h *DomainHandler) getDomainParam(c *gin.Context) (*model.Domain, bool) {
+	domainID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("域名ID格式错误"))
+		return nil, false
+	}
+
+	domain, err := h.svcCtx.DomainModel.GetById(domainID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, result.ErrorSimpleResult("域名不存在"))
+		} else {
+			c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取域名失败"))
+		}
+		return nil, false
+	}
+	return domain, true
+}
+
+func (h *DomainHandler) dkimKeyError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, result.ErrorSimpleResult("DKIM密钥不存在"))
+		return
+	}
+	c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+}
+
 // VerifySenderConfiguration 验证发件配置
 func (h *DomainHandler) VerifySenderConfiguration(c *gin.Context) {
 	domainIDStr := c.Param("id")
@@ -236,7 +543,8 @@ func (h *DomainHandler) GetDomainDNSRecords(c *gin.Context) {
 	c.JSON(http.StatusOK, result.DataResult("", data))
 }
 
-// GetDKIMRecord 获取域名的DKIM记录
+// GetDKIMRecord 获取域名需要发布的所有DKIM记录
+// records 包含所有未停用的选择器（轮换期间新旧选择器都需要发布），selector/record 等字段为当前签名的RSA密钥
 func (h *DomainHandler) GetDKIMRecord(c *gin.Context) {
 	domainName := c.Query("domain")
 	if domainName == "" {
@@ -244,28 +552,33 @@ func (h *DomainHandler) GetDKIMRecord(c *gin.Context) {
 		return
 	}
 
-	// 生成或获取DKIM记录
-	dkimRecord, err := h.dkimService.GenerateDKIMRecord(domainName)
+	domain, err := h.svcCtx.DomainModel.GetByName(domainName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "生成DKIM记录失败: " + err.Error()})
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "域名不存在"})
 		return
 	}
 
-	// 获取公钥
-	publicKey, err := h.dkimService.GetPublicKey(domainName)
+	records, err := h.dkimService.Records(domain)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "获取公钥失败: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "生成DKIM记录失败: " + err.Error()})
 		return
 	}
 
+	data := gin.H{
+		"domain":  domainName,
+		"records": records,
+	}
+	for _, record := range records {
+		if record.Algorithm == model.DkimAlgorithmRSA && (record.Signing || data["selector"] == nil) {
+			data["selector"] = record.Selector
+			data["dkim_domain"] = record.Name
+			data["record"] = record.Value
+			data["public_key"] = record.PublicKey
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data": gin.H{
-			"domain":      domainName,
-			"selector":    h.dkimService.GetDKIMSelector(),
-			"dkim_domain": h.dkimService.GetDKIMDomain(domainName),
-			"record":      dkimRecord,
-			"public_key":  publicKey,
-		},
+		"data":    data,
 	})
 }
@@ -135,8 +135,8 @@ func (h *EmailHandler) SendEmail(c *gin.Context) {
 		return
 	}
 
-	// 验证发件邮箱是否属于当前用户
-	fromMailbox, err := h.mailboxService.GetMailboxByEmail(req.From)
+	// 验证发件邮箱是否属于当前用户（可以使用邮箱的别名发件）
+	fromMailbox, err := h.mailboxService.GetSenderMailbox(req.From)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("发件邮箱不存在"))
 		return
@@ -161,51 +161,46 @@ func (h *EmailHandler) SendEmail(c *gin.Context) {
 		recipients[i] = strings.TrimSpace(recipient)
 	}
 
-	// 发送邮件到每个收件人
-	var successfulSends []string // 记录成功发送的收件人
-
+	// 过滤无效的收件人
+	var validRecipients []string
 	for _, recipient := range recipients {
 		if recipient == "" {
 			continue
 		}
 
-		// 所有邮件都通过SMTP服务器发送，确保一致的处理流程
-		var sendErr error
-
-		// 检查收件人邮箱是否存在于系统中
-		_, err := h.mailboxService.GetMailboxByEmail(recipient)
-		if err != nil {
+		// 检查收件人邮箱（包括别名和群组）是否存在于系统中
+		if !h.mailboxService.IsLocalAddress(recipient) {
 			// 收件人不在系统中，检查是否为有效的外部邮箱
 			if !h.smtpClient.IsExternalEmail(recipient) {
 				// 不是有效的外部邮箱，跳过
 				continue
 			}
 		}
+		validRecipients = append(validRecipients, recipient)
+	}
 
-		// 统一通过MX发送邮件（无论是内部还是外部邮件）
-		if len(attachments) > 0 {
-			// 构建MIME邮件内容
-			mimeContent := h.buildMIMEMessage(req.From, recipient, req.Subject, req.Content, attachments)
-			sendErr = h.smtpClient.SendMIMEEmail(req.From, recipient, mimeContent)
-		} else {
-			sendErr = h.smtpClient.SendEmail(req.From, recipient, req.Subject, req.Content)
-		}
-
-		// 记录发送尝试
-		h.smtpClient.LogSendAttempt(req.From, recipient, req.Subject, sendErr)
+	if len(validRecipients) == 0 {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("没有有效的收件人"))
+		return
+	}
 
-		if sendErr == nil {
-			// 发送成功，记录成功的收件人
-			successfulSends = append(successfulSends, recipient)
-		} else {
-			// 发送失败，继续处理下一个收件人
-			log.Printf("邮件发送失败 %s -> %s: %v", req.From, recipient, sendErr)
-			continue
-		}
+	// 加入出站队列，由后台协程统一通过SMTP投递（无论是内部还是外部邮件），失败时自动重试或退信
+	var queued *model.OutboundMessage
+	if len(attachments) > 0 {
+		// 构建MIME邮件内容
+		mimeContent := h.buildMIMEMessage(req.From, strings.Join(validRecipients, ", "), req.Subject, req.Content, attachments)
+		queued, err = h.smtpClient.QueueMIMEEmail(req.From, validRecipients, []byte(mimeContent))
+	} else {
+		queued, err = h.smtpClient.QueueEmail(req.From, validRecipients, req.Subject, req.Content)
+	}
+	if err != nil {
+		log.Printf("邮件加入发送队列失败 %s: %v", req.From, err)
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("邮件加入发送队列失败: "+err.Error()))
+		return
 	}
 
-	// 只有在有成功发送的邮件时，才保存到发件人的已发送文件夹
-	for _, recipient := range successfulSends {
+	// 保存到发件人的已发送文件夹
+	for _, recipient := range validRecipients {
 		err := h.emailService.SaveEmailToSent(fromMailbox.Id, req.From, recipient, req.Subject, req.Content)
 		if err != nil {
 			// 保存到已发送失败，记录日志但不影响主要功能
@@ -213,14 +208,11 @@ func (h *EmailHandler) SendEmail(c *gin.Context) {
 		}
 	}
 
-	// 根据发送结果返回相应消息
-	if len(successfulSends) == 0 {
-		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("没有邮件发送成功"))
-	} else if len(successfulSends) == len(recipients) {
-		c.JSON(http.StatusOK, result.SimpleResult("所有邮件发送成功"))
-	} else {
-		c.JSON(http.StatusOK, result.SimpleResult(fmt.Sprintf("部分邮件发送成功 (%d/%d)", len(successfulSends), len(recipients))))
-	}
+	c.JSON(http.StatusOK, result.DataResult("邮件已加入发送队列", gin.H{
+		"id":         queued.Id,
+		"message_id": queued.MessageId,
+		"recipients": validRecipients,
+	}))
 }
 
 // GetEmails 获取邮件列表
@@ -239,6 +231,7 @@ func (h *EmailHandler) GetEmails(c *gin.Context) {
 	// 获取查询参数
 	mailboxEmail := c.Query("mailbox")
 	emailType := c.DefaultQuery("type", "inbox") // inbox, sent, trash
+	tag := c.Query("tag")                        // 可选：子地址标签过滤
 	pageStr := c.DefaultQuery("page", "1")
 	limitStr := c.DefaultQuery("limit", "20")
 
@@ -256,11 +249,16 @@ func (h *EmailHandler) GetEmails(c *gin.Context) {
 	var err error
 
 	if mailboxEmail != "" {
-		targetMailbox, err = h.mailboxService.GetMailboxByEmail(mailboxEmail)
+		// 指定子地址（user+tag@domain）时只返回该标签的邮件
+		var addressTag string
+		targetMailbox, addressTag, err = h.mailboxService.GetMailboxBySubaddress(mailboxEmail)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("邮箱不存在"))
 			return
 		}
+		if tag == "" {
+			tag = addressTag
+		}
 	} else {
 		// 获取用户的邮箱列表
 		mailboxes, err := h.mailboxService.GetUserMailboxesRaw(userID, isAdmin)
@@ -285,7 +283,7 @@ func (h *EmailHandler) GetEmails(c *gin.Context) {
 	}
 
 	// 获取邮件列表
-	emails, total, err := h.emailService.GetEmails(targetMailbox.Id, emailType, page, limit)
+	emails, total, err := h.emailService.GetEmails(targetMailbox.Id, emailType, tag, page, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取邮件失败"))
 		return
@@ -353,6 +351,207 @@ func (h *EmailHandler) GetEmailByID(c *gin.Context) {
 	c.JSON(http.StatusOK, result.DataResult("获取邮件详情成功", email))
 }
 
+// ExportEmail 导出邮件原文（.eml）
+func (h *EmailHandler) ExportEmail(c *gin.Context) {
+	targetMailbox, ok := h.checkMailboxOwnership(c)
+	if !ok {
+		return
+	}
+
+	emailID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("邮件ID无效"))
+		return
+	}
+
+	email, err := h.emailService.GetEmailByID(int64(emailID), targetMailbox.Id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, result.ErrorSimpleResult("邮件不存在"))
+		return
+	}
+
+	raw, err := h.emailService.GetRawMessage(email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取邮件原文失败"))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"email-%d.eml\"", email.Id))
+	c.Data(http.StatusOK, "message/rfc822", raw)
+}
+
+type MarkSpamRequest struct {
+	Spam bool `json:"spam"`
+}
+
+// MarkSpam 标记邮件为垃圾邮件或非垃圾邮件（同时训练贝叶斯分类器）
+func (h *EmailHandler) MarkSpam(c *gin.Context) {
+	targetMailbox, ok := h.checkMailboxOwnership(c)
+	if !ok {
+		return
+	}
+
+	emailID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("邮件ID无效"))
+		return
+	}
+
+	var req MarkSpamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorReqParam)
+		return
+	}
+
+	email, err := h.emailService.GetEmailByID(int64(emailID), targetMailbox.Id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, result.ErrorSimpleResult("邮件不存在"))
+		return
+	}
+
+	if err := h.emailService.MarkSpam(email, req.Spam); err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("标记邮件失败"))
+		return
+	}
+
+	if req.Spam {
+		c.JSON(http.StatusOK, result.SimpleResult("已标记为垃圾邮件"))
+	} else {
+		c.JSON(http.StatusOK, result.SimpleResult("已标记为非垃圾邮件"))
+	}
+}
+
+// GetEmailAttachments 获取邮件附件列表
+func (h *EmailHandler) GetEmailAttachments(c *gin.Context) {
+	targetMailbox, ok := h.checkMailboxOwnership(c)
+	if !ok {
+		return
+	}
+
+	emailID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("邮件ID无效"))
+		return
+	}
+
+	if _, err := h.emailService.GetEmailByID(int64(emailID), targetMailbox.Id); err != nil {
+		c.JSON(http.StatusNotFound, result.ErrorSimpleResult("邮件不存在"))
+		return
+	}
+
+	attachments, err := h.emailService.GetAttachments(int64(emailID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取附件列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SuccessResult(attachments))
+}
+
+// DownloadEmailAttachment 下载邮件附件
+func (h *EmailHandler) DownloadEmailAttachment(c *gin.Context) {
+	targetMailbox, ok := h.checkMailboxOwnership(c)
+	if !ok {
+		return
+	}
+
+	emailID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("邮件ID无效"))
+		return
+	}
+
+	attachmentID, err := strconv.ParseInt(c.Param("aid"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("附件ID无效"))
+		return
+	}
+
+	if _, err := h.emailService.GetEmailByID(int64(emailID), targetMailbox.Id); err != nil {
+		c.JSON(http.StatusNotFound, result.ErrorSimpleResult("邮件不存在"))
+		return
+	}
+
+	attachment, content, err := h.emailService.GetAttachment(int64(emailID), attachmentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, result.ErrorSimpleResult("附件不存在"))
+		return
+	}
+
+	// 类型和展示方式由发件人决定，除安全的图片外一律作为下载，避免在本站点执行邮件中的脚本
+	contentType, dispositionType := attachmentResponseType(attachment.ContentType)
+
+	// 文件名使用RFC 2231编码，兼容中文文件名
+	disposition := mime.FormatMediaType(dispositionType, map[string]string{"filename": attachment.Filename})
+	if disposition == "" {
+		disposition = dispositionType
+	}
+	c.Header("Content-Disposition", disposition)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+	// API中间件默认设置了JSON类型，这里覆盖
+	c.Header("Content-Type", contentType)
+	c.Data(http.StatusOK, contentType, content)
+}
+
+// inlineAttachmentTypes 可以在浏览器中直接显示的附件类型（不含SVG等可执行脚本的类型）
+var inlineAttachmentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// attachmentResponseType 返回下载附件时使用的Content-Type和Content-Disposition类型
+func attachmentResponseType(contentType string) (string, string) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "application/octet-stream", "attachment"
+	}
+	if inlineAttachmentTypes[mediaType] {
+		return mediaType, "inline"
+	}
+	return mediaType, "attachment"
+}
+
+// checkMailboxOwnership 根据 mailbox 查询参数获取邮箱并检查所有权（与 GetEmailByID 一致）
+// 校验失败时直接写入响应并返回 false
+func (h *EmailHandler) checkMailboxOwnership(c *gin.Context) (*model.Mailbox, bool) {
+	userID := c.GetInt64("user_id")
+	isAdmin := c.GetBool("is_admin")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, result.ErrorSimpleResult("未登录"))
+		return nil, false
+	}
+
+	mailboxEmail := c.Query("mailbox")
+	if mailboxEmail == "" {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("请指定邮箱"))
+		return nil, false
+	}
+
+	targetMailbox, err := h.mailboxService.GetMailboxByEmail(mailboxEmail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("邮箱不存在"))
+		return nil, false
+	}
+
+	if isAdmin {
+		if targetMailbox.AdminId == nil || *targetMailbox.AdminId != userID {
+			c.JSON(http.StatusForbidden, result.ErrorSimpleResult("无权访问此邮箱"))
+			return nil, false
+		}
+	} else {
+		if targetMailbox.UserId == nil || *targetMailbox.UserId != userID {
+			c.JSON(http.StatusForbidden, result.ErrorSimpleResult("无权访问此邮箱"))
+			return nil, false
+		}
+	}
+
+	return targetMailbox, true
+}
+
 // DeleteEmail 删除邮件
 func (h *EmailHandler) DeleteEmail(c *gin.Context) {
 	c.Header("Content-Type", "application/json; charset=utf-8")
@@ -574,6 +773,7 @@ func (h *EmailHandler) TestForwardRule(c *gin.Context) {
 	}
 
 	var req struct {
+		EmailID int64  `json:"email_id"` // 指定时用源邮箱中的这封邮件试运行规则，不发送邮件
 		Subject string `json:"subject"`
 		Content string `json:"content"`
 	}
@@ -583,15 +783,34 @@ func (h *EmailHandler) TestForwardRule(c *gin.Context) {
 	}
 
 	// 获取用户ID
-	userID := c.GetInt("user_id")
+	userID := c.GetInt64("user_id")
 
 	// 获取转发规则详情
-	rule, err := h.forwardService.GetForwardRuleByID(int64(id), int64(userID))
+	rule, err := h.forwardService.GetForwardRuleByID(int64(id), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, result.ErrorSimpleResult("转发规则不存在或无权限访问"))
 		return
 	}
 
+	// 试运行：检查已收到的邮件是否匹配规则，并说明每个条件的结果
+	if req.EmailID > 0 {
+		email, err := h.emailService.GetEmailByID(req.EmailID, rule.MailboxID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, result.ErrorSimpleResult("邮件不存在"))
+			return
+		}
+
+		raw, err := h.emailService.GetRawMessage(email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取邮件原文失败"))
+			return
+		}
+
+		match := rule.Match(forward.NewMatchMessage(raw))
+		c.JSON(http.StatusOK, result.DataResult(match.Explanation, match))
+		return
+	}
+
 	// 检查规则是否启用
 	if !rule.Enabled {
 		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("转发规则已禁用，无法测试"))
@@ -655,6 +874,8 @@ func (h *EmailHandler) buildMIMEMessage(from, to, subject, body string, attachme
 	message.WriteString(fmt.Sprintf("From: %s\r\n", from))
 	message.WriteString(fmt.Sprintf("To: %s\r\n", to))
 	message.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	message.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	message.WriteString(fmt.Sprintf("Message-ID: <%d.%s>\r\n", time.Now().UnixNano(), from))
 	message.WriteString("MIME-Version: 1.0\r\n")
 	message.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", boundary))
 	message.WriteString("\r\n")
@@ -712,6 +933,7 @@ func (h *EmailHandler) GetVerificationCode(c *gin.Context) {
 	mailbox := c.Query("mailbox")
 	sender := c.Query("sender")               // 可选：指定发件人过滤
 	subject := c.Query("subject")             // 可选：指定主题关键词过滤
+	tag := c.Query("tag")                     // 可选：指定子地址标签过滤
 	emailIDStr := c.Query("email_id")         // 可选：指定特定邮件ID
 	limitStr := c.DefaultQuery("limit", "10") // 默认查询最近10封邮件
 
@@ -725,12 +947,15 @@ func (h *EmailHandler) GetVerificationCode(c *gin.Context) {
 		return
 	}
 
-	// 验证邮箱是否属于当前用户
-	mailboxInfo, err := h.mailboxService.GetMailboxByEmail(mailbox)
+	// 验证邮箱是否属于当前用户，指定子地址（user+tag@domain）时只查询该标签的邮件
+	mailboxInfo, addressTag, err := h.mailboxService.GetMailboxBySubaddress(mailbox)
 	if err != nil {
 		c.JSON(http.StatusNotFound, result.ErrorSimpleResult("邮箱不存在"))
 		return
 	}
+	if tag == "" {
+		tag = addressTag
+	}
 
 	if mailboxInfo.UserId == nil || *mailboxInfo.UserId != userID {
 		c.JSON(http.StatusForbidden, result.ErrorSimpleResult("无权访问此邮箱"))
@@ -757,7 +982,7 @@ func (h *EmailHandler) GetVerificationCode(c *gin.Context) {
 	} else {
 		// 获取邮件列表
 		var getErr error
-		emails, _, getErr = h.emailService.GetEmails(mailboxInfo.Id, "inbox", 1, limit)
+		emails, _, getErr = h.emailService.GetEmails(mailboxInfo.Id, "inbox", tag, 1, limit)
 		if getErr != nil {
 			c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取邮件失败: "+getErr.Error()))
 			return
@@ -786,6 +1011,7 @@ func (h *EmailHandler) GetVerificationCode(c *gin.Context) {
 				"email_id":   email.Id,
 				"from":       email.FromAddr,
 				"subject":    email.Subject,
+				"tag":        email.Tag,
 				"created_at": email.CreatedAt,
 				"codes":      codes,
 			})
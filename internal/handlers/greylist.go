@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+	"miko-email/internal/result"
+	"miko-email/internal/svc"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// greylistDomainRegex 白名单域名格式
+var greylistDomainRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+type GreylistHandler struct {
+	svcCtx *svc.ServiceContext
+}
+
+func NewGreylistHandler(svcCtx *svc.ServiceContext) *GreylistHandler {
+	return &GreylistHandler{
+		svcCtx: svcCtx,
+	}
+}
+
+// GetGreylist 获取灰名单配置和未过期的记录
+// status: pending 只返回等待重试的，passed 只返回已通过的，为空时返回全部
+func (h *GreylistHandler) GetGreylist(c *gin.Context) {
+	var passed *bool
+	switch status := c.Query("status"); status {
+	case "":
+	case "pending", "passed":
+		value := status == "passed"
+		passed = &value
+	default:
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("无效的状态: "+status))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	items, total, err := h.svcCtx.GreylistModel.List(passed, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取灰名单失败"))
+		return
+	}
+
+	delay, retry, lifetime := config.GetGreylistTimes()
+	ipv4, ipv6 := config.GetGreylistPrefixes()
+	c.JSON(http.StatusOK, result.DataResult("", gin.H{
+		"enabled":       config.IsGreylistEnabled(),
+		"delay_minutes": int(delay.Minutes()),
+		"retry_hours":   int(retry.Hours()),
+		"lifetime_days": int(lifetime.Hours() / 24),
+		"ipv4_prefix":   ipv4,
+		"ipv6_prefix":   ipv6,
+		"list":          items,
+		"page":          page,
+		"pageSize":      pageSize,
+		"total":         total,
+	}))
+}
+
+// DeleteGreylist 删除灰名单记录，下次投递时重新开始等待
+func (h *GreylistHandler) DeleteGreylist(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("记录ID格式错误"))
+		return
+	}
+
+	if err := h.svcCtx.GreylistModel.Delete(nil, id); err != nil {
+		h.greylistError(c, err, "删除失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("删除成功"))
+}
+
+// GetWhitelist 获取灰名单白名单
+func (h *GreylistHandler) GetWhitelist(c *gin.Context) {
+	entries, err := h.svcCtx.GreylistModel.ListWhitelist()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取白名单失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("", entries))
+}
+
+type CreateGreylistWhitelistRequest struct {
+	Type    string `json:"type" binding:"required"`
+	Value   string `json:"value" binding:"required"`
+	Comment string `json:"comment"`
+}
+
+// CreateWhitelist 添加灰名单白名单（IP、CIDR网段或发件人域名）
+func (h *GreylistHandler) CreateWhitelist(c *gin.Context) {
+	var req CreateGreylistWhitelistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorReqParam)
+		return
+	}
+
+	value := strings.ToLower(strings.TrimSpace(req.Value))
+	switch req.Type {
+	case model.GreylistWhitelistIP:
+		if strings.Contains(value, "/") {
+			_, network, err := net.ParseCIDR(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("无效的网段: "+req.Value))
+				return
+			}
+			value = network.String()
+		} else {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("无效的IP地址: "+req.Value))
+				return
+			}
+			value = ip.String()
+		}
+	case model.GreylistWhitelistDomain:
+		value = strings.Trim(value, ".")
+		if !greylistDomainRegex.MatchString(value) {
+			c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("无效的域名: "+req.Value))
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("无效的类型: "+req.Type))
+		return
+	}
+
+	entry := &model.GreylistWhitelist{
+		Type:    req.Type,
+		Value:   value,
+		Comment: strings.TrimSpace(req.Comment),
+	}
+	if err := h.svcCtx.GreylistModel.CreateWhitelist(nil, entry); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("添加失败，白名单可能已存在"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("添加成功", entry))
+}
+
+// DeleteWhitelist 删除灰名单白名单
+func (h *GreylistHandler) DeleteWhitelist(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("白名单ID格式错误"))
+		return
+	}
+
+	if err := h.svcCtx.GreylistModel.DeleteWhitelist(nil, id); err != nil {
+		h.greylistError(c, err, "删除失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("删除成功"))
+}
+
+func (h *GreylistHandler) greylistError(c *gin.Context, err error, msg string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, result.ErrorSimpleResult("记录不存在"))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult(msg))
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"miko-email/internal/model"
+	"miko-email/internal/result"
+	"miko-email/internal/svc"
+	"net/http"
+	"strconv"
+
+	"miko-email/internal/services/email"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type QueueHandler struct {
+	svcCtx       *svc.ServiceContext
+	emailService *email.Service
+}
+
+func NewQueueHandler(emailService *email.Service, svcCtx *svc.ServiceContext) *QueueHandler {
+	return &QueueHandler{
+		svcCtx:       svcCtx,
+		emailService: emailService,
+	}
+}
+
+// GetQueue 获取出站队列
+// status: 为空时返回未投递成功的邮件（queued/sending/deferred/failed），all 返回全部，也可指定单个状态
+func (h *QueueHandler) GetQueue(c *gin.Context) {
+	var statuses []string
+	switch status := c.Query("status"); status {
+	case "":
+		statuses = []string{model.OutboundStatusQueued, model.OutboundStatusSending, model.OutboundStatusDeferred, model.OutboundStatusFailed}
+	case "all":
+	case model.OutboundStatusQueued, model.OutboundStatusSending, model.OutboundStatusDeferred,
+		model.OutboundStatusDelivered, model.OutboundStatusFailed:
+		statuses = []string{status}
+	default:
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("无效的状态: "+status))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	items, total, err := h.svcCtx.OutboundQueueModel.ListMessages(statuses, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取出站队列失败"))
+		return
+	}
+
+	counts, err := h.svcCtx.OutboundQueueModel.CountRecipientsByStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取出站队列统计失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("", gin.H{
+		"list":     items,
+		"page":     page,
+		"pageSize": pageSize,
+		"total":    total,
+		"counts":   counts,
+	}))
+}
+
+// RetryQueueMessage 立即重试等待投递的收件人
+func (h *QueueHandler) RetryQueueMessage(c *gin.Context) {
+	id, ok := h.parseQueueId(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.emailService.RetryOutboundMessage(id)
+	if err != nil {
+		h.queueError(c, err, "重试失败")
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("没有等待投递的收件人"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("已安排立即重试 "+strconv.FormatInt(count, 10)+" 个收件人"))
+}
+
+// BounceQueueMessage 放弃投递并立即给发件人发送退信
+func (h *QueueHandler) BounceQueueMessage(c *gin.Context) {
+	id, ok := h.parseQueueId(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.emailService.BounceOutboundMessage(id)
+	if err != nil {
+		h.queueError(c, err, "退信失败")
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("没有等待投递的收件人"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("已放弃投递 "+strconv.FormatInt(count, 10)+" 个收件人并发送退信"))
+}
+
+// DeleteQueueMessage 从出站队列中删除邮件
+func (h *QueueHandler) DeleteQueueMessage(c *gin.Context) {
+	id, ok := h.parseQueueId(c)
+	if !ok {
+		return
+	}
+
+	if err := h.emailService.DeleteOutboundMessage(id); err != nil {
+		h.queueError(c, err, "删除失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("删除成功"))
+}
+
+func (h *QueueHandler) parseQueueId(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("队列ID格式错误"))
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *QueueHandler) queueError(c *gin.Context, err error, msg string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, result.ErrorSimpleResult("队列邮件不存在"))
+		return
+	}
+	c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(msg+": "+err.Error()))
+}
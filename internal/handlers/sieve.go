@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"miko-email/internal/result"
+	"miko-email/internal/services/sieve"
+	"miko-email/internal/svc"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SieveHandler struct {
+	sieveService *sieve.Service
+	svcCtx       *svc.ServiceContext
+}
+
+func NewSieveHandler(svcCtx *svc.ServiceContext) *SieveHandler {
+	return &SieveHandler{
+		sieveService: sieve.NewService(svcCtx),
+		svcCtx:       svcCtx,
+	}
+}
+
+type PutSieveScriptRequest struct {
+	Content string `json:"content"`
+}
+
+type RenameSieveScriptRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type CheckSieveScriptRequest struct {
+	Content string `json:"content"`
+}
+
+// GetSieveScripts 获取邮箱的Sieve脚本列表和支持的扩展
+func (h *SieveHandler) GetSieveScripts(c *gin.Context) {
+	mailboxID, ok := h.ownedMailboxId(c)
+	if !ok {
+		return
+	}
+
+	scripts, err := h.sieveService.ListScripts(mailboxID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, result.ErrorSimpleResult("获取脚本列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SuccessResult(gin.H{
+		"scripts":      scripts,
+		"capabilities": sieve.Capabilities,
+	}))
+}
+
+// GetSieveScript 获取脚本内容
+func (h *SieveHandler) GetSieveScript(c *gin.Context) {
+	mailboxID, ok := h.ownedMailboxId(c)
+	if !ok {
+		return
+	}
+
+	script, err := h.sieveService.GetScript(mailboxID, c.Param("name"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SuccessResult(script))
+}
+
+// PutSieveScript 检查并保存脚本，同名脚本存在时替换
+func (h *SieveHandler) PutSieveScript(c *gin.Context) {
+	mailboxID, ok := h.ownedMailboxId(c)
+	if !ok {
+		return
+	}
+
+	var req PutSieveScriptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("请求参数错误"))
+		return
+	}
+
+	script, err := h.sieveService.PutScript(mailboxID, c.Param("name"), req.Content)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result.DataResult("脚本保存成功", script))
+}
+
+// RenameSieveScript 重命名脚本
+func (h *SieveHandler) RenameSieveScript(c *gin.Context) {
+	mailboxID, ok := h.ownedMailboxId(c)
+	if !ok {
+		return
+	}
+
+	var req RenameSieveScriptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("请求参数错误"))
+		return
+	}
+
+	if err := h.sieveService.RenameScript(mailboxID, c.Param("name"), req.Name); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("脚本重命名成功"))
+}
+
+// DeleteSieveScript 删除脚本（启用中的脚本需要先停用）
+func (h *SieveHandler) DeleteSieveScript(c *gin.Context) {
+	mailboxID, ok := h.ownedMailboxId(c)
+	if !ok {
+		return
+	}
+
+	if err := h.sieveService.DeleteScript(mailboxID, c.Param("name")); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("脚本删除成功"))
+}
+
+// ActivateSieveScript 启用脚本（同时停用邮箱的其他脚本）
+func (h *SieveHandler) ActivateSieveScript(c *gin.Context) {
+	mailboxID, ok := h.ownedMailboxId(c)
+	if !ok {
+		return
+	}
+
+	if err := h.sieveService.SetActive(mailboxID, c.Param("name")); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("脚本已启用"))
+}
+
+// DeactivateSieveScript 停用邮箱的所有脚本
+func (h *SieveHandler) DeactivateSieveScript(c *gin.Context) {
+	mailboxID, ok := h.ownedMailboxId(c)
+	if !ok {
+		return
+	}
+
+	if err := h.sieveService.SetActive(mailboxID, ""); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("脚本已停用"))
+}
+
+// CheckSieveScript 检查脚本语法
+func (h *SieveHandler) CheckSieveScript(c *gin.Context) {
+	var req CheckSieveScriptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("请求参数错误"))
+		return
+	}
+
+	if err := h.sieveService.CheckScript(req.Content); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result.SimpleResult("脚本语法正确"))
+}
+
+// ownedMailboxId 解析路径中的邮箱ID并检查权限
+func (h *SieveHandler) ownedMailboxId(c *gin.Context) (int64, bool) {
+	mailboxID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("邮箱ID格式错误"))
+		return 0, false
+	}
+
+	userID := c.GetInt64("user_id")
+	isAdmin := c.GetBool("is_admin")
+
+	if _, err := h.sieveService.GetOwnedMailbox(mailboxID, userID, isAdmin); err != nil {
+		c.JSON(http.StatusForbidden, result.ErrorSimpleResult(err.Error()))
+		return 0, false
+	}
+	return mailboxID, true
+}
+
+// writeError 脚本错误带上行号返回
+func (h *SieveHandler) writeError(c *gin.Context, err error) {
+	var scriptErr *sieve.Error
+	switch {
+	case errors.As(err, &scriptErr):
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult("脚本错误: "+scriptErr.Error()))
+	case errors.Is(err, sieve.ErrScriptNotFound):
+		c.JSON(http.StatusNotFound, result.ErrorSimpleResult(err.Error()))
+	default:
+		c.JSON(http.StatusBadRequest, result.ErrorSimpleResult(err.Error()))
+	}
+}
@@ -146,3 +146,21 @@ func (h *WebHandler) AdminMailboxesPage(c *gin.Context) {
 		"username": username,
 	})
 }
+
+// QueuePage 出站队列管理页面
+func (h *WebHandler) QueuePage(c *gin.Context) {
+	username := c.GetString("username")
+	c.HTML(http.StatusOK, "admin_queue.html", gin.H{
+		"title":    "出站队列",
+		"username": username,
+	})
+}
+
+// DNSBLPage DNS黑名单页面
+func (h *WebHandler) DNSBLPage(c *gin.Context) {
+	username := c.GetString("username")
+	c.HTML(http.StatusOK, "admin_dnsbl.html", gin.H{
+		"title":    "DNS黑名单",
+		"username": username,
+	})
+}
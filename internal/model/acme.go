@@ -0,0 +1,123 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AcmeAccount ACME账户模型（每个ACME目录地址一个账户）
+type AcmeAccount struct {
+	Id           int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                    // 数据库主键ID
+	DirectoryUrl string    `gorm:"column:directory_url;uniqueIndex;not null;comment:ACME目录地址" json:"directory_url"` // ACME目录地址
+	Email        string    `gorm:"column:email;comment:联系邮箱" json:"email"`                                          // 联系邮箱
+	AccountUrl   string    `gorm:"column:account_url;comment:账户地址" json:"account_url"`                              // 账户地址（kid）
+	PrivateKey   string    `gorm:"column:private_key;type:text;not null;comment:账户私钥(PEM)" json:"-"`                // 账户私钥(PEM)
+	CreatedAt    time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"`      // 创建时间
+	UpdatedAt    time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"`      // 更新时间
+}
+
+// TableName 指定表名
+func (AcmeAccount) TableName() string {
+	return "acme_account"
+}
+
+// AcmeCertificate ACME证书模型（每个域名一条，证书签发给 mail.<域名>）
+type AcmeCertificate struct {
+	Id            int64      `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`               // 数据库主键ID
+	Domain        string     `gorm:"column:domain;uniqueIndex;not null;comment:域名" json:"domain"`                // 域名
+	Hostname      string     `gorm:"column:hostname;not null;comment:证书主机名" json:"hostname"`                     // 证书主机名
+	Certificate   string     `gorm:"column:certificate;type:text;comment:证书链(PEM)" json:"-"`                     // 证书链(PEM)
+	PrivateKey    string     `gorm:"column:private_key;type:text;comment:证书私钥(PEM)" json:"-"`                    // 证书私钥(PEM)
+	NotAfter      *time.Time `gorm:"column:not_after;comment:到期时间" json:"not_after"`                             // 到期时间
+	Status        string     `gorm:"column:status;not null;default:pending;comment:状态" json:"status"`            // 状态：pending/valid/failed（最近一次申请的结果）
+	LastError     string     `gorm:"column:last_error;comment:最后一次错误" json:"last_error,omitempty"`               // 最后一次错误
+	LastAttemptAt *time.Time `gorm:"column:last_attempt_at;comment:最后一次申请时间" json:"last_attempt_at"`             // 最后一次申请时间
+	CreatedAt     time.Time  `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"` // 创建时间
+	UpdatedAt     time.Time  `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"` // 更新时间
+}
+
+// TableName 指定表名
+func (AcmeCertificate) TableName() string {
+	return "acme_certificate"
+}
+
+// AcmeCertificate 状态
+const (
+	AcmeStatusPending = "pending"
+	AcmeStatusValid   = "valid"
+	AcmeStatusFailed  = "failed"
+)
+
+// AcmeModel ACME账户和证书模型
+type AcmeModel struct {
+	db *gorm.DB
+}
+
+// NewAcmeModel 创建ACME模型
+func NewAcmeModel(db *gorm.DB) *AcmeModel {
+	return &AcmeModel{
+		db: db,
+	}
+}
+
+// GetAccount 根据目录地址获取账户
+func (m *AcmeModel) GetAccount(directoryUrl string) (*AcmeAccount, error) {
+	var account AcmeAccount
+	if err := m.db.Where("directory_url = ?", directoryUrl).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// SaveAccount 保存账户
+func (m *AcmeModel) SaveAccount(tx *gorm.DB, account *AcmeAccount) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	account.UpdatedAt = time.Now()
+	return db.Save(account).Error
+}
+
+// GetCertificate 根据域名获取证书
+func (m *AcmeModel) GetCertificate(domain string) (*AcmeCertificate, error) {
+	var cert AcmeCertificate
+	if err := m.db.Where("domain = ?", domain).First(&cert).Error; err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// ListCertificates 获取所有证书
+func (m *AcmeModel) ListCertificates() ([]*AcmeCertificate, error) {
+	var certs []*AcmeCertificate
+	err := m.db.Order("domain").Find(&certs).Error
+	return certs, err
+}
+
+// ListIssuedCertificates 获取已签发过的证书（续期失败时仍保留旧证书）
+func (m *AcmeModel) ListIssuedCertificates() ([]*AcmeCertificate, error) {
+	var certs []*AcmeCertificate
+	err := m.db.Where("certificate <> ''").Find(&certs).Error
+	return certs, err
+}
+
+// SaveCertificate 保存证书
+func (m *AcmeModel) SaveCertificate(tx *gorm.DB, cert *AcmeCertificate) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	cert.UpdatedAt = time.Now()
+	return db.Save(cert).Error
+}
+
+// DeleteCertificate 删除域名的证书
+func (m *AcmeModel) DeleteCertificate(tx *gorm.DB, domain string) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Where("domain = ?", domain).Delete(&AcmeCertificate{}).Error
+}
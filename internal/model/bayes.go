@@ -0,0 +1,139 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BayesGlobalMailboxId 全局贝叶斯数据的邮箱ID（所有邮箱的训练都会同时计入）
+const BayesGlobalMailboxId = 0
+
+// 邮件的贝叶斯训练分类
+const (
+	BayesClassSpam = "spam"
+	BayesClassHam  = "ham"
+)
+
+// BayesToken 贝叶斯分类器的词条统计
+type BayesToken struct {
+	Id        int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                                          // 数据库主键ID
+	MailboxId int64     `gorm:"column:mailbox_id;uniqueIndex:idx_bayes_token;not null;default:0;comment:邮箱ID(0为全局)" json:"mailbox_id"` // 邮箱ID（0为全局）
+	Token     string    `gorm:"column:token;uniqueIndex:idx_bayes_token;size:100;not null;comment:词条" json:"token"`                    // 词条
+	SpamCount int64     `gorm:"column:spam_count;not null;default:0;comment:出现在垃圾邮件中的次数" json:"spam_count"`                            // 出现在垃圾邮件中的次数
+	HamCount  int64     `gorm:"column:ham_count;not null;default:0;comment:出现在正常邮件中的次数" json:"ham_count"`                              // 出现在正常邮件中的次数
+	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"`                            // 更新时间
+}
+
+// TableName 指定表名
+func (BayesToken) TableName() string {
+	return "bayes_token"
+}
+
+// BayesCorpus 贝叶斯分类器已训练的邮件数量
+type BayesCorpus struct {
+	MailboxId int64     `gorm:"column:mailbox_id;primaryKey;autoIncrement:false;comment:邮箱ID(0为全局)" json:"mailbox_id"` // 邮箱ID（0为全局）
+	SpamCount int64     `gorm:"column:spam_count;not null;default:0;comment:已训练的垃圾邮件数" json:"spam_count"`              // 已训练的垃圾邮件数
+	HamCount  int64     `gorm:"column:ham_count;not null;default:0;comment:已训练的正常邮件数" json:"ham_count"`                // 已训练的正常邮件数
+	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"`            // 更新时间
+}
+
+// TableName 指定表名
+func (BayesCorpus) TableName() string {
+	return "bayes_corpus"
+}
+
+// BayesModel 贝叶斯分类器数据模型
+type BayesModel struct {
+	db *gorm.DB
+}
+
+// NewBayesModel 创建贝叶斯分类器数据模型
+func NewBayesModel(db *gorm.DB) *BayesModel {
+	return &BayesModel{
+		db: db,
+	}
+}
+
+// bayesBatchSize 每次查询或写入的词条数量（SQLite单条语句的参数数量有限）
+const bayesBatchSize = 200
+
+// AddTokens 增减词条的计数（delta 为负数时表示撤销训练，计数不会小于0）
+func (m *BayesModel) AddTokens(tx *gorm.DB, mailboxId int64, tokens []string, spamDelta, hamDelta int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+
+	now := time.Now()
+	for start := 0; start < len(tokens); start += bayesBatchSize {
+		end := min(start+bayesBatchSize, len(tokens))
+		rows := make([]*BayesToken, 0, end-start)
+		for _, token := range tokens[start:end] {
+			rows = append(rows, &BayesToken{
+				MailboxId: mailboxId,
+				Token:     token,
+				SpamCount: max(spamDelta, 0),
+				HamCount:  max(hamDelta, 0),
+				UpdatedAt: now,
+			})
+		}
+		err := db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "mailbox_id"}, {Name: "token"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"spam_count": gorm.Expr("MAX(spam_count + ?, 0)", spamDelta),
+				"ham_count":  gorm.Expr("MAX(ham_count + ?, 0)", hamDelta),
+				"updated_at": now,
+			}),
+		}).Create(&rows).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTokens 获取词条的计数，未出现过的词条不在结果中
+func (m *BayesModel) GetTokens(mailboxId int64, tokens []string) (map[string]*BayesToken, error) {
+	result := make(map[string]*BayesToken, len(tokens))
+	for start := 0; start < len(tokens); start += bayesBatchSize {
+		end := min(start+bayesBatchSize, len(tokens))
+		var rows []*BayesToken
+		if err := m.db.Where("mailbox_id = ? AND token IN ?", mailboxId, tokens[start:end]).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			result[row.Token] = row
+		}
+	}
+	return result, nil
+}
+
+// AddCorpus 增减已训练的邮件数量
+func (m *BayesModel) AddCorpus(tx *gorm.DB, mailboxId int64, spamDelta, hamDelta int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "mailbox_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"spam_count": gorm.Expr("MAX(spam_count + ?, 0)", spamDelta),
+			"ham_count":  gorm.Expr("MAX(ham_count + ?, 0)", hamDelta),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&BayesCorpus{
+		MailboxId: mailboxId,
+		SpamCount: max(spamDelta, 0),
+		HamCount:  max(hamDelta, 0),
+		UpdatedAt: time.Now(),
+	}).Error
+}
+
+// GetCorpus 获取已训练的邮件数量，没有训练过时返回0
+func (m *BayesModel) GetCorpus(mailboxId int64) (*BayesCorpus, error) {
+	corpus := &BayesCorpus{MailboxId: mailboxId}
+	err := m.db.Where("mailbox_id = ?", mailboxId).Find(corpus).Error
+	return corpus, err
+}
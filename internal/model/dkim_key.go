@@ -0,0 +1,138 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DkimKey DKIM密钥模型（每个域名可以有多个选择器，私钥加密保存）
+type DkimKey struct {
+	Id         int64      `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                              // 数据库主键ID
+	DomainId   int64      `gorm:"column:domain_id;uniqueIndex:idx_dkim_key_selector;not null;comment:域名ID" json:"domain_id"` // 域名ID
+	Selector   string     `gorm:"column:selector;uniqueIndex:idx_dkim_key_selector;not null;comment:选择器" json:"selector"`    // 选择器
+	Algorithm  string     `gorm:"column:algorithm;not null;default:rsa;comment:算法" json:"algorithm"`                         // 算法：rsa/ed25519
+	PublicKey  string     `gorm:"column:public_key;type:text;not null;comment:公钥(DNS记录中的p=)" json:"public_key"`              // 公钥（base64，即DNS记录中的p=）
+	PrivateKey string     `gorm:"column:private_key;type:text;not null;comment:加密后的私钥" json:"-"`                             // 加密后的私钥
+	ActivateAt time.Time  `gorm:"column:activate_at;not null;comment:开始签名时间" json:"activate_at"`                             // 开始签名时间（同一算法中已生效且最新的密钥用于签名）
+	RetiredAt  *time.Time `gorm:"column:retired_at;comment:停用时间" json:"retired_at"`                                          // 停用时间（停用后不再签名，也不再需要发布DNS记录）
+	CreatedAt  time.Time  `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"`                // 创建时间
+	UpdatedAt  time.Time  `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"`                // 更新时间
+}
+
+// TableName 指定表名
+func (DkimKey) TableName() string {
+	return "dkim_key"
+}
+
+// DKIM密钥算法
+const (
+	DkimAlgorithmRSA     = "rsa"     // RSA-SHA256（RFC 6376）
+	DkimAlgorithmEd25519 = "ed25519" // Ed25519-SHA256（RFC 8463）
+)
+
+// DkimKeyModel DKIM密钥模型
+type DkimKeyModel struct {
+	db *gorm.DB
+}
+
+// NewDkimKeyModel 创建DKIM密钥模型
+func NewDkimKeyModel(db *gorm.DB) *DkimKeyModel {
+	return &DkimKeyModel{
+		db: db,
+	}
+}
+
+// Create 创建密钥
+func (m *DkimKeyModel) Create(tx *gorm.DB, key *DkimKey) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Create(key).Error
+}
+
+// GetById 根据ID获取域名的密钥
+func (m *DkimKeyModel) GetById(domainId, id int64) (*DkimKey, error) {
+	var key DkimKey
+	if err := m.db.Where("id = ? AND domain_id = ?", id, domainId).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListByDomain 获取域名的所有密钥（包括已停用的）
+func (m *DkimKeyModel) ListByDomain(domainId int64) ([]*DkimKey, error) {
+	var keys []*DkimKey
+	err := m.db.Where("domain_id = ?", domainId).Order("activate_at, id").Find(&keys).Error
+	return keys, err
+}
+
+// ListPublished 获取域名未停用的密钥（需要在DNS中发布）
+func (m *DkimKeyModel) ListPublished(domainId int64) ([]*DkimKey, error) {
+	var keys []*DkimKey
+	err := m.db.Where("domain_id = ? AND retired_at IS NULL", domainId).Order("activate_at, id").Find(&keys).Error
+	return keys, err
+}
+
+// GetSigningKeys 获取域名当前用于签名的密钥：每种算法中已生效且最新的一个
+func (m *DkimKeyModel) GetSigningKeys(domainId int64, now time.Time) ([]*DkimKey, error) {
+	var keys []*DkimKey
+	err := m.db.Where("domain_id = ? AND retired_at IS NULL AND activate_at <= ?", domainId, now).
+		Order("activate_at DESC, id DESC").Find(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var signing []*DkimKey
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if seen[key.Algorithm] {
+			continue
+		}
+		seen[key.Algorithm] = true
+		signing = append(signing, key)
+	}
+	return signing, nil
+}
+
+// CheckSelectorExist 检查域名下选择器是否已存在
+func (m *DkimKeyModel) CheckSelectorExist(domainId int64, selector string) (bool, error) {
+	var count int64
+	err := m.db.Model(&DkimKey{}).Where("domain_id = ? AND selector = ?", domainId, selector).Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateActivateAt 更新密钥开始签名的时间
+func (m *DkimKeyModel) UpdateActivateAt(tx *gorm.DB, id int64, activateAt time.Time) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&DkimKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"activate_at": activateAt,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+// Retire 停用密钥
+func (m *DkimKeyModel) Retire(tx *gorm.DB, id int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	now := time.Now()
+	return db.Model(&DkimKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"retired_at": &now,
+		"updated_at": now,
+	}).Error
+}
+
+// DeleteByDomain 删除域名的所有密钥
+func (m *DkimKeyModel) DeleteByDomain(tx *gorm.DB, domainId int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Where("domain_id = ?", domainId).Delete(&DkimKey{}).Error
+}
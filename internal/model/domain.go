@@ -20,6 +20,11 @@ type Domain struct {
 	DMARCRecord                string    `json:"dmarc_record" db:"dmarc_record"`                                             // DMARC记录
 	DKIMRecord                 string    `json:"dkim_record" db:"dkim_record"`                                               // DKIM记录
 	PTRRecord                  string    `json:"ptr_record" db:"ptr_record"`                                                 // PTR记录
+	DKIMHeaders                string    `gorm:"column:dkim_headers;comment:DKIM签名的邮件头" json:"dkim_headers"`                 // DKIM签名的邮件头（逗号分隔，为空时使用默认列表）
+	SpamSettings               string    `gorm:"column:spam_settings;type:text;comment:垃圾邮件设置" json:"spam_settings"`         // 垃圾邮件设置（JSON：阈值和规则分数，为空时使用全局配置）
+	CatchAll                   string    `gorm:"column:catch_all;default:'';comment:catch-all邮箱" json:"catch_all"`           // catch-all邮箱（投递到该域名下不存在的地址的邮件放入此邮箱，为空时拒收）
+	DisableGreylist            bool      `gorm:"column:disable_greylist;default:0;comment:是否关闭灰名单" json:"disable_greylist"`  // 是否关闭灰名单（全局开启时该域名的收件人不做灰名单检查）
+	DisableSRS                 bool      `gorm:"column:disable_srs;default:0;comment:是否关闭SRS" json:"disable_srs"`            // 是否关闭SRS（转发到外部邮箱时不改写信封发件人）
 	SenderVerificationStatus   string    `json:"sender_verification_status" db:"sender_verification_status"`                 // 发件验证状态
 	ReceiverVerificationStatus string    `json:"receiver_verification_status" db:"receiver_verification_status"`             // 收件验证状态
 	CreatedAt                  time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"` // 创建时间
@@ -275,6 +280,66 @@ func (m *DomainModel) UpdateTXTRecord(tx *gorm.DB, id int64, txtRecord string) e
 	}).Error
 }
 
+// UpdateDKIMHeaders 更新DKIM签名的邮件头
+func (m *DomainModel) UpdateDKIMHeaders(tx *gorm.DB, id int64, headers string) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"dkim_headers": headers,
+		"updated_at":   time.Now(),
+	}).Error
+}
+
+// UpdateSpamSettings 更新域名的垃圾邮件设置
+func (m *DomainModel) UpdateSpamSettings(tx *gorm.DB, id int64, settings string) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"spam_settings": settings,
+		"updated_at":    time.Now(),
+	}).Error
+}
+
+// UpdateCatchAll 更新域名的 catch-all 邮箱
+func (m *DomainModel) UpdateCatchAll(tx *gorm.DB, id int64, mailbox string) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"catch_all":  mailbox,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// UpdateGreylist 更新域名是否启用灰名单
+func (m *DomainModel) UpdateGreylist(tx *gorm.DB, id int64, enabled bool) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"disable_greylist": !enabled,
+		"updated_at":       time.Now(),
+	}).Error
+}
+
+// UpdateSRS 更新域名转发时是否使用SRS改写信封发件人
+func (m *DomainModel) UpdateSRS(tx *gorm.DB, id int64, enabled bool) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"disable_srs": !enabled,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
 // GetDomainsByStatus 根据状态获取域名列表
 func (m *DomainModel) GetDomainsByStatus(isActive, isVerified bool) ([]*Domain, error) {
 	var domains []*Domain
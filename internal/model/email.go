@@ -1,23 +1,40 @@
 package model
 
 import (
+	"net/mail"
+	"strings"
 	"time"
+	"unicode"
 
 	"gorm.io/gorm"
 )
 
 // Email 邮件模型
 type Email struct {
-	Id        int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`               // 数据库主键ID
-	MailboxId int64     `gorm:"column:mailbox_id;not null;comment:邮箱ID" json:"mailbox_id"`                  // 邮箱ID
-	FromAddr  string    `gorm:"column:from_addr;not null;comment:发件人" json:"from_addr"`                     // 发件人
-	ToAddr    string    `gorm:"column:to_addr;not null;comment:收件人" json:"to_addr"`                         // 收件人
-	Subject   string    `gorm:"column:subject;comment:主题" json:"subject,omitempty"`                         // 主题
-	Body      string    `gorm:"column:body;comment:邮件内容" json:"body,omitempty"`                             // 邮件内容
-	IsRead    bool      `gorm:"column:is_read;default:0;comment:是否已读" json:"is_read"`                       // 是否已读
-	Folder    string    `gorm:"column:folder;default:inbox;comment:文件夹" json:"folder"`                      // 文件夹 (inbox, sent, trash)
-	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"` // 创建时间
-	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"` // 更新时间
+	Id          int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                      // 数据库主键ID
+	MailboxId   int64     `gorm:"column:mailbox_id;not null;comment:邮箱ID" json:"mailbox_id"`                         // 邮箱ID
+	FromAddr    string    `gorm:"column:from_addr;not null;comment:发件人" json:"from_addr"`                            // 发件人
+	Sender      string    `gorm:"column:sender;default:'';index;comment:小写的发件人" json:"-"`                            // 小写的发件人地址，用于按发件人统计（发件人信誉）
+	ToAddr      string    `gorm:"column:to_addr;not null;comment:收件人" json:"to_addr"`                                // 收件人
+	Tag         string    `gorm:"column:tag;default:'';index;comment:子地址标签" json:"tag"`                              // 子地址标签（投递到 user+tag@domain 时为 tag）
+	Subject     string    `gorm:"column:subject;comment:主题" json:"subject,omitempty"`                                // 主题
+	Body        string    `gorm:"column:body;comment:邮件内容" json:"body,omitempty"`                                    // 邮件内容
+	IsRead      bool      `gorm:"column:is_read;default:0;comment:是否已读" json:"is_read"`                              // 是否已读
+	Folder      string    `gorm:"column:folder;default:inbox;comment:文件夹" json:"folder"`                             // 文件夹 (inbox, sent, drafts, trash, junk, archive 或用户自定义文件夹名)
+	Uid         int64     `gorm:"column:uid;not null;default:0;index;comment:IMAP UID" json:"uid"`                   // IMAP UID（所在文件夹内递增，0表示尚未分配）
+	IsAnswered  bool      `gorm:"column:is_answered;default:0;comment:是否已回复" json:"is_answered"`                     // 是否已回复 (\Answered)
+	IsFlagged   bool      `gorm:"column:is_flagged;default:0;comment:是否已标记" json:"is_flagged"`                       // 是否已标记 (\Flagged)
+	IsDeleted   bool      `gorm:"column:is_deleted;default:0;comment:是否待删除" json:"is_deleted"`                       // 是否待删除 (\Deleted，EXPUNGE时删除)
+	IsDraft     bool      `gorm:"column:is_draft;default:0;comment:是否草稿" json:"is_draft"`                            // 是否草稿 (\Draft)
+	SpfResult   string    `gorm:"column:spf_result;default:'';comment:SPF检查结果" json:"spf_result"`                    // SPF检查结果 (pass/fail/softfail/neutral/none/temperror/permerror，空表示未检查)
+	DkimResult  string    `gorm:"column:dkim_result;default:'';comment:DKIM验证结果" json:"dkim_result"`                 // DKIM验证结果 (pass/fail/none/temperror/permerror)
+	DmarcResult string    `gorm:"column:dmarc_result;default:'';comment:DMARC检查结果" json:"dmarc_result"`              // DMARC检查结果 (pass/fail/none/temperror/permerror)
+	AuthResults string    `gorm:"column:auth_results;type:text;comment:Authentication-Results头" json:"auth_results"` // 收信时添加的Authentication-Results头（RFC 8601）
+	SpamScore   float64   `gorm:"column:spam_score;default:0;comment:垃圾邮件得分" json:"spam_score"`                      // 垃圾邮件得分
+	SpamRules   string    `gorm:"column:spam_rules;default:'';comment:命中的垃圾邮件规则" json:"spam_rules"`                  // 命中的垃圾邮件规则（逗号分隔）
+	BayesClass  string    `gorm:"column:bayes_class;default:'';comment:贝叶斯训练分类" json:"bayes_class"`                  // 贝叶斯分类器训练时使用的分类 (spam/ham，空表示未训练)
+	CreatedAt   time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"`        // 创建时间
+	UpdatedAt   time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"`        // 更新时间
 }
 
 // TableName 指定表名
@@ -25,9 +42,13 @@ func (Email) TableName() string {
 	return "email"
 }
 
+// FolderChangeHook 邮件移动到其他文件夹后的回调（与移动使用同一事务），email 为移动后的邮件
+type FolderChangeHook func(tx *gorm.DB, email *Email, oldFolder string)
+
 // EmailModel 邮件模型
 type EmailModel struct {
-	db *gorm.DB
+	db         *gorm.DB
+	folderHook FolderChangeHook
 }
 
 // NewEmailModel 创建邮件模型
@@ -37,12 +58,18 @@ func NewEmailModel(db *gorm.DB) *EmailModel {
 	}
 }
 
+// SetFolderChangeHook 设置邮件移动文件夹后的回调（用于贝叶斯分类器训练）
+func (m *EmailModel) SetFolderChangeHook(hook FolderChangeHook) {
+	m.folderHook = hook
+}
+
 // Create 创建邮件
 func (m *EmailModel) Create(tx *gorm.DB, email *Email) error {
 	db := m.db
 	if tx != nil {
 		db = tx
 	}
+	email.Sender = normalizeSender(email.FromAddr)
 	return db.Create(email).Error
 }
 
@@ -120,6 +147,9 @@ func (m *EmailModel) List(params EmailReq) ([]*Email, int64, error) {
 	if params.ToAddr != "" {
 		db = db.Where("to_addr LIKE ?", "%"+params.ToAddr+"%")
 	}
+	if params.Tag != "" {
+		db = db.Where("tag = ?", params.Tag)
+	}
 	if params.Subject != "" {
 		db = db.Where("subject LIKE ?", "%"+params.Subject+"%")
 	}
@@ -193,18 +223,20 @@ func (m *EmailModel) MarkAsUnread(tx *gorm.DB, id int64) error {
 
 // MoveToFolder 移动邮件到指定文件夹
 func (m *EmailModel) MoveToFolder(tx *gorm.DB, id int64, folder string) error {
+	return m.BatchMoveToFolder(tx, []int64{id}, folder)
+}
+
+// UpdateBayesClass 更新邮件的贝叶斯训练分类
+func (m *EmailModel) UpdateBayesClass(tx *gorm.DB, id int64, class string) error {
 	db := m.db
 	if tx != nil {
 		db = tx
 	}
-	return db.Model(&Email{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"folder":     folder,
-		"updated_at": time.Now(),
-	}).Error
+	return db.Model(&Email{}).Where("id = ?", id).Update("bayes_class", class).Error
 }
 
 // GetEmailsByMailboxId 根据邮箱ID获取邮件列表
-func (m *EmailModel) GetEmailsByMailboxId(mailboxId int64, folder string, page, pageSize int) ([]*Email, int64, error) {
+func (m *EmailModel) GetEmailsByMailboxId(mailboxId int64, folder, tag string, page, pageSize int) ([]*Email, int64, error) {
 	var emails []*Email
 	var total int64
 
@@ -213,6 +245,9 @@ func (m *EmailModel) GetEmailsByMailboxId(mailboxId int64, folder string, page,
 	if folder != "" {
 		db = db.Where("folder = ?", folder)
 	}
+	if tag != "" {
+		db = db.Where("tag = ?", tag)
+	}
 
 	// 获取总数
 	if err := db.Count(&total).Error; err != nil {
@@ -231,6 +266,22 @@ func (m *EmailModel) GetEmailsByMailboxId(mailboxId int64, folder string, page,
 	return emails, total, nil
 }
 
+// RenameFolder 将邮箱中某个文件夹的邮件改到新文件夹，resetUid 为 true 时需要重新分配UID
+func (m *EmailModel) RenameFolder(tx *gorm.DB, mailboxId int64, from, to string, resetUid bool) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	data := map[string]interface{}{
+		"folder":     to,
+		"updated_at": time.Now(),
+	}
+	if resetUid {
+		data["uid"] = 0
+	}
+	return db.Model(&Email{}).Where("mailbox_id = ? AND folder = ?", mailboxId, from).Updates(data).Error
+}
+
 // GetUnreadCount 获取未读邮件数量
 func (m *EmailModel) GetUnreadCount(mailboxId int64, folder string) (int64, error) {
 	var count int64
@@ -308,10 +359,31 @@ func (m *EmailModel) BatchMoveToFolder(tx *gorm.DB, ids []int64, folder string)
 	if tx != nil {
 		db = tx
 	}
-	return db.Model(&Email{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+
+	// 记录移动前的文件夹，供回调使用
+	var moved []*Email
+	if m.folderHook != nil {
+		if err := db.Where("id IN ? AND folder <> ?", ids, folder).Find(&moved).Error; err != nil {
+			return err
+		}
+	}
+
+	err := db.Model(&Email{}).Where("id IN ?", ids).Updates(map[string]interface{}{
 		"folder":     folder,
+		"uid":        0, // 进入新文件夹后重新分配UID
 		"updated_at": time.Now(),
 	}).Error
+	if err != nil {
+		return err
+	}
+
+	for _, email := range moved {
+		oldFolder := email.Folder
+		email.Folder = folder
+		email.Uid = 0
+		m.folderHook(db, email, oldFolder)
+	}
+	return nil
 }
 
 // GetEmailsByUserEmail 根据用户邮箱地址获取邮件（用于IMAP/POP3）
@@ -331,6 +403,24 @@ func (m *EmailModel) GetEmailsByUserEmail(userEmail, folder string, limit int) (
 	return emails, err
 }
 
+// GetImapEmails 获取文件夹中已分配UID的邮件（按UID升序，不加载正文，用于IMAP）
+func (m *EmailModel) GetImapEmails(mailboxId int64, folder string) ([]*Email, error) {
+	var emails []*Email
+	err := m.db.Omit("body").
+		Where("mailbox_id = ? AND folder = ? AND uid > 0", mailboxId, folder).
+		Order("uid ASC").Find(&emails).Error
+	return emails, err
+}
+
+// BatchMapUpdate 批量更新邮件
+func (m *EmailModel) BatchMapUpdate(tx *gorm.DB, ids []int64, data map[string]interface{}) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&Email{}).Where("id IN ?", ids).Updates(data).Error
+}
+
 // SaveEmailToFolder 保存邮件到指定文件夹
 func (m *EmailModel) SaveEmailToFolder(tx *gorm.DB, mailboxId int64, fromAddr, toAddr, subject, body, folder string) error {
 	db := m.db
@@ -341,6 +431,7 @@ func (m *EmailModel) SaveEmailToFolder(tx *gorm.DB, mailboxId int64, fromAddr, t
 	email := &Email{
 		MailboxId: mailboxId,
 		FromAddr:  fromAddr,
+		Sender:    normalizeSender(fromAddr),
 		ToAddr:    toAddr,
 		Subject:   subject,
 		Body:      body,
@@ -379,3 +470,71 @@ func (m *EmailModel) CountEmailsByUserEmail(userEmail, folder string) (int64, er
 		Count(&count).Error
 	return count, err
 }
+
+// CountSentTo 统计邮箱发给指定地址的邮件数量（已发送文件夹，收件人地址完全相同才计数）
+func (m *EmailModel) CountSentTo(mailboxId int64, addr string) (int64, error) {
+	addr = normalizeSender(addr)
+	var toAddrs []string
+	// instr 只用于缩小范围，a@b.com 也会匹配 xa@b.com，需要逐个比较解析出的地址
+	err := m.db.Model(&Email{}).
+		Where("mailbox_id = ? AND folder = ? AND instr(lower(to_addr), ?) > 0", mailboxId, "sent", addr).
+		Pluck("to_addr", &toAddrs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, toAddr := range toAddrs {
+		if containsAddress(toAddr, addr) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// containsAddress 判断收件人列表中是否有指定地址（addr 为小写）
+// 列表可以是 "Name <a@b.com>, c@d.com" 格式，解析失败时按逗号、分号和空白拆分
+func containsAddress(list, addr string) bool {
+	if parsed, err := mail.ParseAddressList(list); err == nil {
+		for _, a := range parsed {
+			if normalizeSender(a.Address) == addr {
+				return true
+			}
+		}
+		return false
+	}
+	for _, token := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ';' || unicode.IsSpace(r)
+	}) {
+		if normalizeSender(strings.Trim(token, "<>\"'")) == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// CountReceivedFrom 统计指定时间后收到的某发件人的邮件数量，以及其中在垃圾邮件文件夹中的数量
+// 按 sender 索引查询
+func (m *EmailModel) CountReceivedFrom(fromAddr string, since time.Time) (total, junk int64, err error) {
+	var row struct {
+		Total int64
+		Junk  int64
+	}
+	err = m.db.Model(&Email{}).
+		Select("COUNT(*) AS total, COALESCE(SUM(CASE WHEN folder = ? THEN 1 ELSE 0 END), 0) AS junk", "junk").
+		Where("sender = ? AND created_at >= ? AND folder NOT IN ?", normalizeSender(fromAddr), since, []string{"sent", "drafts"}).
+		Scan(&row).Error
+	return row.Total, row.Junk, err
+}
+
+// BackfillSender 为旧版本保存的邮件填充 sender 字段
+func (m *EmailModel) BackfillSender() (int64, error) {
+	res := m.db.Model(&Email{}).Where("sender = ? AND from_addr <> ?", "", "").
+		UpdateColumn("sender", gorm.Expr("lower(trim(from_addr))"))
+	return res.RowsAffected, res.Error
+}
+
+// normalizeSender 发件人地址统一为小写
+func normalizeSender(addr string) string {
+	return strings.ToLower(strings.TrimSpace(addr))
+}
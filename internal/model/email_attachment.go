@@ -0,0 +1,127 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmailAttachment 邮件附件模型
+type EmailAttachment struct {
+	Id          int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`               // 数据库主键ID
+	EmailId     int64     `gorm:"column:email_id;index;not null;comment:邮件ID" json:"email_id"`                // 邮件ID
+	Filename    string    `gorm:"column:filename;comment:文件名" json:"filename"`                                // 文件名
+	ContentType string    `gorm:"column:content_type;comment:内容类型" json:"content_type"`                       // 内容类型
+	Size        int64     `gorm:"column:size;not null;default:0;comment:大小(字节)" json:"size"`                  // 大小(字节)
+	ContentId   string    `gorm:"column:content_id;comment:Content-ID" json:"content_id"`                     // Content-ID（内嵌图片引用）
+	Disposition string    `gorm:"column:disposition;default:attachment;comment:展示方式" json:"disposition"`      // 展示方式 (attachment, inline)
+	Sha256      string    `gorm:"column:sha256;size:64;comment:内容SHA-256" json:"sha256"`                      // 内容SHA-256
+	StoragePath string    `gorm:"column:storage_path;not null;comment:存储位置" json:"-"`                         // 存储位置（相对附件目录）
+	CreatedAt   time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"` // 创建时间
+}
+
+// TableName 指定表名
+func (EmailAttachment) TableName() string {
+	return "email_attachment"
+}
+
+// EmailAttachmentModel 邮件附件模型
+type EmailAttachmentModel struct {
+	db *gorm.DB
+}
+
+// NewEmailAttachmentModel 创建邮件附件模型
+func NewEmailAttachmentModel(db *gorm.DB) *EmailAttachmentModel {
+	return &EmailAttachmentModel{
+		db: db,
+	}
+}
+
+// Create 创建附件记录
+func (m *EmailAttachmentModel) Create(tx *gorm.DB, attachment *EmailAttachment) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Create(attachment).Error
+}
+
+// GetByEmailId 获取邮件的所有附件
+func (m *EmailAttachmentModel) GetByEmailId(emailId int64) ([]*EmailAttachment, error) {
+	var attachments []*EmailAttachment
+	if err := m.db.Where("email_id = ?", emailId).Order("id ASC").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// GetByIdAndEmailId 根据ID和邮件ID获取附件
+func (m *EmailAttachmentModel) GetByIdAndEmailId(id, emailId int64) (*EmailAttachment, error) {
+	var attachment EmailAttachment
+	if err := m.db.Where("id = ? AND email_id = ?", id, emailId).First(&attachment).Error; err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// GetStoragePathsByEmailId 获取邮件附件的存储位置
+func (m *EmailAttachmentModel) GetStoragePathsByEmailId(emailId int64) ([]string, error) {
+	var paths []string
+	err := m.db.Model(&EmailAttachment{}).Where("email_id = ?", emailId).Pluck("storage_path", &paths).Error
+	return paths, err
+}
+
+// GetStoragePathsByMailboxId 获取邮箱下所有附件的存储位置
+func (m *EmailAttachmentModel) GetStoragePathsByMailboxId(mailboxId int64) ([]string, error) {
+	var paths []string
+	err := m.db.Model(&EmailAttachment{}).
+		Where("email_id IN (?)", m.db.Model(&Email{}).Select("id").Where("mailbox_id = ?", mailboxId)).
+		Pluck("storage_path", &paths).Error
+	return paths, err
+}
+
+// CountByStoragePath 统计引用同一存储位置的附件数量
+func (m *EmailAttachmentModel) CountByStoragePath(path string) (int64, error) {
+	var count int64
+	err := m.db.Model(&EmailAttachment{}).Where("storage_path = ?", path).Count(&count).Error
+	return count, err
+}
+
+// CopyToEmail 将附件记录复制到另一封邮件（文件按内容寻址，无需复制）
+func (m *EmailAttachmentModel) CopyToEmail(tx *gorm.DB, fromEmailId, toEmailId int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	var attachments []*EmailAttachment
+	if err := db.Where("email_id = ?", fromEmailId).Order("id ASC").Find(&attachments).Error; err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		attachment.Id = 0
+		attachment.EmailId = toEmailId
+		if err := db.Create(attachment).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteByEmailId 删除邮件的所有附件记录
+func (m *EmailAttachmentModel) DeleteByEmailId(tx *gorm.DB, emailId int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Where("email_id = ?", emailId).Delete(&EmailAttachment{}).Error
+}
+
+// DeleteByMailboxId 删除邮箱下所有邮件的附件记录
+func (m *EmailAttachmentModel) DeleteByMailboxId(tx *gorm.DB, mailboxId int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Where("email_id IN (?)", m.db.Model(&Email{}).Select("id").Where("mailbox_id = ?", mailboxId)).
+		Delete(&EmailAttachment{}).Error
+}
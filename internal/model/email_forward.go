@@ -18,6 +18,14 @@ type EmailForward struct {
 	ForwardAttachments bool       `gorm:"column:forward_attachments;default:1;comment:是否转发附件" json:"forward_attachments"`  // 是否转发附件
 	SubjectPrefix      string     `gorm:"column:subject_prefix;default:[转发];comment:主题前缀" json:"subject_prefix,omitempty"` // 主题前缀
 	Description        string     `gorm:"column:description;comment:描述" json:"description,omitempty"`                      // 描述
+	Conditions         string     `gorm:"column:conditions;type:text;comment:匹配条件(JSON)" json:"conditions,omitempty"`      // 匹配条件(JSON)
+	MatchMode          string     `gorm:"column:match_mode;default:all;comment:条件组合方式" json:"match_mode"`                  // 条件组合方式 all/any
+	StopProcessing     bool       `gorm:"column:stop_processing;default:0;comment:匹配后不再执行后续规则" json:"stop_processing"`     // 匹配后不再执行后续规则
+	Priority           int        `gorm:"column:priority;default:0;comment:执行顺序" json:"priority"`                          // 执行顺序，越小越先执行
+	RateLimit          int        `gorm:"column:rate_limit;default:0;comment:每小时最多转发次数" json:"rate_limit"`                 // 每小时最多转发次数（0使用全局配置）
+	RateWindowStart    *time.Time `gorm:"column:rate_window_start;comment:限流窗口开始时间" json:"-"`                              // 限流窗口开始时间
+	RateWindowCount    int        `gorm:"column:rate_window_count;default:0;comment:限流窗口内的转发次数" json:"-"`                  // 限流窗口内的转发次数
+	DisabledReason     string     `gorm:"column:disabled_reason;comment:自动停用原因" json:"disabled_reason,omitempty"`          // 自动停用原因（手动启用或停用时清空）
 	ForwardCount       int64      `gorm:"column:forward_count;default:0;comment:转发次数" json:"forward_count"`                // 转发次数
 	LastForwardAt      *time.Time `gorm:"column:last_forward_at;comment:最后转发时间" json:"last_forward_at,omitempty"`          // 最后转发时间
 	CreatedAt          time.Time  `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"`      // 创建时间
@@ -187,8 +195,50 @@ func (m *EmailForwardModel) UpdateStatus(tx *gorm.DB, id int64, enabled bool) er
 		db = tx
 	}
 	return db.Model(&EmailForward{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"enabled":    enabled,
-		"updated_at": time.Now(),
+		"enabled":           enabled,
+		"disabled_reason":   "",
+		"rate_window_count": 0,
+		"updated_at":        time.Now(),
+	}).Error
+}
+
+// TakeForwardQuota 在限流窗口内占用一次转发次数，窗口过期时重新计数，超过 limit 时返回false
+func (m *EmailForwardModel) TakeForwardQuota(id int64, limit int, window time.Duration) (bool, error) {
+	allowed := false
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var emailForward EmailForward
+		if err := tx.First(&emailForward, id).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if emailForward.RateWindowStart == nil || now.Sub(*emailForward.RateWindowStart) >= window {
+			allowed = true
+			return tx.Model(&EmailForward{}).Where("id = ?", id).Updates(map[string]interface{}{
+				"rate_window_start": &now,
+				"rate_window_count": 1,
+			}).Error
+		}
+		if emailForward.RateWindowCount >= limit {
+			return nil
+		}
+		allowed = true
+		return tx.Model(&EmailForward{}).Where("id = ?", id).
+			Update("rate_window_count", gorm.Expr("rate_window_count + 1")).Error
+	})
+	return allowed, err
+}
+
+// AutoDisable 自动停用转发规则并记录原因
+func (m *EmailForwardModel) AutoDisable(tx *gorm.DB, id int64, reason string) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&EmailForward{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"enabled":         false,
+		"disabled_reason": reason,
+		"updated_at":      time.Now(),
 	}).Error
 }
 
@@ -207,11 +257,11 @@ func (m *EmailForwardModel) GetEnabledForwardsByMailboxId(mailboxId int64) ([]*E
 	return emailForwards, err
 }
 
-// GetForwardsBySourceEmail 根据源邮箱获取转发规则
+// GetForwardsBySourceEmail 根据源邮箱获取启用的转发规则（按执行顺序）
 func (m *EmailForwardModel) GetForwardsBySourceEmail(sourceEmail string) ([]*EmailForward, error) {
 	var emailForwards []*EmailForward
 	err := m.db.Where("source_email = ? AND enabled = ?", sourceEmail, true).
-		Order("created_at DESC").Find(&emailForwards).Error
+		Order("priority ASC, created_at DESC").Find(&emailForwards).Error
 	return emailForwards, err
 }
 
@@ -312,7 +362,7 @@ func (m *EmailForwardModel) GetForwardsByUserId(userId int64) ([]*EmailForward,
 		Select("ef.*").
 		Joins("JOIN mailbox m ON ef.mailbox_id = m.id").
 		Where("m.user_id = ?", userId).
-		Order("ef.created_at DESC").
+		Order("ef.priority ASC, ef.created_at DESC").
 		Find(&emailForwards).Error
 	return emailForwards, err
 }
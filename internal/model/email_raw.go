@@ -0,0 +1,97 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmailRaw 邮件原文模型（完整的RFC 5322原始报文）
+type EmailRaw struct {
+	Id        int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`               // 数据库主键ID
+	EmailId   int64     `gorm:"column:email_id;uniqueIndex;not null;comment:邮件ID" json:"email_id"`          // 邮件ID
+	Size      int64     `gorm:"column:size;not null;default:0;comment:原文大小(字节)" json:"size"`                // 原文大小(字节)
+	Sha256    string    `gorm:"column:sha256;size:64;not null;comment:原文SHA-256" json:"sha256"`             // 原文SHA-256
+	Content   []byte    `gorm:"column:content;not null;comment:原文内容" json:"-"`                              // 原文内容
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"` // 创建时间
+}
+
+// TableName 指定表名
+func (EmailRaw) TableName() string {
+	return "email_raw"
+}
+
+// EmailRawModel 邮件原文模型
+type EmailRawModel struct {
+	db *gorm.DB
+}
+
+// NewEmailRawModel 创建邮件原文模型
+func NewEmailRawModel(db *gorm.DB) *EmailRawModel {
+	return &EmailRawModel{
+		db: db,
+	}
+}
+
+// Create 创建邮件原文
+func (m *EmailRawModel) Create(tx *gorm.DB, raw *EmailRaw) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Create(raw).Error
+}
+
+// GetByEmailId 根据邮件ID获取原文
+func (m *EmailRawModel) GetByEmailId(emailId int64) (*EmailRaw, error) {
+	var raw EmailRaw
+	if err := m.db.Where("email_id = ?", emailId).First(&raw).Error; err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+// GetMetaByEmailId 根据邮件ID获取原文元信息（不加载内容）
+func (m *EmailRawModel) GetMetaByEmailId(emailId int64) (*EmailRaw, error) {
+	var raw EmailRaw
+	if err := m.db.Select("id", "email_id", "size", "sha256", "created_at").
+		Where("email_id = ?", emailId).First(&raw).Error; err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+// GetSizesByEmailIds 批量获取原文大小
+func (m *EmailRawModel) GetSizesByEmailIds(emailIds []int64) (map[int64]int64, error) {
+	var raws []*EmailRaw
+	sizes := make(map[int64]int64)
+	if len(emailIds) == 0 {
+		return sizes, nil
+	}
+	if err := m.db.Select("email_id", "size").Where("email_id IN ?", emailIds).Find(&raws).Error; err != nil {
+		return nil, err
+	}
+	for _, raw := range raws {
+		sizes[raw.EmailId] = raw.Size
+	}
+	return sizes, nil
+}
+
+// DeleteByEmailId 根据邮件ID删除原文
+func (m *EmailRawModel) DeleteByEmailId(tx *gorm.DB, emailId int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Where("email_id = ?", emailId).Delete(&EmailRaw{}).Error
+}
+
+// DeleteByMailboxId 删除邮箱下所有邮件的原文
+func (m *EmailRawModel) DeleteByMailboxId(tx *gorm.DB, mailboxId int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Where("email_id IN (?)", m.db.Model(&Email{}).Select("id").Where("mailbox_id = ?", mailboxId)).
+		Delete(&EmailRaw{}).Error
+}
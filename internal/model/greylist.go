@@ -0,0 +1,186 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Greylist 灰名单记录（客户端网段、发件人、收件人的组合）
+type Greylist struct {
+	Id        int64      `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                                // 数据库主键ID
+	ClientNet string     `gorm:"column:client_net;uniqueIndex:idx_greylist_triplet;not null;comment:客户端网段" json:"client_net"` // 客户端网段，如 192.0.2.0/24
+	Sender    string     `gorm:"column:sender;uniqueIndex:idx_greylist_triplet;not null;comment:发件人" json:"sender"`           // MAIL FROM（小写，退信为空）
+	Recipient string     `gorm:"column:recipient;uniqueIndex:idx_greylist_triplet;not null;comment:收件人" json:"recipient"`     // RCPT TO（小写）
+	Blocked   int64      `gorm:"column:blocked;not null;default:0;comment:拒绝次数" json:"blocked"`                               // 返回451的次数
+	Passed    int64      `gorm:"column:passed;not null;default:0;comment:通过次数" json:"passed"`                                 // 通过的次数
+	FirstSeen time.Time  `gorm:"column:first_seen;not null;comment:首次投递时间" json:"first_seen"`                                 // 首次投递时间
+	LastSeen  time.Time  `gorm:"column:last_seen;not null;comment:最后投递时间" json:"last_seen"`                                   // 最后投递时间
+	PassedAt  *time.Time `gorm:"column:passed_at;comment:通过时间" json:"passed_at"`                                              // 首次通过的时间，为空表示等待重试
+	ExpiresAt time.Time  `gorm:"column:expires_at;not null;index;comment:过期时间" json:"expires_at"`                             // 过期时间（等待重试的截止时间或免检的截止时间）
+}
+
+// TableName 指定表名
+func (Greylist) TableName() string {
+	return "greylist"
+}
+
+// GreylistWhitelist 灰名单白名单
+type GreylistWhitelist struct {
+	Id        int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                              // 数据库主键ID
+	Type      string    `gorm:"column:type;uniqueIndex:idx_greylist_whitelist;not null;comment:类型(ip/domain)" json:"type"` // 类型：ip（IP或CIDR网段）/domain（发件人域名，包括子域名）
+	Value     string    `gorm:"column:value;uniqueIndex:idx_greylist_whitelist;not null;comment:IP、网段或域名" json:"value"`    // IP、网段或域名
+	Comment   string    `gorm:"column:comment;default:'';comment:备注" json:"comment"`                                       // 备注
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"`                // 创建时间
+}
+
+// TableName 指定表名
+func (GreylistWhitelist) TableName() string {
+	return "greylist_whitelist"
+}
+
+// 灰名单白名单类型
+const (
+	GreylistWhitelistIP     = "ip"
+	GreylistWhitelistDomain = "domain"
+)
+
+// GreylistModel 灰名单模型
+type GreylistModel struct {
+	db *gorm.DB
+}
+
+// NewGreylistModel 创建灰名单模型
+func NewGreylistModel(db *gorm.DB) *GreylistModel {
+	return &GreylistModel{
+		db: db,
+	}
+}
+
+// Check 记录一次投递并判断是否放行：
+// 新的组合（或已过期的）记录首次投递时间并拒绝；等待时间不足时拒绝；等待后重试的放行并在 lifetime 内免检
+func (m *GreylistModel) Check(clientNet, sender, recipient string, delay, retry, lifetime time.Duration) (bool, error) {
+	now := time.Now()
+	passed := false
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var entry Greylist
+		err := tx.Where("client_net = ? AND sender = ? AND recipient = ?", clientNet, sender, recipient).First(&entry).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) || now.After(entry.ExpiresAt) {
+			entry = Greylist{
+				Id:        entry.Id,
+				ClientNet: clientNet,
+				Sender:    sender,
+				Recipient: recipient,
+				Blocked:   1,
+				FirstSeen: now,
+				LastSeen:  now,
+				ExpiresAt: now.Add(retry),
+			}
+			return tx.Save(&entry).Error
+		}
+
+		entry.LastSeen = now
+		switch {
+		case entry.PassedAt != nil:
+			passed = true
+			entry.Passed++
+			entry.ExpiresAt = now.Add(lifetime)
+		case now.Sub(entry.FirstSeen) >= delay:
+			passed = true
+			entry.Passed++
+			entry.PassedAt = &now
+			entry.ExpiresAt = now.Add(lifetime)
+		default:
+			entry.Blocked++
+		}
+		return tx.Save(&entry).Error
+	})
+	return passed, err
+}
+
+// List 获取灰名单记录，passed 为nil时返回全部
+func (m *GreylistModel) List(passed *bool, page, pageSize int) ([]*Greylist, int64, error) {
+	var entries []*Greylist
+	var total int64
+
+	db := m.db.Model(&Greylist{}).Where("expires_at > ?", time.Now())
+	if passed != nil {
+		if *passed {
+			db = db.Where("passed_at IS NOT NULL")
+		} else {
+			db = db.Where("passed_at IS NULL")
+		}
+	}
+
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := db.Order("last_seen DESC").Offset(offset).Limit(pageSize).Find(&entries).Error
+	return entries, total, err
+}
+
+// Delete 删除灰名单记录（下次投递重新计算）
+func (m *GreylistModel) Delete(tx *gorm.DB, id int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	result := db.Delete(&Greylist{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteExpired 删除已过期的灰名单记录
+func (m *GreylistModel) DeleteExpired(tx *gorm.DB) (int64, error) {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	result := db.Where("expires_at < ?", time.Now()).Delete(&Greylist{})
+	return result.RowsAffected, result.Error
+}
+
+// ListWhitelist 获取白名单
+func (m *GreylistModel) ListWhitelist() ([]*GreylistWhitelist, error) {
+	var entries []*GreylistWhitelist
+	err := m.db.Order("type, value").Find(&entries).Error
+	return entries, err
+}
+
+// CreateWhitelist 添加白名单
+func (m *GreylistModel) CreateWhitelist(tx *gorm.DB, entry *GreylistWhitelist) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Create(entry).Error
+}
+
+// DeleteWhitelist 删除白名单
+func (m *GreylistModel) DeleteWhitelist(tx *gorm.DB, id int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	result := db.Delete(&GreylistWhitelist{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
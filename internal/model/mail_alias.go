@@ -0,0 +1,154 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 别名类型
+const (
+	AliasTypeAlias = "alias" // 别名：投递到一个已有邮箱，可以作为该邮箱的发件地址
+	AliasTypeGroup = "group" // 群组：投递时展开为多个本地或外部成员
+)
+
+// MailAlias 邮箱别名和群组地址
+type MailAlias struct {
+	Id        int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`               // 数据库主键ID
+	UserId    *int64    `gorm:"column:user_id;index;comment:普通用户ID" json:"user_id,omitempty"`               // 普通用户ID
+	AdminId   *int64    `gorm:"column:admin_id;index;comment:管理员ID" json:"admin_id,omitempty"`              // 管理员ID
+	Email     string    `gorm:"column:email;uniqueIndex;not null;comment:别名地址" json:"email"`                // 别名地址
+	DomainId  int64     `gorm:"column:domain_id;not null;comment:域名ID" json:"domain_id"`                    // 域名ID
+	Type      string    `gorm:"column:type;not null;default:alias;comment:类型(alias/group)" json:"type"`     // 类型：alias（别名）/group（群组）
+	MailboxId int64     `gorm:"column:mailbox_id;index;default:0;comment:投递的邮箱ID" json:"mailbox_id"`        // 别名投递的邮箱ID（群组为0）
+	Members   string    `gorm:"column:members;type:text;comment:群组成员" json:"members"`                       // 群组成员（逗号分隔的邮箱地址，可以是外部地址）
+	IsActive  bool      `gorm:"column:is_active;default:1;comment:是否激活" json:"is_active"`                   // 是否激活
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"` // 创建时间
+	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"` // 更新时间
+}
+
+// TableName 指定表名
+func (MailAlias) TableName() string {
+	return "mail_alias"
+}
+
+// MemberList 获取群组成员列表
+func (a *MailAlias) MemberList() []string {
+	var members []string
+	for _, member := range strings.Split(a.Members, ",") {
+		if member = strings.TrimSpace(member); member != "" {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// MailAliasModel 邮箱别名模型
+type MailAliasModel struct {
+	db *gorm.DB
+}
+
+// NewMailAliasModel 创建邮箱别名模型
+func NewMailAliasModel(db *gorm.DB) *MailAliasModel {
+	return &MailAliasModel{
+		db: db,
+	}
+}
+
+// Create 创建别名
+func (m *MailAliasModel) Create(tx *gorm.DB, alias *MailAlias) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Create(alias).Error
+}
+
+// MapUpdate 更新别名
+func (m *MailAliasModel) MapUpdate(tx *gorm.DB, id int64, data map[string]interface{}) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&MailAlias{}).Where("id = ?", id).Updates(data).Error
+}
+
+// Delete 删除别名
+func (m *MailAliasModel) Delete(tx *gorm.DB, id int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Delete(&MailAlias{}, id).Error
+}
+
+// DeleteByMailboxId 删除投递到指定邮箱的别名
+func (m *MailAliasModel) DeleteByMailboxId(tx *gorm.DB, mailboxId int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Where("mailbox_id = ? AND type = ?", mailboxId, AliasTypeAlias).Delete(&MailAlias{}).Error
+}
+
+// DeleteByUserId 删除用户的所有别名和群组
+func (m *MailAliasModel) DeleteByUserId(tx *gorm.DB, userId int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Where("user_id = ?", userId).Delete(&MailAlias{}).Error
+}
+
+// GetById 根据ID获取别名
+func (m *MailAliasModel) GetById(id int64) (*MailAlias, error) {
+	var alias MailAlias
+	if err := m.db.First(&alias, id).Error; err != nil {
+		return nil, err
+	}
+	return &alias, nil
+}
+
+// GetByEmail 根据地址获取别名
+func (m *MailAliasModel) GetByEmail(email string) (*MailAlias, error) {
+	var alias MailAlias
+	if err := m.db.Where("email = ?", email).First(&alias).Error; err != nil {
+		return nil, err
+	}
+	return &alias, nil
+}
+
+// CheckEmailExist 检查地址是否已被别名使用
+func (m *MailAliasModel) CheckEmailExist(email string) (bool, error) {
+	var count int64
+	err := m.db.Model(&MailAlias{}).Where("email = ?", email).Count(&count).Error
+	return count > 0, err
+}
+
+// GetByOwner 获取用户（或管理员）的别名列表
+func (m *MailAliasModel) GetByOwner(ownerId int64, isAdmin bool) ([]*MailAlias, error) {
+	var aliases []*MailAlias
+	db := m.db.Model(&MailAlias{})
+	if isAdmin {
+		db = db.Where("admin_id = ?", ownerId)
+	} else {
+		db = db.Where("user_id = ?", ownerId)
+	}
+	err := db.Order("created_at DESC").Find(&aliases).Error
+	return aliases, err
+}
+
+// GetAll 获取所有别名（管理员）
+func (m *MailAliasModel) GetAll() ([]*MailAlias, error) {
+	var aliases []*MailAlias
+	err := m.db.Order("created_at DESC").Find(&aliases).Error
+	return aliases, err
+}
+
+// CountByUserId 统计用户的别名数量
+func (m *MailAliasModel) CountByUserId(userId int64) (int64, error) {
+	var count int64
+	err := m.db.Model(&MailAlias{}).Where("user_id = ?", userId).Count(&count).Error
+	return count, err
+}
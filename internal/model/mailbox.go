@@ -1,6 +1,8 @@
 package model
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -26,7 +28,8 @@ func (Mailbox) TableName() string {
 
 // MailboxModel 邮箱模型
 type MailboxModel struct {
-	db *gorm.DB
+	db                  *gorm.DB
+	subaddressSeparator string // 子地址分隔符（RFC 5233），为空时不支持子地址
 }
 
 // NewMailboxModel 创建邮箱模型
@@ -36,6 +39,24 @@ func NewMailboxModel(db *gorm.DB) *MailboxModel {
 	}
 }
 
+// SetSubaddressSeparator 设置子地址分隔符（可以有多个字符，任一字符都作为分隔符）
+func (m *MailboxModel) SetSubaddressSeparator(separator string) {
+	m.subaddressSeparator = separator
+}
+
+// SplitSubaddress 拆分子地址 user+tag@domain，返回 user@domain 和 tag；不是子地址时返回原地址和空标签
+func (m *MailboxModel) SplitSubaddress(email string) (string, string) {
+	at := strings.LastIndexByte(email, '@')
+	if m.subaddressSeparator == "" || at <= 0 {
+		return email, ""
+	}
+	i := strings.IndexAny(email[:at], m.subaddressSeparator)
+	if i <= 0 {
+		return email, ""
+	}
+	return email[:i] + email[at:], email[i+1 : at]
+}
+
 // Create 创建邮箱
 func (m *MailboxModel) Create(tx *gorm.DB, mailbox *Mailbox) error {
 	db := m.db
@@ -298,7 +319,14 @@ func (m *MailboxModel) GetByEmailAndPassword(email, password string) (*Mailbox,
 // GetIdByEmail 根据邮箱地址获取邮箱ID
 func (m *MailboxModel) GetIdByEmail(email string) (int64, error) {
 	var mailbox Mailbox
-	if err := m.db.Select("id").Where("email = ? AND is_active = ?", email, true).First(&mailbox).Error; err != nil {
+	err := m.db.Select("id").Where("email = ? AND is_active = ?", email, true).First(&mailbox).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 子地址 user+tag@domain 使用 user@domain 的邮箱
+		if base, _ := m.SplitSubaddress(email); base != email {
+			err = m.db.Select("id").Where("email = ? AND is_active = ?", base, true).First(&mailbox).Error
+		}
+	}
+	if err != nil {
 		return 0, err
 	}
 	return mailbox.Id, nil
@@ -311,6 +339,12 @@ func (m *MailboxModel) CheckEmailExists(email string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if count == 0 {
+		// 子地址 user+tag@domain 使用 user@domain 的邮箱
+		if base, _ := m.SplitSubaddress(email); base != email {
+			return m.CheckEmailExists(base)
+		}
+	}
 	return count > 0, nil
 }
 
@@ -0,0 +1,170 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MailboxFolder 邮箱文件夹模型（记录IMAP的UIDVALIDITY、UIDNEXT和订阅状态，用户自定义文件夹也保存在此表）
+type MailboxFolder struct {
+	Id          int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                                  // 数据库主键ID
+	MailboxId   int64     `gorm:"column:mailbox_id;not null;uniqueIndex:idx_mailbox_folder_name;comment:邮箱ID" json:"mailbox_id"` // 邮箱ID
+	Name        string    `gorm:"column:name;not null;uniqueIndex:idx_mailbox_folder_name;comment:文件夹名" json:"name"`             // 文件夹名（与email.folder一致）
+	UidValidity int64     `gorm:"column:uid_validity;not null;comment:UIDVALIDITY" json:"uid_validity"`                          // UIDVALIDITY
+	UidNext     int64     `gorm:"column:uid_next;not null;default:1;comment:下一个UID" json:"uid_next"`                             // 下一个UID
+	Subscribed  bool      `gorm:"column:subscribed;not null;default:true;comment:是否订阅" json:"subscribed"`                        // 是否订阅（LSUB）
+	CreatedAt   time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"`                    // 创建时间
+	UpdatedAt   time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"`                    // 更新时间
+}
+
+// TableName 指定表名
+func (MailboxFolder) TableName() string {
+	return "mailbox_folder"
+}
+
+// MailboxFolderModel 邮箱文件夹模型
+type MailboxFolderModel struct {
+	db *gorm.DB
+	mu sync.Mutex // 串行化UID分配，保证同一文件夹内UID严格递增
+}
+
+// NewMailboxFolderModel 创建邮箱文件夹模型
+func NewMailboxFolderModel(db *gorm.DB) *MailboxFolderModel {
+	return &MailboxFolderModel{
+		db: db,
+	}
+}
+
+// GetOrCreate 获取文件夹状态，不存在时创建
+func (m *MailboxFolderModel) GetOrCreate(mailboxId int64, name string) (*MailboxFolder, error) {
+	var folder MailboxFolder
+	err := m.db.Where("mailbox_id = ? AND name = ?", mailboxId, name).First(&folder).Error
+	if err == nil {
+		return &folder, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	folder = MailboxFolder{
+		MailboxId:   mailboxId,
+		Name:        name,
+		UidValidity: time.Now().Unix(),
+		UidNext:     1,
+		Subscribed:  true,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if err := m.db.Create(&folder).Error; err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// GetByName 根据文件夹名获取文件夹
+func (m *MailboxFolderModel) GetByName(mailboxId int64, name string) (*MailboxFolder, error) {
+	var folder MailboxFolder
+	if err := m.db.Where("mailbox_id = ? AND name = ?", mailboxId, name).First(&folder).Error; err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// GetByMailboxId 获取邮箱的所有文件夹
+func (m *MailboxFolderModel) GetByMailboxId(mailboxId int64) ([]*MailboxFolder, error) {
+	var folders []*MailboxFolder
+	err := m.db.Where("mailbox_id = ?", mailboxId).Order("name ASC").Find(&folders).Error
+	return folders, err
+}
+
+// Create 创建文件夹
+func (m *MailboxFolderModel) Create(tx *gorm.DB, folder *MailboxFolder) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Create(folder).Error
+}
+
+// Rename 重命名文件夹
+func (m *MailboxFolderModel) Rename(tx *gorm.DB, id int64, name string) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&MailboxFolder{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"name":       name,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// Delete 删除文件夹
+func (m *MailboxFolderModel) Delete(tx *gorm.DB, id int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Where("id = ?", id).Delete(&MailboxFolder{}).Error
+}
+
+// SetSubscribed 设置文件夹订阅状态
+func (m *MailboxFolderModel) SetSubscribed(id int64, subscribed bool) error {
+	return m.db.Model(&MailboxFolder{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"subscribed": subscribed,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// AssignUids 为文件夹中尚未分配UID的邮件按到达顺序分配UID，返回最新的文件夹状态
+func (m *MailboxFolderModel) AssignUids(mailboxId int64, name string) (*MailboxFolder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	folder, err := m.GetOrCreate(mailboxId, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	if err := m.db.Model(&Email{}).
+		Where("mailbox_id = ? AND folder = ? AND uid = 0", mailboxId, name).
+		Order("id ASC").Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return folder, nil
+	}
+
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		uid := folder.UidNext
+		for _, id := range ids {
+			if err := tx.Model(&Email{}).Where("id = ?", id).Update("uid", uid).Error; err != nil {
+				return err
+			}
+			uid++
+		}
+		folder.UidNext = uid
+		folder.UpdatedAt = time.Now()
+		return tx.Model(&MailboxFolder{}).Where("id = ?", folder.Id).Updates(map[string]interface{}{
+			"uid_next":   folder.UidNext,
+			"updated_at": folder.UpdatedAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return folder, nil
+}
+
+// DeleteByMailboxId 删除邮箱的所有文件夹状态
+func (m *MailboxFolderModel) DeleteByMailboxId(tx *gorm.DB, mailboxId int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Where("mailbox_id = ?", mailboxId).Delete(&MailboxFolder{}).Error
+}
@@ -0,0 +1,306 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutboundMessage 出站队列中的邮件（保存完整报文，按收件人分别投递）
+type OutboundMessage struct {
+	Id         int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                 // 数据库主键ID
+	MessageId  string    `gorm:"column:message_id;index;comment:Message-ID" json:"message_id"`                 // 邮件头中的Message-ID
+	MailboxId  int64     `gorm:"column:mailbox_id;index;comment:发件邮箱ID" json:"mailbox_id"`                     // 发件邮箱ID（0表示不是本地邮箱）
+	Sender     string    `gorm:"column:sender;comment:信封发件人" json:"sender"`                                    // 信封发件人（MAIL FROM，退信发送到此地址）
+	Subject    string    `gorm:"column:subject;comment:主题" json:"subject"`                                     // 主题
+	Content    []byte    `gorm:"column:content;type:blob;not null;comment:邮件原文" json:"-"`                      // 邮件原文
+	Size       int64     `gorm:"column:size;not null;default:0;comment:原文大小(字节)" json:"size"`                  // 原文大小(字节)
+	Status     string    `gorm:"column:status;index;not null;default:queued;comment:状态" json:"status"`         // 状态：queued/delivered/failed
+	BounceSent bool      `gorm:"column:bounce_sent;not null;default:false;comment:是否已发送退信" json:"bounce_sent"` // 是否已发送退信（DSN）
+	CreatedAt  time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"`   // 创建时间
+	UpdatedAt  time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"`   // 更新时间
+}
+
+// TableName 指定表名
+func (OutboundMessage) TableName() string {
+	return "outbound_message"
+}
+
+// OutboundRecipient 出站队列中每个收件人的投递状态
+type OutboundRecipient struct {
+	Id            int64      `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                                    // 数据库主键ID
+	QueueId       int64      `gorm:"column:queue_id;index;not null;comment:队列邮件ID" json:"queue_id"`                                   // 队列邮件ID
+	Recipient     string     `gorm:"column:recipient;not null;comment:收件人" json:"recipient"`                                          // 收件人
+	Status        string     `gorm:"column:status;index:idx_outbound_recipient_due;not null;default:queued;comment:状态" json:"status"` // 状态：queued/sending/deferred/delivered/failed
+	Attempts      int        `gorm:"column:attempts;not null;default:0;comment:投递次数" json:"attempts"`                                 // 投递次数
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;index:idx_outbound_recipient_due;comment:下次投递时间" json:"next_attempt_at"`   // 下次投递时间
+	LastAttemptAt *time.Time `gorm:"column:last_attempt_at;comment:最后一次投递时间" json:"last_attempt_at"`                                  // 最后一次投递时间
+	RemoteMta     string     `gorm:"column:remote_mta;comment:远程服务器" json:"remote_mta,omitempty"`                                     // 远程服务器
+	StatusCode    string     `gorm:"column:status_code;comment:增强状态码" json:"status_code,omitempty"`                                   // 增强状态码（RFC 3463），如 5.1.1
+	LastError     string     `gorm:"column:last_error;comment:最后一次错误" json:"last_error,omitempty"`                                    // 最后一次错误（远程服务器的响应）
+	DeliveredAt   *time.Time `gorm:"column:delivered_at;comment:投递成功时间" json:"delivered_at"`                                          // 投递成功时间
+	CreatedAt     time.Time  `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"`                      // 创建时间
+	UpdatedAt     time.Time  `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"`                      // 更新时间
+}
+
+// TableName 指定表名
+func (OutboundRecipient) TableName() string {
+	return "outbound_recipient"
+}
+
+// 出站队列状态
+const (
+	OutboundStatusQueued    = "queued"    // 等待投递
+	OutboundStatusSending   = "sending"   // 正在投递
+	OutboundStatusDeferred  = "deferred"  // 临时失败，等待重试
+	OutboundStatusDelivered = "delivered" // 投递成功
+	OutboundStatusFailed    = "failed"    // 永久失败（已退信）
+)
+
+// OutboundQueueModel 出站队列模型
+type OutboundQueueModel struct {
+	db *gorm.DB
+}
+
+// NewOutboundQueueModel 创建出站队列模型
+func NewOutboundQueueModel(db *gorm.DB) *OutboundQueueModel {
+	return &OutboundQueueModel{
+		db: db,
+	}
+}
+
+// Enqueue 在同一事务中保存邮件和收件人
+func (m *OutboundQueueModel) Enqueue(message *OutboundMessage, recipients []string) ([]*OutboundRecipient, error) {
+	now := time.Now()
+	message.Status = OutboundStatusQueued
+	message.Size = int64(len(message.Content))
+	message.CreatedAt = now
+	message.UpdatedAt = now
+
+	var created []*OutboundRecipient
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		for _, recipient := range recipients {
+			created = append(created, &OutboundRecipient{
+				QueueId:       message.Id,
+				Recipient:     recipient,
+				Status:        OutboundStatusQueued,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			})
+		}
+		return tx.Create(&created).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetMessage 根据ID获取队列邮件
+func (m *OutboundQueueModel) GetMessage(id int64) (*OutboundMessage, error) {
+	var message OutboundMessage
+	if err := m.db.First(&message, id).Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetRecipients 获取队列邮件的所有收件人
+func (m *OutboundQueueModel) GetRecipients(queueId int64) ([]*OutboundRecipient, error) {
+	var recipients []*OutboundRecipient
+	err := m.db.Where("queue_id = ?", queueId).Order("id").Find(&recipients).Error
+	return recipients, err
+}
+
+// ClaimDue 领取到期需要投递的收件人（状态改为sending，多个协程同时领取时每条只会被领取一次）
+func (m *OutboundQueueModel) ClaimDue(now time.Time, limit int) ([]*OutboundRecipient, error) {
+	var due []*OutboundRecipient
+	err := m.db.Where("status IN ? AND next_attempt_at <= ?", []string{OutboundStatusQueued, OutboundStatusDeferred}, now).
+		Order("next_attempt_at").Limit(limit).Find(&due).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []*OutboundRecipient
+	for _, recipient := range due {
+		res := m.db.Model(&OutboundRecipient{}).
+			Where("id = ? AND status = ?", recipient.Id, recipient.Status).
+			Updates(map[string]interface{}{
+				"status":     OutboundStatusSending,
+				"updated_at": now,
+			})
+		if res.Error != nil {
+			return claimed, res.Error
+		}
+		if res.RowsAffected == 1 {
+			recipient.Status = OutboundStatusSending
+			claimed = append(claimed, recipient)
+		}
+	}
+	return claimed, nil
+}
+
+// ResetSending 将中断的投递（进程退出时仍为sending）恢复为等待重试
+func (m *OutboundQueueModel) ResetSending() error {
+	return m.db.Model(&OutboundRecipient{}).
+		Where("status = ?", OutboundStatusSending).
+		Updates(map[string]interface{}{
+			"status":     OutboundStatusDeferred,
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// SaveRecipient 保存收件人投递状态
+func (m *OutboundQueueModel) SaveRecipient(tx *gorm.DB, recipient *OutboundRecipient) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	recipient.UpdatedAt = time.Now()
+	return db.Save(recipient).Error
+}
+
+// FinishMessage 所有收件人都已结束时更新邮件状态，返回是否由本次调用完成（用于保证退信只发送一次）
+func (m *OutboundQueueModel) FinishMessage(id int64, status string) (bool, error) {
+	res := m.db.Model(&OutboundMessage{}).
+		Where("id = ? AND status = ?", id, OutboundStatusQueued).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"updated_at": time.Now(),
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// MarkBounceSent 标记已发送退信
+func (m *OutboundQueueModel) MarkBounceSent(id int64) error {
+	return m.db.Model(&OutboundMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"bounce_sent": true,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+// OutboundQueueItem 管理页面中的队列邮件（含每个收件人的投递状态）
+type OutboundQueueItem struct {
+	*OutboundMessage
+	Recipients []*OutboundRecipient `json:"recipients"`
+}
+
+// ListMessages 分页获取包含指定状态收件人的队列邮件，statuses 为空时返回所有邮件
+func (m *OutboundQueueModel) ListMessages(statuses []string, page, pageSize int) ([]*OutboundQueueItem, int64, error) {
+	db := m.db.Model(&OutboundMessage{})
+	if len(statuses) > 0 {
+		db = db.Where("id IN (?)", m.db.Model(&OutboundRecipient{}).Select("queue_id").Where("status IN ?", statuses))
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var messages []*OutboundMessage
+	if err := db.Omit("content").Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&messages).Error; err != nil {
+		return nil, 0, err
+	}
+	if len(messages) == 0 {
+		return []*OutboundQueueItem{}, total, nil
+	}
+
+	ids := make([]int64, 0, len(messages))
+	items := make([]*OutboundQueueItem, 0, len(messages))
+	byId := make(map[int64]*OutboundQueueItem, len(messages))
+	for _, message := range messages {
+		item := &OutboundQueueItem{OutboundMessage: message, Recipients: []*OutboundRecipient{}}
+		ids = append(ids, message.Id)
+		items = append(items, item)
+		byId[message.Id] = item
+	}
+
+	var recipients []*OutboundRecipient
+	if err := m.db.Where("queue_id IN ?", ids).Order("id").Find(&recipients).Error; err != nil {
+		return nil, 0, err
+	}
+	for _, recipient := range recipients {
+		if item, ok := byId[recipient.QueueId]; ok {
+			item.Recipients = append(item.Recipients, recipient)
+		}
+	}
+	return items, total, nil
+}
+
+// CountRecipientsByStatus 按状态统计收件人数量
+func (m *OutboundQueueModel) CountRecipientsByStatus() (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := m.db.Model(&OutboundRecipient{}).Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int64{
+		OutboundStatusQueued:    0,
+		OutboundStatusSending:   0,
+		OutboundStatusDeferred:  0,
+		OutboundStatusDelivered: 0,
+		OutboundStatusFailed:    0,
+	}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// RetryNow 将等待投递的收件人的下次投递时间改为现在，返回受影响的收件人数量
+func (m *OutboundQueueModel) RetryNow(queueId int64) (int64, error) {
+	res := m.db.Model(&OutboundRecipient{}).
+		Where("queue_id = ? AND status IN ?", queueId, []string{OutboundStatusQueued, OutboundStatusDeferred}).
+		Updates(map[string]interface{}{
+			"next_attempt_at": time.Now(),
+			"updated_at":      time.Now(),
+		})
+	return res.RowsAffected, res.Error
+}
+
+// FailPending 将等待投递的收件人直接标记为永久失败（正在投递的收件人不受影响），返回受影响的收件人数量
+func (m *OutboundQueueModel) FailPending(queueId int64, statusCode, lastError string) (int64, error) {
+	res := m.db.Model(&OutboundRecipient{}).
+		Where("queue_id = ? AND status IN ?", queueId, []string{OutboundStatusQueued, OutboundStatusDeferred}).
+		Updates(map[string]interface{}{
+			"status":      OutboundStatusFailed,
+			"status_code": statusCode,
+			// 保留最后一次投递的错误，便于在退信中说明
+			"last_error": gorm.Expr("CASE WHEN last_error = '' OR last_error IS NULL THEN ? ELSE ? || last_error END", lastError, lastError+"，最后一次错误: "),
+			"updated_at": time.Now(),
+		})
+	return res.RowsAffected, res.Error
+}
+
+// CountSending 统计正在投递的收件人数量
+func (m *OutboundQueueModel) CountSending(tx *gorm.DB, queueId int64) (int64, error) {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	var count int64
+	err := db.Model(&OutboundRecipient{}).
+		Where("queue_id = ? AND status = ?", queueId, OutboundStatusSending).
+		Count(&count).Error
+	return count, err
+}
+
+// DeleteMessage 删除队列邮件及其收件人
+func (m *OutboundQueueModel) DeleteMessage(tx *gorm.DB, id int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	if err := db.Where("queue_id = ?", id).Delete(&OutboundRecipient{}).Error; err != nil {
+		return err
+	}
+	return db.Where("id = ?", id).Delete(&OutboundMessage{}).Error
+}
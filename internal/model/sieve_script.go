@@ -0,0 +1,170 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SieveScript 邮箱的Sieve过滤脚本（每个邮箱最多一个启用的脚本）
+type SieveScript struct {
+	Id        int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                                // 数据库主键ID
+	MailboxId int64     `gorm:"column:mailbox_id;not null;uniqueIndex:idx_sieve_script_name;comment:邮箱ID" json:"mailbox_id"` // 邮箱ID
+	Name      string    `gorm:"column:name;not null;uniqueIndex:idx_sieve_script_name;comment:脚本名" json:"name"`              // 脚本名
+	Content   string    `gorm:"column:content;type:text;comment:脚本内容" json:"content"`                                        // 脚本内容
+	IsActive  bool      `gorm:"column:is_active;not null;default:0;comment:是否启用" json:"is_active"`                           // 是否启用
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:创建时间" json:"created_at"`                  // 创建时间
+	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP;comment:更新时间" json:"updated_at"`                  // 更新时间
+}
+
+// TableName 指定表名
+func (SieveScript) TableName() string {
+	return "sieve_script"
+}
+
+// SieveVacation 自动回复记录（同一邮箱、发件人、回复标识在 :days 内只回复一次）
+type SieveVacation struct {
+	Id        int64     `gorm:"column:id;primaryKey;autoIncrement;comment:数据库主键ID" json:"id"`                             // 数据库主键ID
+	MailboxId int64     `gorm:"column:mailbox_id;not null;uniqueIndex:idx_sieve_vacation;comment:邮箱ID" json:"mailbox_id"` // 邮箱ID
+	Sender    string    `gorm:"column:sender;not null;uniqueIndex:idx_sieve_vacation;comment:回复的发件人" json:"sender"`       // 回复的发件人（小写）
+	Handle    string    `gorm:"column:handle;not null;uniqueIndex:idx_sieve_vacation;comment:回复标识" json:"handle"`         // vacation 的 :handle（未指定时按回复内容生成）
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index;comment:过期时间" json:"expires_at"`                          // 过期后可以再次回复
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP;comment:回复时间" json:"created_at"`               // 回复时间
+}
+
+// TableName 指定表名
+func (SieveVacation) TableName() string {
+	return "sieve_vacation"
+}
+
+// SieveScriptModel Sieve脚本模型
+type SieveScriptModel struct {
+	db *gorm.DB
+}
+
+// NewSieveScriptModel 创建Sieve脚本模型
+func NewSieveScriptModel(db *gorm.DB) *SieveScriptModel {
+	return &SieveScriptModel{
+		db: db,
+	}
+}
+
+// Create 创建脚本
+func (m *SieveScriptModel) Create(tx *gorm.DB, script *SieveScript) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Create(script).Error
+}
+
+// MapUpdate 更新脚本
+func (m *SieveScriptModel) MapUpdate(tx *gorm.DB, id int64, data map[string]interface{}) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Model(&SieveScript{}).Where("id = ?", id).Updates(data).Error
+}
+
+// Delete 删除脚本
+func (m *SieveScriptModel) Delete(tx *gorm.DB, id int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	return db.Delete(&SieveScript{}, id).Error
+}
+
+// DeleteByMailboxId 删除邮箱的所有脚本和自动回复记录
+func (m *SieveScriptModel) DeleteByMailboxId(tx *gorm.DB, mailboxId int64) error {
+	db := m.db
+	if tx != nil {
+		db = tx
+	}
+	if err := db.Where("mailbox_id = ?", mailboxId).Delete(&SieveScript{}).Error; err != nil {
+		return err
+	}
+	return db.Where("mailbox_id = ?", mailboxId).Delete(&SieveVacation{}).Error
+}
+
+// GetByName 获取邮箱的指定脚本
+func (m *SieveScriptModel) GetByName(mailboxId int64, name string) (*SieveScript, error) {
+	var script SieveScript
+	if err := m.db.Where("mailbox_id = ? AND name = ?", mailboxId, name).First(&script).Error; err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+// GetByMailboxId 获取邮箱的所有脚本
+func (m *SieveScriptModel) GetByMailboxId(mailboxId int64) ([]*SieveScript, error) {
+	var scripts []*SieveScript
+	err := m.db.Where("mailbox_id = ?", mailboxId).Order("name").Find(&scripts).Error
+	return scripts, err
+}
+
+// GetActive 获取邮箱启用的脚本，没有时返回 gorm.ErrRecordNotFound
+func (m *SieveScriptModel) GetActive(mailboxId int64) (*SieveScript, error) {
+	var script SieveScript
+	if err := m.db.Where("mailbox_id = ? AND is_active = ?", mailboxId, true).First(&script).Error; err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+// CountByMailboxId 统计邮箱的脚本数量
+func (m *SieveScriptModel) CountByMailboxId(mailboxId int64) (int64, error) {
+	var count int64
+	err := m.db.Model(&SieveScript{}).Where("mailbox_id = ?", mailboxId).Count(&count).Error
+	return count, err
+}
+
+// SetActive 启用指定脚本并停用邮箱的其他脚本，id 为0时停用所有脚本
+func (m *SieveScriptModel) SetActive(mailboxId, id int64) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&SieveScript{}).Where("mailbox_id = ? AND is_active = ?", mailboxId, true).
+			Updates(map[string]interface{}{"is_active": false, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		if id == 0 {
+			return nil
+		}
+		return tx.Model(&SieveScript{}).Where("id = ? AND mailbox_id = ?", id, mailboxId).
+			Updates(map[string]interface{}{"is_active": true, "updated_at": time.Now()}).Error
+	})
+}
+
+// RecordVacation 记录一次自动回复，同一邮箱、发件人、回复标识未过期时返回false（不应再回复）
+// 同时删除该邮箱已过期的记录
+func (m *SieveScriptModel) RecordVacation(mailboxId int64, sender, handle string, period time.Duration) (bool, error) {
+	now := time.Now()
+	reply := false
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("mailbox_id = ? AND expires_at < ?", mailboxId, now).Delete(&SieveVacation{}).Error; err != nil {
+			return err
+		}
+
+		var entry SieveVacation
+		err := tx.Where("mailbox_id = ? AND sender = ? AND handle = ?", mailboxId, sender, handle).First(&entry).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		reply = true
+		entry = SieveVacation{
+			MailboxId: mailboxId,
+			Sender:    sender,
+			Handle:    handle,
+			ExpiresAt: now.Add(period),
+			CreatedAt: now,
+		}
+		return tx.Save(&entry).Error
+	})
+	return reply, err
+}
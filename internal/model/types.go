@@ -66,6 +66,7 @@ type EmailReq struct {
 	MailboxId int64     `json:"mailbox_id"`
 	FromAddr  string    `json:"from_addr"`
 	ToAddr    string    `json:"to_addr"`
+	Tag       string    `json:"tag"`
 	Subject   string    `json:"subject"`
 	Body      string    `json:"body"`
 	IsRead    *bool     `json:"is_read"`
@@ -2,6 +2,7 @@ package server
 
 import (
 	"database/sql"
+	"log"
 	"miko-email/internal/config"
 	"miko-email/internal/handlers"
 	"miko-email/internal/middleware"
@@ -13,6 +14,7 @@ import (
 	"miko-email/internal/services/mailbox"
 	"miko-email/internal/services/user"
 	"miko-email/internal/svc"
+	"net"
 	"net/http"
 	"strings"
 
@@ -27,6 +29,7 @@ type Server struct {
 	sessionStore   *sessions.CookieStore
 	emailService   *email.Service
 	forwardService *forward.Service
+	svcCtx         *svc.ServiceContext
 }
 
 func New(db *sql.DB, cfg *config.Config, svcCtx *svc.ServiceContext) *Server {
@@ -36,7 +39,7 @@ func New(db *sql.DB, cfg *config.Config, svcCtx *svc.ServiceContext) *Server {
 		Path:     "/",
 		MaxAge:   86400 * 7, // 7天
 		HttpOnly: true,
-		Secure:   false, // 在生产环境中应该设置为true
+		Secure:   config.IsHTTPSEnabled(), // 启用HTTPS时只通过HTTPS发送Cookie
 		SameSite: http.SameSiteLaxMode,
 	}
 
@@ -53,6 +56,7 @@ func New(db *sql.DB, cfg *config.Config, svcCtx *svc.ServiceContext) *Server {
 		sessionStore:   sessionStore,
 		emailService:   emailService,
 		forwardService: forwardService,
+		svcCtx:         svcCtx,
 	}
 
 	server.setupRoutes(svcCtx)
@@ -76,16 +80,22 @@ func (s *Server) setupRoutes(svcCtx *svc.ServiceContext) {
 	authService := auth.NewService(svcCtx)
 	mailboxService := mailbox.NewService(svcCtx)
 	domainService := domain.NewService(svcCtx)
-	dkimService := dkim.NewService("./dkim_keys")
+	dkimService := dkim.NewService(svcCtx, "./dkim_keys")
 	userService := user.NewService(svcCtx)
 
 	// 创建处理器实例
 	authHandler := handlers.NewAuthHandler(authService, s.sessionStore, svcCtx)
 	mailboxHandler := handlers.NewMailboxHandler(mailboxService, s.sessionStore, svcCtx)
+	aliasHandler := handlers.NewAliasHandler(mailboxService, svcCtx)
 	domainHandler := handlers.NewDomainHandler(domainService, dkimService, s.sessionStore, svcCtx)
 	userHandler := handlers.NewUserHandler(userService, s.sessionStore, svcCtx)
 	emailHandler := handlers.NewEmailHandler(s.emailService, mailboxService, s.forwardService, s.sessionStore, svcCtx)
 	webHandler := handlers.NewWebHandler(s.sessionStore, svcCtx)
+	acmeHandler := handlers.NewACMEHandler(svcCtx)
+	queueHandler := handlers.NewQueueHandler(s.emailService, svcCtx)
+	dnsblHandler := handlers.NewDNSBLHandler(svcCtx)
+	greylistHandler := handlers.NewGreylistHandler(svcCtx)
+	sieveHandler := handlers.NewSieveHandler(svcCtx)
 
 	// 中间件
 	authMiddleware := middleware.NewAuthMiddleware(s.sessionStore)
@@ -95,6 +105,9 @@ func (s *Server) setupRoutes(svcCtx *svc.ServiceContext) {
 	s.router.Static("/static", "./web/static")
 	s.router.LoadHTMLGlob("web/templates/*")
 
+	// ACME HTTP-01验证
+	s.router.GET("/.well-known/acme-challenge/:token", acmeHandler.HTTPChallenge)
+
 	// Web页面路由
 	web := s.router.Group("/")
 	{
@@ -124,6 +137,8 @@ func (s *Server) setupRoutes(svcCtx *svc.ServiceContext) {
 			webAdmin.GET("/users", webHandler.UsersPage)
 			webAdmin.GET("/mailboxes", webHandler.AdminMailboxesPage)
 			webAdmin.GET("/domains", webHandler.DomainsPage)
+			webAdmin.GET("/queue", webHandler.QueuePage)
+			webAdmin.GET("/dnsbl", webHandler.DNSBLPage)
 		}
 	}
 
@@ -152,11 +167,31 @@ func (s *Server) setupRoutes(svcCtx *svc.ServiceContext) {
 			apiAuth.DELETE("/mailboxes/:id", mailboxHandler.DeleteMailbox)
 			apiAuth.GET("/mailboxes/stats", mailboxHandler.GetUserStats)
 
+			// 别名和群组
+			apiAuth.GET("/aliases", aliasHandler.GetAliases)
+			apiAuth.POST("/aliases", aliasHandler.CreateAlias)
+			apiAuth.PUT("/aliases/:id", aliasHandler.UpdateAlias)
+			apiAuth.DELETE("/aliases/:id", aliasHandler.DeleteAlias)
+
+			// Sieve过滤脚本
+			apiAuth.GET("/mailboxes/:id/sieve", sieveHandler.GetSieveScripts)
+			apiAuth.POST("/mailboxes/:id/sieve/deactivate", sieveHandler.DeactivateSieveScript)
+			apiAuth.GET("/mailboxes/:id/sieve/:name", sieveHandler.GetSieveScript)
+			apiAuth.PUT("/mailboxes/:id/sieve/:name", sieveHandler.PutSieveScript)
+			apiAuth.DELETE("/mailboxes/:id/sieve/:name", sieveHandler.DeleteSieveScript)
+			apiAuth.POST("/mailboxes/:id/sieve/:name/activate", sieveHandler.ActivateSieveScript)
+			apiAuth.POST("/mailboxes/:id/sieve/:name/rename", sieveHandler.RenameSieveScript)
+			apiAuth.POST("/sieve/check", sieveHandler.CheckSieveScript)
+
 			// 邮件相关
 			apiAuth.GET("/emails", emailHandler.GetEmails)
 			apiAuth.GET("/emails/:id", emailHandler.GetEmailByID)
+			apiAuth.GET("/emails/:id/raw", emailHandler.ExportEmail)
+			apiAuth.GET("/emails/:id/attachments", emailHandler.GetEmailAttachments)
+			apiAuth.GET("/emails/:id/attachments/:aid", emailHandler.DownloadEmailAttachment)
 			apiAuth.POST("/emails/send", emailHandler.SendEmail)
 			apiAuth.DELETE("/emails/:id", emailHandler.DeleteEmail)
+			apiAuth.POST("/emails/:id/spam", emailHandler.MarkSpam)
 
 			// 转发规则相关
 			apiAuth.GET("/forward-rules", emailHandler.GetForwardRules)
@@ -184,6 +219,20 @@ func (s *Server) setupRoutes(svcCtx *svc.ServiceContext) {
 			apiAdmin.POST("/domains/:id/verify", domainHandler.VerifyDomain)
 			apiAdmin.POST("/domains/:id/verify-sender", domainHandler.VerifySenderConfiguration)
 			apiAdmin.POST("/domains/:id/verify-receiver", domainHandler.VerifyReceiverConfiguration)
+			apiAdmin.PUT("/domains/:id/dkim", domainHandler.UpdateDKIMHeaders)
+			apiAdmin.GET("/domains/:id/dkim/keys", domainHandler.GetDKIMKeys)
+			apiAdmin.POST("/domains/:id/dkim/keys", domainHandler.CreateDKIMKey)
+			apiAdmin.POST("/domains/:id/dkim/keys/:kid/activate", domainHandler.ActivateDKIMKey)
+			apiAdmin.DELETE("/domains/:id/dkim/keys/:kid", domainHandler.RetireDKIMKey)
+			apiAdmin.PUT("/domains/:id/spam", domainHandler.UpdateSpamSettings)
+			apiAdmin.GET("/spam/rules", domainHandler.GetSpamRules)
+			apiAdmin.PUT("/domains/:id/greylist", domainHandler.UpdateGreylist)
+			apiAdmin.PUT("/domains/:id/srs", domainHandler.UpdateSRS)
+			apiAdmin.PUT("/domains/:id/catch-all", domainHandler.UpdateCatchAll)
+
+			// ACME证书
+			apiAdmin.GET("/certificates", acmeHandler.GetCertificates)
+			apiAdmin.POST("/domains/:id/certificate", acmeHandler.RequestCertificate)
 
 			// 用户管理
 			apiAdmin.GET("/users", userHandler.GetUsers)
@@ -197,6 +246,28 @@ func (s *Server) setupRoutes(svcCtx *svc.ServiceContext) {
 			apiAdmin.PUT("/mailboxes/:id/status", mailboxHandler.UpdateMailboxStatus)
 			apiAdmin.DELETE("/mailboxes/:id", mailboxHandler.DeleteMailboxAdmin)
 			apiAdmin.GET("/mailboxes/:id/stats", mailboxHandler.GetMailboxStats)
+
+			// 别名和群组管理
+			apiAdmin.GET("/aliases", aliasHandler.GetAllAliases)
+			apiAdmin.PUT("/aliases/:id/status", aliasHandler.UpdateAliasStatus)
+			apiAdmin.DELETE("/aliases/:id", aliasHandler.DeleteAliasAdmin)
+
+			// 出站队列
+			apiAdmin.GET("/queue", queueHandler.GetQueue)
+			apiAdmin.POST("/queue/:id/retry", queueHandler.RetryQueueMessage)
+			apiAdmin.POST("/queue/:id/bounce", queueHandler.BounceQueueMessage)
+			apiAdmin.DELETE("/queue/:id", queueHandler.DeleteQueueMessage)
+
+			// DNS黑名单
+			apiAdmin.GET("/dnsbl", dnsblHandler.GetDNSBL)
+			apiAdmin.POST("/dnsbl/check", dnsblHandler.CheckDNSBL)
+
+			// 灰名单
+			apiAdmin.GET("/greylist", greylistHandler.GetGreylist)
+			apiAdmin.DELETE("/greylist/:id", greylistHandler.DeleteGreylist)
+			apiAdmin.GET("/greylist/whitelist", greylistHandler.GetWhitelist)
+			apiAdmin.POST("/greylist/whitelist", greylistHandler.CreateWhitelist)
+			apiAdmin.DELETE("/greylist/whitelist/:id", greylistHandler.DeleteWhitelist)
 		}
 
 		// 公共API
@@ -207,5 +278,43 @@ func (s *Server) setupRoutes(svcCtx *svc.ServiceContext) {
 }
 
 func (s *Server) Start() error {
-	return s.router.Run(":" + s.config.WebPort)
+	// ACME自动证书（HTTP-01验证固定访问80端口，需要时额外监听HTTP）
+	s.svcCtx.ACME.Start()
+	if port := config.GetACMEHTTPPort(); config.IsACMEEnabled() && port != "" && port != s.config.WebPort {
+		go func() {
+			log.Printf("ACME HTTP server starting on port %s", port)
+			if err := http.ListenAndServe(":"+port, http.HandlerFunc(s.serveACMEHTTP)); err != nil {
+				log.Printf("ACME HTTP server error: %v", err)
+			}
+		}()
+	}
+
+	if !config.IsHTTPSEnabled() {
+		return s.router.Run(":" + s.config.WebPort)
+	}
+
+	// HTTPS与邮件服务共用证书提供者（支持SNI和证书热更新）
+	httpServer := &http.Server{
+		Addr:      ":" + s.config.WebPort,
+		Handler:   s.router,
+		TLSConfig: s.svcCtx.Certificates.TLSConfig(),
+	}
+	return httpServer.ListenAndServeTLS("", "")
+}
+
+// serveACMEHTTP 额外HTTP端口的处理：提供HTTP-01验证，启用HTTPS时其他请求跳转到HTTPS
+func (s *Server) serveACMEHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") || !config.IsHTTPSEnabled() {
+		s.router.ServeHTTP(w, r)
+		return
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if s.config.WebPort != "443" {
+		host = net.JoinHostPort(host, s.config.WebPort)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
 }
@@ -0,0 +1,161 @@
+package attachment
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+	"miko-email/internal/svc"
+
+	"github.com/jhillyerd/enmime/v2"
+	"gorm.io/gorm"
+)
+
+type Service struct {
+	svcCtx *svc.ServiceContext
+}
+
+func NewService(svcCtx *svc.ServiceContext) *Service {
+	return &Service{svcCtx: svcCtx}
+}
+
+// SaveFromRaw 从邮件原文中提取附件（含内嵌图片），文件按SHA-256保存到附件目录
+func (s *Service) SaveFromRaw(tx *gorm.DB, emailID int64, raw []byte) ([]*model.EmailAttachment, error) {
+	if len(raw) == 0 || !config.IsAttachmentsEnabled() {
+		return nil, nil
+	}
+
+	env, err := enmime.NewParser().ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("解析邮件附件失败: %w", err)
+	}
+
+	// 普通附件、内嵌附件，以及 multipart/related 中带 Content-ID 的其他部分（如HTML引用的图片）
+	var parts []*enmime.Part
+	parts = append(parts, env.Attachments...)
+	parts = append(parts, env.Inlines...)
+	for _, part := range env.OtherParts {
+		if part.ContentID != "" || part.FileName != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	var attachments []*model.EmailAttachment
+	for i, part := range parts {
+		attachment, err := s.savePart(tx, emailID, i, part)
+		if err != nil {
+			log.Printf("保存附件失败 (邮件ID: %d, 文件名: %s): %v", emailID, part.FileName, err)
+			continue
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	if len(attachments) > 0 {
+		log.Printf("邮件 %d 提取到 %d 个附件", emailID, len(attachments))
+	}
+
+	return attachments, nil
+}
+
+// savePart 保存单个MIME部分
+func (s *Service) savePart(tx *gorm.DB, emailID int64, index int, part *enmime.Part) (*model.EmailAttachment, error) {
+	sum := sha256.Sum256(part.Content)
+	hash := hex.EncodeToString(sum[:])
+	storagePath := filepath.ToSlash(filepath.Join(hash[:2], hash))
+
+	// 相同内容只保存一份
+	fullPath := filepath.Join(config.GetAttachmentPath(), storagePath)
+	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return nil, fmt.Errorf("创建附件目录失败: %w", err)
+		}
+		if err := os.WriteFile(fullPath, part.Content, 0644); err != nil {
+			return nil, fmt.Errorf("写入附件文件失败: %w", err)
+		}
+	}
+
+	filename := part.FileName
+	if filename == "" {
+		filename = fmt.Sprintf("attachment-%d", index+1)
+	}
+
+	contentType := part.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	disposition := strings.ToLower(part.Disposition)
+	if disposition != "inline" {
+		if part.ContentID != "" && part.Disposition == "" {
+			disposition = "inline"
+		} else {
+			disposition = "attachment"
+		}
+	}
+
+	attachment := &model.EmailAttachment{
+		EmailId:     emailID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(part.Content)),
+		ContentId:   strings.Trim(part.ContentID, "<>"),
+		Disposition: disposition,
+		Sha256:      hash,
+		StoragePath: storagePath,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.svcCtx.AttachmentModel.Create(tx, attachment); err != nil {
+		return nil, fmt.Errorf("保存附件记录失败: %w", err)
+	}
+
+	return attachment, nil
+}
+
+// GetAttachments 获取邮件的附件列表
+func (s *Service) GetAttachments(emailID int64) ([]*model.EmailAttachment, error) {
+	return s.svcCtx.AttachmentModel.GetByEmailId(emailID)
+}
+
+// GetAttachment 获取邮件的单个附件及其内容
+func (s *Service) GetAttachment(emailID, attachmentID int64) (*model.EmailAttachment, []byte, error) {
+	attachment, err := s.svcCtx.AttachmentModel.GetByIdAndEmailId(attachmentID, emailID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(config.GetAttachmentPath(), filepath.FromSlash(attachment.StoragePath)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取附件文件失败: %w", err)
+	}
+
+	return attachment, content, nil
+}
+
+// RemoveUnreferencedFiles 删除已不再被任何附件记录引用的文件（在删除记录的事务提交后调用）
+func (s *Service) RemoveUnreferencedFiles(paths []string) {
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		count, err := s.svcCtx.AttachmentModel.CountByStoragePath(path)
+		if err != nil || count > 0 {
+			continue
+		}
+		fullPath := filepath.Join(config.GetAttachmentPath(), filepath.FromSlash(path))
+		if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("删除附件文件失败: %s, %v", fullPath, err)
+		}
+	}
+}
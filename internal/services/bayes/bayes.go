@@ -0,0 +1,195 @@
+package bayes
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/jhillyerd/enmime/v2"
+	"gorm.io/gorm"
+	"miko-email/internal/model"
+	"miko-email/internal/services/spam"
+	"miko-email/internal/svc"
+)
+
+const (
+	// minCorpus 垃圾邮件和正常邮件都至少训练这么多封后才参与评分
+	minCorpus = 10
+	// maxClues 参与计算的最有区分度的词条数量
+	maxClues = 150
+	// minStrength 词条概率与0.5的差距小于该值时不参与计算
+	minStrength = 0.1
+	// 未知词条的先验概率和强度（Robinson）
+	unknownProb     = 0.5
+	unknownStrength = 0.45
+)
+
+// Service 贝叶斯分类器：每个邮箱单独统计词条，同时计入全局数据；邮箱的训练数据不足时使用全局数据
+type Service struct {
+	svcCtx *svc.ServiceContext
+}
+
+// NewService 创建贝叶斯分类器
+func NewService(svcCtx *svc.ServiceContext) *Service {
+	return &Service{svcCtx: svcCtx}
+}
+
+// Train 将邮件训练为垃圾邮件（class 为 spam）或正常邮件（ham）
+// 已按相同分类训练过的忽略，按相反分类训练过的先撤销原来的训练
+func (s *Service) Train(tx *gorm.DB, email *model.Email, class string) error {
+	if class != model.BayesClassSpam && class != model.BayesClassHam {
+		return errors.New("无效的训练分类")
+	}
+	if email.BayesClass == class {
+		return nil
+	}
+
+	tokens, err := s.emailTokens(email)
+	if err != nil {
+		return err
+	}
+
+	var spamDelta, hamDelta int64
+	if class == model.BayesClassSpam {
+		spamDelta = 1
+	} else {
+		hamDelta = 1
+	}
+	switch email.BayesClass {
+	case model.BayesClassSpam:
+		spamDelta--
+	case model.BayesClassHam:
+		hamDelta--
+	}
+
+	for _, mailboxId := range []int64{email.MailboxId, model.BayesGlobalMailboxId} {
+		if err := s.svcCtx.BayesModel.AddTokens(tx, mailboxId, tokens, spamDelta, hamDelta); err != nil {
+			return err
+		}
+		if err := s.svcCtx.BayesModel.AddCorpus(tx, mailboxId, spamDelta, hamDelta); err != nil {
+			return err
+		}
+	}
+
+	if err := s.svcCtx.EmailModel.UpdateBayesClass(tx, email.Id, class); err != nil {
+		return err
+	}
+	email.BayesClass = class
+	return nil
+}
+
+// OnFolderChange 邮件移动文件夹后训练：移入垃圾邮件训练为垃圾邮件，从垃圾邮件移到其他文件夹（废纸篓除外）训练为正常邮件
+func (s *Service) OnFolderChange(tx *gorm.DB, email *model.Email, oldFolder string) {
+	var class string
+	switch {
+	case email.Folder == "junk":
+		class = model.BayesClassSpam
+	case oldFolder == "junk" && email.Folder != "trash":
+		class = model.BayesClassHam
+	default:
+		return
+	}
+
+	if err := s.Train(tx, email, class); err != nil {
+		log.Printf("贝叶斯训练失败 (邮件ID: %d): %v", email.Id, err)
+		return
+	}
+	log.Printf("贝叶斯训练: 邮件ID %d 从 %s 移到 %s，训练为 %s", email.Id, oldFolder, email.Folder, class)
+}
+
+// SpamProbability 计算邮件是垃圾邮件的概率（实现 spam.Classifier）
+// 使用第一个训练数据充足的收件邮箱的数据，都不足时使用全局数据
+func (s *Service) SpamProbability(msg *spam.Message) (float64, bool) {
+	tokens := Tokenize(msg.Envelope)
+	if len(tokens) == 0 {
+		return 0, false
+	}
+
+	for _, mailboxId := range append(msg.MailboxIds, model.BayesGlobalMailboxId) {
+		corpus, err := s.svcCtx.BayesModel.GetCorpus(mailboxId)
+		if err != nil {
+			log.Printf("获取贝叶斯训练数据失败: %v", err)
+			return 0, false
+		}
+		if corpus.SpamCount < minCorpus || corpus.HamCount < minCorpus {
+			continue
+		}
+
+		stats, err := s.svcCtx.BayesModel.GetTokens(mailboxId, tokens)
+		if err != nil {
+			log.Printf("获取贝叶斯词条失败: %v", err)
+			return 0, false
+		}
+		return classify(tokens, stats, corpus)
+	}
+	return 0, false
+}
+
+// emailTokens 提取邮件的词条，优先使用邮件原文
+func (s *Service) emailTokens(email *model.Email) ([]string, error) {
+	raw, err := s.svcCtx.EmailRawModel.GetByEmailId(email.Id)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if raw != nil {
+		if envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw.Content)); err == nil {
+			return Tokenize(envelope), nil
+		}
+	}
+	return TokenizeText(email.Subject, email.Body), nil
+}
+
+// classify 使用 Robinson-Fisher 方法合并词条概率
+func classify(tokens []string, stats map[string]*model.BayesToken, corpus *model.BayesCorpus) (float64, bool) {
+	var clues []float64
+	for _, token := range tokens {
+		stat, ok := stats[token]
+		if !ok || stat.SpamCount+stat.HamCount == 0 {
+			continue
+		}
+
+		spamRatio := float64(stat.SpamCount) / float64(corpus.SpamCount)
+		hamRatio := float64(stat.HamCount) / float64(corpus.HamCount)
+		prob := spamRatio / (spamRatio + hamRatio)
+
+		// 出现次数少的词条向0.5靠拢
+		n := float64(stat.SpamCount + stat.HamCount)
+		prob = (unknownStrength*unknownProb + n*prob) / (unknownStrength + n)
+		if math.Abs(prob-0.5) >= minStrength {
+			clues = append(clues, prob)
+		}
+	}
+	if len(clues) == 0 {
+		return 0, false
+	}
+
+	sort.Slice(clues, func(i, j int) bool {
+		return math.Abs(clues[i]-0.5) > math.Abs(clues[j]-0.5)
+	})
+	if len(clues) > maxClues {
+		clues = clues[:maxClues]
+	}
+
+	var spamLog, hamLog float64
+	for _, prob := range clues {
+		spamLog += math.Log(1 - prob)
+		hamLog += math.Log(prob)
+	}
+	spamness := 1 - chi2Q(-2*spamLog, 2*len(clues))
+	hamness := 1 - chi2Q(-2*hamLog, 2*len(clues))
+	return (spamness - hamness + 1) / 2, true
+}
+
+// chi2Q 自由度为v（偶数）的卡方分布的上尾概率
+func chi2Q(x2 float64, v int) float64 {
+	m := x2 / 2
+	sum := math.Exp(-m)
+	term := sum
+	for i := 1; i < v/2; i++ {
+		term *= m / float64(i)
+		sum += term
+	}
+	return math.Min(sum, 1)
+}
@@ -0,0 +1,262 @@
+package bayes
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/jhillyerd/enmime/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"miko-email/internal/model"
+	"miko-email/internal/services/spam"
+	"miko-email/internal/svc"
+)
+
+// newTestService 使用内存数据库创建分类器
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("获取数据库连接失败: %v", err)
+	}
+	// 内存数据库每个连接是独立的
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&model.Email{}, &model.EmailRaw{}, &model.BayesToken{}, &model.BayesCorpus{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	return NewService(&svc.ServiceContext{
+		DB:            db,
+		EmailModel:    model.NewEmailModel(db),
+		EmailRawModel: model.NewEmailRawModel(db),
+		BayesModel:    model.NewBayesModel(db),
+	})
+}
+
+var (
+	spamSubjects = []string{"Cheap pills winner", "Claim your prize now", "Exclusive casino bonus", "Winner lottery notification", "Cheap replica watches"}
+	spamBodies   = []string{"Buy cheap pills now, limited offer, click here to claim your free bonus prize",
+		"Congratulations winner! Claim your lottery prize, send your bank details today",
+		"Casino bonus offer, free spins, click here now, limited time exclusive deal"}
+	hamSubjects = []string{"Meeting agenda", "Project status report", "Lunch on Friday", "Quarterly review notes", "Deployment schedule"}
+	hamBodies   = []string{"Please review the attached agenda before our meeting on Thursday afternoon",
+		"The project milestone is on track, deployment is scheduled after the code review",
+		"Notes from the quarterly review are in the shared folder, thanks everyone"}
+)
+
+// trainCorpus 为邮箱训练 n 封垃圾邮件和 n 封正常邮件
+func trainCorpus(t *testing.T, s *Service, mailboxID int64, n int) {
+	t.Helper()
+	var id int64
+	for i := 0; i < n; i++ {
+		for _, class := range []string{model.BayesClassSpam, model.BayesClassHam} {
+			id++
+			email := &model.Email{Id: id, MailboxId: mailboxID}
+			if class == model.BayesClassSpam {
+				email.Subject, email.Body = spamSubjects[i%len(spamSubjects)], spamBodies[i%len(spamBodies)]
+			} else {
+				email.Subject, email.Body = hamSubjects[i%len(hamSubjects)], hamBodies[i%len(hamBodies)]
+			}
+			if err := s.Train(nil, email, class); err != nil {
+				t.Fatalf("训练失败: %v", err)
+			}
+		}
+	}
+}
+
+// testMessage 构建评分用的邮件
+func testMessage(subject, body string, mailboxIDs ...int64) *spam.Message {
+	raw := fmt.Sprintf("From: sender@example.org\r\nTo: user@local.test\r\nSubject: %s\r\n"+
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", subject, body)
+	msg := spam.NewMessage([]byte(raw))
+	msg.MailboxIds = mailboxIDs
+	return msg
+}
+
+func TestTrainAndClassify(t *testing.T) {
+	s := newTestService(t)
+	trainCorpus(t, s, 1, minCorpus)
+
+	tests := []struct {
+		name      string
+		subject   string
+		body      string
+		mailboxes []int64
+		wantSpam  bool
+	}{
+		{"垃圾邮件", "Claim your bonus prize", "Click here now for cheap pills and a free casino bonus", []int64{1}, true},
+		{"正常邮件", "Review meeting notes", "The agenda for the project review meeting is attached", []int64{1}, false},
+		{"没有训练数据的邮箱使用全局数据", "Winner prize claim", "Limited offer, claim your free lottery prize now", []int64{2}, true},
+		{"全局数据判断正常邮件", "Deployment review", "Thanks everyone, the deployment schedule is in the shared folder", []int64{2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prob, ok := s.SpamProbability(testMessage(tt.subject, tt.body, tt.mailboxes...))
+			if !ok {
+				t.Fatal("训练数据充足时应返回概率")
+			}
+			if tt.wantSpam && prob < 0.9 {
+				t.Errorf("垃圾邮件概率 = %.3f，期望大于0.9", prob)
+			}
+			if !tt.wantSpam && prob > 0.1 {
+				t.Errorf("垃圾邮件概率 = %.3f，期望小于0.1", prob)
+			}
+		})
+	}
+
+	// 没有已知词条时不参与评分
+	if _, ok := s.SpamProbability(testMessage("zzzz", "qqqq xxxx yyyy", 1)); ok {
+		t.Error("没有已知词条时不应返回概率")
+	}
+}
+
+func TestClassifyNeedsCorpus(t *testing.T) {
+	s := newTestService(t)
+	trainCorpus(t, s, 1, minCorpus-1)
+
+	if _, ok := s.SpamProbability(testMessage("Claim your bonus prize", "cheap pills casino bonus", 1)); ok {
+		t.Errorf("训练的邮件少于 %d 封时不应返回概率", minCorpus)
+	}
+}
+
+func TestRetrain(t *testing.T) {
+	s := newTestService(t)
+	email := &model.Email{Id: 1, MailboxId: 1, Subject: "Cheap pills", Body: "cheap pills offer"}
+
+	steps := []struct {
+		class          string
+		wantSpam       int64
+		wantHam        int64
+		wantTokenSpam  int64
+		wantTokenHam   int64
+		wantEmailClass string
+	}{
+		{model.BayesClassSpam, 1, 0, 1, 0, model.BayesClassSpam},
+		// 相同分类再次训练不重复计数
+		{model.BayesClassSpam, 1, 0, 1, 0, model.BayesClassSpam},
+		// 改为正常邮件时撤销原来的训练
+		{model.BayesClassHam, 0, 1, 0, 1, model.BayesClassHam},
+	}
+	for i, step := range steps {
+		if err := s.Train(nil, email, step.class); err != nil {
+			t.Fatalf("第 %d 次训练失败: %v", i+1, err)
+		}
+		for _, mailboxID := range []int64{1, model.BayesGlobalMailboxId} {
+			corpus, err := s.svcCtx.BayesModel.GetCorpus(mailboxID)
+			if err != nil {
+				t.Fatalf("获取训练数量失败: %v", err)
+			}
+			if corpus.SpamCount != step.wantSpam || corpus.HamCount != step.wantHam {
+				t.Errorf("第 %d 次训练后邮箱 %d: spam=%d ham=%d，期望 spam=%d ham=%d",
+					i+1, mailboxID, corpus.SpamCount, corpus.HamCount, step.wantSpam, step.wantHam)
+			}
+			stats, err := s.svcCtx.BayesModel.GetTokens(mailboxID, []string{"subject:cheap"})
+			if err != nil {
+				t.Fatalf("获取词条失败: %v", err)
+			}
+			stat := stats["subject:cheap"]
+			if stat == nil || stat.SpamCount != step.wantTokenSpam || stat.HamCount != step.wantTokenHam {
+				t.Errorf("第 %d 次训练后邮箱 %d 的词条统计 = %+v，期望 spam=%d ham=%d",
+					i+1, mailboxID, stat, step.wantTokenSpam, step.wantTokenHam)
+			}
+		}
+		if email.BayesClass != step.wantEmailClass {
+			t.Errorf("第 %d 次训练后邮件分类 = %q，期望 %q", i+1, email.BayesClass, step.wantEmailClass)
+		}
+	}
+
+	if err := s.Train(nil, email, "unknown"); err == nil {
+		t.Error("无效的分类应返回错误")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	corpus := &model.BayesCorpus{SpamCount: 100, HamCount: 100}
+	stats := map[string]*model.BayesToken{
+		"spam1": {SpamCount: 90, HamCount: 1},
+		"spam2": {SpamCount: 80, HamCount: 2},
+		"spam3": {SpamCount: 70, HamCount: 0},
+		"ham1":  {SpamCount: 1, HamCount: 90},
+		"ham2":  {SpamCount: 0, HamCount: 85},
+		"ham3":  {SpamCount: 2, HamCount: 60},
+		"even":  {SpamCount: 50, HamCount: 50},
+		"rare":  {SpamCount: 1, HamCount: 0},
+	}
+
+	tests := []struct {
+		name   string
+		tokens []string
+		min    float64
+		max    float64
+		ok     bool
+	}{
+		{"垃圾邮件词条", []string{"spam1", "spam2", "spam3"}, 0.99, 1, true},
+		{"正常邮件词条", []string{"ham1", "ham2", "ham3"}, 0, 0.01, true},
+		{"混合词条", []string{"spam1", "ham1"}, 0.4, 0.6, true},
+		{"没有区分度的词条", []string{"even"}, 0, 0, false},
+		{"未知词条", []string{"unknown"}, 0, 0, false},
+		{"出现次数少的词条向0.5靠拢", []string{"rare"}, 0.5, 0.9, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prob, ok := classify(tt.tokens, stats, corpus)
+			if ok != tt.ok {
+				t.Fatalf("classify ok = %v，期望 %v", ok, tt.ok)
+			}
+			if ok && (prob < tt.min || prob > tt.max) {
+				t.Errorf("classify = %.4f，期望在 [%.2f, %.2f] 之间", prob, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	raw := "From: \"Lucky Winner\" <promo@Spam.Example>\r\n" +
+		"Subject: FREE Prize 2024\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		"恭喜中奖 visit https://Bad.Example/claim?id=1 now, it's 100% free!! ok a1\r\n"
+	envelope, err := enmime.ReadEnvelope(bytes.NewReader([]byte(raw)))
+	if err != nil {
+		t.Fatalf("解析邮件失败: %v", err)
+	}
+	tokens := make(map[string]bool)
+	for _, token := range Tokenize(envelope) {
+		tokens[token] = true
+	}
+
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{"subject:free", true},
+		{"subject:prize", true},
+		{"subject:2024", false}, // 纯数字
+		{"from:spam.example", true},
+		{"fromname:lucky", true},
+		{"fromname:winner", true},
+		{"url:bad.example", true},
+		{"claim", false}, // 链接不作为正文词条
+		{"恭喜", true},
+		{"喜中", true},
+		{"中奖", true},
+		{"visit", true},
+		{"it's", true},
+		{"100%", true},
+		{"free", true},
+		{"now", true},
+		{"ok", false}, // 过短
+		{"a1", false},
+	}
+	for _, tt := range tests {
+		if tokens[tt.token] != tt.want {
+			t.Errorf("词条 %q 存在 = %v，期望 %v", tt.token, tokens[tt.token], tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package bayes
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/jhillyerd/enmime/v2"
+)
+
+// 词条长度范围（按字符计），过短的词区分度低，过长的多为编码内容
+const (
+	minWordLen = 3
+	maxWordLen = 30
+	maxTokens  = 2000
+)
+
+var urlPattern = regexp.MustCompile(`(?i)https?://[^\s"'<>()]+`)
+
+// tokenizer 收集去重后的词条
+type tokenizer struct {
+	seen   map[string]bool
+	tokens []string
+}
+
+func newTokenizer() *tokenizer {
+	return &tokenizer{seen: make(map[string]bool)}
+}
+
+func (t *tokenizer) add(token string) {
+	if len(t.tokens) >= maxTokens || t.seen[token] {
+		return
+	}
+	t.seen[token] = true
+	t.tokens = append(t.tokens, token)
+}
+
+// addText 拆分文本：拉丁字母和数字按单词，汉字等按相邻两个字组成词条，prefix 用于区分主题和正文
+func (t *tokenizer) addText(prefix, text string) {
+	var word []rune
+	var prevHan rune
+	flush := func() {
+		w := []rune(strings.TrimRight(string(word), "-'."))
+		if len(w) >= minWordLen && len(w) <= maxWordLen && !isNumber(w) {
+			t.add(prefix + string(w))
+		}
+		word = word[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isIdeograph(r):
+			flush()
+			if prevHan != 0 {
+				t.add(prefix + string([]rune{prevHan, r}))
+			}
+			prevHan = r
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '$' || r == '%':
+			word = append(word, r)
+		case (r == '-' || r == '\'' || r == '.') && len(word) > 0:
+			word = append(word, r)
+		default:
+			flush()
+		}
+		prevHan = 0
+	}
+	flush()
+}
+
+// Tokenize 从邮件中提取词条：主题、正文、发件人域名、链接域名和附件类型
+func Tokenize(envelope *enmime.Envelope) []string {
+	t := newTokenizer()
+	if envelope == nil {
+		return t.tokens
+	}
+
+	t.addText("subject:", envelope.GetHeader("Subject"))
+	if from, err := mail.ParseAddress(envelope.GetHeader("From")); err == nil {
+		if at := strings.LastIndexByte(from.Address, '@'); at >= 0 {
+			t.add("from:" + strings.ToLower(from.Address[at+1:]))
+		}
+		t.addText("fromname:", from.Name)
+	}
+
+	body := envelope.Text
+	for _, raw := range urlPattern.FindAllString(body+"\n"+envelope.HTML, -1) {
+		if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+			t.add("url:" + strings.ToLower(u.Hostname()))
+		}
+	}
+	// 链接本身不作为正文词条
+	t.addText("", urlPattern.ReplaceAllString(body, " "))
+
+	for _, part := range append(envelope.Attachments, envelope.Inlines...) {
+		t.add("att:" + strings.ToLower(part.ContentType))
+	}
+	return t.tokens
+}
+
+// TokenizeText 从主题和正文中提取词条（没有邮件原文时使用）
+func TokenizeText(subject, body string) []string {
+	t := newTokenizer()
+	t.addText("subject:", subject)
+	t.addText("", urlPattern.ReplaceAllString(body, " "))
+	return t.tokens
+}
+
+func isIdeograph(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+func isNumber(word []rune) bool {
+	for _, r := range word {
+		if !unicode.IsDigit(r) && r != '.' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -2,243 +2,451 @@ package dkim
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/emersion/go-msgauth/dkim"
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+	"miko-email/internal/svc"
 )
 
-// Service DKIM服务
+// ErrNoSigningKey 域名没有可用于签名的密钥
+var ErrNoSigningKey = errors.New("没有可用的DKIM签名密钥")
+
+// selectorPattern DKIM选择器必须是合法的DNS标签（可用点分隔）
+var selectorPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+// encryptedKeyPrefix 加密私钥的格式版本
+const encryptedKeyPrefix = "v1:"
+
+// Service DKIM服务（密钥加密保存在数据库中）
 type Service struct {
-	keyDir string
+	svcCtx *svc.ServiceContext
+	keyDir string // 旧版本保存PEM文件的目录，域名没有密钥时从这里导入
+}
+
+// Record 需要在DNS中发布的DKIM记录
+type Record struct {
+	KeyId      int64     `json:"key_id"`
+	Selector   string    `json:"selector"`
+	Algorithm  string    `json:"algorithm"`
+	Name       string    `json:"name"`  // 记录名：<选择器>._domainkey.<域名>
+	Value      string    `json:"value"` // TXT记录值
+	PublicKey  string    `json:"public_key"`
+	Signing    bool      `json:"signing"` // 当前是否用于签名
+	ActivateAt time.Time `json:"activate_at"`
 }
 
 // NewService 创建DKIM服务
-func NewService(keyDir string) *Service {
-	// 确保密钥目录存在
-	os.MkdirAll(keyDir, 0755)
+func NewService(svcCtx *svc.ServiceContext, keyDir string) *Service {
 	return &Service{
+		svcCtx: svcCtx,
 		keyDir: keyDir,
 	}
 }
 
-// GenerateKeyPair 为域名生成DKIM密钥对
-func (s *Service) GenerateKeyPair(domain string) (string, error) {
-	// 生成RSA密钥对
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return "", fmt.Errorf("生成RSA密钥失败: %v", err)
+// ValidateSelector 检查选择器格式
+func ValidateSelector(selector string) error {
+	if !selectorPattern.MatchString(selector) {
+		return fmt.Errorf("无效的DKIM选择器: %s", selector)
 	}
+	return nil
+}
 
-	// 获取公钥
-	publicKey := &privateKey.PublicKey
+// GenerateKey 为域名生成新密钥，activateAt 之前只发布DNS记录，之后开始用于签名
+// selector 为空时按算法和日期自动生成
+func (s *Service) GenerateKey(domain *model.Domain, algorithm, selector string, activateAt time.Time) (*model.DkimKey, error) {
+	if algorithm == "" {
+		algorithm = model.DkimAlgorithmRSA
+	}
 
-	// 将公钥转换为PKIX格式
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
-	if err != nil {
-		return "", fmt.Errorf("序列化公钥失败: %v", err)
+	selector = strings.ToLower(strings.TrimSpace(selector))
+	if selector == "" {
+		var err error
+		if selector, err = s.nextSelector(domain.Id, algorithm); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := ValidateSelector(selector); err != nil {
+			return nil, err
+		}
+		exists, err := s.svcCtx.DkimKeyModel.CheckSelectorExist(domain.Id, selector)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, fmt.Errorf("选择器 %s 已存在", selector)
+		}
 	}
 
-	// 将公钥编码为base64
-	publicKeyBase64 := base64.StdEncoding.EncodeToString(publicKeyBytes)
+	var signer crypto.Signer
+	var publicKey string
+	switch algorithm {
+	case model.DkimAlgorithmRSA:
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("生成RSA密钥失败: %v", err)
+		}
+		publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("序列化公钥失败: %v", err)
+		}
+		signer = privateKey
+		publicKey = base64.StdEncoding.EncodeToString(publicKeyBytes)
+	case model.DkimAlgorithmEd25519:
+		// RFC 8463：DNS记录中直接发布32字节的公钥
+		pub, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("生成Ed25519密钥失败: %v", err)
+		}
+		signer = privateKey
+		publicKey = base64.StdEncoding.EncodeToString(pub)
+	default:
+		return nil, fmt.Errorf("不支持的DKIM算法: %s", algorithm)
+	}
 
-	// 将私钥转换为PKCS#1格式
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
+	return s.saveKey(domain, algorithm, selector, signer, publicKey, activateAt)
+}
 
-	// 创建PEM块
-	privateKeyPEM := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: privateKeyBytes,
+// Keys 获取域名的所有密钥（包括已停用的）
+func (s *Service) Keys(domain *model.Domain) ([]*model.DkimKey, error) {
+	if err := s.importLegacyKey(domain); err != nil {
+		return nil, err
 	}
+	return s.svcCtx.DkimKeyModel.ListByDomain(domain.Id)
+}
 
-	// 保存私钥到文件
-	privateKeyPath := filepath.Join(s.keyDir, fmt.Sprintf("%s.private", domain))
-	privateKeyFile, err := os.Create(privateKeyPath)
+// ActivateKey 设置密钥开始签名的时间（到时后替换同一算法的旧密钥，旧密钥保留发布直到停用）
+func (s *Service) ActivateKey(domain *model.Domain, keyId int64, activateAt time.Time) (*model.DkimKey, error) {
+	key, err := s.svcCtx.DkimKeyModel.GetById(domain.Id, keyId)
 	if err != nil {
-		return "", fmt.Errorf("创建私钥文件失败: %v", err)
+		return nil, err
+	}
+	if key.RetiredAt != nil {
+		return nil, fmt.Errorf("密钥已停用")
 	}
-	defer privateKeyFile.Close()
 
-	err = pem.Encode(privateKeyFile, privateKeyPEM)
-	if err != nil {
-		return "", fmt.Errorf("写入私钥文件失败: %v", err)
+	if err := s.svcCtx.DkimKeyModel.UpdateActivateAt(nil, key.Id, activateAt); err != nil {
+		return nil, err
 	}
+	key.ActivateAt = activateAt
+	return key, nil
+}
 
-	// 保存公钥到文件
-	publicKeyPath := filepath.Join(s.keyDir, fmt.Sprintf("%s.public", domain))
-	publicKeyFile, err := os.Create(publicKeyPath)
+// RetireKey 停用密钥（不再签名，DNS记录可以删除），正在用于签名的密钥不能停用
+func (s *Service) RetireKey(domain *model.Domain, keyId int64) error {
+	key, err := s.svcCtx.DkimKeyModel.GetById(domain.Id, keyId)
 	if err != nil {
-		return "", fmt.Errorf("创建公钥文件失败: %v", err)
+		return err
+	}
+	if key.RetiredAt != nil {
+		return nil
 	}
-	defer publicKeyFile.Close()
 
-	_, err = publicKeyFile.WriteString(publicKeyBase64)
+	signing, err := s.svcCtx.DkimKeyModel.GetSigningKeys(domain.Id, time.Now())
 	if err != nil {
-		return "", fmt.Errorf("写入公钥文件失败: %v", err)
+		return err
+	}
+	for _, k := range signing {
+		if k.Id == key.Id {
+			return fmt.Errorf("密钥 %s 正在用于签名，请先启用同一算法的其他密钥", key.Selector)
+		}
 	}
 
-	return publicKeyBase64, nil
+	return s.svcCtx.DkimKeyModel.Retire(nil, key.Id)
 }
 
-// GetPublicKey 获取域名的DKIM公钥
-func (s *Service) GetPublicKey(domain string) (string, error) {
-	publicKeyPath := filepath.Join(s.keyDir, fmt.Sprintf("%s.public", domain))
-
-	// 检查文件是否存在
-	if _, err := os.Stat(publicKeyPath); os.IsNotExist(err) {
-		// 如果不存在，生成新的密钥对
-		return s.GenerateKeyPair(domain)
+// Records 获取域名需要发布的所有DKIM记录，域名还没有密钥时生成一个RSA密钥
+func (s *Service) Records(domain *model.Domain) ([]*Record, error) {
+	if err := s.importLegacyKey(domain); err != nil {
+		return nil, err
 	}
 
-	// 读取公钥文件
-	publicKeyBytes, err := os.ReadFile(publicKeyPath)
+	keys, err := s.svcCtx.DkimKeyModel.ListPublished(domain.Id)
 	if err != nil {
-		return "", fmt.Errorf("读取公钥文件失败: %v", err)
+		return nil, err
 	}
-
-	return string(publicKeyBytes), nil
-}
-
-// GetPrivateKey 获取域名的DKIM私钥
-func (s *Service) GetPrivateKey(domain string) (string, error) {
-	privateKeyPath := filepath.Join(s.keyDir, fmt.Sprintf("%s.private", domain))
-
-	// 检查文件是否存在
-	if _, err := os.Stat(privateKeyPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("私钥文件不存在，请先生成密钥对")
+	if len(keys) == 0 {
+		selector := "default"
+		if exists, err := s.svcCtx.DkimKeyModel.CheckSelectorExist(domain.Id, selector); err != nil || exists {
+			selector = ""
+		}
+		key, err := s.GenerateKey(domain, model.DkimAlgorithmRSA, selector, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		keys = []*model.DkimKey{key}
 	}
 
-	// 读取私钥文件
-	privateKeyBytes, err := os.ReadFile(privateKeyPath)
+	signing, err := s.svcCtx.DkimKeyModel.GetSigningKeys(domain.Id, time.Now())
 	if err != nil {
-		return "", fmt.Errorf("读取私钥文件失败: %v", err)
+		return nil, err
+	}
+	signingIds := make(map[int64]bool)
+	for _, key := range signing {
+		signingIds[key.Id] = true
+	}
+
+	records := make([]*Record, 0, len(keys))
+	for _, key := range keys {
+		records = append(records, &Record{
+			KeyId:      key.Id,
+			Selector:   key.Selector,
+			Algorithm:  key.Algorithm,
+			Name:       fmt.Sprintf("%s._domainkey.%s", key.Selector, domain.Name),
+			Value:      fmt.Sprintf("v=DKIM1; k=%s; p=%s", key.Algorithm, key.PublicKey),
+			PublicKey:  key.PublicKey,
+			Signing:    signingIds[key.Id],
+			ActivateAt: key.ActivateAt,
+		})
 	}
+	return records, nil
+}
 
-	return string(privateKeyBytes), nil
+// SigningKeys 获取域名当前用于签名的密钥（每种算法一个）
+func (s *Service) SigningKeys(domain *model.Domain) ([]*model.DkimKey, error) {
+	if err := s.importLegacyKey(domain); err != nil {
+		return nil, err
+	}
+	return s.svcCtx.DkimKeyModel.GetSigningKeys(domain.Id, time.Now())
 }
 
-// GenerateDKIMRecord 生成DKIM DNS记录
-func (s *Service) GenerateDKIMRecord(domain string) (string, error) {
-	publicKey, err := s.GetPublicKey(domain)
+// Sign 使用域名当前的所有签名密钥对邮件签名（同时有RSA和Ed25519密钥时双重签名）
+// 没有签名密钥时返回 ErrNoSigningKey
+func (s *Service) Sign(domain *model.Domain, headerKeys []string, emailContent []byte) ([]byte, []string, error) {
+	keys, err := s.SigningKeys(domain)
 	if err != nil {
-		return "", err
+		return nil, nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil, ErrNoSigningKey
 	}
 
-	// 构造DKIM记录
-	// 移除换行符和空格
-	cleanPublicKey := strings.ReplaceAll(publicKey, "\n", "")
-	cleanPublicKey = strings.ReplaceAll(cleanPublicKey, "\r", "")
-	cleanPublicKey = strings.ReplaceAll(cleanPublicKey, " ", "")
+	signed := emailContent
+	var selectors []string
+	for _, key := range keys {
+		signer, err := s.decryptPrivateKey(key.PrivateKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("解密DKIM私钥失败 (%s): %v", key.Selector, err)
+		}
 
-	dkimRecord := fmt.Sprintf("v=DKIM1; k=rsa; p=%s", cleanPublicKey)
+		// 创建DKIM签名选项
+		options := &dkim.SignOptions{
+			Domain:                 domain.Name,
+			Selector:               key.Selector,
+			Signer:                 signer,
+			HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+			BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+			HeaderKeys:             headerKeys,
+			Expiration:             time.Now().Add(7 * 24 * time.Hour), // 7天后过期
+		}
 
-	return dkimRecord, nil
-}
+		// 对邮件进行签名
+		var signedEmail bytes.Buffer
+		if err := dkim.Sign(&signedEmail, bytes.NewReader(signed), options); err != nil {
+			return nil, nil, fmt.Errorf("DKIM签名失败: %v", err)
+		}
+		signed = signedEmail.Bytes()
+		selectors = append(selectors, key.Selector)
+	}
 
-// GetDKIMSelector 获取DKIM选择器（默认使用"default"）
-func (s *Service) GetDKIMSelector() string {
-	return "default"
+	return signed, selectors, nil
 }
 
-// GetDKIMDomain 获取DKIM域名
-func (s *Service) GetDKIMDomain(domain string) string {
-	return fmt.Sprintf("%s._domainkey.%s", s.GetDKIMSelector(), domain)
+// DefaultSignedHeaders 默认参与DKIM签名的邮件头
+var DefaultSignedHeaders = []string{
+	"from", "to", "cc", "subject", "date", "message-id", "reply-to",
+	"in-reply-to", "references", "mime-version", "content-type", "content-transfer-encoding",
 }
 
-// ListDomainKeys 列出所有域名的密钥
-func (s *Service) ListDomainKeys() ([]string, error) {
-	files, err := os.ReadDir(s.keyDir)
-	if err != nil {
-		return nil, fmt.Errorf("读取密钥目录失败: %v", err)
+// ParseSignedHeaders 解析逗号分隔的签名邮件头列表，为空时返回默认列表（RFC 6376 要求必须包含From）
+func ParseSignedHeaders(headers string) ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(headers, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || seen[key] {
+			continue
+		}
+		if strings.ContainsAny(key, ": \t") {
+			return nil, fmt.Errorf("无效的邮件头名称: %s", key)
+		}
+		seen[key] = true
+		keys = append(keys, key)
 	}
 
-	var domains []string
-	domainSet := make(map[string]bool)
+	if len(keys) == 0 {
+		return DefaultSignedHeaders, nil
+	}
+	if !seen["from"] {
+		return nil, fmt.Errorf("DKIM签名的邮件头必须包含From")
+	}
+	return keys, nil
+}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
+// nextSelector 按算法和日期生成未使用的选择器，如 rsa-20250101、ed25519-20250101
+func (s *Service) nextSelector(domainId int64, algorithm string) (string, error) {
+	base := fmt.Sprintf("%s-%s", algorithm, time.Now().Format("20060102"))
+	selector := base
+	for i := 2; ; i++ {
+		exists, err := s.svcCtx.DkimKeyModel.CheckSelectorExist(domainId, selector)
+		if err != nil {
+			return "", err
 		}
-
-		name := file.Name()
-		if strings.HasSuffix(name, ".private") || strings.HasSuffix(name, ".public") {
-			domain := strings.TrimSuffix(name, ".private")
-			domain = strings.TrimSuffix(domain, ".public")
-			if !domainSet[domain] {
-				domains = append(domains, domain)
-				domainSet[domain] = true
-			}
+		if !exists {
+			return selector, nil
 		}
+		selector = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// saveKey 加密私钥并保存
+func (s *Service) saveKey(domain *model.Domain, algorithm, selector string, signer crypto.Signer, publicKey string, activateAt time.Time) (*model.DkimKey, error) {
+	encrypted, err := s.encryptPrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &model.DkimKey{
+		DomainId:   domain.Id,
+		Selector:   selector,
+		Algorithm:  algorithm,
+		PublicKey:  publicKey,
+		PrivateKey: encrypted,
+		ActivateAt: activateAt,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := s.svcCtx.DkimKeyModel.Create(nil, key); err != nil {
+		return nil, fmt.Errorf("保存DKIM密钥失败: %v", err)
 	}
 
-	return domains, nil
+	log.Printf("已为域名 %s 生成DKIM密钥: %s (%s)", domain.Name, selector, algorithm)
+	return key, nil
 }
 
-// DeleteDomainKeys 删除域名的密钥文件
-func (s *Service) DeleteDomainKeys(domain string) error {
-	privateKeyPath := filepath.Join(s.keyDir, fmt.Sprintf("%s.private", domain))
-	publicKeyPath := filepath.Join(s.keyDir, fmt.Sprintf("%s.public", domain))
+// importLegacyKey 域名还没有密钥时，导入旧版本保存在 <keyDir>/<域名>.private 的RSA私钥（选择器 default）
+func (s *Service) importLegacyKey(domain *model.Domain) error {
+	if s.keyDir == "" {
+		return nil
+	}
+	privateKeyPath := filepath.Join(s.keyDir, fmt.Sprintf("%s.private", domain.Name))
+	privateKeyPEM, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil
+	}
 
-	// 删除私钥文件
-	if _, err := os.Stat(privateKeyPath); err == nil {
-		if err := os.Remove(privateKeyPath); err != nil {
-			return fmt.Errorf("删除私钥文件失败: %v", err)
-		}
+	keys, err := s.svcCtx.DkimKeyModel.ListByDomain(domain.Id)
+	if err != nil || len(keys) > 0 {
+		return err
 	}
 
-	// 删除公钥文件
-	if _, err := os.Stat(publicKeyPath); err == nil {
-		if err := os.Remove(publicKeyPath); err != nil {
-			return fmt.Errorf("删除公钥文件失败: %v", err)
-		}
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return fmt.Errorf("解析私钥PEM失败: %s", privateKeyPath)
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("解析私钥失败 (%s): %v", privateKeyPath, err)
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return fmt.Errorf("序列化公钥失败: %v", err)
 	}
 
+	if _, err := s.saveKey(domain, model.DkimAlgorithmRSA, "default", privateKey,
+		base64.StdEncoding.EncodeToString(publicKeyBytes), time.Now()); err != nil {
+		return err
+	}
+	log.Printf("已将域名 %s 的DKIM私钥文件导入数据库，可以删除 %s", domain.Name, privateKeyPath)
 	return nil
 }
 
-// SignEmail 对邮件进行DKIM签名
-func (s *Service) SignEmail(domain, selector string, emailContent []byte) ([]byte, error) {
-	// 获取私钥
-	privateKeyPEM, err := s.GetPrivateKey(domain)
+// cipherBlock 使用密钥创建AES-256-GCM
+func cipherBlock(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
 	if err != nil {
-		return nil, fmt.Errorf("获取私钥失败: %v", err)
+		return nil, err
 	}
+	return cipher.NewGCM(block)
+}
 
-	// 解析私钥
-	block, _ := pem.Decode([]byte(privateKeyPEM))
-	if block == nil {
-		return nil, fmt.Errorf("解析私钥PEM失败")
+// encryptPrivateKey 将私钥序列化为PKCS#8并加密
+func (s *Service) encryptPrivateKey(signer crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return "", fmt.Errorf("序列化私钥失败: %v", err)
 	}
 
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	secret, err := config.GetDKIMKeySecret()
+	if err != nil {
+		return "", fmt.Errorf("DKIM私钥加密密钥不可用: %v", err)
+	}
+	gcm, err := cipherBlock(secret)
 	if err != nil {
-		return nil, fmt.Errorf("解析私钥失败: %v", err)
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
 	}
 
-	// 创建DKIM签名选项
-	options := &dkim.SignOptions{
-		Domain:   domain,
-		Selector: selector,
-		Signer:   privateKey,
-		HeaderKeys: []string{
-			"from", "to", "subject", "date", "message-id",
-		},
-		Expiration: time.Now().Add(24 * time.Hour), // 24小时后过期
+	sealed := gcm.Seal(nonce, nonce, der, nil)
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptPrivateKey 解密私钥
+func (s *Service) decryptPrivateKey(encrypted string) (crypto.Signer, error) {
+	if !strings.HasPrefix(encrypted, encryptedKeyPrefix) {
+		return nil, fmt.Errorf("未知的私钥格式")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, encryptedKeyPrefix))
+	if err != nil {
+		return nil, err
 	}
 
-	// 对邮件进行签名
-	var signedEmail bytes.Buffer
-	if err := dkim.Sign(&signedEmail, bytes.NewReader(emailContent), options); err != nil {
-		return nil, fmt.Errorf("DKIM签名失败: %v", err)
+	secret, err := config.GetDKIMKeySecret()
+	if err != nil {
+		return nil, fmt.Errorf("DKIM私钥加密密钥不可用: %v", err)
+	}
+	gcm, err := cipherBlock(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("私钥数据不完整")
+	}
+	der, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("密钥不匹配，请检查 security.dkim_key_secret: %v", err)
 	}
 
-	return signedEmail.Bytes(), nil
+	privateKey, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("不支持的私钥类型")
+	}
+	return signer, nil
 }
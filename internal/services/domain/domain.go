@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -10,6 +11,8 @@ import (
 	"github.com/miekg/dns"
 	"gorm.io/gorm"
 	"miko-email/internal/model"
+	"miko-email/internal/services/dkim"
+	"miko-email/internal/services/spam"
 	"miko-email/internal/svc"
 )
 
@@ -180,7 +183,7 @@ func (s *Service) VerifySenderConfiguration(domainID int64) (*model.Domain, erro
 
 	// 验证DKIM记录
 	if domain.DKIMRecord != "" {
-		if !s.verifyDKIMRecord(domain.Name, domain.DKIMRecord) {
+		if !s.verifyDKIMRecord(domain.Name, s.dkimSelector(domain), domain.DKIMRecord) {
 			senderStatus = "failed"
 		}
 	}
@@ -371,11 +374,23 @@ func (s *Service) verifyDMARCRecord(domain, expectedDMARC string) bool {
 	return s.verifyDNSRecord(dmarcDomain, dns.TypeTXT, expectedDMARC)
 }
 
+// dkimSelector 获取域名当前用于RSA签名的选择器，没有密钥时为 default
+func (s *Service) dkimSelector(domain *model.Domain) string {
+	keys, err := s.svcCtx.DkimKeyModel.GetSigningKeys(domain.Id, time.Now())
+	if err == nil {
+		for _, key := range keys {
+			if key.Algorithm == model.DkimAlgorithmRSA {
+				return key.Selector
+			}
+		}
+	}
+	return "default"
+}
+
 // verifyDKIMRecord 验证DKIM记录
-func (s *Service) verifyDKIMRecord(domain, expectedDKIM string) bool {
-	// DKIM记录通常在selector._domainkey.domain的TXT记录中
-	// 这里假设使用default作为selector
-	dkimDomain := "default._domainkey." + domain
+func (s *Service) verifyDKIMRecord(domain, selector, expectedDKIM string) bool {
+	// DKIM记录在selector._domainkey.domain的TXT记录中
+	dkimDomain := selector + "._domainkey." + domain
 	txtRecords, err := net.LookupTXT(dkimDomain)
 	if err == nil {
 		for _, txt := range txtRecords {
@@ -466,6 +481,120 @@ func (s *Service) UpdateDomainWithAllRecords(domainID int64, mxRecord, aRecord,
 	return s.svcCtx.DomainModel.UpdateAllDNSRecords(nil, int64(domainID), mxRecord, aRecord, txtRecord, spfRecord, dmarcRecord, dkimRecord, ptrRecord)
 }
 
+// UpdateDKIMHeaders 更新域名DKIM签名的邮件头（headers为空时使用默认列表）
+func (s *Service) UpdateDKIMHeaders(domainID int64, headers []string) (*model.Domain, error) {
+	domain, err := s.GetDomainByID(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := dkim.ParseSignedHeaders(strings.Join(headers, ","))
+	if err != nil {
+		return nil, err
+	}
+	headerList := ""
+	if len(headers) > 0 {
+		headerList = strings.Join(keys, ",")
+	}
+
+	if err := s.svcCtx.DomainModel.UpdateDKIMHeaders(nil, domainID, headerList); err != nil {
+		return nil, err
+	}
+
+	domain.DKIMHeaders = headerList
+	return domain, nil
+}
+
+// UpdateSpamSettings 更新域名的垃圾邮件阈值和规则分数（未设置的项使用全局配置）
+func (s *Service) UpdateSpamSettings(domainID int64, settings *spam.Settings) (*model.Domain, error) {
+	domain, err := s.GetDomainByID(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := spam.ValidateSettings(settings); err != nil {
+		return nil, err
+	}
+
+	value := ""
+	if settings.JunkThreshold > 0 || settings.RejectThreshold > 0 || len(settings.Weights) > 0 {
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return nil, err
+		}
+		value = string(data)
+	}
+
+	if err := s.svcCtx.DomainModel.UpdateSpamSettings(nil, domainID, value); err != nil {
+		return nil, err
+	}
+
+	domain.SpamSettings = value
+	return domain, nil
+}
+
+// UpdateCatchAll 设置域名的 catch-all 邮箱，mailbox 为空时关闭
+func (s *Service) UpdateCatchAll(domainID int64, mailbox string) (*model.Domain, error) {
+	domain, err := s.GetDomainByID(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	mailbox = strings.ToLower(strings.TrimSpace(mailbox))
+	if mailbox != "" {
+		target, err := s.svcCtx.MailboxModel.GetByEmail(mailbox)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("邮箱不存在")
+			}
+			return nil, err
+		}
+		if target.DomainId != domain.Id {
+			return nil, fmt.Errorf("catch-all邮箱必须属于该域名")
+		}
+		if !target.IsActive {
+			return nil, fmt.Errorf("邮箱已停用")
+		}
+	}
+
+	if err := s.svcCtx.DomainModel.UpdateCatchAll(nil, domainID, mailbox); err != nil {
+		return nil, err
+	}
+
+	domain.CatchAll = mailbox
+	return domain, nil
+}
+
+// UpdateGreylist 设置域名是否启用灰名单
+func (s *Service) UpdateGreylist(domainID int64, enabled bool) (*model.Domain, error) {
+	domain, err := s.GetDomainByID(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.svcCtx.DomainModel.UpdateGreylist(nil, domainID, enabled); err != nil {
+		return nil, err
+	}
+
+	domain.DisableGreylist = !enabled
+	return domain, nil
+}
+
+// UpdateSRS 设置域名转发外部邮件时是否使用SRS
+func (s *Service) UpdateSRS(domainID int64, enabled bool) (*model.Domain, error) {
+	domain, err := s.GetDomainByID(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.svcCtx.DomainModel.UpdateSRS(nil, domainID, enabled); err != nil {
+		return nil, err
+	}
+
+	domain.DisableSRS = !enabled
+	return domain, nil
+}
+
 // DeleteDomain 删除域名
 func (s *Service) DeleteDomain(domainID int64) error {
 	// 检查是否有邮箱使用此域名
@@ -486,8 +615,16 @@ func (s *Service) DeleteDomain(domainID int64) error {
 		return err
 	}
 
-	// 删除域名记录
-	return s.svcCtx.DomainModel.Delete(nil, domain)
+	// 删除域名记录、ACME证书和DKIM密钥
+	return s.svcCtx.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.svcCtx.AcmeModel.DeleteCertificate(tx, strings.ToLower(domain.Name)); err != nil {
+			return err
+		}
+		if err := s.svcCtx.DkimKeyModel.DeleteByDomain(tx, domain.Id); err != nil {
+			return err
+		}
+		return s.svcCtx.DomainModel.Delete(tx, domain)
+	})
 }
 
 // GetAvailableDomains 获取可用的域名列表（已验证且激活的）
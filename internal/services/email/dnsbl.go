@@ -0,0 +1,61 @@
+package email
+
+import (
+	"fmt"
+	"log"
+
+	"miko-email/internal/svc"
+)
+
+// checkClientDNSBL 连接时查询客户端IP是否在DNS黑名单中（本机连接不查询）
+func (session *SMTPSession) checkClientDNSBL() {
+	if session.isLoopback() {
+		return
+	}
+	session.dnsbl = session.server.svcCtx.DNSBL.CheckIP(session.remoteIP())
+	logDNSBLListings(session.dnsbl)
+}
+
+// checkHeloDNSBL HELO时查询HELO域名是否在DNS黑名单中，重复HELO时替换之前的结果
+func (session *SMTPSession) checkHeloDNSBL(helo string) {
+	if session.isLoopback() {
+		return
+	}
+
+	var listings []svc.DNSBLListing
+	for _, listing := range session.dnsbl {
+		if listing.Type != "domain" {
+			listings = append(listings, listing)
+		}
+	}
+	heloListings := session.server.svcCtx.DNSBL.CheckDomain(helo)
+	logDNSBLListings(heloListings)
+	session.dnsbl = append(listings, heloListings...)
+}
+
+// dnsblReject 获取需要拒收的黑名单，已认证的会话不拒收
+func (session *SMTPSession) dnsblReject() *svc.DNSBLListing {
+	if session.authenticated {
+		return nil
+	}
+	for i := range session.dnsbl {
+		if session.dnsbl[i].Action == "reject" {
+			return &session.dnsbl[i]
+		}
+	}
+	return nil
+}
+
+// dnsblRejectMessage 生成拒收的响应内容
+func dnsblRejectMessage(listing *svc.DNSBLListing) string {
+	if listing.Type == "domain" {
+		return fmt.Sprintf("5.7.1 Service unavailable; Helo command [%s] blocked using %s", listing.Target, listing.Zone)
+	}
+	return fmt.Sprintf("5.7.1 Service unavailable; Client host [%s] blocked using %s", listing.Target, listing.Zone)
+}
+
+func logDNSBLListings(listings []svc.DNSBLListing) {
+	for _, listing := range listings {
+		log.Printf("%s 在DNS黑名单 %s 中 (%s)，处理: %s", listing.Target, listing.Zone, listing.Code, listing.Action)
+	}
+}
@@ -3,17 +3,12 @@ package email
 import (
 	"bufio"
 	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math/big"
 	"miko-email/internal/config"
 	"mime/quotedprintable"
 	"net"
@@ -33,8 +28,13 @@ import (
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/encoding/traditionalchinese"
 	"golang.org/x/text/transform"
+	"miko-email/internal/services/attachment"
+	"miko-email/internal/services/bayes"
 	"miko-email/internal/services/forward"
+	"miko-email/internal/services/mailauth"
+	"miko-email/internal/services/sieve"
 	"miko-email/internal/services/smtp"
+	"miko-email/internal/services/spam"
 	"miko-email/internal/svc"
 
 	"github.com/jhillyerd/enmime/v2"
@@ -95,19 +95,34 @@ func (ct *ConnectionTracker) IsAllowed(ip string) bool {
 }
 
 type Service struct {
-	svcCtx         *svc.ServiceContext
-	tracker        *ConnectionTracker
-	forwardService *forward.Service
-	smtpClient     *smtp.OutboundClient
+	svcCtx            *svc.ServiceContext
+	tracker           *ConnectionTracker
+	forwardService    *forward.Service
+	attachmentService *attachment.Service
+	smtpClient        *smtp.OutboundClient
+	authService       *mailauth.Service
+	spamEngine        *spam.Engine
+	bayesService      *bayes.Service
+	sieveService      *sieve.Service
 }
 
 func NewService(svcCtx *svc.ServiceContext) *Service {
-	return &Service{
-		svcCtx:         svcCtx,
-		tracker:        NewConnectionTracker(),
-		forwardService: forward.NewService(svcCtx),
-		smtpClient:     smtp.NewOutboundClientWithSvcCtx(svcCtx),
+	s := &Service{
+		svcCtx:            svcCtx,
+		tracker:           NewConnectionTracker(),
+		forwardService:    forward.NewService(svcCtx),
+		attachmentService: attachment.NewService(svcCtx),
+		smtpClient:        smtp.NewOutboundClientWithSvcCtx(svcCtx),
+		authService:       mailauth.NewService(),
+		spamEngine:        spam.NewEngine(svcCtx),
+		bayesService:      bayes.NewService(svcCtx),
+		sieveService:      sieve.NewService(svcCtx),
 	}
+
+	// 贝叶斯分类器参与评分，邮件移入或移出垃圾邮件时自动训练
+	s.spamEngine.SetClassifier(s.bayesService)
+	svcCtx.EmailModel.SetFolderChangeHook(s.bayesService.OnFolderChange)
+	return s
 }
 
 // StartSMTPServer 启动SMTP服务器
@@ -147,26 +162,7 @@ func (s *Service) startPlainSMTPServer(port string) error {
 
 // startSMTPSServer 启动SMTPS服务器（465端口，SSL）
 func (s *Service) startSMTPSServer(port string) error {
-	// 创建自签名证书（生产环境应使用真实证书）
-	cert, err := s.generateSelfSignedCert()
-	if err != nil {
-		log.Printf("警告：无法生成SSL证书，465端口将使用普通连接: %v", err)
-		return s.startPlainSMTPServer(port)
-	}
-
-	// 获取配置中的域名
-	cfg := config.Load()
-	serverName := cfg.Domain
-	if serverName == "" || serverName == "localhost" {
-		serverName = "mail.local"
-	}
-
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		ServerName:   serverName,
-	}
-
-	listener, err := tls.Listen("tcp", ":"+port, tlsConfig)
+	listener, err := tls.Listen("tcp", ":"+port, s.serverTLSConfig())
 	if err != nil {
 		return fmt.Errorf("failed to start SMTPS server: %w", err)
 	}
@@ -206,49 +202,9 @@ func (s *Service) startSMTPWithSTARTTLS(port string) error {
 	}
 }
 
-// generateSelfSignedCert 生成自签名证书
-func (s *Service) generateSelfSignedCert() (tls.Certificate, error) {
-	// 加载配置
-	cfg := config.Load()
-
-	// 生成私钥
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return tls.Certificate{}, err
-	}
-
-	// 创建证书模板
-	template := x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			Organization:  []string{"Miko Email System"},
-			Country:       []string{"CN"},
-			Province:      []string{""},
-			Locality:      []string{""},
-			StreetAddress: []string{""},
-			PostalCode:    []string{""},
-		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().Add(365 * 24 * time.Hour), // 1年有效期
-		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		DNSNames:    []string{"localhost", cfg.Domain, "*." + cfg.Domain},
-	}
-
-	// 生成证书
-	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
-	if err != nil {
-		return tls.Certificate{}, err
-	}
-
-	// 创建TLS证书
-	cert := tls.Certificate{
-		Certificate: [][]byte{certDER},
-		PrivateKey:  priv,
-	}
-
-	return cert, nil
+// serverTLSConfig 邮件服务的TLS配置（SMTPS/STARTTLS/IMAPS/POP3S与Web共用同一个证书提供者）
+func (s *Service) serverTLSConfig() *tls.Config {
+	return s.svcCtx.Certificates.TLSConfig()
 }
 
 // StartIMAPServer 启动IMAP服务器
@@ -270,7 +226,30 @@ func (s *Service) StartIMAPServer(port string) error {
 			continue
 		}
 
-		go s.handleIMAPConnection(conn)
+		go s.handleIMAPConnection(conn, false)
+	}
+}
+
+// StartIMAPSServer 启动IMAPS服务器（993端口，隐式TLS）
+func (s *Service) StartIMAPSServer(port string) error {
+	log.Printf("IMAPS server starting on port %s", port)
+
+	listener, err := tls.Listen("tcp", ":"+port, s.serverTLSConfig())
+	if err != nil {
+		return fmt.Errorf("failed to start IMAPS server: %w", err)
+	}
+	defer listener.Close()
+
+	log.Printf("IMAPS server listening on port %s (SSL)", port)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("IMAPS connection error: %v", err)
+			continue
+		}
+
+		go s.handleIMAPConnection(conn, true)
 	}
 }
 
@@ -293,7 +272,30 @@ func (s *Service) StartPOP3Server(port string) error {
 			continue
 		}
 
-		go s.handlePOP3Connection(conn)
+		go s.handlePOP3Connection(conn, false)
+	}
+}
+
+// StartPOP3SServer 启动POP3S服务器（995端口，隐式TLS）
+func (s *Service) StartPOP3SServer(port string) error {
+	log.Printf("POP3S server starting on port %s", port)
+
+	listener, err := tls.Listen("tcp", ":"+port, s.serverTLSConfig())
+	if err != nil {
+		return fmt.Errorf("failed to start POP3S server: %w", err)
+	}
+	defer listener.Close()
+
+	log.Printf("POP3S server listening on port %s (SSL)", port)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("POP3S connection error: %v", err)
+			continue
+		}
+
+		go s.handlePOP3Connection(conn, true)
 	}
 }
 
@@ -324,8 +326,6 @@ func (s *Service) handleSMTPConnection(conn net.Conn, isSSL bool) {
 	if serverDomain == "" || serverDomain == "localhost" {
 		serverDomain = "mail.local"
 	}
-	s.writeResponse(writer, 220, fmt.Sprintf("%s Miko Email SMTP Server Ready", serverDomain))
-
 	session := &SMTPSession{
 		conn:   conn,
 		reader: reader,
@@ -334,6 +334,11 @@ func (s *Service) handleSMTPConnection(conn net.Conn, isSSL bool) {
 		isSSL:  isSSL,
 	}
 
+	// 查询DNS黑名单，命中需要拒收的黑名单时在MAIL FROM阶段拒收未认证的邮件
+	session.checkClientDNSBL()
+
+	s.writeResponse(writer, 220, fmt.Sprintf("%s Miko Email SMTP Server Ready", serverDomain))
+
 	session.handle()
 }
 
@@ -376,13 +381,19 @@ type SMTPSession struct {
 	server        *Service
 	helo          string
 	from          string
+	hasMail       bool // 已收到MAIL命令（空信封发件人 <> 时 from 为空）
 	to            []string
+	targets       map[string]*recipientTarget // 本地收件人实际投递的位置（小写的收件人地址 -> 邮箱和群组外部成员）
 	data          []byte
 	username      string
 	password      string
 	authenticated bool
 	tlsEnabled    bool
 	isSSL         bool
+	authResult    *mailauth.Result         // 收信认证结果（SPF/DKIM/DMARC），未验证时为nil
+	quarantine    bool                     // DMARC未通过，放入垃圾邮件
+	spamVerdicts  map[string]*spam.Verdict // 按收件人域名的垃圾邮件评分结果，未评分时为nil
+	dnsbl         []svc.DNSBLListing       // 客户端IP和HELO域名命中的DNS黑名单
 }
 
 // handle 处理SMTP会话
@@ -453,13 +464,9 @@ func (session *SMTPSession) writeResponse(code int, message string) error {
 func (session *SMTPSession) handleHelo(args string, command string) {
 	session.helo = args
 	log.Printf("SMTP握手: %s (来自 %s)", args, session.conn.RemoteAddr())
+	session.checkHeloDNSBL(args)
 
-	// 获取配置的域名作为服务器主机名
-	cfg := config.Load()
-	serverHostname := cfg.Domain
-	if serverHostname == "" || serverHostname == "localhost" {
-		serverHostname = "mail.local"
-	}
+	serverHostname := smtpServerHostname()
 
 	if command == "EHLO" {
 		// EHLO响应，支持扩展，使用配置的域名作为主机名
@@ -487,32 +494,12 @@ func (session *SMTPSession) handleStartTLS() {
 		return
 	}
 
-	// 生成自签名证书
-	cert, err := session.server.generateSelfSignedCert()
-	if err != nil {
-		log.Printf("生成TLS证书失败: %v", err)
-		session.writeResponse(454, "TLS not available due to temporary reason")
-		return
-	}
-
 	// 发送准备开始TLS的响应
 	session.writeResponse(220, "Ready to start TLS")
 
-	// 创建TLS配置
-	cfg := config.Load()
-	serverName := cfg.Domain
-	if serverName == "" || serverName == "localhost" {
-		serverName = "mail.local"
-	}
-
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		ServerName:   serverName,
-	}
-
 	// 将连接升级为TLS
-	tlsConn := tls.Server(session.conn, tlsConfig)
-	err = tlsConn.Handshake()
+	tlsConn := tls.Server(session.conn, session.server.serverTLSConfig())
+	err := tlsConn.Handshake()
 	if err != nil {
 		log.Printf("TLS握手失败: %v", err)
 		return
@@ -531,18 +518,6 @@ func (session *SMTPSession) handleStartTLS() {
 	session.helo = ""
 }
 
-// IMAPSession IMAP会话
-type IMAPSession struct {
-	conn    net.Conn
-	reader  *bufio.Reader
-	writer  *bufio.Writer
-	server  *Service
-	state   string // NOTAUTHENTICATED, AUTHENTICATED, SELECTED
-	user    string
-	mailbox string
-	tag     string
-}
-
 // POP3Session POP3会话
 type POP3Session struct {
 	conn      net.Conn
@@ -554,6 +529,8 @@ type POP3Session struct {
 	mailboxID int
 	emails    []POP3Email
 	deleted   map[int]bool
+
+	tlsEnabled bool // 是否已加密（POP3S或STLS之后）
 }
 
 // POP3Email POP3邮件信息
@@ -565,352 +542,7 @@ type POP3Email struct {
 	To      string
 	Date    string
 	Body    string
-}
-
-// handleIMAPConnection 处理IMAP连接
-func (s *Service) handleIMAPConnection(conn net.Conn) {
-	defer conn.Close()
-
-	log.Printf("新的IMAP连接: %s", conn.RemoteAddr())
-
-	// 设置连接超时
-	conn.SetDeadline(time.Now().Add(30 * time.Minute))
-
-	reader := bufio.NewReader(conn)
-	writer := bufio.NewWriter(conn)
-
-	session := &IMAPSession{
-		conn:   conn,
-		reader: reader,
-		writer: writer,
-		server: s,
-		state:  "NOTAUTHENTICATED",
-	}
-
-	// 发送欢迎消息
-	session.writeResponse("* OK Miko Email IMAP Server Ready")
-
-	session.handle()
-}
-
-// handle 处理IMAP会话
-func (session *IMAPSession) handle() {
-	for {
-		line, _, err := session.reader.ReadLine()
-		if err != nil {
-			log.Printf("读取命令失败: %v", err)
-			return
-		}
-
-		command := strings.TrimSpace(string(line))
-		if command == "" {
-			continue
-		}
-
-		log.Printf("IMAP命令: %s", command)
-
-		parts := strings.Fields(command)
-		if len(parts) < 2 {
-			session.writeResponse("* BAD Invalid command")
-			continue
-		}
-
-		tag := parts[0]
-		cmd := strings.ToUpper(parts[1])
-		args := parts[2:]
-
-		session.tag = tag
-
-		switch cmd {
-		case "CAPABILITY":
-			session.handleCapability()
-		case "LOGIN":
-			session.handleLogin(args)
-		case "LIST":
-			session.handleList(args)
-		case "SELECT":
-			session.handleSelect(args)
-		case "SEARCH":
-			session.handleSearch(args)
-		case "FETCH":
-			session.handleFetch(args)
-		case "LOGOUT":
-			session.handleLogout()
-			return
-		default:
-			session.writeTaggedResponse("BAD Command not implemented")
-		}
-	}
-}
-
-// writeResponse 写入响应
-func (session *IMAPSession) writeResponse(response string) {
-	session.writer.WriteString(response + "\r\n")
-	session.writer.Flush()
-}
-
-// writeTaggedResponse 写入带标签的响应
-func (session *IMAPSession) writeTaggedResponse(response string) {
-	session.writeResponse(session.tag + " " + response)
-}
-
-// handleCapability 处理CAPABILITY命令
-func (session *IMAPSession) handleCapability() {
-	session.writeResponse("* CAPABILITY IMAP4rev1 AUTH=PLAIN AUTH=LOGIN")
-	session.writeTaggedResponse("OK CAPABILITY completed")
-}
-
-// handleLogin 处理LOGIN命令
-func (session *IMAPSession) handleLogin(args []string) {
-	if len(args) < 2 {
-		session.writeTaggedResponse("BAD LOGIN requires username and password")
-		return
-	}
-
-	username := strings.Trim(args[0], "\"")
-	password := strings.Trim(args[1], "\"")
-
-	// 支持多种认证方式
-	if session.authenticateIMAPUser(username, password) {
-		session.state = "AUTHENTICATED"
-		session.user = username
-		log.Printf("IMAP登录成功: %s", username)
-		session.writeTaggedResponse("OK LOGIN completed")
-	} else {
-		log.Printf("IMAP登录失败: %s", username)
-		session.writeTaggedResponse("NO LOGIN failed")
-	}
-}
-
-// authenticateIMAPUser IMAP用户认证（支持多种认证方式）
-func (session *IMAPSession) authenticateIMAPUser(username, password string) bool {
-	log.Printf("IMAP认证开始: 用户名=%s", username)
-
-	// 方式1: 直接邮箱认证 (邮箱地址 + 邮箱密码)
-	log.Printf("尝试方式1: 直接邮箱认证")
-	if session.authenticateByMailbox(username, password) {
-		log.Printf("方式1认证成功")
-		return true
-	}
-
-	// 方式2: 组合认证 (网站账号@邮箱地址 + 邮箱密码)
-	// 格式: "网站用户名@邮箱地址" + "邮箱密码"
-	log.Printf("尝试方式2: 组合认证")
-	if strings.Contains(username, "@") {
-		parts := strings.Split(username, "@")
-		log.Printf("用户名分割结果: %v", parts)
-		if len(parts) >= 2 {
-			// 重新组合邮箱地址
-			emailParts := parts[1:]
-			emailAddr := strings.Join(emailParts, "@")
-			websiteUser := parts[0]
-
-			log.Printf("解析结果: 网站用户=%s, 邮箱地址=%s", websiteUser, emailAddr)
-
-			// 验证邮箱和密码
-			if session.authenticateByMailbox(emailAddr, password) {
-				log.Printf("邮箱密码验证成功")
-				// 同时验证网站用户是否有权限访问该邮箱
-				if session.verifyUserMailboxAccess(websiteUser, emailAddr) {
-					log.Printf("组合认证成功: 网站用户=%s, 邮箱=%s", websiteUser, emailAddr)
-					return true
-				} else {
-					log.Printf("用户权限验证失败")
-				}
-			} else {
-				log.Printf("邮箱密码验证失败")
-			}
-		}
-	}
-
-	// 方式3: 网站用户认证 (网站用户名 + 网站密码)
-	log.Printf("尝试方式3: 网站用户认证")
-	if session.authenticateByWebsiteUser(username, password) {
-		log.Printf("方式3认证成功")
-		return true
-	}
-
-	log.Printf("所有认证方式都失败")
-	return false
-}
-
-// authenticateByMailbox 通过邮箱认证
-func (session *IMAPSession) authenticateByMailbox(email, password string) bool {
-	mailbox, err := session.server.svcCtx.MailboxModel.GetByEmailAndPassword(email, password)
-	if err != nil {
-		return false
-	}
-
-	return mailbox != nil
-}
-
-// verifyUserMailboxAccess 验证网站用户是否有权限访问指定邮箱
-func (session *IMAPSession) verifyUserMailboxAccess(websiteUser, email string) bool {
-	// 先获取用户
-	user, err := session.server.svcCtx.UserModel.GetByUsername(websiteUser)
-	if err != nil {
-		log.Printf("获取用户失败: %v", err)
-		return false
-	}
-
-	// 检查用户是否拥有该邮箱
-	mailbox, err := session.server.svcCtx.MailboxModel.GetByEmailAndUserId(email, user.Id)
-	if err != nil {
-		log.Printf("验证用户邮箱权限失败: %v", err)
-		return false
-	} else if !mailbox.IsActive {
-		log.Printf("验证用户邮箱权限失败: %v", err)
-		return false
-	}
-
-	log.Printf("用户权限验证: 网站用户=%s, 邮箱=%s, 验证成功", websiteUser, email)
-	return true
-}
-
-// authenticateByWebsiteUser 通过网站用户认证
-func (session *IMAPSession) authenticateByWebsiteUser(username, password string) bool {
-	user, err := session.server.svcCtx.UserModel.GetByEmail(username)
-	if err != nil {
-		return false
-	}
-
-	// 使用bcrypt验证密码
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	return err == nil
-}
-
-// handleList 处理LIST命令
-func (session *IMAPSession) handleList(args []string) {
-	if session.state != "AUTHENTICATED" && session.state != "SELECTED" {
-		session.writeTaggedResponse("NO Not authenticated")
-		return
-	}
-
-	session.writeResponse("* LIST () \"/\" \"INBOX\"")
-	session.writeTaggedResponse("OK LIST completed")
-}
-
-// handleSelect 处理SELECT命令
-func (session *IMAPSession) handleSelect(args []string) {
-	if session.state != "AUTHENTICATED" && session.state != "SELECTED" {
-		session.writeTaggedResponse("NO Not authenticated")
-		return
-	}
-
-	if len(args) < 1 {
-		session.writeTaggedResponse("BAD SELECT requires mailbox name")
-		return
-	}
-
-	mailbox := strings.Trim(args[0], "\"")
-	if strings.ToUpper(mailbox) != "INBOX" {
-		session.writeTaggedResponse("NO Mailbox does not exist")
-		return
-	}
-
-	// 获取邮件数量 - 查询收件箱邮件
-	count, err := session.server.svcCtx.EmailModel.CountEmailsByUserEmail(session.user, "inbox")
-	if err != nil {
-		log.Printf("查询邮件数量失败: %v", err)
-		count = 0
-	}
-
-	session.state = "SELECTED"
-	session.mailbox = "INBOX"
-
-	session.writeResponse(fmt.Sprintf("* %d EXISTS", count))
-	session.writeResponse("* 0 RECENT")
-	session.writeResponse("* OK [UIDVALIDITY 1] UIDs valid")
-	session.writeTaggedResponse("OK [READ-WRITE] SELECT completed")
-}
-
-// handleSearch 处理SEARCH命令
-func (session *IMAPSession) handleSearch(args []string) {
-	if session.state != "SELECTED" {
-		session.writeTaggedResponse("NO Not selected")
-		return
-	}
-
-	// 简化实现，支持基本的SEARCH命令
-	// 目前只支持 "ALL" 搜索
-	if len(args) == 0 || strings.ToUpper(args[0]) != "ALL" {
-		session.writeTaggedResponse("BAD SEARCH command requires ALL parameter")
-		return
-	}
-
-	// 查询用户的所有邮件ID
-	emails, err := session.server.svcCtx.EmailModel.GetEmailsByUserEmail(session.user, "inbox", 0)
-	if err != nil {
-		log.Printf("SEARCH查询失败: %v", err)
-		session.writeTaggedResponse("NO SEARCH failed")
-		return
-	}
-
-	var emailIDs []string
-	for _, email := range emails {
-		emailIDs = append(emailIDs, fmt.Sprintf("%d", email.Id))
-	}
-
-	// 返回搜索结果
-	if len(emailIDs) > 0 {
-		session.writeResponse("* SEARCH " + strings.Join(emailIDs, " "))
-	} else {
-		session.writeResponse("* SEARCH")
-	}
-	session.writeTaggedResponse("OK SEARCH completed")
-}
-
-// handleFetch 处理FETCH命令
-func (session *IMAPSession) handleFetch(args []string) {
-	if session.state != "SELECTED" {
-		session.writeTaggedResponse("NO Not selected")
-		return
-	}
-
-	if len(args) < 2 {
-		session.writeTaggedResponse("BAD FETCH requires sequence set and data items")
-		return
-	}
-
-	// 解析参数
-	dataItems := strings.Join(args[1:], " ")
-
-	// 查询邮件数据
-	emails, err := session.server.svcCtx.EmailModel.GetEmailsByUserEmail(session.user, "inbox", 10)
-	if err != nil {
-		session.writeTaggedResponse("NO FETCH failed")
-		return
-	}
-
-	seqNum := 1
-	for _, email := range emails {
-
-		// 根据请求的数据项返回不同的信息
-		if strings.Contains(dataItems, "RFC822") {
-			// 构造完整的邮件内容
-			emailContent := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s",
-				email.FromAddr, email.ToAddr, email.Subject, email.CreatedAt.Format("2006-01-02 15:04:05"), email.Body)
-
-			// 返回RFC822格式的邮件
-			session.writeResponse(fmt.Sprintf("* %d FETCH (RFC822 {%d}", seqNum, len(emailContent)))
-			session.writer.WriteString(emailContent)
-			session.writer.WriteString(")\r\n")
-			session.writer.Flush()
-		} else {
-			// 返回基本信息
-			session.writeResponse(fmt.Sprintf("* %d FETCH (UID %d RFC822.SIZE %d ENVELOPE (\"%s\" \"%s\" ((\"%s\" NIL \"%s\" NIL)) NIL NIL NIL NIL NIL))",
-				seqNum, email.Id, len(email.Body), email.CreatedAt.Format("2006-01-02 15:04:05"), email.Subject, email.FromAddr, email.FromAddr))
-		}
-		seqNum++
-	}
-
-	session.writeTaggedResponse("OK FETCH completed")
-}
-
-// handleLogout 处理LOGOUT命令
-func (session *IMAPSession) handleLogout() {
-	session.writeResponse("* BYE Miko Email IMAP Server logging out")
-	session.writeTaggedResponse("OK LOGOUT completed")
+	email   *model.Email
 }
 
 // handleAuth 处理AUTH命令
@@ -1017,7 +649,7 @@ func (session *SMTPSession) handleAuthLogin() {
 }
 
 // handlePOP3Connection 处理POP3连接
-func (s *Service) handlePOP3Connection(conn net.Conn) {
+func (s *Service) handlePOP3Connection(conn net.Conn, isTLS bool) {
 	defer conn.Close()
 
 	log.Printf("新的POP3连接: %s", conn.RemoteAddr())
@@ -1035,6 +667,8 @@ func (s *Service) handlePOP3Connection(conn net.Conn) {
 		server:  s,
 		state:   "AUTHORIZATION",
 		deleted: make(map[int]bool),
+
+		tlsEnabled: isTLS,
 	}
 
 	// 发送欢迎消息
@@ -1071,6 +705,10 @@ func (session *POP3Session) handle() {
 		switch session.state {
 		case "AUTHORIZATION":
 			switch cmd {
+			case "CAPA":
+				session.handleCapa()
+			case "STLS":
+				session.handleStls()
 			case "USER":
 				session.handleUser(args)
 			case "PASS":
@@ -1099,6 +737,8 @@ func (session *POP3Session) handle() {
 				session.handleTop(args)
 			case "UIDL":
 				session.handleUidl(args)
+			case "CAPA":
+				session.handleCapa()
 			case "QUIT":
 				session.handleQuit()
 				return
@@ -1115,6 +755,46 @@ func (session *POP3Session) writeResponse(response string) {
 	session.writer.Flush()
 }
 
+// handleCapa 处理CAPA命令（RFC 2449）
+func (session *POP3Session) handleCapa() {
+	session.writeResponse("+OK Capability list follows")
+	if !session.tlsEnabled && session.state == "AUTHORIZATION" {
+		session.writeResponse("STLS")
+	}
+	if session.tlsEnabled || !config.IsPlaintextAuthDisabled() {
+		session.writeResponse("USER")
+	}
+	session.writeResponse("TOP")
+	session.writeResponse("UIDL")
+	session.writeResponse(".")
+}
+
+// handleStls 处理STLS命令（RFC 2595），将连接升级为TLS
+func (session *POP3Session) handleStls() {
+	if session.tlsEnabled {
+		session.writeResponse("-ERR TLS already active")
+		return
+	}
+
+	session.writeResponse("+OK Begin TLS negotiation")
+
+	tlsConn := tls.Server(session.conn, session.server.serverTLSConfig())
+	if err := tlsConn.Handshake(); err != nil {
+		log.Printf("POP3 TLS握手失败: %v", err)
+		session.conn.Close()
+		return
+	}
+
+	log.Printf("POP3 TLS连接建立成功: %s", session.conn.RemoteAddr())
+
+	// 升级后丢弃之前的会话状态
+	session.conn = tlsConn
+	session.reader = bufio.NewReader(tlsConn)
+	session.writer = bufio.NewWriter(tlsConn)
+	session.tlsEnabled = true
+	session.user = ""
+}
+
 // handleUser 处理USER命令
 func (session *POP3Session) handleUser(args []string) {
 	if len(args) != 1 {
@@ -1122,6 +802,11 @@ func (session *POP3Session) handleUser(args []string) {
 		return
 	}
 
+	if !session.tlsEnabled && config.IsPlaintextAuthDisabled() {
+		session.writeResponse("-ERR [AUTH] Plaintext authentication disallowed on non-secure connection, use STLS")
+		return
+	}
+
 	session.user = args[0]
 	session.writeResponse("+OK User accepted")
 }
@@ -1170,8 +855,23 @@ func (session *POP3Session) loadEmails() error {
 		return err
 	}
 
+	// 批量获取原文大小
+	emailIDs := make([]int64, 0, len(emails))
+	for _, email := range emails {
+		emailIDs = append(emailIDs, email.Id)
+	}
+	sizes, err := session.server.svcCtx.EmailRawModel.GetSizesByEmailIds(emailIDs)
+	if err != nil {
+		return err
+	}
+
 	session.emails = []POP3Email{}
 	for _, email := range emails {
+		size, ok := sizes[email.Id]
+		if !ok {
+			// 没有保存原文的邮件，使用重建报文的大小
+			size = int64(len(buildRFC822Message(email)))
+		}
 		pop3Email := POP3Email{
 			ID:      int(email.Id),
 			From:    email.FromAddr,
@@ -1179,7 +879,8 @@ func (session *POP3Session) loadEmails() error {
 			Subject: email.Subject,
 			Body:    email.Body,
 			Date:    email.CreatedAt.Format("2006-01-02 15:04:05"),
-			Size:    len(email.Body) + len(email.Subject) + len(email.FromAddr) + len(email.ToAddr) + 100, // 估算大小
+			Size:    int(size),
+			email:   email,
 		}
 		session.emails = append(session.emails, pop3Email)
 	}
@@ -1255,17 +956,22 @@ func (session *POP3Session) handleRetr(args []string) {
 
 	email := session.emails[msgNum-1]
 
-	// 构造完整的邮件内容
-	emailContent := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s",
-		email.From, email.To, email.Subject, email.Date, email.Body)
+	// 读取完整的邮件原文
+	raw, err := session.server.GetRawMessage(email.email)
+	if err != nil {
+		log.Printf("读取邮件原文失败: %v", err)
+		session.writeResponse("-ERR Failed to read message")
+		return
+	}
+	emailContent := toCRLF(raw)
 
 	session.writeResponse(fmt.Sprintf("+OK %d octets", len(emailContent)))
 
-	// 发送邮件内容
-	session.writer.WriteString(emailContent)
+	// 发送邮件内容（行首的点需要填充）
+	session.writer.Write(dotStuff(emailContent))
 
 	// 确保邮件内容以换行结束，然后发送结束标记
-	if !strings.HasSuffix(emailContent, "\r\n") {
+	if !bytes.HasSuffix(emailContent, []byte("\r\n")) {
 		session.writer.WriteString("\r\n")
 	}
 	session.writer.WriteString(".\r\n")
@@ -1331,24 +1037,28 @@ func (session *POP3Session) handleTop(args []string) {
 
 	email := session.emails[msgNum-1]
 
-	// 构造邮件头
-	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n",
-		email.From, email.To, email.Subject, email.Date)
+	// 读取完整的邮件原文，拆分出邮件头
+	raw, err := session.server.GetRawMessage(email.email)
+	if err != nil {
+		log.Printf("读取邮件原文失败: %v", err)
+		session.writeResponse("-ERR Failed to read message")
+		return
+	}
+	header, body := splitRawMessage(toCRLF(raw))
 
 	// 获取指定行数的正文
-	bodyLines := strings.Split(email.Body, "\n")
+	bodyLines := bytes.SplitAfter(body, []byte("\r\n"))
 	if lines > len(bodyLines) {
 		lines = len(bodyLines)
 	}
 
-	body := strings.Join(bodyLines[:lines], "\n")
-	content := header + body
+	content := append(append([]byte{}, header...), bytes.Join(bodyLines[:lines], nil)...)
 
 	session.writeResponse("+OK")
-	session.writer.WriteString(content)
+	session.writer.Write(dotStuff(content))
 
 	// 确保内容以换行结束，然后发送结束标记
-	if !strings.HasSuffix(content, "\r\n") {
+	if !bytes.HasSuffix(content, []byte("\r\n")) {
 		session.writer.WriteString("\r\n")
 	}
 	session.writer.WriteString(".\r\n")
@@ -1397,7 +1107,7 @@ func (session *POP3Session) handleQuit() {
 		for msgNum := range session.deleted {
 			if msgNum > 0 && msgNum <= len(session.emails) {
 				email := session.emails[msgNum-1]
-				err := session.server.svcCtx.EmailModel.DeleteEmailById(nil, int64(email.ID))
+				err := session.server.deleteEmailWithRaw(email.email)
 				if err != nil {
 					log.Printf("删除邮件失败: %v", err)
 				} else {
@@ -1417,6 +1127,14 @@ func (session *SMTPSession) handleMail(args string) {
 		return
 	}
 
+	// 命中需要拒收的DNS黑名单时，只接受认证后的提交
+	if listing := session.dnsblReject(); listing != nil {
+		session.server.svcCtx.DNSBL.RecordReject(*listing)
+		log.Printf("拒收来自 %s 的邮件: %s 在DNS黑名单 %s 中", session.conn.RemoteAddr(), listing.Target, listing.Zone)
+		session.writeResponse(554, dnsblRejectMessage(listing))
+		return
+	}
+
 	// 提取FROM:后面的内容
 	fromPart := strings.TrimSpace(args[5:])
 
@@ -1426,6 +1144,7 @@ func (session *SMTPSession) handleMail(args string) {
 		from := strings.Trim(parts[0], "<>")
 
 		session.from = from
+		session.hasMail = true
 		log.Printf("设置发件人: %s (来自 %s)", from, session.conn.RemoteAddr())
 	} else {
 		log.Printf("MAIL FROM语法错误: %s (来自 %s)", args, session.conn.RemoteAddr())
@@ -1446,37 +1165,54 @@ func (session *SMTPSession) handleRcpt(args string) {
 	to := strings.TrimSpace(args[3:])
 	to = strings.Trim(to, "<>")
 
-	// 检查收件人是否为本域用户
-	if session.isLocalUser(to) {
+	target, status := session.resolveRecipient(to)
+	switch status {
+	case rcptLocal:
+		// 外部服务器首次投递时暂时拒绝，等待重试
+		if !session.checkGreylist(to) {
+			session.writeResponse(451, "4.7.1 Greylisted, please try again later")
+			return
+		}
+
 		// 本域用户，允许接收
-		session.to = append(session.to, to)
+		session.addRecipient(to, target)
 		log.Printf("添加本域收件人: %s (来自 %s)", to, session.conn.RemoteAddr())
 		session.writeResponse(250, "OK")
 		return
-	}
-
-	// 外部邮箱，需要认证才能发送
-	if !session.isValidExternalEmail(to) {
-		log.Printf("无效的收件人地址: %s (来自 %s)", to, session.conn.RemoteAddr())
-		session.writeResponse(550, "Invalid recipient address")
+	case rcptUnknown:
+		log.Printf("本域收件人不存在: %s (来自 %s)", to, session.conn.RemoteAddr())
+		session.writeResponse(550, "5.1.1 Recipient address rejected: User unknown")
+		return
+	case rcptDisabled:
+		log.Printf("本域收件人已停用: %s (来自 %s)", to, session.conn.RemoteAddr())
+		session.writeResponse(550, "5.2.1 Recipient address rejected: Mailbox disabled")
+		return
+	case rcptError:
+		session.writeResponse(451, "4.3.0 Temporary lookup failure")
 		return
 	}
 
-	// 检查是否有权限发送到外部邮箱
+	// 外部邮箱，未认证时拒绝中继
 	if !session.authenticated {
 		log.Printf("未认证用户尝试发送到外部邮箱: %s (来自 %s)", to, session.conn.RemoteAddr())
-		session.writeResponse(550, "Authentication required for external delivery")
+		session.writeResponse(554, "5.7.1 Relay access denied")
 		return
 	}
 
-	session.to = append(session.to, to)
+	if !session.isValidExternalEmail(to) {
+		log.Printf("无效的收件人地址: %s (来自 %s)", to, session.conn.RemoteAddr())
+		session.writeResponse(550, "Invalid recipient address")
+		return
+	}
+
+	session.addRecipient(to, nil)
 	log.Printf("添加外部收件人: %s (来自 %s)", to, session.conn.RemoteAddr())
 	session.writeResponse(250, "OK")
 }
 
 // handleData 处理DATA命令
 func (session *SMTPSession) handleData() {
-	if session.from == "" || len(session.to) == 0 {
+	if !session.hasMail || len(session.to) == 0 {
 		session.writeResponse(503, "Bad sequence of commands")
 		return
 	}
@@ -1502,13 +1238,43 @@ func (session *SMTPSession) handleData() {
 			break
 		}
 
-		data = append(data, []byte(line)...)
+		data = append(data, []byte(dotUnstuff(line))...)
 	}
 
 	session.data = data
 
+	// 验证SPF/DKIM/DMARC，按策略拒收
+	if temporary, err := session.verifyInbound(); err != nil {
+		log.Printf("拒收邮件: %v (发件人: %s, 来自 %s)", err, session.from, session.conn.RemoteAddr())
+		if temporary {
+			session.writeResponse(451, "4.7.5 "+err.Error())
+		} else {
+			session.writeResponse(550, "5.7.1 Message rejected due to DMARC policy")
+		}
+		session.reset()
+		return
+	}
+
+	// 删除发件人伪造的垃圾邮件评分头（在DKIM验证之后，不影响签名验证）
+	session.stripSpamHeaders()
+
+	// 垃圾邮件评分，得分达到拒收阈值时拒收
+	if err := session.scoreSpam(); err != nil {
+		log.Printf("拒收邮件: %v (发件人: %s, 来自 %s)", err, session.from, session.conn.RemoteAddr())
+		session.writeResponse(550, "5.7.1 Message rejected as spam")
+		session.reset()
+		return
+	}
+
 	// 保存邮件到数据库
 	if err := session.saveEmail(); err != nil {
+		var rejection *sieveRejectError
+		if errors.As(err, &rejection) {
+			log.Printf("拒收邮件: %v (发件人: %s, 来自 %s)", err, session.from, session.conn.RemoteAddr())
+			session.writeResponse(550, "5.7.1 "+rejection.smtpReply())
+			session.reset()
+			return
+		}
 		log.Printf("保存邮件失败: %v", err)
 		session.writeResponse(550, "Failed to save email")
 		return
@@ -1521,8 +1287,13 @@ func (session *SMTPSession) handleData() {
 // reset 重置会话状态
 func (session *SMTPSession) reset() {
 	session.from = ""
+	session.hasMail = false
 	session.to = nil
+	session.targets = nil
 	session.data = nil
+	session.authResult = nil
+	session.quarantine = false
+	session.spamVerdicts = nil
 }
 
 // isLocalUser 检查是否为本地用户
@@ -1566,7 +1337,7 @@ func (session *SMTPSession) canSendFrom(from string) bool {
 // hasLocalRecipients 检查是否有本地收件人
 func (session *SMTPSession) hasLocalRecipients() bool {
 	for _, recipient := range session.to {
-		if session.isLocalUser(recipient) {
+		if session.recipientTarget(recipient) != nil {
 			return true
 		}
 	}
@@ -1584,6 +1355,14 @@ func (session *SMTPSession) isAuthorizedSender(from string) bool {
 		return true
 	}
 
+	// 别名可以作为其投递邮箱的发件地址，按投递的邮箱检查权限
+	if mailbox := session.aliasMailbox(from); mailbox != nil {
+		if strings.EqualFold(mailbox.Email, session.username) {
+			return true
+		}
+		from = mailbox.Email
+	}
+
 	// 检查用户是否拥有该邮箱（通过users表关联）
 	user, err := session.server.svcCtx.UserModel.GetByEmail(session.username)
 	if err != nil {
@@ -1637,30 +1416,20 @@ func (session *SMTPSession) isValidExternalEmail(email string) bool {
 	return true
 }
 
-// sendToExternalEmail 发送邮件到外部邮箱
-func (s *Service) sendToExternalEmail(from, to, subject, body string) error {
-	// 使用SMTP客户端发送到外部邮箱
-	if s.smtpClient != nil && s.smtpClient.IsExternalEmail(to) {
-		err := s.smtpClient.SendEmail(from, to, subject, body)
-		if err != nil {
-			log.Printf("外部邮箱发送失败: %v", err)
-			return fmt.Errorf("外部邮箱发送失败: %w", err)
-		}
-		log.Printf("✅ 外部邮箱发送成功: %s -> %s", from, to)
-		return nil
-	}
-	return fmt.Errorf("无效的外部邮箱地址: %s", to)
-}
-
 // SaveEmail 保存邮件到数据库
 func (s *Service) SaveEmail(mailboxID int64, fromAddr, toAddr, subject, body string) error {
-	return s.svcCtx.EmailModel.SaveEmailToFolder(nil, mailboxID, fromAddr, toAddr, subject, body, "inbox")
+	if err := s.svcCtx.EmailModel.SaveEmailToFolder(nil, mailboxID, fromAddr, toAddr, subject, body, "inbox"); err != nil {
+		return err
+	}
+	s.notifyMailbox(mailboxID)
+	return nil
 }
 
 // saveEmail 保存邮件到数据库
 func (session *SMTPSession) saveEmail() error {
-	// 添加Received头部到邮件数据
+	// 添加Received头部和Authentication-Results头部到邮件数据
 	session.addReceivedHeader()
+	session.addAuthResultsHeader()
 
 	// 解析邮件内容
 	subject, body := session.parseEmailContent()
@@ -1669,50 +1438,173 @@ func (session *SMTPSession) saveEmail() error {
 	log.Printf("解析后的邮件 - Subject: %s, Body: %s", subject, body)
 
 	// 为每个收件人处理邮件
+	var external []string
+	var rejections []sieveRejection
+	var forwards []pendingForward
+	accepted := false
+	delivered := make(map[string]bool)
 	for _, to := range session.to {
-		if session.isLocalUser(to) {
-			// 本地用户，保存到数据库
-			mailboxID, err := session.server.svcCtx.MailboxModel.GetIdByEmail(to)
+		target := session.recipientTarget(to)
+		if target == nil {
+			// 外部邮箱，加入出站队列统一投递
+			external = appendAddress(external, to)
+			continue
+		}
+
+		for _, mailbox := range target.mailboxes {
+			// 同一邮箱（如既是收件人又是群组成员）只保存一次
+			if delivered[strings.ToLower(mailbox)] {
+				continue
+			}
+			delivered[strings.ToLower(mailbox)] = true
+
+			mailboxID, err := session.server.svcCtx.MailboxModel.GetIdByEmail(mailbox)
 			if err != nil {
 				log.Printf("获取邮箱ID失败: %v", err)
 				continue
 			}
 
-			// 插入邮件记录
-			log.Printf("准备插入数据库 - Body: %s", body)
-			err = session.server.svcCtx.EmailModel.SaveEmailToFolder(nil, mailboxID, session.from, to, subject, body, "inbox")
+			// 执行邮箱启用的Sieve脚本，被拒收的不保存
+			result, msg := session.runSieve(to, mailbox, mailboxID)
+			if result != nil && result.Reject {
+				rejections = append(rejections, sieveRejection{to: to, mailbox: mailbox, reason: result.Reason})
+				continue
+			}
+			accepted = true
+
+			// 先匹配转发规则（放入垃圾邮件或被Sieve丢弃的不转发），规则都不保留原邮件时不放入默认文件夹
+			var plan *forwardPlan
+			if !session.isJunk(to) && (result == nil || result.Keep || len(result.FileInto) > 0) {
+				plan = session.server.planForwardRules(mailbox, session.from, subject, body, session.data)
+			}
+			keepInbox := plan == nil || plan.keepOriginal()
+			withheld, err := session.deliverLocal(to, mailbox, mailboxID, subject, body, keepInbox, result, msg)
 			if err != nil {
-				log.Printf("插入邮件记录失败: %v", err)
 				return err
 			}
 
-			log.Printf("✅ 邮件保存成功 - 邮箱ID: %d, 主题: %s", mailboxID, subject)
+			if plan != nil {
+				f := pendingForward{plan: plan, to: to, mailbox: mailbox, mailboxID: mailboxID, withheld: withheld}
+				if result != nil {
+					f.flags = result.KeepFlags
+				}
+				forwards = append(forwards, f)
+			}
+		}
 
-			// 检查并执行转发规则
-			session.server.processForwardRules(to, session.from, subject, body)
-		} else {
-			// 外部邮箱，发送到外部
-			log.Printf("发送邮件到外部邮箱: %s", to)
-			err := session.server.sendToExternalEmail(session.from, to, subject, body)
-			if err != nil {
-				log.Printf("外部邮件发送失败: %v", err)
-				return err
+		// 群组的外部成员（放入垃圾邮件的不转发）
+		if len(target.external) > 0 {
+			accepted = true
+			if session.isJunk(to) {
+				log.Printf("邮件被判定为垃圾邮件，不投递到群组 %s 的外部成员", to)
+				continue
 			}
-			log.Printf("✅ 外部邮件发送成功: %s -> %s", session.from, to)
+			session.relayToGroupMembers(to, target.external)
 		}
 	}
 
-	return nil
+	if len(rejections) > 0 {
+		// 所有收件人都拒收时在SMTP会话中直接拒收，否则向发件人发送拒收通知
+		if !accepted && len(external) == 0 {
+			return &sieveRejectError{reason: rejections[0].reason}
+		}
+		session.sendRejectNotices(rejections, subject)
+	}
+
+	if len(external) > 0 {
+		log.Printf("发送邮件到外部邮箱: %s", strings.Join(external, ", "))
+		if _, err := session.server.smtpClient.QueueMIMEEmail(session.from, external, session.data); err != nil {
+			log.Printf("外部邮件加入队列失败: %v", err)
+			return err
+		}
+	}
+
+	// 所有收件人都保存成功后再发送转发邮件，避免保存失败、发件人重试时重复转发
+	var forwardErr error
+	for _, f := range forwards {
+		if err := session.applyForwardRules(f, subject, body); err != nil && forwardErr == nil {
+			forwardErr = err
+		}
+	}
+
+	return forwardErr
+}
+
+// pendingForward 保存成功后待发送的转发邮件
+type pendingForward struct {
+	plan      *forwardPlan
+	to        string
+	mailbox   string
+	mailboxID int64
+	flags     []string // Sieve keep 设置的IMAP标志
+	withheld  bool     // 转发规则不保留原邮件，没有放入默认文件夹
+}
+
+// applyForwardRules 发送转发邮件，没有放入默认文件夹的邮件在转发失败时补充保存，避免邮件丢失
+func (session *SMTPSession) applyForwardRules(f pendingForward, subject, body string) error {
+	if session.server.sendForwards(f.plan) || !f.withheld {
+		return nil
+	}
+	log.Printf("转发失败，原邮件放入邮箱 %s", f.mailbox)
+	_, err := session.saveToMailbox(f.to, f.mailbox, f.mailboxID, "", f.flags, subject, body)
+	return err
+}
+
+// saveToMailbox 将邮件保存到本地邮箱，to 为原始收件人地址（别名、子地址等），
+// folder 为空时放入收件箱（垃圾邮件放入垃圾邮件），flags 为Sieve脚本设置的IMAP标志
+func (session *SMTPSession) saveToMailbox(to, mailbox string, mailboxID int64, folder string, flags []string, subject, body string) (*model.Email, error) {
+	// 插入邮件记录及完整原文
+	log.Printf("准备插入数据库 - Body: %s", body)
+	email := &model.Email{
+		MailboxId: mailboxID,
+		FromAddr:  session.from,
+		ToAddr:    to,
+		Tag:       session.recipientTag(to, mailbox),
+		Subject:   subject,
+		Body:      body,
+		Folder:    "inbox",
+		IsRead:    false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	session.applyAuthResult(email)
+	raw := session.applySpamVerdict(email, session.data)
+	if folder != "" {
+		email.Folder = folder
+	}
+	applySieveFlags(email, flags)
+	if err := session.server.saveEmailWithRaw(email, raw); err != nil {
+		log.Printf("插入邮件记录失败: %v", err)
+		return nil, err
+	}
+
+	log.Printf("✅ 邮件保存成功 - 邮箱ID: %d, 主题: %s, 原文大小: %d", mailboxID, subject, len(session.data))
+	return email, nil
+}
+
+// relayToGroupMembers 将邮件转发给群组的外部成员（或SRS地址还原出的原发件人），
+// 信封发件人按群组地址的域名做SRS改写（与转发规则相同），加入队列失败只记录日志，不影响本地投递
+func (session *SMTPSession) relayToGroupMembers(group string, members []string) {
+	log.Printf("转发发送到 %s 的邮件到外部地址: %s", group, strings.Join(members, ", "))
+	envelope := session.server.forwardEnvelope(session.from, group)
+	if _, err := session.server.smtpClient.QueueMIMEEmail(envelope, members, session.data); err != nil {
+		log.Printf("群组 %s 的外部成员转发失败: %v", group, err)
+	}
+}
+
+// appendAddress 添加地址（忽略大小写去重）
+func appendAddress(addresses []string, address string) []string {
+	for _, existing := range addresses {
+		if strings.EqualFold(existing, address) {
+			return addresses
+		}
+	}
+	return append(addresses, address)
 }
 
 // addReceivedHeader 添加Received头部到邮件数据
 func (session *SMTPSession) addReceivedHeader() {
-	// 获取配置的域名作为服务器主机名
-	cfg := config.Load()
-	serverHostname := cfg.Domain
-	if serverHostname == "" || serverHostname == "localhost" {
-		serverHostname = "mail.local"
-	}
+	serverHostname := smtpServerHostname()
 
 	// 获取客户端信息
 	clientAddr := session.conn.RemoteAddr().String()
@@ -1730,17 +1622,34 @@ func (session *SMTPSession) addReceivedHeader() {
 	session.data = append([]byte(receivedHeader), session.data...)
 }
 
+// smtpServerHostname 获取本服务器的主机名（使用配置的域名），用于SMTP问候、Received头和Authentication-Results头
+func smtpServerHostname() string {
+	cfg := config.Load()
+	serverHostname := cfg.Domain
+	if serverHostname == "" || serverHostname == "localhost" {
+		serverHostname = "mail.local"
+	}
+	return serverHostname
+}
+
 // SaveEmailToSent 保存邮件到已发送文件夹
 func (s *Service) SaveEmailToSent(mailboxID int64, fromAddr, toAddr, subject, body string) error {
-	return s.svcCtx.EmailModel.SaveEmailToFolder(nil, mailboxID, fromAddr, toAddr, subject, body, "sent")
+	if err := s.svcCtx.EmailModel.SaveEmailToFolder(nil, mailboxID, fromAddr, toAddr, subject, body, "sent"); err != nil {
+		return err
+	}
+	s.notifyMailbox(mailboxID)
+	return nil
 }
 
 // parseEmailContent 解析邮件内容
 func (session *SMTPSession) parseEmailContent() (subject, body string) {
-	content := string(session.data)
+	return parseMessageContent(string(session.data))
+}
 
+// parseMessageContent 解析邮件原文的主题和正文（SMTP投递和IMAP APPEND共用）
+func parseMessageContent(content string) (subject, body string) {
 	// 首先尝试使用enmime解析
-	if parsedSubject, parsedBody := session.parseEmailWithEnmime(content); parsedSubject != "" || parsedBody != "" {
+	if parsedSubject, parsedBody := parseEmailWithEnmime(content); parsedSubject != "" || parsedBody != "" {
 		log.Printf("enmime解析成功")
 		return parsedSubject, parsedBody
 	}
@@ -1804,29 +1713,123 @@ func (session *SMTPSession) parseEmailContent() (subject, body string) {
 	return subject, body
 }
 
+// forwardPlan 邮件匹配的转发规则：保存邮件前决定是否保留原邮件，保存成功后再发送
+type forwardPlan struct {
+	sourceEmail string
+	fromAddr    string
+	subject     string
+	body        string
+	raw         []byte
+	trace       *forwardTrace
+	rules       []forward.ForwardRule
+}
+
+// keepOriginal 是否在源邮箱保留原邮件：匹配的规则都设置了不保留时才返回false
+func (p *forwardPlan) keepOriginal() bool {
+	for _, rule := range p.rules {
+		if rule.KeepOriginal {
+			return true
+		}
+	}
+	return false
+}
+
 // processForwardRules 处理邮件转发规则
-func (s *Service) processForwardRules(sourceEmail, fromAddr, subject, body string) {
+// raw 为收到的完整原文，规则转发附件时作为 message/rfc822 附件原样携带
+// 返回是否需要在源邮箱保留原邮件：匹配的规则都设置了不保留且全部转发成功时才返回false
+func (s *Service) processForwardRules(sourceEmail, fromAddr, subject, body string, raw []byte) bool {
+	plan := s.planForwardRules(sourceEmail, fromAddr, subject, body, raw)
+	if plan == nil {
+		return true
+	}
+	// 转发失败时保留原邮件，避免邮件丢失
+	return !s.sendForwards(plan) || plan.keepOriginal()
+}
+
+// planForwardRules 匹配邮箱的转发规则（不发送邮件），没有需要执行的规则时返回nil
+// 邮件的转发次数、Received头数量超过上限或已经由该邮箱转发过时不再转发，避免转发循环
+func (s *Service) planForwardRules(sourceEmail, fromAddr, subject, body string, raw []byte) *forwardPlan {
+	trace := parseForwardTrace(raw)
+	if reason := trace.loopReason(sourceEmail); reason != "" {
+		log.Printf("⚠️ 检测到转发循环，%s 不再转发邮件: %s", sourceEmail, reason)
+		return nil
+	}
+
 	// 获取该邮箱的活跃转发规则
 	rules, err := s.forwardService.GetActiveForwardRules(sourceEmail)
 	if err != nil {
 		log.Printf("获取转发规则失败: %v", err)
-		return
+		return nil
 	}
 
 	if len(rules) == 0 {
 		log.Printf("邮箱 %s 没有活跃的转发规则", sourceEmail)
-		return
+		return nil
 	}
 
-	log.Printf("找到 %d 个转发规则，开始处理转发", len(rules))
+	log.Printf("找到 %d 个转发规则，开始匹配", len(rules))
 
+	// 解析原文用于条件匹配，没有原文时（测试邮件）使用已知的信息
+	msg := &forward.MatchMessage{From: fromAddr, To: sourceEmail, Subject: subject, Size: int64(len(body))}
+	if len(raw) > 0 {
+		msg = forward.NewMatchMessage(raw)
+	}
+
+	plan := &forwardPlan{
+		sourceEmail: sourceEmail,
+		fromAddr:    fromAddr,
+		subject:     subject,
+		body:        body,
+		raw:         raw,
+		trace:       trace,
+	}
 	for _, rule := range rules {
+		match := rule.Match(msg)
+		if !match.Matched {
+			log.Printf("转发规则 %d 不匹配: %s", rule.ID, match.Explanation)
+			continue
+		}
+		if trace.seen(rule.TargetEmail) {
+			log.Printf("⚠️ 邮件已经由 %s 转发过，跳过转发规则 %d，避免转发循环", rule.TargetEmail, rule.ID)
+			continue
+		}
+		plan.rules = append(plan.rules, rule)
+
+		// 匹配的规则设置了停止处理时，不再执行后续规则
+		if rule.StopProcessing {
+			log.Printf("转发规则 %d 匹配后停止处理后续规则", rule.ID)
+			break
+		}
+	}
+	if len(plan.rules) == 0 {
+		return nil
+	}
+	return plan
+}
+
+// sendForwards 按匹配的转发规则发送转发邮件，返回是否全部转发成功
+// 超过转发频率限制的规则自动停用并通知用户，视为转发失败
+func (s *Service) sendForwards(plan *forwardPlan) bool {
+	ok := true
+	for _, rule := range plan.rules {
+		// 检查规则的转发频率，超过限制时自动停用规则并通知用户
+		allowed, limit, err := s.forwardService.TakeForwardQuota(rule)
+		if err != nil {
+			log.Printf("%v", err)
+			ok = false
+			continue
+		}
+		if !allowed {
+			s.disableForwardRule(rule, limit)
+			ok = false
+			continue
+		}
 		log.Printf("处理转发规则: %s -> %s", rule.SourceEmail, rule.TargetEmail)
 
 		// 构建转发邮件的主题
-		forwardSubject := subject
+		forwardSubject := plan.subject
 		if rule.SubjectPrefix != "" {
-			forwardSubject = rule.SubjectPrefix + " " + subject
+			forwardSubject = rule.SubjectPrefix + " " + plan.subject
 		}
 
 		// 构建转发邮件的内容
@@ -1838,47 +1841,69 @@ func (s *Service) processForwardRules(sourceEmail, fromAddr, subject, body strin
 时间: %s
 
 %s
-`, fromAddr, sourceEmail, subject, time.Now().Format("2006-01-02 15:04:05"), body)
+`, plan.fromAddr, plan.sourceEmail, plan.subject, time.Now().Format("2006-01-02 15:04:05"), plan.body)
 
-		// 发送转发邮件
-		err := s.sendForwardEmail(rule.SourceEmail, rule.TargetEmail, forwardSubject, forwardBody)
-		if err != nil {
+		// 构建转发报文，转发附件时原文作为附件，否则只转发正文
+		var original []byte
+		if rule.ForwardAttachments {
+			original = plan.raw
+		}
+		message := buildForwardMessage(rule.SourceEmail, rule.TargetEmail, forwardSubject, forwardBody, original, plan.trace.headers(rule.SourceEmail))
+
+		// 发送转发邮件，外部邮箱的信封发件人按SRS改写
+		envelope := s.forwardEnvelope(plan.fromAddr, rule.SourceEmail)
+		if err := s.sendForwardEmail(rule.SourceEmail, envelope, rule.TargetEmail, forwardSubject, forwardBody, message); err != nil {
 			log.Printf("转发邮件失败: %v", err)
+			ok = false
 			continue
 		}
 
 		// 更新转发次数
-		err = s.forwardService.IncrementForwardCount(rule.ID)
-		if err != nil {
+		if err := s.forwardService.IncrementForwardCount(rule.ID); err != nil {
 			log.Printf("更新转发次数失败: %v", err)
 		}
-
 		log.Printf("✅ 邮件转发成功: %s -> %s", rule.SourceEmail, rule.TargetEmail)
 	}
+	return ok
 }
 
-// sendForwardEmail 发送转发邮件
-func (s *Service) sendForwardEmail(fromAddr, toAddr, subject, body string) error {
+// sendForwardEmail 发送转发邮件，envelopeFrom 为转发到外部邮箱时的信封发件人
+func (s *Service) sendForwardEmail(fromAddr, envelopeFrom, toAddr, subject, body string, message []byte) error {
 	// 检查目标邮箱是否是本域邮箱
 	mailboxID, err := s.svcCtx.MailboxModel.GetIdByEmail(toAddr)
 
 	if err == nil {
-		// 目标是本域邮箱，直接保存到收件箱
+		// 目标是本域邮箱，先执行目标邮箱的转发规则（转发报文带有跟踪头部，循环时不会再转发）
 		log.Printf("转发到本域邮箱: %s", toAddr)
-		return s.SaveEmail(mailboxID, fromAddr, toAddr, subject, body)
+		if !s.processForwardRules(toAddr, fromAddr, subject, body, message) {
+			return nil
+		}
+
+		// 连同转发报文一起保存到收件箱
+		return s.saveEmailWithRaw(&model.Email{
+			MailboxId: mailboxID,
+			FromAddr:  fromAddr,
+			ToAddr:    toAddr,
+			Subject:   subject,
+			Body:      body,
+			Folder:    "inbox",
+			IsRead:    false,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}, message)
 	} else if errors.Is(err, gorm.ErrRecordNotFound) {
 		// 目标是外部邮箱，通过SMTP发送
 		log.Printf("转发到外部邮箱: %s", toAddr)
 
 		// 检查是否为外部邮箱
 		if s.smtpClient.IsExternalEmail(toAddr) {
-			// 使用SMTP客户端发送到外部邮箱
-			err := s.smtpClient.SendEmail(fromAddr, toAddr, subject, body)
+			// 加入出站队列，由后台协程投递和重试
+			_, err = s.smtpClient.QueueMIMEEmail(envelopeFrom, []string{toAddr}, message)
 			if err != nil {
 				log.Printf("外部邮箱转发失败: %v", err)
 				return fmt.Errorf("外部邮箱转发失败: %w", err)
 			}
-			log.Printf("✅ 外部邮箱转发成功: %s -> %s", fromAddr, toAddr)
+			log.Printf("✅ 外部邮箱转发已加入队列: %s -> %s (信封发件人: %s)", fromAddr, toAddr, envelopeFrom)
 			return nil
 		} else {
 			return fmt.Errorf("无效的外部邮箱地址: %s", toAddr)
@@ -2065,9 +2090,9 @@ func decodeQuotedPrintableFallback(s string) string {
 	return result.String()
 }
 
-// GetEmails 获取邮件列表
-func (s *Service) GetEmails(mailboxID int64, folder string, page, limit int) ([]*model.Email, int64, error) {
-	return s.svcCtx.EmailModel.GetEmailsByMailboxId(mailboxID, folder, page, limit)
+// GetEmails 获取邮件列表，tag 不为空时只返回投递到该子地址标签的邮件
+func (s *Service) GetEmails(mailboxID int64, folder, tag string, page, limit int) ([]*model.Email, int64, error) {
+	return s.svcCtx.EmailModel.GetEmailsByMailboxId(mailboxID, folder, tag, page, limit)
 }
 
 // GetEmailByID 根据ID获取邮件
@@ -2085,10 +2110,33 @@ func (s *Service) GetEmailByID(emailID, mailboxID int64) (*model.Email, error) {
 
 // MarkAsRead 标记邮件为已读
 func (s *Service) MarkAsRead(emailID, mailboxID int64) error {
-	return s.svcCtx.EmailModel.MapUpdate(nil, emailID, map[string]interface{}{
+	err := s.svcCtx.EmailModel.MapUpdate(nil, emailID, map[string]interface{}{
 		"is_read":    true,
 		"updated_at": time.Now(),
 	})
+	if err != nil {
+		return err
+	}
+	s.notifyMailbox(mailboxID)
+	return nil
+}
+
+// MarkSpam 将邮件标记为垃圾邮件（移到垃圾邮件文件夹）或非垃圾邮件（移回收件箱），并训练贝叶斯分类器
+func (s *Service) MarkSpam(email *model.Email, isSpam bool) error {
+	class, folder := model.BayesClassHam, "inbox"
+	if isSpam {
+		class, folder = model.BayesClassSpam, "junk"
+	}
+
+	// 移动文件夹时由回调完成训练，已在目标文件夹（如标记收件箱中的邮件为非垃圾邮件）时直接训练
+	if isSpam == (email.Folder == "junk") {
+		return s.bayesService.Train(nil, email, class)
+	}
+	if err := s.svcCtx.EmailModel.MoveToFolder(nil, email.Id, folder); err != nil {
+		return err
+	}
+	s.notifyMailbox(email.MailboxId)
+	return nil
 }
 
 // DeleteEmail 删除邮件
@@ -2099,8 +2147,8 @@ func (s *Service) DeleteEmail(emailID, mailboxID int64) error {
 		return err
 	}
 
-	// 删除邮件
-	return s.svcCtx.EmailModel.Delete(nil, email)
+	// 删除邮件及其原文
+	return s.deleteEmailWithRaw(email)
 }
 
 // SendTestForwardEmail 发送测试转发邮件
@@ -2111,20 +2159,22 @@ func (s *Service) SendTestForwardEmail(sourceEmail, targetEmail, subject, conten
 		return fmt.Errorf("获取源邮箱失败: %w", err)
 	}
 
+	// 触发转发规则处理，规则不保留原邮件时不保存测试邮件
+	if !s.processForwardRules(sourceEmail, "system@test.com", subject, content, nil) {
+		return nil
+	}
+
 	// 保存测试邮件到源邮箱
 	err = s.svcCtx.EmailModel.SaveEmailToFolder(nil, mailboxID, "system@test.com", sourceEmail, subject, content, "inbox")
 	if err != nil {
 		return fmt.Errorf("保存测试邮件失败: %w", err)
 	}
 
-	// 触发转发规则处理
-	s.processForwardRules(sourceEmail, "system@test.com", subject, content)
-
 	return nil
 }
 
 // parseEmailWithEnmime 使用enmime库解析邮件内容
-func (session *SMTPSession) parseEmailWithEnmime(rawEmail string) (subject, body string) {
+func parseEmailWithEnmime(rawEmail string) (subject, body string) {
 	log.Printf("开始使用enmime解析邮件")
 
 	// 创建enmime解析器，禁用字符检测让库自己处理
@@ -0,0 +1,112 @@
+package email
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"miko-email/internal/config"
+	"miko-email/internal/services/forward"
+)
+
+// 转发邮件携带的跟踪头部
+const (
+	headerForwardHops = "X-Forward-Hops" // 已经过的转发次数
+	headerLoop        = "X-Loop"         // 经过的转发邮箱，每个邮箱一行
+)
+
+// forwardTrace 邮件的转发轨迹，从顶层头部解析
+type forwardTrace struct {
+	hops     int
+	loops    []string
+	received []string // Received头，转发时复制到转发邮件，经过外部服务器的循环也能累计
+}
+
+// parseForwardTrace 解析邮件原文顶层头部中的转发次数、转发邮箱和Received头
+func parseForwardTrace(raw []byte) *forwardTrace {
+	trace := &forwardTrace{}
+	if len(raw) == 0 {
+		return trace
+	}
+	headerRaw, _ := splitRawMessage(raw)
+	header := parseMIMEHeader(headerRaw)
+
+	for _, v := range header.Values(headerForwardHops) {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > trace.hops {
+			trace.hops = n
+		}
+	}
+	for _, v := range header.Values(headerLoop) {
+		if addr := strings.ToLower(strings.Trim(strings.TrimSpace(v), "<>")); addr != "" {
+			trace.loops = append(trace.loops, addr)
+		}
+	}
+	trace.received = header.Values("Received")
+	return trace
+}
+
+// seen 邮件是否已经由该邮箱转发过
+func (t *forwardTrace) seen(address string) bool {
+	address = strings.ToLower(strings.TrimSpace(address))
+	for _, addr := range t.loops {
+		if addr == address {
+			return true
+		}
+	}
+	return false
+}
+
+// loopReason 检查是否应停止转发，返回原因，可以转发时返回空字符串
+func (t *forwardTrace) loopReason(sourceEmail string) string {
+	maxHops, maxReceived, _ := config.GetForwardLimits()
+	switch {
+	case t.hops >= maxHops:
+		return fmt.Sprintf("已转发 %d 次，达到上限 %d", t.hops, maxHops)
+	case len(t.received) > maxReceived:
+		return fmt.Sprintf("Received头数量 %d 超过上限 %d", len(t.received), maxReceived)
+	case t.seen(sourceEmail):
+		return fmt.Sprintf("邮件已经由 %s 转发过", sourceEmail)
+	}
+	return ""
+}
+
+// headers 转发邮件携带的跟踪头部：保留原邮件的Received头和之前的转发邮箱，加上本次转发的邮箱，转发次数加一
+func (t *forwardTrace) headers(sourceEmail string) []string {
+	lines := make([]string, 0, len(t.received)+len(t.loops)+2)
+	for _, received := range t.received {
+		lines = append(lines, "Received: "+received)
+	}
+	for _, addr := range t.loops {
+		lines = append(lines, headerLoop+": "+addr)
+	}
+	lines = append(lines, headerLoop+": "+strings.ToLower(sourceEmail))
+	lines = append(lines, fmt.Sprintf("%s: %d", headerForwardHops, t.hops+1))
+	return lines
+}
+
+// disableForwardRule 转发频率超过限制时停用规则，并在源邮箱中通知用户
+func (s *Service) disableForwardRule(rule forward.ForwardRule, limit int) {
+	reason := fmt.Sprintf("每小时转发次数超过限制 %d，规则已自动停用", limit)
+	log.Printf("⚠️ 转发规则 %d (%s -> %s) %s", rule.ID, rule.SourceEmail, rule.TargetEmail, reason)
+	if err := s.forwardService.AutoDisableForwardRule(rule.ID, reason); err != nil {
+		log.Printf("%v", err)
+		return
+	}
+
+	subject := "转发规则已自动停用"
+	body := fmt.Sprintf(`您的邮件转发规则已被自动停用。
+
+源邮箱: %s
+目标邮箱: %s
+原因: %s
+时间: %s
+
+这通常是转发循环或短时间内收到大量邮件导致的。请检查转发设置，确认无误后在转发管理页面重新启用该规则。
+`, rule.SourceEmail, rule.TargetEmail, reason, time.Now().Format("2006-01-02 15:04:05"))
+
+	if err := s.SaveEmail(rule.MailboxID, "postmaster@"+domainOf(rule.SourceEmail), rule.SourceEmail, subject, body); err != nil {
+		log.Printf("发送转发规则停用通知失败: %v", err)
+	}
+}
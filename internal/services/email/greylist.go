@@ -0,0 +1,115 @@
+package email
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+)
+
+// greylistCleanupInterval 删除过期灰名单记录的间隔
+const greylistCleanupInterval = time.Hour
+
+var (
+	greylistCleanupMu   sync.Mutex
+	greylistLastCleanup time.Time
+)
+
+// checkGreylist 对投递到本地收件人的邮件进行灰名单检查（RFC 6647），返回 false 表示需要暂时拒绝
+// 已认证的会话、本机连接、关闭了灰名单的域名以及白名单中的IP和发件人域名不检查
+func (session *SMTPSession) checkGreylist(to string) bool {
+	if !config.IsGreylistEnabled() || session.authenticated || session.isLoopback() {
+		return true
+	}
+
+	svcCtx := session.server.svcCtx
+	if domain, err := svcCtx.DomainModel.GetByName(recipientDomain(to)); err == nil && domain.DisableGreylist {
+		return true
+	}
+
+	ip := session.remoteIP()
+	if ip == nil {
+		return true
+	}
+	sender := strings.ToLower(session.from)
+	if session.greylistWhitelisted(ip, recipientDomain(sender)) {
+		return true
+	}
+
+	delay, retry, lifetime := config.GetGreylistTimes()
+	passed, err := svcCtx.GreylistModel.Check(greylistNet(ip), sender, strings.ToLower(to), delay, retry, lifetime)
+	if err != nil {
+		// 数据库出错时放行，避免拒收正常邮件
+		log.Printf("灰名单检查失败: %v", err)
+		return true
+	}
+	session.cleanupGreylist()
+
+	if !passed {
+		log.Printf("灰名单暂时拒绝: %s %s -> %s", greylistNet(ip), session.from, to)
+	}
+	return passed
+}
+
+// greylistWhitelisted 检查客户端IP或发件人域名（包括上级域名）是否在白名单中
+func (session *SMTPSession) greylistWhitelisted(ip net.IP, senderDomain string) bool {
+	entries, err := session.server.svcCtx.GreylistModel.ListWhitelist()
+	if err != nil {
+		log.Printf("获取灰名单白名单失败: %v", err)
+		return false
+	}
+
+	for _, entry := range entries {
+		switch entry.Type {
+		case model.GreylistWhitelistIP:
+			if strings.Contains(entry.Value, "/") {
+				if _, network, err := net.ParseCIDR(entry.Value); err == nil && network.Contains(ip) {
+					return true
+				}
+			} else if entryIP := net.ParseIP(entry.Value); entryIP != nil && entryIP.Equal(ip) {
+				return true
+			}
+		case model.GreylistWhitelistDomain:
+			if senderDomain != "" && (senderDomain == entry.Value || strings.HasSuffix(senderDomain, "."+entry.Value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// greylistNet 按配置的前缀长度获取客户端所在网段，同一网段的多台服务器重试时视为同一来源
+func greylistNet(ip net.IP) string {
+	ipv4Bits, ipv6Bits := config.GetGreylistPrefixes()
+	if ip4 := ip.To4(); ip4 != nil {
+		network := net.IPNet{IP: ip4.Mask(net.CIDRMask(ipv4Bits, 32)), Mask: net.CIDRMask(ipv4Bits, 32)}
+		return network.String()
+	}
+	network := net.IPNet{IP: ip.Mask(net.CIDRMask(ipv6Bits, 128)), Mask: net.CIDRMask(ipv6Bits, 128)}
+	return network.String()
+}
+
+// cleanupGreylist 定期删除过期的灰名单记录
+func (session *SMTPSession) cleanupGreylist() {
+	greylistCleanupMu.Lock()
+	now := time.Now()
+	if now.Sub(greylistLastCleanup) < greylistCleanupInterval {
+		greylistCleanupMu.Unlock()
+		return
+	}
+	greylistLastCleanup = now
+	greylistCleanupMu.Unlock()
+
+	count, err := session.server.svcCtx.GreylistModel.DeleteExpired(nil)
+	if err != nil {
+		log.Printf("删除过期灰名单记录失败: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("已删除 %d 条过期灰名单记录", count)
+	}
+}
@@ -0,0 +1,61 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripHeaders(t *testing.T) {
+	spamHeader := func(name, _ string) bool {
+		return strings.HasPrefix(strings.ToLower(name), "x-spam-")
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "删除X-Spam头",
+			input: "X-Spam-Status: No, score=-10\r\nFrom: a@example.com\r\nx-spam-flag: NO\r\n\r\nbody\r\n",
+			want:  "From: a@example.com\r\n\r\nbody\r\n",
+		},
+		{
+			name:  "删除折行的续行",
+			input: "From: a@example.com\r\nX-Spam-Status: No,\r\n\tscore=-10\r\nSubject: hi\r\n \there\r\n\r\nbody\r\n",
+			want:  "From: a@example.com\r\nSubject: hi\r\n \there\r\n\r\nbody\r\n",
+		},
+		{
+			name:  "不修改正文",
+			input: "From: a@example.com\r\n\r\nX-Spam-Status: Yes\r\n",
+			want:  "From: a@example.com\r\n\r\nX-Spam-Status: Yes\r\n",
+		},
+		{
+			name:  "LF换行",
+			input: "X-Spam-Score: 0\nFrom: a@example.com\n\nbody\n",
+			want:  "From: a@example.com\n\nbody\n",
+		},
+		{
+			name:  "没有空行",
+			input: "X-Spam-Status: No",
+			want:  "X-Spam-Status: No",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(stripHeaders([]byte(tt.input), spamHeader)); got != tt.want {
+				t.Errorf("stripHeaders = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripAuthResults(t *testing.T) {
+	input := "Authentication-Results: mx.local.test; spf=pass\r\n" +
+		"Authentication-Results: mx.other.test; dkim=pass\r\n" +
+		"From: a@example.com\r\n\r\nbody\r\n"
+	want := "Authentication-Results: mx.other.test; dkim=pass\r\n" +
+		"From: a@example.com\r\n\r\nbody\r\n"
+	if got := string(stripAuthResults([]byte(input), "MX.local.test")); got != want {
+		t.Errorf("stripAuthResults = %q，期望 %q", got, want)
+	}
+}
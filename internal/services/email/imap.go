@@ -0,0 +1,1208 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+)
+
+// imapDateLayout IMAP INTERNALDATE 格式
+const imapDateLayout = "02-Jan-2006 15:04:05 -0700"
+
+// imapSupportedFlags 支持的系统标志
+const imapSupportedFlags = `(\Answered \Flagged \Deleted \Seen \Draft)`
+
+// imapFlagColumns IMAP标志对应的 email 字段
+var imapFlagColumns = map[string]string{
+	`\seen`:     "is_read",
+	`\answered`: "is_answered",
+	`\flagged`:  "is_flagged",
+	`\deleted`:  "is_deleted",
+	`\draft`:    "is_draft",
+}
+
+// IMAPSession IMAP会话
+type IMAPSession struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	server  *Service
+	state   string // NOTAUTHENTICATED, AUTHENTICATED, SELECTED
+	user    string
+	mailbox string // 当前选中的IMAP文件夹名
+	tag     string
+
+	mailboxID   int64            // 登录邮箱ID
+	folder      string           // 当前选中文件夹对应的 email.folder
+	readOnly    bool             // EXAMINE 打开时为只读
+	uidValidity int64            // 当前文件夹的UIDVALIDITY
+	uids        []int64          // 序列号（下标+1）对应的UID
+	flags       map[int64]string // UID -> FLAGS 快照，用于通知其他会话的标志变化
+
+	tlsEnabled bool // 是否已加密（IMAPS或STARTTLS之后）
+}
+
+// handleIMAPConnection 处理IMAP连接
+func (s *Service) handleIMAPConnection(conn net.Conn, isTLS bool) {
+	defer conn.Close()
+
+	log.Printf("新的IMAP连接: %s", conn.RemoteAddr())
+
+	// 设置连接超时
+	conn.SetDeadline(time.Now().Add(30 * time.Minute))
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	session := &IMAPSession{
+		conn:   conn,
+		reader: reader,
+		writer: writer,
+		server: s,
+		state:  "NOTAUTHENTICATED",
+
+		tlsEnabled: isTLS,
+	}
+
+	// 发送欢迎消息
+	session.writeResponse("* OK [CAPABILITY " + session.capabilities() + "] Miko Email IMAP Server Ready")
+
+	session.handle()
+}
+
+// handle 处理IMAP会话
+func (session *IMAPSession) handle() {
+	for {
+		tag, cmd, args, err := session.readCommand()
+		if err != nil {
+			if errors.Is(err, errIMAPSyntax) {
+				if tag == "" {
+					session.writeResponse("* BAD Invalid command")
+				} else {
+					session.writeTaggedResponse("BAD Invalid command syntax")
+				}
+				continue
+			}
+			if errors.Is(err, errIMAPLiteralTooLarge) {
+				session.writeTaggedResponse("NO Literal too large")
+				continue
+			}
+			if err != io.EOF {
+				log.Printf("读取命令失败: %v", err)
+			}
+			return
+		}
+
+		// 每条命令刷新一次超时
+		session.conn.SetDeadline(time.Now().Add(30 * time.Minute))
+
+		if cmd == "LOGIN" || cmd == "AUTHENTICATE" {
+			log.Printf("IMAP命令: %s %s", tag, cmd)
+		} else {
+			log.Printf("IMAP命令: %s %s %v", tag, cmd, args)
+		}
+
+		switch cmd {
+		case "CAPABILITY":
+			session.handleCapability()
+		case "NOOP":
+			session.handleNoop()
+		case "LOGOUT":
+			session.handleLogout()
+			return
+		case "STARTTLS":
+			session.handleStartTLS()
+		case "LOGIN":
+			session.handleLogin(args)
+		case "AUTHENTICATE":
+			session.handleAuthenticate(args)
+		default:
+			session.handleAuthenticatedCommand(cmd, args)
+		}
+	}
+}
+
+// handleAuthenticatedCommand 处理需要登录的命令
+func (session *IMAPSession) handleAuthenticatedCommand(cmd string, args []interface{}) {
+	if session.state == "NOTAUTHENTICATED" {
+		switch cmd {
+		case "SELECT", "EXAMINE", "CREATE", "DELETE", "RENAME", "SUBSCRIBE", "UNSUBSCRIBE",
+			"LIST", "LSUB", "STATUS", "APPEND", "IDLE", "CHECK", "CLOSE",
+			"EXPUNGE", "SEARCH", "FETCH", "STORE", "COPY", "UID":
+			session.writeTaggedResponse("NO Not authenticated")
+		default:
+			session.writeTaggedResponse("BAD Command not implemented")
+		}
+		return
+	}
+
+	switch cmd {
+	case "SELECT":
+		session.handleSelect(args, false)
+	case "EXAMINE":
+		session.handleSelect(args, true)
+	case "CREATE":
+		session.handleCreate(args)
+	case "DELETE":
+		session.handleDelete(args)
+	case "RENAME":
+		session.handleRename(args)
+	case "SUBSCRIBE":
+		session.handleSubscribe(args, true)
+	case "UNSUBSCRIBE":
+		session.handleSubscribe(args, false)
+	case "LIST":
+		session.handleList(args, false)
+	case "LSUB":
+		session.handleList(args, true)
+	case "STATUS":
+		session.handleStatus(args)
+	case "APPEND":
+		session.handleAppend(args)
+	case "IDLE":
+		session.handleIdle()
+	default:
+		session.handleSelectedCommand(cmd, args)
+	}
+}
+
+// handleSelectedCommand 处理需要选中文件夹的命令
+func (session *IMAPSession) handleSelectedCommand(cmd string, args []interface{}) {
+	switch cmd {
+	case "CHECK", "CLOSE", "EXPUNGE", "SEARCH", "FETCH", "STORE", "COPY", "MOVE", "UID":
+	default:
+		session.writeTaggedResponse("BAD Command not implemented")
+		return
+	}
+
+	if session.state != "SELECTED" {
+		session.writeTaggedResponse("NO Not selected")
+		return
+	}
+
+	switch cmd {
+	case "CHECK":
+		session.refresh(true)
+		session.writeTaggedResponse("OK CHECK completed")
+	case "CLOSE":
+		session.handleClose()
+	case "EXPUNGE":
+		session.handleExpunge()
+	case "SEARCH":
+		session.handleSearch(args, false)
+	case "FETCH":
+		session.handleFetch(args, false)
+	case "STORE":
+		session.handleStore(args, false)
+	case "COPY":
+		session.handleCopy(args, false)
+	case "MOVE":
+		session.handleMove(args, false)
+	case "UID":
+		session.handleUID(args)
+	}
+}
+
+// writeResponse 写入响应
+func (session *IMAPSession) writeResponse(response string) {
+	session.writer.WriteString(response + "\r\n")
+	session.writer.Flush()
+}
+
+// writeTaggedResponse 写入带标签的响应
+func (session *IMAPSession) writeTaggedResponse(response string) {
+	session.writeResponse(session.tag + " " + response)
+}
+
+// handleCapability 处理CAPABILITY命令
+func (session *IMAPSession) handleCapability() {
+	session.writeResponse("* CAPABILITY " + session.capabilities())
+	session.writeTaggedResponse("OK CAPABILITY completed")
+}
+
+// capabilities 当前连接支持的能力（未加密且禁止明文认证时返回 LOGINDISABLED）
+func (session *IMAPSession) capabilities() string {
+	caps := "IMAP4rev1 IDLE SPECIAL-USE MOVE"
+	if !session.tlsEnabled {
+		caps += " STARTTLS"
+	}
+	if session.loginDisabled() {
+		caps += " LOGINDISABLED"
+	} else {
+		caps += " AUTH=PLAIN AUTH=LOGIN"
+	}
+	return caps
+}
+
+// loginDisabled 是否禁止在当前连接上登录
+func (session *IMAPSession) loginDisabled() bool {
+	return !session.tlsEnabled && config.IsPlaintextAuthDisabled()
+}
+
+// handleStartTLS 处理STARTTLS命令，将连接升级为TLS
+func (session *IMAPSession) handleStartTLS() {
+	if session.tlsEnabled {
+		session.writeTaggedResponse("BAD TLS already active")
+		return
+	}
+	if session.state != "NOTAUTHENTICATED" {
+		session.writeTaggedResponse("BAD Already authenticated")
+		return
+	}
+
+	session.writeTaggedResponse("OK Begin TLS negotiation now")
+
+	tlsConn := tls.Server(session.conn, session.server.serverTLSConfig())
+	if err := tlsConn.Handshake(); err != nil {
+		log.Printf("IMAP TLS握手失败: %v", err)
+		session.conn.Close()
+		return
+	}
+
+	log.Printf("IMAP TLS连接建立成功: %s", session.conn.RemoteAddr())
+
+	session.conn = tlsConn
+	session.reader = bufio.NewReader(tlsConn)
+	session.writer = bufio.NewWriter(tlsConn)
+	session.tlsEnabled = true
+}
+
+// handleNoop 处理NOOP命令（同时推送文件夹变化）
+func (session *IMAPSession) handleNoop() {
+	if session.state == "SELECTED" {
+		session.refresh(true)
+	}
+	session.writeTaggedResponse("OK NOOP completed")
+}
+
+// handleLogin 处理LOGIN命令
+func (session *IMAPSession) handleLogin(args []interface{}) {
+	if session.state != "NOTAUTHENTICATED" {
+		session.writeTaggedResponse("BAD Already authenticated")
+		return
+	}
+
+	if session.loginDisabled() {
+		session.writeTaggedResponse("NO [PRIVACYREQUIRED] LOGIN is disabled, use STARTTLS")
+		return
+	}
+
+	if len(args) < 2 {
+		session.writeTaggedResponse("BAD LOGIN requires username and password")
+		return
+	}
+
+	username, ok1 := argString(args[0])
+	password, ok2 := argString(args[1])
+	if !ok1 || !ok2 {
+		session.writeTaggedResponse("BAD LOGIN requires username and password")
+		return
+	}
+
+	if session.login(username, password) {
+		session.writeTaggedResponse("OK LOGIN completed")
+	} else {
+		session.writeTaggedResponse("NO LOGIN failed")
+	}
+}
+
+// handleAuthenticate 处理AUTHENTICATE命令（PLAIN、LOGIN）
+func (session *IMAPSession) handleAuthenticate(args []interface{}) {
+	if session.state != "NOTAUTHENTICATED" {
+		session.writeTaggedResponse("BAD Already authenticated")
+		return
+	}
+
+	if session.loginDisabled() {
+		session.writeTaggedResponse("NO [PRIVACYREQUIRED] Authentication is disabled, use STARTTLS")
+		return
+	}
+
+	if len(args) < 1 {
+		session.writeTaggedResponse("BAD AUTHENTICATE requires mechanism")
+		return
+	}
+
+	mechanism, _ := argString(args[0])
+	var username, password string
+
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		var response string
+		if len(args) > 1 {
+			response, _ = argString(args[1])
+		} else {
+			line, err := session.readContinuation("")
+			if err != nil {
+				return
+			}
+			response = line
+		}
+		decoded, err := base64.StdEncoding.DecodeString(response)
+		if err != nil {
+			session.writeTaggedResponse("BAD Invalid base64 data")
+			return
+		}
+		// PLAIN认证格式: authzid\0username\0password
+		parts := strings.Split(string(decoded), "\x00")
+		if len(parts) != 3 {
+			session.writeTaggedResponse("BAD Invalid credentials format")
+			return
+		}
+		username, password = parts[1], parts[2]
+	case "LOGIN":
+		line, err := session.readContinuation(base64.StdEncoding.EncodeToString([]byte("Username:")))
+		if err != nil {
+			return
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			session.writeTaggedResponse("BAD Invalid base64 data")
+			return
+		}
+		username = string(decoded)
+
+		line, err = session.readContinuation(base64.StdEncoding.EncodeToString([]byte("Password:")))
+		if err != nil {
+			return
+		}
+		decoded, err = base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			session.writeTaggedResponse("BAD Invalid base64 data")
+			return
+		}
+		password = string(decoded)
+	default:
+		session.writeTaggedResponse("NO Unsupported authentication mechanism")
+		return
+	}
+
+	if session.login(username, password) {
+		session.writeTaggedResponse("OK AUTHENTICATE completed")
+	} else {
+		session.writeTaggedResponse("NO AUTHENTICATE failed")
+	}
+}
+
+// readContinuation 发送继续请求并读取客户端的响应行
+func (session *IMAPSession) readContinuation(prompt string) (string, error) {
+	session.writeResponse("+ " + prompt)
+	line, err := session.readLine()
+	if err != nil {
+		return "", err
+	}
+	if line == "*" {
+		session.writeTaggedResponse("BAD AUTHENTICATE cancelled")
+		return "", errors.New("authenticate cancelled")
+	}
+	return line, nil
+}
+
+// login 验证用户并进入已认证状态
+func (session *IMAPSession) login(username, password string) bool {
+	mailboxAddr, ok := session.authenticateIMAPUser(username, password)
+	if !ok {
+		log.Printf("IMAP登录失败: %s", username)
+		return false
+	}
+
+	session.state = "AUTHENTICATED"
+	session.user = mailboxAddr
+	if mailbox, err := session.server.svcCtx.MailboxModel.GetByEmail(mailboxAddr); err == nil {
+		session.mailboxID = mailbox.Id
+	}
+	log.Printf("IMAP登录成功: %s", username)
+	return true
+}
+
+// authenticateIMAPUser IMAP用户认证（支持多种认证方式），返回登录的邮箱地址
+func (session *IMAPSession) authenticateIMAPUser(username, password string) (string, bool) {
+	log.Printf("IMAP认证开始: 用户名=%s", username)
+
+	// 方式1: 直接邮箱认证 (邮箱地址 + 邮箱密码)
+	log.Printf("尝试方式1: 直接邮箱认证")
+	if session.authenticateByMailbox(username, password) {
+		log.Printf("方式1认证成功")
+		return username, true
+	}
+
+	// 方式2: 组合认证 (网站账号@邮箱地址 + 邮箱密码)
+	// 格式: "网站用户名@邮箱地址" + "邮箱密码"
+	log.Printf("尝试方式2: 组合认证")
+	if strings.Contains(username, "@") {
+		parts := strings.Split(username, "@")
+		log.Printf("用户名分割结果: %v", parts)
+		if len(parts) >= 2 {
+			// 重新组合邮箱地址
+			emailParts := parts[1:]
+			emailAddr := strings.Join(emailParts, "@")
+			websiteUser := parts[0]
+
+			log.Printf("解析结果: 网站用户=%s, 邮箱地址=%s", websiteUser, emailAddr)
+
+			// 验证邮箱和密码
+			if session.authenticateByMailbox(emailAddr, password) {
+				log.Printf("邮箱密码验证成功")
+				// 同时验证网站用户是否有权限访问该邮箱
+				if session.verifyUserMailboxAccess(websiteUser, emailAddr) {
+					log.Printf("组合认证成功: 网站用户=%s, 邮箱=%s", websiteUser, emailAddr)
+					return emailAddr, true
+				} else {
+					log.Printf("用户权限验证失败")
+				}
+			} else {
+				log.Printf("邮箱密码验证失败")
+			}
+		}
+	}
+
+	// 方式3: 网站用户认证 (网站用户名 + 网站密码)
+	log.Printf("尝试方式3: 网站用户认证")
+	if session.authenticateByWebsiteUser(username, password) {
+		log.Printf("方式3认证成功")
+		return username, true
+	}
+
+	log.Printf("所有认证方式都失败")
+	return "", false
+}
+
+// authenticateByMailbox 通过邮箱认证
+func (session *IMAPSession) authenticateByMailbox(email, password string) bool {
+	mailbox, err := session.server.svcCtx.MailboxModel.GetByEmailAndPassword(email, password)
+	if err != nil {
+		return false
+	}
+
+	return mailbox != nil
+}
+
+// verifyUserMailboxAccess 验证网站用户是否有权限访问指定邮箱
+func (session *IMAPSession) verifyUserMailboxAccess(websiteUser, email string) bool {
+	// 先获取用户
+	user, err := session.server.svcCtx.UserModel.GetByUsername(websiteUser)
+	if err != nil {
+		log.Printf("获取用户失败: %v", err)
+		return false
+	}
+
+	// 检查用户是否拥有该邮箱
+	mailbox, err := session.server.svcCtx.MailboxModel.GetByEmailAndUserId(email, user.Id)
+	if err != nil {
+		log.Printf("验证用户邮箱权限失败: %v", err)
+		return false
+	} else if !mailbox.IsActive {
+		log.Printf("验证用户邮箱权限失败: %v", err)
+		return false
+	}
+
+	log.Printf("用户权限验证: 网站用户=%s, 邮箱=%s, 验证成功", websiteUser, email)
+	return true
+}
+
+// authenticateByWebsiteUser 通过网站用户认证
+func (session *IMAPSession) authenticateByWebsiteUser(username, password string) bool {
+	user, err := session.server.svcCtx.UserModel.GetByEmail(username)
+	if err != nil {
+		return false
+	}
+
+	// 使用bcrypt验证密码
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	return err == nil
+}
+
+// loadFolder 加载文件夹状态和邮件（会先为新邮件分配UID）
+func (session *IMAPSession) loadFolder(folder string) (*model.MailboxFolder, []*model.Email, error) {
+	// 用户文件夹可能已被其他会话删除，不能自动重建
+	if !isSpecialFolder(folder) {
+		if _, err := session.server.svcCtx.FolderModel.GetByName(session.mailboxID, folder); err != nil {
+			return nil, nil, err
+		}
+	}
+	state, err := session.server.svcCtx.FolderModel.AssignUids(session.mailboxID, folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	emails, err := session.server.svcCtx.EmailModel.GetImapEmails(session.mailboxID, folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	return state, emails, nil
+}
+
+// handleSelect 处理SELECT/EXAMINE命令
+func (session *IMAPSession) handleSelect(args []interface{}, readOnly bool) {
+	command := "SELECT"
+	if readOnly {
+		command = "EXAMINE"
+	}
+
+	if len(args) < 1 {
+		session.writeTaggedResponse("BAD " + command + " requires mailbox name")
+		return
+	}
+
+	// 选择新文件夹前先退出当前文件夹
+	session.unselect()
+
+	name, _ := argString(args[0])
+	folder, ok := session.resolveFolder(name)
+	if !ok {
+		session.writeTaggedResponse("NO Mailbox does not exist")
+		return
+	}
+
+	state, emails, err := session.loadFolder(folder)
+	if err != nil {
+		log.Printf("加载文件夹失败: %v", err)
+		session.writeTaggedResponse("NO " + command + " failed")
+		return
+	}
+
+	session.state = "SELECTED"
+	session.mailbox = imapFolderName(name)
+	session.folder = folder
+	session.readOnly = readOnly
+	session.uidValidity = state.UidValidity
+	session.flags = make(map[int64]string)
+
+	firstUnseen := 0
+	for i, email := range emails {
+		session.uids = append(session.uids, email.Uid)
+		session.flags[email.Uid] = imapFlags(email)
+		if firstUnseen == 0 && !email.IsRead {
+			firstUnseen = i + 1
+		}
+	}
+
+	session.writeResponse("* FLAGS " + imapSupportedFlags)
+	if readOnly {
+		session.writeResponse("* OK [PERMANENTFLAGS ()] Read-only mailbox")
+	} else {
+		session.writeResponse("* OK [PERMANENTFLAGS " + imapSupportedFlags + "] Flags permitted")
+	}
+	session.writeResponse(fmt.Sprintf("* %d EXISTS", len(emails)))
+	session.writeResponse("* 0 RECENT")
+	if firstUnseen > 0 {
+		session.writeResponse(fmt.Sprintf("* OK [UNSEEN %d] First unseen message", firstUnseen))
+	}
+	session.writeResponse(fmt.Sprintf("* OK [UIDVALIDITY %d] UIDs valid", state.UidValidity))
+	session.writeResponse(fmt.Sprintf("* OK [UIDNEXT %d] Predicted next UID", state.UidNext))
+
+	if readOnly {
+		session.writeTaggedResponse("OK [READ-ONLY] EXAMINE completed")
+	} else {
+		session.writeTaggedResponse("OK [READ-WRITE] SELECT completed")
+	}
+}
+
+// unselect 退出当前选中的文件夹
+func (session *IMAPSession) unselect() {
+	if session.state == "SELECTED" {
+		session.state = "AUTHENTICATED"
+	}
+	session.mailbox = ""
+	session.folder = ""
+	session.readOnly = false
+	session.uids = nil
+	session.flags = nil
+}
+
+// refresh 将文件夹的变化（新邮件、标志变化、被删除的邮件）推送给客户端
+// allowExpunge 为 false 时不发送 EXPUNGE（FETCH/STORE/SEARCH 期间不允许改变序列号）
+func (session *IMAPSession) refresh(allowExpunge bool) {
+	_, emails, err := session.loadFolder(session.folder)
+	if err != nil {
+		log.Printf("刷新文件夹失败: %v", err)
+		return
+	}
+
+	current := make(map[int64]*model.Email, len(emails))
+	for _, email := range emails {
+		current[email.Uid] = email
+	}
+
+	if allowExpunge {
+		for i := len(session.uids) - 1; i >= 0; i-- {
+			uid := session.uids[i]
+			if _, ok := current[uid]; !ok {
+				session.writeResponse(fmt.Sprintf("* %d EXPUNGE", i+1))
+				session.uids = append(session.uids[:i], session.uids[i+1:]...)
+				delete(session.flags, uid)
+			}
+		}
+	}
+
+	for i, uid := range session.uids {
+		email, ok := current[uid]
+		if !ok {
+			continue
+		}
+		if flags := imapFlags(email); flags != session.flags[uid] {
+			session.flags[uid] = flags
+			session.writeResponse(fmt.Sprintf("* %d FETCH (FLAGS %s)", i+1, flags))
+		}
+	}
+
+	var lastUID int64
+	if len(session.uids) > 0 {
+		lastUID = session.uids[len(session.uids)-1]
+	}
+	added := false
+	for _, email := range emails {
+		if email.Uid > lastUID {
+			session.uids = append(session.uids, email.Uid)
+			session.flags[email.Uid] = imapFlags(email)
+			added = true
+		}
+	}
+	if added {
+		session.writeResponse(fmt.Sprintf("* %d EXISTS", len(session.uids)))
+		session.writeResponse("* 0 RECENT")
+	}
+}
+
+// imapMessage 序列号与邮件的对应关系
+type imapMessage struct {
+	seq   int
+	email *model.Email
+}
+
+// selectMessages 根据序列号集合（或UID集合）选出当前文件夹中的邮件
+func (session *IMAPSession) selectMessages(setArg interface{}, byUID bool) ([]imapMessage, error) {
+	setStr, ok := argString(setArg)
+	if !ok {
+		return nil, errIMAPSyntax
+	}
+	set, err := parseSeqSet(setStr)
+	if err != nil {
+		return nil, err
+	}
+
+	emails, err := session.server.svcCtx.EmailModel.GetImapEmails(session.mailboxID, session.folder)
+	if err != nil {
+		return nil, err
+	}
+	byUid := make(map[int64]*model.Email, len(emails))
+	for _, email := range emails {
+		byUid[email.Uid] = email
+	}
+
+	var maxValue uint32
+	if len(session.uids) > 0 {
+		if byUID {
+			maxValue = uint32(session.uids[len(session.uids)-1])
+		} else {
+			maxValue = uint32(len(session.uids))
+		}
+	}
+
+	var messages []imapMessage
+	for i, uid := range session.uids {
+		n := uint32(i + 1)
+		if byUID {
+			n = uint32(uid)
+		}
+		if !set.contains(n, maxValue) {
+			continue
+		}
+		// 已被其他会话删除的邮件跳过
+		if email, ok := byUid[uid]; ok {
+			messages = append(messages, imapMessage{seq: i + 1, email: email})
+		}
+	}
+	return messages, nil
+}
+
+// imapFlags 格式化邮件的标志列表
+func imapFlags(email *model.Email) string {
+	var flags []string
+	if email.IsAnswered {
+		flags = append(flags, `\Answered`)
+	}
+	if email.IsFlagged {
+		flags = append(flags, `\Flagged`)
+	}
+	if email.IsDeleted {
+		flags = append(flags, `\Deleted`)
+	}
+	if email.IsRead {
+		flags = append(flags, `\Seen`)
+	}
+	if email.IsDraft {
+		flags = append(flags, `\Draft`)
+	}
+	return "(" + strings.Join(flags, " ") + ")"
+}
+
+// setEmailFlag 设置邮件结构体中对应的标志字段
+func setEmailFlag(email *model.Email, column string, value bool) {
+	switch column {
+	case "is_read":
+		email.IsRead = value
+	case "is_answered":
+		email.IsAnswered = value
+	case "is_flagged":
+		email.IsFlagged = value
+	case "is_deleted":
+		email.IsDeleted = value
+	case "is_draft":
+		email.IsDraft = value
+	}
+}
+
+// handleStore 处理STORE命令
+func (session *IMAPSession) handleStore(args []interface{}, byUID bool) {
+	if len(args) < 3 {
+		session.writeTaggedResponse("BAD STORE requires sequence set, item and flags")
+		return
+	}
+	if session.readOnly {
+		session.writeTaggedResponse("NO Mailbox is read-only")
+		return
+	}
+
+	item, _ := argString(args[1])
+	item = strings.ToUpper(item)
+	silent := strings.HasSuffix(item, ".SILENT")
+	item = strings.TrimSuffix(item, ".SILENT")
+	if item != "FLAGS" && item != "+FLAGS" && item != "-FLAGS" {
+		session.writeTaggedResponse("BAD Invalid STORE data item")
+		return
+	}
+
+	var flagNames []string
+	for _, arg := range args[2:] {
+		flagNames = append(flagNames, argStrings(arg)...)
+	}
+	columns := make(map[string]bool)
+	for _, flag := range flagNames {
+		// 不支持的关键字忽略（PERMANENTFLAGS 中未声明 \*）
+		if column, ok := imapFlagColumns[strings.ToLower(flag)]; ok {
+			columns[column] = true
+		}
+	}
+
+	messages, err := session.selectMessages(args[0], byUID)
+	if err != nil {
+		session.writeTaggedResponse("BAD Invalid sequence set")
+		return
+	}
+
+	changed := false
+	for _, msg := range messages {
+		update := make(map[string]interface{})
+		for _, column := range imapFlagColumns {
+			switch item {
+			case "FLAGS":
+				update[column] = columns[column]
+			case "+FLAGS":
+				if columns[column] {
+					update[column] = true
+				}
+			case "-FLAGS":
+				if columns[column] {
+					update[column] = false
+				}
+			}
+		}
+		for column, value := range update {
+			setEmailFlag(msg.email, column, value.(bool))
+		}
+
+		if len(update) > 0 {
+			update["updated_at"] = time.Now()
+			if err := session.server.svcCtx.EmailModel.MapUpdate(nil, msg.email.Id, update); err != nil {
+				log.Printf("更新邮件标志失败: %v", err)
+				session.writeTaggedResponse("NO STORE failed")
+				return
+			}
+			changed = true
+		}
+
+		flags := imapFlags(msg.email)
+		session.flags[msg.email.Uid] = flags
+		if !silent {
+			if byUID {
+				session.writeResponse(fmt.Sprintf("* %d FETCH (UID %d FLAGS %s)", msg.seq, msg.email.Uid, flags))
+			} else {
+				session.writeResponse(fmt.Sprintf("* %d FETCH (FLAGS %s)", msg.seq, flags))
+			}
+		}
+	}
+
+	if changed {
+		session.server.notifyMailbox(session.mailboxID)
+	}
+	session.writeTaggedResponse("OK STORE completed")
+}
+
+// handleCopy 处理COPY命令
+func (session *IMAPSession) handleCopy(args []interface{}, byUID bool) {
+	if len(args) < 2 {
+		session.writeTaggedResponse("BAD COPY requires sequence set and mailbox name")
+		return
+	}
+
+	name, _ := argString(args[1])
+	target, ok := session.resolveFolder(name)
+	if !ok {
+		session.writeTaggedResponse("NO [TRYCREATE] Mailbox does not exist")
+		return
+	}
+
+	messages, err := session.selectMessages(args[0], byUID)
+	if err != nil {
+		session.writeTaggedResponse("BAD Invalid sequence set")
+		return
+	}
+
+	for _, msg := range messages {
+		if err := session.server.copyEmailToFolder(msg.email.Id, target); err != nil {
+			log.Printf("复制邮件失败: %v", err)
+			session.writeTaggedResponse("NO COPY failed")
+			return
+		}
+	}
+
+	if target == session.folder {
+		session.refresh(!byUID)
+	}
+	session.writeTaggedResponse("OK COPY completed")
+}
+
+// handleMove 处理MOVE命令（RFC 6851），移动后向客户端发送被移走邮件的EXPUNGE
+func (session *IMAPSession) handleMove(args []interface{}, byUID bool) {
+	if len(args) < 2 {
+		session.writeTaggedResponse("BAD MOVE requires sequence set and mailbox name")
+		return
+	}
+	if session.readOnly {
+		session.writeTaggedResponse("NO Mailbox is read-only")
+		return
+	}
+
+	name, _ := argString(args[1])
+	target, ok := session.resolveFolder(name)
+	if !ok {
+		session.writeTaggedResponse("NO [TRYCREATE] Mailbox does not exist")
+		return
+	}
+
+	messages, err := session.selectMessages(args[0], byUID)
+	if err != nil {
+		session.writeTaggedResponse("BAD Invalid sequence set")
+		return
+	}
+	if len(messages) == 0 {
+		session.writeTaggedResponse("OK MOVE completed")
+		return
+	}
+
+	ids := make([]int64, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.email.Id)
+	}
+	if err := session.server.svcCtx.EmailModel.BatchMoveToFolder(nil, ids, target); err != nil {
+		log.Printf("移动邮件失败: %v", err)
+		session.writeTaggedResponse("NO MOVE failed")
+		return
+	}
+
+	// 从序号大的开始删除，前面邮件的序号不受影响
+	for i := len(messages) - 1; i >= 0; i-- {
+		index := messages[i].seq - 1
+		uid := session.uids[index]
+		session.writeResponse(fmt.Sprintf("* %d EXPUNGE", messages[i].seq))
+		session.uids = append(session.uids[:index], session.uids[index+1:]...)
+		delete(session.flags, uid)
+	}
+
+	session.server.notifyMailbox(session.mailboxID)
+	if target == session.folder {
+		session.refresh(!byUID)
+	}
+	session.writeTaggedResponse("OK MOVE completed")
+}
+
+// handleExpunge 处理EXPUNGE命令
+func (session *IMAPSession) handleExpunge() {
+	if session.readOnly {
+		session.writeTaggedResponse("NO Mailbox is read-only")
+		return
+	}
+
+	session.refresh(true)
+	if err := session.expunge(false); err != nil {
+		log.Printf("EXPUNGE失败: %v", err)
+		session.writeTaggedResponse("NO EXPUNGE failed")
+		return
+	}
+	session.writeTaggedResponse("OK EXPUNGE completed")
+}
+
+// handleClose 处理CLOSE命令（只读模式下不删除邮件）
+func (session *IMAPSession) handleClose() {
+	if !session.readOnly {
+		if err := session.expunge(true); err != nil {
+			log.Printf("CLOSE删除邮件失败: %v", err)
+		}
+	}
+	session.unselect()
+	session.writeTaggedResponse("OK CLOSE completed")
+}
+
+// expunge 永久删除带 \Deleted 标志的邮件，silent 为 true 时不发送 EXPUNGE 响应
+func (session *IMAPSession) expunge(silent bool) error {
+	emails, err := session.server.svcCtx.EmailModel.GetImapEmails(session.mailboxID, session.folder)
+	if err != nil {
+		return err
+	}
+	byUid := make(map[int64]*model.Email, len(emails))
+	for _, email := range emails {
+		byUid[email.Uid] = email
+	}
+
+	for i := 0; i < len(session.uids); {
+		uid := session.uids[i]
+		email, ok := byUid[uid]
+		if !ok || !email.IsDeleted {
+			i++
+			continue
+		}
+		if err := session.server.deleteEmailWithRaw(email); err != nil {
+			return err
+		}
+		if !silent {
+			session.writeResponse(fmt.Sprintf("* %d EXPUNGE", i+1))
+		}
+		session.uids = append(session.uids[:i], session.uids[i+1:]...)
+		delete(session.flags, uid)
+	}
+	return nil
+}
+
+// handleStatus 处理STATUS命令
+func (session *IMAPSession) handleStatus(args []interface{}) {
+	if len(args) < 2 {
+		session.writeTaggedResponse("BAD STATUS requires mailbox name and status items")
+		return
+	}
+
+	name, _ := argString(args[0])
+	folder, ok := session.resolveFolder(name)
+	if !ok {
+		session.writeTaggedResponse("NO Mailbox does not exist")
+		return
+	}
+
+	state, emails, err := session.loadFolder(folder)
+	if err != nil {
+		log.Printf("STATUS查询失败: %v", err)
+		session.writeTaggedResponse("NO STATUS failed")
+		return
+	}
+
+	var items []string
+	for _, item := range argStrings(args[1]) {
+		switch strings.ToUpper(item) {
+		case "MESSAGES":
+			items = append(items, fmt.Sprintf("MESSAGES %d", len(emails)))
+		case "RECENT":
+			items = append(items, "RECENT 0")
+		case "UIDNEXT":
+			items = append(items, fmt.Sprintf("UIDNEXT %d", state.UidNext))
+		case "UIDVALIDITY":
+			items = append(items, fmt.Sprintf("UIDVALIDITY %d", state.UidValidity))
+		case "UNSEEN":
+			unseen := 0
+			for _, email := range emails {
+				if !email.IsRead {
+					unseen++
+				}
+			}
+			items = append(items, fmt.Sprintf("UNSEEN %d", unseen))
+		default:
+			session.writeTaggedResponse("BAD Invalid status item")
+			return
+		}
+	}
+
+	session.writeResponse(fmt.Sprintf("* STATUS %s (%s)", imapQuote(name), strings.Join(items, " ")))
+	session.writeTaggedResponse("OK STATUS completed")
+}
+
+// handleAppend 处理APPEND命令: APPEND mailbox [(flags)] [date-time] literal
+func (session *IMAPSession) handleAppend(args []interface{}) {
+	if len(args) < 2 {
+		session.writeTaggedResponse("BAD APPEND requires mailbox name and message")
+		return
+	}
+
+	name, _ := argString(args[0])
+	message, ok := argString(args[len(args)-1])
+	if !ok {
+		session.writeTaggedResponse("BAD APPEND requires message literal")
+		return
+	}
+
+	email := &model.Email{
+		MailboxId: session.mailboxID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	for _, arg := range args[1 : len(args)-1] {
+		switch v := arg.(type) {
+		case imapList:
+			for _, flag := range argStrings(v) {
+				if column, ok := imapFlagColumns[strings.ToLower(flag)]; ok {
+					setEmailFlag(email, column, true)
+				}
+			}
+		case string:
+			date, err := time.Parse("_2-Jan-2006 15:04:05 -0700", v)
+			if err != nil {
+				session.writeTaggedResponse("BAD Invalid date-time")
+				return
+			}
+			email.CreatedAt = date
+		}
+	}
+
+	folder, ok := session.resolveFolder(name)
+	if !ok {
+		session.writeTaggedResponse("NO [TRYCREATE] Mailbox does not exist")
+		return
+	}
+	email.Folder = folder
+
+	raw := []byte(message)
+	header, _ := splitRawMessage(raw)
+	h := parseMIMEHeader(header)
+	email.FromAddr = parseAddressHeader(h.Get("From"))
+	email.ToAddr = parseAddressHeader(h.Get("To"))
+	email.Subject, email.Body = parseMessageContent(message)
+
+	if err := session.server.saveEmailWithRaw(email, raw); err != nil {
+		log.Printf("APPEND保存邮件失败: %v", err)
+		session.writeTaggedResponse("NO APPEND failed")
+		return
+	}
+
+	if session.state == "SELECTED" && folder == session.folder {
+		session.refresh(true)
+	}
+	session.writeTaggedResponse("OK APPEND completed")
+}
+
+// parseAddressHeader 提取地址头部中的邮箱地址（多个地址用逗号分隔）
+func parseAddressHeader(value string) string {
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	var list []string
+	for _, addr := range addresses {
+		list = append(list, addr.Address)
+	}
+	return strings.Join(list, ", ")
+}
+
+// handleUID 处理UID命令
+func (session *IMAPSession) handleUID(args []interface{}) {
+	if len(args) < 1 {
+		session.writeTaggedResponse("BAD UID requires command")
+		return
+	}
+
+	sub, _ := argString(args[0])
+	switch strings.ToUpper(sub) {
+	case "FETCH":
+		session.handleFetch(args[1:], true)
+	case "SEARCH":
+		session.handleSearch(args[1:], true)
+	case "STORE":
+		session.handleStore(args[1:], true)
+	case "COPY":
+		session.handleCopy(args[1:], true)
+	case "MOVE":
+		session.handleMove(args[1:], true)
+	default:
+		session.writeTaggedResponse("BAD Invalid UID command")
+	}
+}
+
+// handleLogout 处理LOGOUT命令
+func (session *IMAPSession) handleLogout() {
+	session.writeResponse("* BYE Miko Email IMAP Server logging out")
+	session.writeTaggedResponse("OK LOGOUT completed")
+}
+
+// copyEmailToFolder 复制邮件（含原文和附件记录）到指定文件夹
+func (s *Service) copyEmailToFolder(emailID int64, folder string) error {
+	email, err := s.svcCtx.EmailModel.GetById(emailID)
+	if err != nil {
+		return err
+	}
+
+	raw, err := s.svcCtx.EmailRawModel.GetByEmailId(emailID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	tx := s.svcCtx.DB.Begin()
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	copied := *email
+	copied.Id = 0
+	copied.Uid = 0
+	copied.Folder = folder
+	copied.BayesClass = ""
+	copied.UpdatedAt = time.Now()
+	if err := s.svcCtx.EmailModel.Create(tx, &copied); err != nil {
+		return err
+	}
+
+	if raw != nil {
+		if err := s.svcCtx.EmailRawModel.Create(tx, newEmailRaw(copied.Id, raw.Content)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.svcCtx.AttachmentModel.CopyToEmail(tx, emailID, copied.Id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	tx = nil
+
+	// 复制到垃圾邮件或从垃圾邮件复制出来时训练贝叶斯分类器
+	if folder != email.Folder {
+		s.bayesService.OnFolderChange(nil, &copied, email.Folder)
+	}
+
+	s.notifyMailbox(copied.MailboxId)
+
+	return nil
+}
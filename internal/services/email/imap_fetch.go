@@ -0,0 +1,321 @@
+package email
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"miko-email/internal/model"
+)
+
+// fetchItem FETCH数据项
+type fetchItem struct {
+	name    string // 数据项名称（大写），BODY[...] 和 BODY.PEEK[...] 统一为 BODY[]
+	section string // BODY[section] 中的 section（大写）
+	peek    bool   // BODY.PEEK 不设置 \Seen
+	partial bool   // 是否带 <origin.count>
+	origin  int
+	count   int
+}
+
+// fetchMessage FETCH时按需加载的邮件内容
+type fetchMessage struct {
+	session *IMAPSession
+	email   *model.Email
+	full    *model.Email // 包含正文的完整邮件记录
+	raw     []byte
+	root    *mimePart
+}
+
+// load 加载邮件原文并解析MIME结构
+func (m *fetchMessage) load() error {
+	if m.raw != nil {
+		return nil
+	}
+	full, err := m.session.server.svcCtx.EmailModel.GetById(m.email.Id)
+	if err != nil {
+		return err
+	}
+	raw, err := m.session.server.GetRawMessage(full)
+	if err != nil {
+		return err
+	}
+	m.full = full
+	m.raw = toCRLF(raw)
+	m.root = parseMIMEPart(m.raw, "text/plain")
+	return nil
+}
+
+// parseFetchItems 解析FETCH数据项（支持 ALL/FAST/FULL 宏）
+func parseFetchItems(args []interface{}) ([]fetchItem, error) {
+	var names []string
+	for _, arg := range args {
+		names = append(names, argStrings(arg)...)
+	}
+	if len(names) == 1 {
+		switch strings.ToUpper(names[0]) {
+		case "ALL":
+			names = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE"}
+		case "FAST":
+			names = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE"}
+		case "FULL":
+			names = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODY"}
+		}
+	}
+	if len(names) == 0 {
+		return nil, errIMAPSyntax
+	}
+
+	var items []fetchItem
+	for _, name := range names {
+		upper := strings.ToUpper(name)
+		switch upper {
+		case "UID", "FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODYSTRUCTURE", "BODY",
+			"RFC822", "RFC822.HEADER", "RFC822.TEXT":
+			items = append(items, fetchItem{name: upper})
+			continue
+		}
+
+		var item fetchItem
+		switch {
+		case strings.HasPrefix(upper, "BODY.PEEK["):
+			item.peek = true
+			upper = upper[len("BODY.PEEK"):]
+		case strings.HasPrefix(upper, "BODY["):
+			upper = upper[len("BODY"):]
+		default:
+			return nil, errIMAPSyntax
+		}
+		item.name = "BODY[]"
+
+		end := strings.LastIndex(upper, "]")
+		if end < 0 {
+			return nil, errIMAPSyntax
+		}
+		item.section = upper[1:end]
+
+		if rest := upper[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, "<") || !strings.HasSuffix(rest, ">") {
+				return nil, errIMAPSyntax
+			}
+			bounds := strings.SplitN(rest[1:len(rest)-1], ".", 2)
+			if len(bounds) != 2 {
+				return nil, errIMAPSyntax
+			}
+			origin, err1 := strconv.Atoi(bounds[0])
+			count, err2 := strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil || origin < 0 || count < 0 {
+				return nil, errIMAPSyntax
+			}
+			item.partial, item.origin, item.count = true, origin, count
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// handleFetch 处理FETCH命令
+func (session *IMAPSession) handleFetch(args []interface{}, byUID bool) {
+	if len(args) < 2 {
+		session.writeTaggedResponse("BAD FETCH requires sequence set and data items")
+		return
+	}
+
+	items, err := parseFetchItems(args[1:])
+	if err != nil {
+		session.writeTaggedResponse("BAD Invalid FETCH data items")
+		return
+	}
+
+	// UID FETCH 的响应总是包含UID
+	if byUID {
+		hasUID := false
+		for _, item := range items {
+			if item.name == "UID" {
+				hasUID = true
+			}
+		}
+		if !hasUID {
+			items = append([]fetchItem{{name: "UID"}}, items...)
+		}
+	}
+
+	messages, err := session.selectMessages(args[0], byUID)
+	if err != nil {
+		session.writeTaggedResponse("BAD Invalid sequence set")
+		return
+	}
+
+	// 批量查询原文大小
+	var ids []int64
+	for _, msg := range messages {
+		ids = append(ids, msg.email.Id)
+	}
+	sizes, err := session.server.svcCtx.EmailRawModel.GetSizesByEmailIds(ids)
+	if err != nil {
+		log.Printf("查询邮件大小失败: %v", err)
+		sizes = map[int64]int64{}
+	}
+
+	for _, msg := range messages {
+		m := &fetchMessage{session: session, email: msg.email}
+		var parts []string
+		setSeen := false
+		hasFlags := false
+
+		for _, item := range items {
+			value, seen, err := m.fetch(item, sizes)
+			if err != nil {
+				log.Printf("FETCH读取邮件失败: %v", err)
+				session.writeTaggedResponse("NO FETCH failed")
+				return
+			}
+			if item.name == "FLAGS" {
+				hasFlags = true
+			}
+			setSeen = setSeen || seen
+			parts = append(parts, value)
+		}
+
+		// 读取正文时设置 \Seen 标志
+		if setSeen && !session.readOnly && !msg.email.IsRead {
+			if err := session.server.svcCtx.EmailModel.MarkAsRead(nil, msg.email.Id); err != nil {
+				log.Printf("标记邮件已读失败: %v", err)
+			} else {
+				msg.email.IsRead = true
+				session.server.notifyMailbox(session.mailboxID)
+				session.flags[msg.email.Uid] = imapFlags(msg.email)
+				if !hasFlags {
+					parts = append(parts, "FLAGS "+imapFlags(msg.email))
+				} else {
+					for i, item := range items {
+						if item.name == "FLAGS" {
+							parts[i] = "FLAGS " + imapFlags(msg.email)
+						}
+					}
+				}
+			}
+		}
+
+		session.writer.WriteString(fmt.Sprintf("* %d FETCH (%s)\r\n", msg.seq, strings.Join(parts, " ")))
+	}
+	session.writer.Flush()
+
+	session.writeTaggedResponse("OK FETCH completed")
+}
+
+// fetch 生成单个数据项的响应，返回是否需要设置 \Seen
+func (m *fetchMessage) fetch(item fetchItem, sizes map[int64]int64) (string, bool, error) {
+	switch item.name {
+	case "UID":
+		return fmt.Sprintf("UID %d", m.email.Uid), false, nil
+	case "FLAGS":
+		return "FLAGS " + imapFlags(m.email), false, nil
+	case "INTERNALDATE":
+		return fmt.Sprintf("INTERNALDATE \"%s\"", m.email.CreatedAt.In(time.Local).Format(imapDateLayout)), false, nil
+	case "RFC822.SIZE":
+		if size, ok := sizes[m.email.Id]; ok {
+			return fmt.Sprintf("RFC822.SIZE %d", size), false, nil
+		}
+		if err := m.load(); err != nil {
+			return "", false, err
+		}
+		return fmt.Sprintf("RFC822.SIZE %d", len(m.raw)), false, nil
+	}
+
+	if err := m.load(); err != nil {
+		return "", false, err
+	}
+
+	switch item.name {
+	case "ENVELOPE":
+		return "ENVELOPE " + buildEnvelope(m.root.header), false, nil
+	case "BODYSTRUCTURE":
+		return "BODYSTRUCTURE " + m.root.bodyStructure(true), false, nil
+	case "BODY":
+		// 不带 section 的 BODY 为非扩展的 BODYSTRUCTURE
+		return "BODY " + m.root.bodyStructure(false), false, nil
+	case "RFC822":
+		return "RFC822 " + imapLiteral(m.raw), true, nil
+	case "RFC822.HEADER":
+		return "RFC822.HEADER " + imapLiteral(m.root.rawHeader), false, nil
+	case "RFC822.TEXT":
+		return "RFC822.TEXT " + imapLiteral(m.root.body), true, nil
+	}
+
+	content := fetchSection(m.root, m.raw, item.section)
+	name := "BODY[" + item.section + "]"
+	if item.partial {
+		name += fmt.Sprintf("<%d>", item.origin)
+		if item.origin >= len(content) {
+			content = nil
+		} else {
+			content = content[item.origin:]
+			if item.count < len(content) {
+				content = content[:item.count]
+			}
+		}
+	}
+	return name + " " + imapLiteral(content), !item.peek, nil
+}
+
+// fetchSection 获取 BODY[section] 的内容
+func fetchSection(root *mimePart, raw []byte, section string) []byte {
+	// 解析部分编号，如 1.2.HEADER
+	part := root
+	numbered := false
+	for section != "" && section[0] >= '0' && section[0] <= '9' {
+		end := 0
+		for end < len(section) && section[end] >= '0' && section[end] <= '9' {
+			end++
+		}
+		n, _ := strconv.Atoi(section[:end])
+		part = part.child(n)
+		if part == nil {
+			return nil
+		}
+		numbered = true
+		section = strings.TrimPrefix(section[end:], ".")
+	}
+
+	// 目标邮件（HEADER/TEXT针对 message/rfc822 部分内嵌的邮件）
+	msg := root
+	if numbered {
+		msg = part.message
+	}
+
+	switch {
+	case section == "":
+		if !numbered {
+			return raw
+		}
+		return part.body
+	case section == "MIME":
+		if !numbered {
+			return nil
+		}
+		return part.rawHeader
+	case section == "HEADER":
+		if msg == nil {
+			return nil
+		}
+		return msg.rawHeader
+	case section == "TEXT":
+		if msg == nil {
+			return nil
+		}
+		return msg.body
+	case strings.HasPrefix(section, "HEADER.FIELDS"):
+		if msg == nil {
+			return nil
+		}
+		not := strings.HasPrefix(section, "HEADER.FIELDS.NOT")
+		fields := section[strings.Index(section, "FIELDS")+len("FIELDS"):]
+		fields = strings.TrimPrefix(fields, ".NOT")
+		fields = strings.Trim(strings.TrimSpace(fields), "()")
+		return headerFields(msg.rawHeader, strings.Fields(fields), not)
+	}
+	return nil
+}
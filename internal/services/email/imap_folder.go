@@ -0,0 +1,487 @@
+package email
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"miko-email/internal/model"
+)
+
+// imapSpecialFolder 系统文件夹（RFC 6154 SPECIAL-USE）
+type imapSpecialFolder struct {
+	name   string // IMAP文件夹名
+	folder string // 对应的 email.folder
+	attr   string // SPECIAL-USE 属性
+}
+
+// imapSpecialFolders 系统文件夹列表，不能删除或重命名（INBOX 重命名时移动其中的邮件）
+var imapSpecialFolders = []imapSpecialFolder{
+	{name: "INBOX", folder: "inbox"},
+	{name: "Sent", folder: "sent", attr: `\Sent`},
+	{name: "Drafts", folder: "drafts", attr: `\Drafts`},
+	{name: "Trash", folder: "trash", attr: `\Trash`},
+	{name: "Junk", folder: "junk", attr: `\Junk`},
+	{name: "Archive", folder: "archive", attr: `\Archive`},
+}
+
+// imapHierarchyDelimiter 层级分隔符
+const imapHierarchyDelimiter = "/"
+
+// findSpecialFolder 根据IMAP文件夹名查找系统文件夹（大小写不敏感）
+func findSpecialFolder(name string) *imapSpecialFolder {
+	for i := range imapSpecialFolders {
+		if strings.EqualFold(name, imapSpecialFolders[i].name) {
+			return &imapSpecialFolders[i]
+		}
+	}
+	return nil
+}
+
+// isSpecialFolder 判断 email.folder 是否为系统文件夹
+func isSpecialFolder(folder string) bool {
+	for _, special := range imapSpecialFolders {
+		if special.folder == folder {
+			return true
+		}
+	}
+	return false
+}
+
+// imapFolderName 规范化IMAP文件夹名（系统文件夹使用标准名称，INBOX 的子文件夹前缀统一为大写）
+func imapFolderName(name string) string {
+	if special := findSpecialFolder(name); special != nil {
+		return special.name
+	}
+	if len(name) > len("INBOX/") && strings.EqualFold(name[:len("INBOX/")], "INBOX/") {
+		return "INBOX/" + name[len("INBOX/"):]
+	}
+	return name
+}
+
+// resolveFolder 将IMAP文件夹名转换为 email.folder（用户文件夹的 email.folder 即文件夹名）
+func (session *IMAPSession) resolveFolder(name string) (string, bool) {
+	if session.mailboxID == 0 {
+		return "", false
+	}
+	if special := findSpecialFolder(name); special != nil {
+		return special.folder, true
+	}
+	name = imapFolderName(name)
+	if _, err := session.server.svcCtx.FolderModel.GetByName(session.mailboxID, name); err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// validFolderName 检查用户文件夹名是否合法
+func validFolderName(name string) bool {
+	if name == "" || strings.ContainsAny(name, "*%\r\n\"\\") {
+		return false
+	}
+	for _, segment := range strings.Split(name, imapHierarchyDelimiter) {
+		if segment == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// imapFolderEntry LIST/LSUB 返回的文件夹
+type imapFolderEntry struct {
+	name       string
+	attr       string
+	subscribed bool
+}
+
+// listFolders 获取当前邮箱的所有文件夹（系统文件夹在前）
+func (session *IMAPSession) listFolders() ([]imapFolderEntry, error) {
+	rows, err := session.server.svcCtx.FolderModel.GetByMailboxId(session.mailboxID)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*model.MailboxFolder, len(rows))
+	for _, row := range rows {
+		byName[row.Name] = row
+	}
+
+	var entries []imapFolderEntry
+	for _, special := range imapSpecialFolders {
+		// 系统文件夹在首次使用时才创建记录，默认订阅
+		subscribed := true
+		if row, ok := byName[special.folder]; ok {
+			subscribed = row.Subscribed
+		}
+		entries = append(entries, imapFolderEntry{name: special.name, attr: special.attr, subscribed: subscribed})
+	}
+
+	var users []imapFolderEntry
+	for _, row := range rows {
+		if isSpecialFolder(row.Name) {
+			continue
+		}
+		users = append(users, imapFolderEntry{name: row.Name, subscribed: row.Subscribed})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].name < users[j].name })
+
+	return append(entries, users...), nil
+}
+
+// handleList 处理LIST/LSUB命令
+func (session *IMAPSession) handleList(args []interface{}, lsub bool) {
+	command := "LIST"
+	if lsub {
+		command = "LSUB"
+	}
+
+	if len(args) < 2 {
+		session.writeTaggedResponse("BAD " + command + " requires reference and mailbox name")
+		return
+	}
+	reference, _ := argString(args[0])
+	pattern, _ := argString(args[1])
+
+	// 空模式用于查询层级分隔符
+	if pattern == "" && !lsub {
+		session.writeResponse(`* LIST (\Noselect) "/" ""`)
+		session.writeTaggedResponse("OK LIST completed")
+		return
+	}
+
+	entries, err := session.listFolders()
+	if err != nil {
+		log.Printf("获取文件夹列表失败: %v", err)
+		session.writeTaggedResponse("NO " + command + " failed")
+		return
+	}
+
+	pattern = reference + pattern
+	for _, entry := range entries {
+		if lsub && !entry.subscribed {
+			continue
+		}
+		// INBOX 大小写不敏感
+		matched := imapMatch(pattern, entry.name)
+		if entry.name == "INBOX" {
+			matched = imapMatch(strings.ToUpper(pattern), entry.name)
+		}
+		if !matched {
+			continue
+		}
+
+		var attrs []string
+		hasChildren := false
+		for _, other := range entries {
+			if strings.HasPrefix(other.name, entry.name+imapHierarchyDelimiter) {
+				hasChildren = true
+				break
+			}
+		}
+		if hasChildren {
+			attrs = append(attrs, `\HasChildren`)
+		} else {
+			attrs = append(attrs, `\HasNoChildren`)
+		}
+		if entry.attr != "" {
+			attrs = append(attrs, entry.attr)
+		}
+		session.writeResponse(fmt.Sprintf(`* %s (%s) "/" %s`, command, strings.Join(attrs, " "), imapQuote(entry.name)))
+	}
+
+	session.writeTaggedResponse("OK " + command + " completed")
+}
+
+// imapMatch 匹配LIST通配符（* 匹配任意字符，% 不匹配层级分隔符）
+func imapMatch(pattern, name string) bool {
+	if pattern == "" {
+		return name == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(name); i++ {
+			if imapMatch(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	case '%':
+		for i := 0; i <= len(name); i++ {
+			if imapMatch(pattern[1:], name[i:]) {
+				return true
+			}
+			if i < len(name) && name[i] == '/' {
+				return false
+			}
+		}
+		return false
+	}
+	if name == "" || pattern[0] != name[0] {
+		return false
+	}
+	return imapMatch(pattern[1:], name[1:])
+}
+
+// createFolders 创建用户文件夹（同时创建不存在的上级文件夹）
+func (s *Service) createFolders(tx *gorm.DB, mailboxID int64, name string) error {
+	segments := strings.Split(name, imapHierarchyDelimiter)
+	for i := range segments {
+		path := strings.Join(segments[:i+1], imapHierarchyDelimiter)
+		if findSpecialFolder(path) != nil {
+			continue
+		}
+		var count int64
+		if err := tx.Model(&model.MailboxFolder{}).
+			Where("mailbox_id = ? AND name = ?", mailboxID, path).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		folder := &model.MailboxFolder{
+			MailboxId:   mailboxID,
+			Name:        path,
+			UidValidity: time.Now().Unix(),
+			UidNext:     1,
+			Subscribed:  true,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+		if err := s.svcCtx.FolderModel.Create(tx, folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleCreate 处理CREATE命令
+func (session *IMAPSession) handleCreate(args []interface{}) {
+	if len(args) < 1 {
+		session.writeTaggedResponse("BAD CREATE requires mailbox name")
+		return
+	}
+	name, _ := argString(args[0])
+	// 结尾的层级分隔符表示将要在其下创建子文件夹
+	name = imapFolderName(strings.TrimSuffix(name, imapHierarchyDelimiter))
+
+	if findSpecialFolder(name) != nil {
+		session.writeTaggedResponse("NO [ALREADYEXISTS] Mailbox already exists")
+		return
+	}
+	if !validFolderName(name) {
+		session.writeTaggedResponse("NO Invalid mailbox name")
+		return
+	}
+	if _, ok := session.resolveFolder(name); ok {
+		session.writeTaggedResponse("NO [ALREADYEXISTS] Mailbox already exists")
+		return
+	}
+
+	err := session.server.svcCtx.DB.Transaction(func(tx *gorm.DB) error {
+		return session.server.createFolders(tx, session.mailboxID, name)
+	})
+	if err != nil {
+		log.Printf("创建文件夹失败: %v", err)
+		session.writeTaggedResponse("NO CREATE failed")
+		return
+	}
+
+	session.writeTaggedResponse("OK CREATE completed")
+}
+
+// handleDelete 处理DELETE命令
+func (session *IMAPSession) handleDelete(args []interface{}) {
+	if len(args) < 1 {
+		session.writeTaggedResponse("BAD DELETE requires mailbox name")
+		return
+	}
+	name, _ := argString(args[0])
+	name = imapFolderName(name)
+
+	if findSpecialFolder(name) != nil {
+		session.writeTaggedResponse("NO Cannot delete special mailbox")
+		return
+	}
+	folder, err := session.server.svcCtx.FolderModel.GetByName(session.mailboxID, name)
+	if err != nil {
+		session.writeTaggedResponse("NO [NONEXISTENT] Mailbox does not exist")
+		return
+	}
+
+	entries, err := session.listFolders()
+	if err != nil {
+		log.Printf("获取文件夹列表失败: %v", err)
+		session.writeTaggedResponse("NO DELETE failed")
+		return
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.name, name+imapHierarchyDelimiter) {
+			session.writeTaggedResponse("NO [INUSE] Mailbox has inferior hierarchical names")
+			return
+		}
+	}
+
+	// 删除文件夹中的邮件
+	emails, err := session.server.svcCtx.EmailModel.GetEmailsByFolder(session.mailboxID, name)
+	if err != nil {
+		log.Printf("获取文件夹邮件失败: %v", err)
+		session.writeTaggedResponse("NO DELETE failed")
+		return
+	}
+	for _, email := range emails {
+		if err := session.server.deleteEmailWithRaw(email); err != nil {
+			log.Printf("删除文件夹邮件失败: %v", err)
+			session.writeTaggedResponse("NO DELETE failed")
+			return
+		}
+	}
+
+	if err := session.server.svcCtx.FolderModel.Delete(nil, folder.Id); err != nil {
+		log.Printf("删除文件夹失败: %v", err)
+		session.writeTaggedResponse("NO DELETE failed")
+		return
+	}
+
+	if session.state == "SELECTED" && session.folder == name {
+		session.unselect()
+	}
+	session.writeTaggedResponse("OK DELETE completed")
+}
+
+// handleRename 处理RENAME命令（子文件夹一并重命名，重命名INBOX时移动其中的邮件）
+func (session *IMAPSession) handleRename(args []interface{}) {
+	if len(args) < 2 {
+		session.writeTaggedResponse("BAD RENAME requires existing and new mailbox names")
+		return
+	}
+	oldName, _ := argString(args[0])
+	newName, _ := argString(args[1])
+	oldName = imapFolderName(oldName)
+	newName = imapFolderName(strings.TrimSuffix(newName, imapHierarchyDelimiter))
+
+	if findSpecialFolder(newName) != nil {
+		session.writeTaggedResponse("NO [ALREADYEXISTS] Mailbox already exists")
+		return
+	}
+	if !validFolderName(newName) {
+		session.writeTaggedResponse("NO Invalid mailbox name")
+		return
+	}
+	if _, ok := session.resolveFolder(newName); ok {
+		session.writeTaggedResponse("NO [ALREADYEXISTS] Mailbox already exists")
+		return
+	}
+
+	special := findSpecialFolder(oldName)
+	if special != nil && special.name != "INBOX" {
+		session.writeTaggedResponse("NO Cannot rename special mailbox")
+		return
+	}
+
+	var err error
+	if special != nil {
+		err = session.renameInbox(newName)
+	} else {
+		if _, ok := session.resolveFolder(oldName); !ok {
+			session.writeTaggedResponse("NO [NONEXISTENT] Mailbox does not exist")
+			return
+		}
+		if strings.HasPrefix(newName, oldName+imapHierarchyDelimiter) {
+			session.writeTaggedResponse("NO Cannot rename mailbox to its own child")
+			return
+		}
+		err = session.renameFolder(oldName, newName)
+	}
+	if err != nil {
+		log.Printf("重命名文件夹失败: %v", err)
+		session.writeTaggedResponse("NO RENAME failed")
+		return
+	}
+	session.server.notifyMailbox(session.mailboxID)
+
+	session.writeTaggedResponse("OK RENAME completed")
+}
+
+// renameInbox 将INBOX中的邮件移动到新文件夹，INBOX保留为空
+func (session *IMAPSession) renameInbox(newName string) error {
+	return session.server.svcCtx.DB.Transaction(func(tx *gorm.DB) error {
+		if err := session.server.createFolders(tx, session.mailboxID, newName); err != nil {
+			return err
+		}
+		return session.server.svcCtx.EmailModel.RenameFolder(tx, session.mailboxID, "inbox", newName, true)
+	})
+}
+
+// renameFolder 重命名用户文件夹及其子文件夹（UIDVALIDITY 和 UID 保持不变）
+func (session *IMAPSession) renameFolder(oldName, newName string) error {
+	rows, err := session.server.svcCtx.FolderModel.GetByMailboxId(session.mailboxID)
+	if err != nil {
+		return err
+	}
+
+	err = session.server.svcCtx.DB.Transaction(func(tx *gorm.DB) error {
+		// 先创建新名称的上级文件夹
+		if idx := strings.LastIndex(newName, imapHierarchyDelimiter); idx > 0 {
+			if err := session.server.createFolders(tx, session.mailboxID, newName[:idx]); err != nil {
+				return err
+			}
+		}
+		for _, row := range rows {
+			if row.Name != oldName && !strings.HasPrefix(row.Name, oldName+imapHierarchyDelimiter) {
+				continue
+			}
+			target := newName + strings.TrimPrefix(row.Name, oldName)
+			if err := session.server.svcCtx.FolderModel.Rename(tx, row.Id, target); err != nil {
+				return err
+			}
+			if err := session.server.svcCtx.EmailModel.RenameFolder(tx, session.mailboxID, row.Name, target, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 当前选中的文件夹被重命名
+	if session.state == "SELECTED" && (session.folder == oldName || strings.HasPrefix(session.folder, oldName+imapHierarchyDelimiter)) {
+		session.folder = newName + strings.TrimPrefix(session.folder, oldName)
+		session.mailbox = session.folder
+	}
+	return nil
+}
+
+// handleSubscribe 处理SUBSCRIBE/UNSUBSCRIBE命令
+func (session *IMAPSession) handleSubscribe(args []interface{}, subscribed bool) {
+	command := "SUBSCRIBE"
+	if !subscribed {
+		command = "UNSUBSCRIBE"
+	}
+
+	if len(args) < 1 {
+		session.writeTaggedResponse("BAD " + command + " requires mailbox name")
+		return
+	}
+	name, _ := argString(args[0])
+
+	folder, ok := session.resolveFolder(name)
+	if !ok {
+		session.writeTaggedResponse("NO [NONEXISTENT] Mailbox does not exist")
+		return
+	}
+
+	state, err := session.server.svcCtx.FolderModel.GetOrCreate(session.mailboxID, folder)
+	if err == nil {
+		err = session.server.svcCtx.FolderModel.SetSubscribed(state.Id, subscribed)
+	}
+	if err != nil {
+		log.Printf("更新文件夹订阅状态失败: %v", err)
+		session.writeTaggedResponse("NO " + command + " failed")
+		return
+	}
+
+	session.writeTaggedResponse("OK " + command + " completed")
+}
@@ -0,0 +1,71 @@
+package email
+
+import (
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// imapIdlePollInterval IDLE期间的兜底轮询间隔（覆盖没有发布通知的修改，如网页端移动邮件）
+const imapIdlePollInterval = 30 * time.Second
+
+// notifyMailbox 通知邮箱发生了变更，正在IDLE的IMAP会话会推送 EXISTS/EXPUNGE/FETCH
+func (s *Service) notifyMailbox(mailboxID int64) {
+	if s.svcCtx.MailboxEvents != nil {
+		s.svcCtx.MailboxEvents.Publish(mailboxID)
+	}
+}
+
+// handleIdle 处理IDLE命令（RFC 2177），直到客户端发送 DONE
+func (session *IMAPSession) handleIdle() {
+	events, cancel := session.server.svcCtx.MailboxEvents.Subscribe(session.mailboxID)
+	defer cancel()
+
+	session.writeResponse("+ idling")
+
+	// 单独的协程等待 DONE，主协程负责推送
+	done := make(chan error, 1)
+	go func() {
+		line, err := session.readLine()
+		if err == nil && !strings.EqualFold(strings.TrimSpace(line), "DONE") {
+			err = errIMAPSyntax
+		}
+		done <- err
+	}()
+
+	ticker := time.NewTicker(imapIdlePollInterval)
+	defer ticker.Stop()
+
+	if session.state == "SELECTED" {
+		session.refresh(true)
+	}
+
+	for {
+		select {
+		case <-events:
+			if session.state == "SELECTED" {
+				session.refresh(true)
+			}
+		case <-ticker.C:
+			if session.state == "SELECTED" {
+				session.refresh(true)
+			}
+		case err := <-done:
+			if err == nil {
+				session.writeTaggedResponse("OK IDLE terminated")
+				return
+			}
+			if err == errIMAPSyntax {
+				session.writeTaggedResponse("BAD Expected DONE")
+				return
+			}
+			if err != io.EOF {
+				log.Printf("IDLE读取失败: %v", err)
+			}
+			// 连接已断开，关闭连接使命令循环退出
+			session.conn.Close()
+			return
+		}
+	}
+}
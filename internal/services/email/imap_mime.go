@@ -0,0 +1,340 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// mimePart 邮件的MIME结构（保留未解码的原始字节，用于IMAP FETCH BODY[section]）
+type mimePart struct {
+	rawHeader []byte // 头部原文（含结尾空行）
+	body      []byte // 正文原文
+	header    textproto.MIMEHeader
+
+	mediaType string // 主类型，如 text
+	subType   string // 子类型，如 plain
+	params    map[string]string
+
+	children []*mimePart // multipart 子部分
+	message  *mimePart   // message/rfc822 内嵌邮件
+}
+
+// parseMIMEPart 解析MIME结构，defaultType 为缺少 Content-Type 时的默认类型
+func parseMIMEPart(raw []byte, defaultType string) *mimePart {
+	header, body := splitRawMessage(raw)
+	part := &mimePart{
+		rawHeader: header,
+		body:      body,
+		header:    parseMIMEHeader(header),
+	}
+
+	contentType := part.header.Get("Content-Type")
+	if contentType == "" {
+		contentType = defaultType
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{"charset": "us-ascii"}
+	}
+	if contentType == defaultType && mediaType == "text/plain" && params["charset"] == "" {
+		params["charset"] = "us-ascii"
+	}
+	part.params = params
+	if idx := strings.Index(mediaType, "/"); idx >= 0 {
+		part.mediaType, part.subType = mediaType[:idx], mediaType[idx+1:]
+	} else {
+		part.mediaType, part.subType = mediaType, ""
+	}
+
+	switch {
+	case part.mediaType == "multipart" && params["boundary"] != "":
+		childDefault := "text/plain"
+		if part.subType == "digest" {
+			childDefault = "message/rfc822"
+		}
+		for _, childRaw := range splitMultipart(body, params["boundary"]) {
+			part.children = append(part.children, parseMIMEPart(childRaw, childDefault))
+		}
+	case part.mediaType == "message" && part.subType == "rfc822":
+		part.message = parseMIMEPart(body, "text/plain")
+	}
+
+	return part
+}
+
+// parseMIMEHeader 解析头部字段
+func parseMIMEHeader(header []byte) textproto.MIMEHeader {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(header)))
+	h, err := reader.ReadMIMEHeader()
+	if err != nil && h == nil {
+		return textproto.MIMEHeader{}
+	}
+	return h
+}
+
+// splitMultipart 按boundary拆分multipart正文
+func splitMultipart(body []byte, boundary string) [][]byte {
+	delim := []byte("--" + boundary)
+	var parts [][]byte
+
+	pos := indexDelimiter(body, delim, 0)
+	for pos >= 0 {
+		lineEnd := bytes.IndexByte(body[pos:], '\n')
+		after := body[pos+len(delim):]
+		if bytes.HasPrefix(after, []byte("--")) || lineEnd < 0 {
+			break // 结束分隔符
+		}
+		start := pos + lineEnd + 1
+
+		next := indexDelimiter(body, delim, start)
+		if next < 0 {
+			parts = append(parts, body[start:])
+			break
+		}
+		// 分隔符前的换行属于分隔符
+		end := next
+		if end > start && body[end-1] == '\n' {
+			end--
+			if end > start && body[end-1] == '\r' {
+				end--
+			}
+		}
+		parts = append(parts, body[start:end])
+		pos = next
+	}
+
+	return parts
+}
+
+// indexDelimiter 查找从 from 开始位于行首的分隔符位置
+func indexDelimiter(body, delim []byte, from int) int {
+	for from <= len(body) {
+		idx := bytes.Index(body[from:], delim)
+		if idx < 0 {
+			return -1
+		}
+		pos := from + idx
+		if pos == 0 || body[pos-1] == '\n' {
+			return pos
+		}
+		from = pos + len(delim)
+	}
+	return -1
+}
+
+// child 按IMAP部分编号获取子部分
+func (p *mimePart) child(n int) *mimePart {
+	if p.message != nil {
+		p = p.message
+	}
+	if len(p.children) > 0 {
+		if n < 1 || n > len(p.children) {
+			return nil
+		}
+		return p.children[n-1]
+	}
+	if n == 1 {
+		return p
+	}
+	return nil
+}
+
+// lines 统计正文行数
+func (p *mimePart) lines() int {
+	if len(p.body) == 0 {
+		return 0
+	}
+	n := bytes.Count(p.body, []byte("\n"))
+	if p.body[len(p.body)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// bodyStructure 生成 BODY / BODYSTRUCTURE 响应，extended 为 true 时包含扩展数据
+func (p *mimePart) bodyStructure(extended bool) string {
+	var sb strings.Builder
+	sb.WriteString("(")
+
+	if len(p.children) > 0 {
+		for _, child := range p.children {
+			sb.WriteString(child.bodyStructure(extended))
+		}
+		sb.WriteString(" " + imapQuote(strings.ToUpper(p.subType)))
+		if extended {
+			sb.WriteString(" " + formatParams(p.params) + " " + p.dispositionString() + " NIL NIL")
+		}
+		sb.WriteString(")")
+		return sb.String()
+	}
+
+	encoding := strings.ToUpper(strings.TrimSpace(p.header.Get("Content-Transfer-Encoding")))
+	if encoding == "" {
+		encoding = "7BIT"
+	}
+
+	sb.WriteString(imapQuote(strings.ToUpper(p.mediaType)) + " " + imapQuote(strings.ToUpper(p.subType)))
+	sb.WriteString(" " + formatParams(p.params))
+	sb.WriteString(" " + imapNString(p.header.Get("Content-Id")))
+	sb.WriteString(" " + imapNString(p.header.Get("Content-Description")))
+	sb.WriteString(" " + imapQuote(encoding))
+	sb.WriteString(" " + strconv.Itoa(len(p.body)))
+
+	if p.message != nil {
+		sb.WriteString(" " + buildEnvelope(p.message.header))
+		sb.WriteString(" " + p.message.bodyStructure(extended))
+		sb.WriteString(" " + strconv.Itoa(p.lines()))
+	} else if p.mediaType == "text" {
+		sb.WriteString(" " + strconv.Itoa(p.lines()))
+	}
+
+	if extended {
+		sb.WriteString(" " + imapNString(p.header.Get("Content-Md5")) + " " + p.dispositionString() + " NIL NIL")
+	}
+
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// dispositionString 格式化 Content-Disposition
+func (p *mimePart) dispositionString() string {
+	value := p.header.Get("Content-Disposition")
+	if value == "" {
+		return "NIL"
+	}
+	disposition, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return "NIL"
+	}
+	return "(" + imapQuote(strings.ToUpper(disposition)) + " " + formatParams(params) + ")"
+}
+
+// formatParams 格式化参数列表
+func formatParams(params map[string]string) string {
+	if len(params) == 0 {
+		return "NIL"
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		v := params[k]
+		// 参数值需要保持为7位字符
+		if !isASCII(v) {
+			v = mime.BEncoding.Encode("UTF-8", v)
+		}
+		parts = append(parts, imapQuote(strings.ToUpper(k))+" "+imapQuote(v))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// buildEnvelope 生成 ENVELOPE 响应
+func buildEnvelope(header textproto.MIMEHeader) string {
+	from := header.Get("From")
+	sender := header.Get("Sender")
+	if sender == "" {
+		sender = from
+	}
+	replyTo := header.Get("Reply-To")
+	if replyTo == "" {
+		replyTo = from
+	}
+
+	fields := []string{
+		imapNString(header.Get("Date")),
+		imapNString(header.Get("Subject")),
+		formatAddressList(from),
+		formatAddressList(sender),
+		formatAddressList(replyTo),
+		formatAddressList(header.Get("To")),
+		formatAddressList(header.Get("Cc")),
+		formatAddressList(header.Get("Bcc")),
+		imapNString(header.Get("In-Reply-To")),
+		imapNString(header.Get("Message-Id")),
+	}
+	return "(" + strings.Join(fields, " ") + ")"
+}
+
+// formatAddressList 格式化地址列表 ((name adl mailbox host) ...)
+func formatAddressList(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "NIL"
+	}
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil || len(addresses) == 0 {
+		// 无法解析时尽量按单个地址返回
+		return "(" + formatAddress("", strings.Trim(strings.TrimSpace(value), "<>")) + ")"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("(")
+	for _, addr := range addresses {
+		sb.WriteString(formatAddress(addr.Name, addr.Address))
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// formatAddress 格式化单个地址
+func formatAddress(name, address string) string {
+	if name != "" && !isASCII(name) {
+		name = mime.QEncoding.Encode("UTF-8", name)
+	}
+	local, host := address, ""
+	if idx := strings.LastIndex(address, "@"); idx >= 0 {
+		local, host = address[:idx], address[idx+1:]
+	}
+	return fmt.Sprintf("(%s NIL %s %s)", imapNString(name), imapNString(local), imapNString(host))
+}
+
+// headerFields 从头部原文中筛选（或排除）指定字段
+func headerFields(rawHeader []byte, fields []string, not bool) []byte {
+	wanted := make(map[string]bool)
+	for _, f := range fields {
+		wanted[strings.ToLower(f)] = true
+	}
+
+	var out bytes.Buffer
+	include := false
+	for _, line := range bytes.SplitAfter(rawHeader, []byte("\n")) {
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if len(trimmed) == 0 {
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			name := string(line)
+			if idx := strings.IndexByte(name, ':'); idx >= 0 {
+				name = name[:idx]
+			}
+			include = wanted[strings.ToLower(strings.TrimSpace(name))] != not
+		}
+		if include {
+			out.Write(trimmed)
+			out.WriteString("\r\n")
+		}
+	}
+	out.WriteString("\r\n")
+	return out.Bytes()
+}
+
+// isASCII 判断是否为7位字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return utf8.ValidString(s)
+}
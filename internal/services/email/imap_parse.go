@@ -0,0 +1,319 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"miko-email/internal/config"
+)
+
+// imapList IMAP括号列表
+type imapList []interface{}
+
+var (
+	errIMAPSyntax          = errors.New("syntax error")
+	errIMAPLiteralTooLarge = errors.New("literal too large")
+)
+
+// imapParser IMAP命令解析器（支持 quoted 字符串、括号列表和 {n} 字面量）
+type imapParser struct {
+	session *IMAPSession
+	line    string
+	pos     int
+}
+
+// readLine 读取一行（去掉结尾的CRLF）
+func (session *IMAPSession) readLine() (string, error) {
+	line, err := session.reader.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readCommand 读取并解析一条完整的IMAP命令
+func (session *IMAPSession) readCommand() (tag, cmd string, args []interface{}, err error) {
+	line, err := session.readLine()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	p := &imapParser{session: session, line: line}
+	p.skipSpaces()
+	tag = p.readAtom()
+	if tag == "" {
+		return "", "", nil, errIMAPSyntax
+	}
+	session.tag = tag
+
+	p.skipSpaces()
+	cmd = strings.ToUpper(p.readAtom())
+	if cmd == "" {
+		return tag, "", nil, errIMAPSyntax
+	}
+
+	args, err = p.parseList(0)
+	return tag, cmd, args, err
+}
+
+// skipSpaces 跳过空格
+func (p *imapParser) skipSpaces() {
+	for p.pos < len(p.line) && p.line[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// readAtom 读取原子（允许 [] 中包含空格和括号，如 BODY[HEADER.FIELDS (FROM)]）
+func (p *imapParser) readAtom() string {
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.line) {
+		c := p.line[p.pos]
+		if depth > 0 {
+			if c == '[' {
+				depth++
+			} else if c == ']' {
+				depth--
+			}
+			p.pos++
+			continue
+		}
+		if c == ' ' || c == '(' || c == ')' || c == '"' || c == '{' {
+			break
+		}
+		if c == '[' {
+			depth++
+		}
+		p.pos++
+	}
+	return p.line[start:p.pos]
+}
+
+// parseList 解析参数列表，closing 为 ')' 时解析到对应的右括号为止
+func (p *imapParser) parseList(closing byte) ([]interface{}, error) {
+	var items []interface{}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.line) {
+			if closing != 0 {
+				return nil, errIMAPSyntax
+			}
+			return items, nil
+		}
+
+		c := p.line[p.pos]
+		switch {
+		case c == '(':
+			p.pos++
+			sub, err := p.parseList(')')
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, imapList(sub))
+		case c == ')':
+			if closing != ')' {
+				return nil, errIMAPSyntax
+			}
+			p.pos++
+			return items, nil
+		case c == '"':
+			s, err := p.readQuoted()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, s)
+		case c == '{':
+			s, err := p.readLiteral()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, s)
+		default:
+			atom := p.readAtom()
+			if atom == "" {
+				return nil, errIMAPSyntax
+			}
+			items = append(items, atom)
+		}
+	}
+}
+
+// readQuoted 读取 quoted 字符串
+func (p *imapParser) readQuoted() (string, error) {
+	p.pos++ // 跳过开头的引号
+	var sb strings.Builder
+	for p.pos < len(p.line) {
+		c := p.line[p.pos]
+		if c == '\\' && p.pos+1 < len(p.line) {
+			sb.WriteByte(p.line[p.pos+1])
+			p.pos += 2
+			continue
+		}
+		if c == '"' {
+			p.pos++
+			return sb.String(), nil
+		}
+		sb.WriteByte(c)
+		p.pos++
+	}
+	return "", errIMAPSyntax
+}
+
+// readLiteral 读取 {n} 字面量，同步字面量需要先发送继续请求
+func (p *imapParser) readLiteral() (string, error) {
+	end := strings.IndexByte(p.line[p.pos:], '}')
+	if end < 0 || p.pos+end != len(p.line)-1 {
+		return "", errIMAPSyntax
+	}
+	spec := p.line[p.pos+1 : p.pos+end]
+	nonSync := strings.HasSuffix(spec, "+")
+	spec = strings.TrimSuffix(spec, "+")
+
+	size, err := strconv.ParseInt(spec, 10, 64)
+	if err != nil || size < 0 {
+		return "", errIMAPSyntax
+	}
+	if size > config.GetMaxEmailSize() {
+		if nonSync {
+			io.CopyN(io.Discard, p.session.reader, size)
+		}
+		return "", errIMAPLiteralTooLarge
+	}
+
+	if !nonSync {
+		p.session.writeResponse("+ Ready for literal data")
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(p.session.reader, buf); err != nil {
+		return "", err
+	}
+
+	// 字面量之后命令继续在下一行
+	line, err := p.session.readLine()
+	if err != nil {
+		return "", err
+	}
+	p.line = line
+	p.pos = 0
+
+	return string(buf), nil
+}
+
+// argString 将参数转换为字符串
+func argString(arg interface{}) (string, bool) {
+	s, ok := arg.(string)
+	return s, ok
+}
+
+// argStrings 将参数（单个原子或括号列表）展开为字符串列表
+func argStrings(arg interface{}) []string {
+	switch v := arg.(type) {
+	case string:
+		return []string{v}
+	case imapList:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// seqRange 序列号/UID区间，0 表示 *
+type seqRange struct {
+	start, end uint32
+}
+
+// seqSet 序列号集合
+type seqSet []seqRange
+
+// parseSeqSet 解析序列号集合，如 1:3,5,7:*
+func parseSeqSet(s string) (seqSet, error) {
+	if s == "" {
+		return nil, errIMAPSyntax
+	}
+	var set seqSet
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, ":", 2)
+		start, err := parseSeqNumber(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = parseSeqNumber(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		set = append(set, seqRange{start: start, end: end})
+	}
+	return set, nil
+}
+
+// parseSeqNumber 解析单个序列号（* 返回0）
+func parseSeqNumber(s string) (uint32, error) {
+	if s == "*" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, errIMAPSyntax
+	}
+	return uint32(n), nil
+}
+
+// contains 判断 n 是否在集合中，max 为 * 代表的值
+func (set seqSet) contains(n, max uint32) bool {
+	for _, r := range set {
+		start, end := r.start, r.end
+		if start == 0 {
+			start = max
+		}
+		if end == 0 {
+			end = max
+		}
+		if start > end {
+			start, end = end, start
+		}
+		if n >= start && n <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// imapQuote 将字符串格式化为 quoted 字符串，含有换行或8位字符时使用字面量
+func imapQuote(s string) string {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\r' || c == '\n' || c == 0 || c >= 0x80 {
+			return fmt.Sprintf("{%d}\r\n%s", len(s), s)
+		}
+	}
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return "\"" + s + "\""
+}
+
+// imapNString 空字符串返回 NIL
+func imapNString(s string) string {
+	if s == "" {
+		return "NIL"
+	}
+	return imapQuote(s)
+}
+
+// imapLiteral 格式化字面量
+func imapLiteral(b []byte) string {
+	return fmt.Sprintf("{%d}\r\n%s", len(b), b)
+}
@@ -0,0 +1,271 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newParseSession 创建从 input 读取命令、响应写入 output 的IMAP会话
+func newParseSession(input string, output *bytes.Buffer) *IMAPSession {
+	return &IMAPSession{
+		reader: bufio.NewReader(strings.NewReader(input)),
+		writer: bufio.NewWriter(output),
+	}
+}
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		tag           string
+		cmd           string
+		args          []interface{}
+		continuations int // 同步字面量发送的继续请求数
+	}{
+		{
+			name:  "原子参数",
+			input: "a1 LOGIN user secret\r\n",
+			tag:   "a1",
+			cmd:   "LOGIN",
+			args:  []interface{}{"user", "secret"},
+		},
+		{
+			name:  "命令不区分大小写",
+			input: "a2 noop\r\n",
+			tag:   "a2",
+			cmd:   "NOOP",
+		},
+		{
+			name:  "quoted字符串和转义",
+			input: "a3 LOGIN \"us\\\"er\" \"p\\\\ss word\"\r\n",
+			tag:   "a3",
+			cmd:   "LOGIN",
+			args:  []interface{}{`us"er`, `p\ss word`},
+		},
+		{
+			name:  "空的quoted字符串",
+			input: "a4 LIST \"\" \"*\"\r\n",
+			tag:   "a4",
+			cmd:   "LIST",
+			args:  []interface{}{"", "*"},
+		},
+		{
+			name:  "括号列表和方括号中的空格",
+			input: "a5 FETCH 1:* (FLAGS BODY.PEEK[HEADER.FIELDS (FROM SUBJECT)] UID)\r\n",
+			tag:   "a5",
+			cmd:   "FETCH",
+			args:  []interface{}{"1:*", imapList{"FLAGS", "BODY.PEEK[HEADER.FIELDS (FROM SUBJECT)]", "UID"}},
+		},
+		{
+			name:  "嵌套列表",
+			input: "a6 SEARCH OR (FROM alice) (SUBJECT \"hello world\")\r\n",
+			tag:   "a6",
+			cmd:   "SEARCH",
+			args:  []interface{}{"OR", imapList{"FROM", "alice"}, imapList{"SUBJECT", "hello world"}},
+		},
+		{
+			name:  "空列表",
+			input: "a7 STORE 1 FLAGS ()\r\n",
+			tag:   "a7",
+			cmd:   "STORE",
+			args:  []interface{}{"1", "FLAGS", imapList(nil)},
+		},
+		{
+			name:  "系统标志",
+			input: "a8 UID STORE 4:7 +FLAGS.SILENT (\\Seen \\Deleted)\r\n",
+			tag:   "a8",
+			cmd:   "UID",
+			args:  []interface{}{"STORE", "4:7", "+FLAGS.SILENT", imapList{`\Seen`, `\Deleted`}},
+		},
+		{
+			name:          "同步字面量",
+			input:         "a9 LOGIN {4}\r\nuser {6}\r\nsecret\r\n",
+			tag:           "a9",
+			cmd:           "LOGIN",
+			args:          []interface{}{"user", "secret"},
+			continuations: 2,
+		},
+		{
+			name:  "非同步字面量",
+			input: "b1 APPEND INBOX (\\Seen) {11+}\r\nhello world\r\n",
+			tag:   "b1",
+			cmd:   "APPEND",
+			args:  []interface{}{"INBOX", imapList{`\Seen`}, "hello world"},
+		},
+		{
+			name:  "字面量中的换行",
+			input: "b2 APPEND Drafts {7+}\r\na\r\nb\r\nc\r\n",
+			tag:   "b2",
+			cmd:   "APPEND",
+			args:  []interface{}{"Drafts", "a\r\nb\r\nc"},
+		},
+		{
+			name:  "字面量后继续参数",
+			input: "b3 APPEND INBOX {2+}\r\nhi (\\Flagged)\r\n",
+			tag:   "b3",
+			cmd:   "APPEND",
+			args:  []interface{}{"INBOX", "hi", imapList{`\Flagged`}},
+		},
+		{
+			name:          "空字面量",
+			input:         "b4 LOGIN {0}\r\n {0+}\r\n\r\n",
+			tag:           "b4",
+			cmd:           "LOGIN",
+			args:          []interface{}{"", ""},
+			continuations: 1,
+		},
+		{
+			name:  "LF换行",
+			input: "b5 SELECT INBOX\n",
+			tag:   "b5",
+			cmd:   "SELECT",
+			args:  []interface{}{"INBOX"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			session := newParseSession(tt.input, &output)
+			tag, cmd, args, err := session.readCommand()
+			if err != nil {
+				t.Fatalf("readCommand 失败: %v", err)
+			}
+			if tag != tt.tag || cmd != tt.cmd {
+				t.Errorf("tag=%q cmd=%q，期望 tag=%q cmd=%q", tag, cmd, tt.tag, tt.cmd)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v，期望 %#v", args, tt.args)
+			}
+			if got := strings.Count(output.String(), "+ Ready for literal data\r\n"); got != tt.continuations {
+				t.Errorf("发送了 %d 次继续请求，期望 %d 次", got, tt.continuations)
+			}
+		})
+	}
+}
+
+func TestReadCommandErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"空行", "\r\n", errIMAPSyntax},
+		{"缺少命令", "a1\r\n", errIMAPSyntax},
+		{"quoted字符串未结束", "a1 LOGIN \"user\r\n", errIMAPSyntax},
+		{"列表未结束", "a1 FETCH 1 (FLAGS UID\r\n", errIMAPSyntax},
+		{"多余的右括号", "a1 FETCH 1 FLAGS)\r\n", errIMAPSyntax},
+		{"字面量不在行尾", "a1 LOGIN {4} user\r\n", errIMAPSyntax},
+		{"字面量长度无效", "a1 LOGIN {x}\r\n", errIMAPSyntax},
+		{"字面量长度为负", "a1 LOGIN {-1}\r\n", errIMAPSyntax},
+		{"字面量过大", "a1 APPEND INBOX {99999999999+}\r\n", errIMAPLiteralTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			_, _, _, err := newParseSession(tt.input, &output).readCommand()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("readCommand 错误 = %v，期望 %v", err, tt.want)
+			}
+		})
+	}
+
+	// 字面量数据不完整
+	var output bytes.Buffer
+	if _, _, _, err := newParseSession("a1 APPEND INBOX {10+}\r\nshort", &output).readCommand(); err == nil {
+		t.Error("字面量数据不完整时应返回错误")
+	}
+}
+
+func TestParseSeqSet(t *testing.T) {
+	tests := []struct {
+		input string
+		want  seqSet
+	}{
+		{"1", seqSet{{1, 1}}},
+		{"1:3", seqSet{{1, 3}}},
+		{"3:1", seqSet{{3, 1}}},
+		{"*", seqSet{{0, 0}}},
+		{"5:*", seqSet{{5, 0}}},
+		{"1:3,5,7:*", seqSet{{1, 3}, {5, 5}, {7, 0}}},
+		{"4294967295", seqSet{{4294967295, 4294967295}}},
+	}
+	for _, tt := range tests {
+		got, err := parseSeqSet(tt.input)
+		if err != nil {
+			t.Errorf("parseSeqSet(%q) 失败: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSeqSet(%q) = %v，期望 %v", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "0", "1:0", "a", "1,", ",1", "1::2", "1:2:3", "-1", "4294967296", "1 2"} {
+		if _, err := parseSeqSet(input); !errors.Is(err, errIMAPSyntax) {
+			t.Errorf("parseSeqSet(%q) 错误 = %v，期望 errIMAPSyntax", input, err)
+		}
+	}
+}
+
+func TestSeqSetContains(t *testing.T) {
+	tests := []struct {
+		name string
+		set  string
+		max  uint32 // * 代表的值：序列号集合为邮件数量，UID集合为最大的UID
+		in   []uint32
+		out  []uint32
+	}{
+		{"单个序列号", "2", 5, []uint32{2}, []uint32{1, 3}},
+		{"区间", "2:4", 5, []uint32{2, 3, 4}, []uint32{1, 5}},
+		{"反向区间", "4:2", 5, []uint32{2, 3, 4}, []uint32{1, 5}},
+		{"星号为最后一封", "*", 5, []uint32{5}, []uint32{1, 4, 6}},
+		{"到星号", "3:*", 5, []uint32{3, 4, 5}, []uint32{1, 2}},
+		{"起点大于星号时为区间 *:n", "7:*", 5, []uint32{5, 6, 7}, []uint32{4, 8}},
+		{"多个部分", "1,3:4,*", 5, []uint32{1, 3, 4, 5}, []uint32{2}},
+		{"UID集合中不存在的UID", "100:200", 150, []uint32{100, 150}, []uint32{99}},
+		{"UID集合星号为最大UID", "120:*", 150, []uint32{120, 150}, []uint32{119}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := parseSeqSet(tt.set)
+			if err != nil {
+				t.Fatalf("parseSeqSet(%q) 失败: %v", tt.set, err)
+			}
+			for _, n := range tt.in {
+				if !set.contains(n, tt.max) {
+					t.Errorf("%s 应包含 %d (* = %d)", tt.set, n, tt.max)
+				}
+			}
+			for _, n := range tt.out {
+				if set.contains(n, tt.max) {
+					t.Errorf("%s 不应包含 %d (* = %d)", tt.set, n, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestIMAPQuote(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"INBOX", `"INBOX"`},
+		{`a"b\c`, `"a\"b\\c"`},
+		{"", `""`},
+		{"line1\r\nline2", "{12}\r\nline1\r\nline2"},
+		{"中文", "{6}\r\n中文"},
+	}
+	for _, tt := range tests {
+		if got := imapQuote(tt.input); got != tt.want {
+			t.Errorf("imapQuote(%q) = %q，期望 %q", tt.input, got, tt.want)
+		}
+	}
+	if got := imapNString(""); got != "NIL" {
+		t.Errorf("imapNString(\"\") = %q，期望 NIL", got)
+	}
+}
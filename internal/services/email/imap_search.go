@@ -0,0 +1,375 @@
+package email
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchKey 搜索条件
+type searchKey func(m *searchMessage) bool
+
+// searchMessage 搜索时按需加载的邮件
+type searchMessage struct {
+	fetchMessage
+	seq    int
+	max    uint32 // 序列号中 * 的值
+	uidMax uint32 // UID中 * 的值
+	sizes  map[int64]int64
+}
+
+// searchDateLayout SEARCH 日期格式
+const searchDateLayout = "2-Jan-2006"
+
+var headerDecoder = new(mime.WordDecoder)
+
+// handleSearch 处理SEARCH命令
+func (session *IMAPSession) handleSearch(args []interface{}, byUID bool) {
+	// 忽略 CHARSET，统一按UTF-8匹配
+	if len(args) >= 2 {
+		if s, ok := argString(args[0]); ok && strings.EqualFold(s, "CHARSET") {
+			args = args[2:]
+		}
+	}
+	if len(args) == 0 {
+		session.writeTaggedResponse("BAD SEARCH requires search criteria")
+		return
+	}
+
+	pos := 0
+	var keys []searchKey
+	for pos < len(args) {
+		key, err := parseSearchKey(args, &pos)
+		if err != nil {
+			session.writeTaggedResponse("BAD Invalid search criteria")
+			return
+		}
+		keys = append(keys, key)
+	}
+
+	messages, err := session.selectMessages("1:*", false)
+	if err != nil {
+		log.Printf("SEARCH查询失败: %v", err)
+		session.writeTaggedResponse("NO SEARCH failed")
+		return
+	}
+
+	var ids []int64
+	for _, msg := range messages {
+		ids = append(ids, msg.email.Id)
+	}
+	sizes, err := session.server.svcCtx.EmailRawModel.GetSizesByEmailIds(ids)
+	if err != nil {
+		sizes = map[int64]int64{}
+	}
+
+	var uidMax uint32
+	if len(session.uids) > 0 {
+		uidMax = uint32(session.uids[len(session.uids)-1])
+	}
+
+	var results []string
+	for _, msg := range messages {
+		m := &searchMessage{
+			fetchMessage: fetchMessage{session: session, email: msg.email},
+			seq:          msg.seq,
+			max:          uint32(len(session.uids)),
+			uidMax:       uidMax,
+			sizes:        sizes,
+		}
+		matched := true
+		for _, key := range keys {
+			if !key(m) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if byUID {
+			results = append(results, strconv.FormatInt(msg.email.Uid, 10))
+		} else {
+			results = append(results, strconv.Itoa(msg.seq))
+		}
+	}
+
+	// 返回搜索结果
+	if len(results) > 0 {
+		session.writeResponse("* SEARCH " + strings.Join(results, " "))
+	} else {
+		session.writeResponse("* SEARCH")
+	}
+	session.writeTaggedResponse("OK SEARCH completed")
+}
+
+// parseSearchKey 解析一个搜索条件
+func parseSearchKey(args []interface{}, pos *int) (searchKey, error) {
+	if *pos >= len(args) {
+		return nil, errIMAPSyntax
+	}
+	arg := args[*pos]
+	*pos++
+
+	// 括号内的条件为AND关系
+	if list, ok := arg.(imapList); ok {
+		var keys []searchKey
+		subPos := 0
+		for subPos < len(list) {
+			key, err := parseSearchKey(list, &subPos)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+		return func(m *searchMessage) bool {
+			for _, key := range keys {
+				if !key(m) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	}
+
+	word, _ := argString(arg)
+	next := func() (string, error) {
+		if *pos >= len(args) {
+			return "", errIMAPSyntax
+		}
+		s, ok := argString(args[*pos])
+		*pos++
+		if !ok {
+			return "", errIMAPSyntax
+		}
+		return s, nil
+	}
+	nextDate := func() (time.Time, error) {
+		s, err := next()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.ParseInLocation(searchDateLayout, s, time.Local)
+	}
+
+	switch strings.ToUpper(word) {
+	case "ALL", "OLD":
+		return func(m *searchMessage) bool { return true }, nil
+	case "NEW", "RECENT":
+		return func(m *searchMessage) bool { return false }, nil
+	case "ANSWERED":
+		return func(m *searchMessage) bool { return m.email.IsAnswered }, nil
+	case "UNANSWERED":
+		return func(m *searchMessage) bool { return !m.email.IsAnswered }, nil
+	case "DELETED":
+		return func(m *searchMessage) bool { return m.email.IsDeleted }, nil
+	case "UNDELETED":
+		return func(m *searchMessage) bool { return !m.email.IsDeleted }, nil
+	case "FLAGGED":
+		return func(m *searchMessage) bool { return m.email.IsFlagged }, nil
+	case "UNFLAGGED":
+		return func(m *searchMessage) bool { return !m.email.IsFlagged }, nil
+	case "SEEN":
+		return func(m *searchMessage) bool { return m.email.IsRead }, nil
+	case "UNSEEN":
+		return func(m *searchMessage) bool { return !m.email.IsRead }, nil
+	case "DRAFT":
+		return func(m *searchMessage) bool { return m.email.IsDraft }, nil
+	case "UNDRAFT":
+		return func(m *searchMessage) bool { return !m.email.IsDraft }, nil
+	case "KEYWORD", "UNKEYWORD":
+		// 不支持自定义关键字
+		if _, err := next(); err != nil {
+			return nil, err
+		}
+		result := strings.ToUpper(word) == "UNKEYWORD"
+		return func(m *searchMessage) bool { return result }, nil
+	case "FROM", "TO", "CC", "BCC", "SUBJECT":
+		value, err := next()
+		if err != nil {
+			return nil, err
+		}
+		field := strings.ToUpper(word)
+		return func(m *searchMessage) bool { return m.headerContains(field, value) }, nil
+	case "HEADER":
+		field, err := next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := next()
+		if err != nil {
+			return nil, err
+		}
+		return func(m *searchMessage) bool { return m.headerContains(field, value) }, nil
+	case "BODY":
+		value, err := next()
+		if err != nil {
+			return nil, err
+		}
+		return func(m *searchMessage) bool { return m.bodyContains(value) }, nil
+	case "TEXT":
+		value, err := next()
+		if err != nil {
+			return nil, err
+		}
+		return func(m *searchMessage) bool {
+			return m.bodyContains(value) || m.load() == nil && containsFold(decodeHeaderValue(string(m.root.rawHeader)), value)
+		}, nil
+	case "BEFORE", "ON", "SINCE":
+		date, err := nextDate()
+		if err != nil {
+			return nil, err
+		}
+		op := strings.ToUpper(word)
+		return func(m *searchMessage) bool { return compareDate(m.email.CreatedAt, date, op) }, nil
+	case "SENTBEFORE", "SENTON", "SENTSINCE":
+		date, err := nextDate()
+		if err != nil {
+			return nil, err
+		}
+		op := strings.TrimPrefix(strings.ToUpper(word), "SENT")
+		return func(m *searchMessage) bool {
+			if m.load() != nil {
+				return false
+			}
+			sent, err := mailDate(m.root.header.Get("Date"))
+			if err != nil {
+				return false
+			}
+			return compareDate(sent, date, op)
+		}, nil
+	case "LARGER", "SMALLER":
+		value, err := next()
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errIMAPSyntax
+		}
+		larger := strings.ToUpper(word) == "LARGER"
+		return func(m *searchMessage) bool {
+			size := m.size()
+			if larger {
+				return size > n
+			}
+			return size < n
+		}, nil
+	case "UID":
+		value, err := next()
+		if err != nil {
+			return nil, err
+		}
+		set, err := parseSeqSet(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(m *searchMessage) bool { return set.contains(uint32(m.email.Uid), m.uidMax) }, nil
+	case "NOT":
+		key, err := parseSearchKey(args, pos)
+		if err != nil {
+			return nil, err
+		}
+		return func(m *searchMessage) bool { return !key(m) }, nil
+	case "OR":
+		left, err := parseSearchKey(args, pos)
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseSearchKey(args, pos)
+		if err != nil {
+			return nil, err
+		}
+		return func(m *searchMessage) bool { return left(m) || right(m) }, nil
+	}
+
+	// 序列号集合
+	set, err := parseSeqSet(word)
+	if err != nil {
+		return nil, err
+	}
+	return func(m *searchMessage) bool { return set.contains(uint32(m.seq), m.max) }, nil
+}
+
+// headerContains 头部字段是否包含指定字符串（先解码MIME编码字）
+func (m *searchMessage) headerContains(field, value string) bool {
+	if m.load() != nil {
+		return false
+	}
+	values := m.root.header.Values(field)
+	if value == "" {
+		return len(values) > 0
+	}
+	for _, v := range values {
+		if containsFold(v, value) || containsFold(decodeHeaderValue(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyContains 正文是否包含指定字符串
+func (m *searchMessage) bodyContains(value string) bool {
+	if m.load() != nil {
+		return false
+	}
+	return containsFold(m.full.Body, value) || containsFold(string(m.root.body), value)
+}
+
+// size 邮件原文大小
+func (m *searchMessage) size() int64 {
+	if size, ok := m.sizes[m.email.Id]; ok {
+		return size
+	}
+	if m.load() != nil {
+		return 0
+	}
+	return int64(len(m.raw))
+}
+
+// decodeHeaderValue 解码头部中的MIME编码字
+func decodeHeaderValue(value string) string {
+	decoded, err := headerDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// containsFold 大小写不敏感的包含判断
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// mailDate 解析邮件的Date头部
+func mailDate(value string) (time.Time, error) {
+	layouts := []string{time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "2 Jan 2006 15:04:05 -0700"}
+	value = strings.TrimSpace(value)
+	if idx := strings.Index(value, " ("); idx > 0 {
+		value = value[:idx]
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %s", value)
+}
+
+// compareDate 按日期（忽略时间）比较
+func compareDate(t, date time.Time, op string) bool {
+	y, mo, d := t.In(time.Local).Date()
+	day := time.Date(y, mo, d, 0, 0, 0, 0, time.Local)
+	switch op {
+	case "BEFORE":
+		return day.Before(date)
+	case "ON":
+		return day.Equal(date)
+	case "SINCE":
+		return !day.Before(date)
+	}
+	return false
+}
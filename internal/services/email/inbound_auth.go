@@ -0,0 +1,167 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+	"miko-email/internal/services/mailauth"
+)
+
+// verifyInbound 对外部投递到本地邮箱的邮件验证SPF/DKIM/DMARC，并按DMARC策略处理
+// 返回错误表示拒收，temporary 为true时应返回4xx让对方稍后重试
+func (session *SMTPSession) verifyInbound() (temporary bool, err error) {
+	session.authResult = nil
+	session.quarantine = false
+
+	// 已认证的提交和本机投递（出站队列投递本地收件人）不需要验证
+	if !config.IsInboundAuthEnabled() || session.authenticated || session.isLoopback() || !session.hasLocalRecipients() {
+		return false, nil
+	}
+
+	result := session.server.authService.Verify(&mailauth.Params{
+		IP:       session.remoteIP(),
+		Helo:     session.helo,
+		MailFrom: session.from,
+		Message:  session.data,
+	})
+	session.authResult = result
+	log.Printf("收信认证: spf=%s dkim=%s dmarc=%s, From域名: %s (来自 %s)",
+		result.SPF, result.DKIM, result.DMARC, result.FromDomain, session.conn.RemoteAddr())
+
+	policy, reason := "", fmt.Sprintf("发件域名 %s 的DMARC验证未通过", result.FromDomain)
+	switch {
+	case result.FromDomain == "":
+		// From头缺失、重复或无法解析（DMARC permerror）时无法确认发件域名，可能冒充本系统域名，按DMARC未通过处理
+		policy, reason = config.GetLocalDomainDMARCPolicy(), "邮件From头缺失、重复或无法解析"
+	case session.server.isLocalDomain(result.FromDomain):
+		// 冒充本系统域名：不论是否发布了DMARC记录，SPF和DKIM都没有对齐时按配置处理
+		if !result.Aligned {
+			if result.SPF == mailauth.SPFTempError || result.DKIM == mailauth.ResultTempError {
+				return true, fmt.Errorf("验证发件域名 %s 时DNS查询失败", result.FromDomain)
+			}
+			policy = config.GetLocalDomainDMARCPolicy()
+		}
+	case result.DMARC == mailauth.ResultFail && config.IsDMARCEnforced():
+		policy = result.DMARCPolicy
+	}
+
+	// 信封发件人为本系统域名时SPF必须通过，否则保存的发件人（MAIL FROM）就是冒充的本域地址
+	if policy == "" && session.from != "" && session.server.isLocalDomain(domainOf(session.from)) && result.SPF != mailauth.SPFPass {
+		if result.SPF == mailauth.SPFTempError {
+			return true, fmt.Errorf("验证发件域名 %s 时DNS查询失败", domainOf(session.from))
+		}
+		policy, reason = config.GetLocalDomainDMARCPolicy(), fmt.Sprintf("本系统域名的信封发件人 %s SPF验证未通过", session.from)
+	}
+
+	switch policy {
+	case "reject":
+		return false, errors.New(reason)
+	case "quarantine":
+		log.Printf("%s，邮件放入垃圾邮件: %s (From域名: %s)", reason, session.from, result.FromDomain)
+		session.quarantine = true
+	}
+	return false, nil
+}
+
+// addAuthResultsHeader 在邮件顶部添加本服务器的Authentication-Results头
+// 先删除邮件中已有的、冒充本服务器的同名头（RFC 8601 5）
+func (session *SMTPSession) addAuthResultsHeader() {
+	if session.authResult == nil {
+		return
+	}
+	authservID := smtpServerHostname()
+	data := stripAuthResults(session.data, authservID)
+	session.data = append([]byte(session.authResult.Header(authservID)), data...)
+}
+
+// applyAuthResult 将验证结果写入邮件记录
+func (session *SMTPSession) applyAuthResult(email *model.Email) {
+	if session.authResult == nil {
+		return
+	}
+	email.SpfResult = session.authResult.SPF
+	email.DkimResult = session.authResult.DKIM
+	email.DmarcResult = session.authResult.DMARC
+	email.AuthResults = session.authResult.HeaderValue(smtpServerHostname())
+	if session.quarantine {
+		email.Folder = "junk"
+	}
+}
+
+// remoteIP 获取客户端IP
+func (session *SMTPSession) remoteIP() net.IP {
+	host, _, err := net.SplitHostPort(session.conn.RemoteAddr().String())
+	if err != nil {
+		host = session.conn.RemoteAddr().String()
+	}
+	return net.ParseIP(host)
+}
+
+// isLoopback 是否为本机连接
+func (session *SMTPSession) isLoopback() bool {
+	ip := session.remoteIP()
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLocalDomain 检查是否为本系统的域名
+func (s *Service) isLocalDomain(domain string) bool {
+	if _, err := s.svcCtx.DomainModel.GetByName(strings.ToLower(domain)); err == nil {
+		return true
+	}
+	cfg := config.Load()
+	return strings.EqualFold(domain, cfg.Domain)
+}
+
+// stripAuthResults 删除邮件头中authserv-id为本服务器的Authentication-Results头
+func stripAuthResults(data []byte, authservID string) []byte {
+	return stripHeaders(data, func(name, value string) bool {
+		if !strings.EqualFold(name, "Authentication-Results") {
+			return false
+		}
+		id, _, _ := strings.Cut(value, ";")
+		if !strings.EqualFold(strings.TrimSpace(id), authservID) {
+			return false
+		}
+		log.Printf("删除伪造的Authentication-Results头: %s: %s", name, strings.TrimSpace(value))
+		return true
+	})
+}
+
+// stripHeaders 删除邮件头中 drop 返回true的头（包括折行的续行），value 为头的第一行
+func stripHeaders(data []byte, drop func(name, value string) bool) []byte {
+	// headerEnd 指向空行，邮件头包含最后一个头的换行符
+	headerEnd := bytes.Index(data, []byte("\r\n\r\n")) + 2
+	if headerEnd < 2 {
+		headerEnd = bytes.Index(data, []byte("\n\n")) + 1
+	}
+	if headerEnd < 1 {
+		return data
+	}
+
+	var out bytes.Buffer
+	lines := bytes.SplitAfter(data[:headerEnd], []byte("\n"))
+	skipping := false
+	for _, line := range lines {
+		// 折行的续行跟随上一个头处理
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			if !skipping {
+				out.Write(line)
+			}
+			continue
+		}
+
+		name, value, found := strings.Cut(string(line), ":")
+		skipping = found && drop(strings.TrimSpace(name), value)
+		if !skipping {
+			out.Write(line)
+		}
+	}
+	out.Write(data[headerEnd:])
+	return out.Bytes()
+}
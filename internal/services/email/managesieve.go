@@ -0,0 +1,521 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"miko-email/internal/config"
+	"miko-email/internal/services/sieve"
+)
+
+// errManageSieveSyntax 命令格式错误
+var errManageSieveSyntax = errors.New("managesieve syntax error")
+
+// errManageSieveLiteralTooLarge 字符串字面量超过脚本大小限制（已读取并丢弃）
+var errManageSieveLiteralTooLarge = errors.New("managesieve literal too large")
+
+// ManageSieveSession ManageSieve会话（RFC 5804）
+type ManageSieveSession struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writer     *bufio.Writer
+	server     *Service
+	tlsEnabled bool
+	mailbox    string // 登录的邮箱地址，未认证时为空
+	mailboxID  int64
+}
+
+// StartManageSieveServer 启动ManageSieve服务器（4190端口，支持STARTTLS）
+func (s *Service) StartManageSieveServer(port string) error {
+	log.Printf("ManageSieve server starting on port %s", port)
+
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return fmt.Errorf("failed to start ManageSieve server: %w", err)
+	}
+	defer listener.Close()
+
+	log.Printf("ManageSieve server listening on port %s", port)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("ManageSieve connection error: %v", err)
+			continue
+		}
+
+		go s.handleManageSieveConnection(conn)
+	}
+}
+
+// handleManageSieveConnection 处理ManageSieve连接
+func (s *Service) handleManageSieveConnection(conn net.Conn) {
+	defer conn.Close()
+
+	log.Printf("新的ManageSieve连接: %s", conn.RemoteAddr())
+
+	// 设置连接超时
+	conn.SetDeadline(time.Now().Add(30 * time.Minute))
+
+	session := &ManageSieveSession{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+		server: s,
+	}
+
+	// 连接建立后发送能力列表
+	session.writeCapabilities()
+	session.writeOK("", "Miko Email ManageSieve Server Ready")
+
+	session.handle()
+}
+
+// handle 处理ManageSieve会话
+func (session *ManageSieveSession) handle() {
+	for {
+		args, err := session.readCommand()
+		if err != nil {
+			if errors.Is(err, errManageSieveSyntax) {
+				session.writeNO("", "Invalid command syntax")
+				continue
+			}
+			if errors.Is(err, errManageSieveLiteralTooLarge) {
+				session.writeNO("QUOTA/MAXSIZE", "Script is too large")
+				continue
+			}
+			if err != io.EOF {
+				log.Printf("读取ManageSieve命令失败: %v", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		cmd := strings.ToUpper(args[0])
+		args = args[1:]
+
+		switch cmd {
+		case "CAPABILITY":
+			session.writeCapabilities()
+			session.writeOK("", "CAPABILITY completed")
+		case "STARTTLS":
+			session.handleStartTLS()
+		case "AUTHENTICATE":
+			session.handleAuthenticate(args)
+		case "NOOP":
+			if len(args) > 0 {
+				session.writeOK("TAG "+quoteSieveString(args[0]), "Done")
+			} else {
+				session.writeOK("", "Done")
+			}
+		case "LOGOUT":
+			session.writeOK("", "Logout completed")
+			return
+		default:
+			if session.mailboxID == 0 {
+				session.writeNO("", "Not authenticated")
+				continue
+			}
+			session.handleAuthenticatedCommand(cmd, args)
+		}
+	}
+}
+
+// handleAuthenticatedCommand 处理需要认证的命令
+func (session *ManageSieveSession) handleAuthenticatedCommand(cmd string, args []string) {
+	service := session.server.sieveService
+
+	switch cmd {
+	case "LISTSCRIPTS":
+		scripts, err := service.ListScripts(session.mailboxID)
+		if err != nil {
+			session.writeError(err)
+			return
+		}
+		for _, script := range scripts {
+			line := quoteSieveString(script.Name)
+			if script.IsActive {
+				line += " ACTIVE"
+			}
+			session.writeLine(line)
+		}
+		session.writeOK("", "Listscripts completed")
+	case "GETSCRIPT":
+		if len(args) != 1 {
+			session.writeNO("", "GETSCRIPT requires script name")
+			return
+		}
+		script, err := service.GetScript(session.mailboxID, args[0])
+		if err != nil {
+			session.writeError(err)
+			return
+		}
+		session.writeLine(fmt.Sprintf("{%d}\r\n%s", len(script.Content), script.Content))
+		session.writeOK("", "Getscript completed")
+	case "PUTSCRIPT":
+		if len(args) != 2 {
+			session.writeNO("", "PUTSCRIPT requires script name and content")
+			return
+		}
+		if _, err := service.PutScript(session.mailboxID, args[0], args[1]); err != nil {
+			session.writeError(err)
+			return
+		}
+		log.Printf("ManageSieve保存脚本: %s -> %s", session.mailbox, args[0])
+		session.writeOK("", "Putscript completed")
+	case "CHECKSCRIPT":
+		if len(args) != 1 {
+			session.writeNO("", "CHECKSCRIPT requires script content")
+			return
+		}
+		if err := service.CheckScript(args[0]); err != nil {
+			session.writeError(err)
+			return
+		}
+		session.writeOK("", "Script is valid")
+	case "SETACTIVE":
+		if len(args) != 1 {
+			session.writeNO("", "SETACTIVE requires script name")
+			return
+		}
+		if err := service.SetActive(session.mailboxID, args[0]); err != nil {
+			session.writeError(err)
+			return
+		}
+		session.writeOK("", "Setactive completed")
+	case "DELETESCRIPT":
+		if len(args) != 1 {
+			session.writeNO("", "DELETESCRIPT requires script name")
+			return
+		}
+		if err := service.DeleteScript(session.mailboxID, args[0]); err != nil {
+			session.writeError(err)
+			return
+		}
+		session.writeOK("", "Deletescript completed")
+	case "RENAMESCRIPT":
+		if len(args) != 2 {
+			session.writeNO("", "RENAMESCRIPT requires old and new script name")
+			return
+		}
+		if err := service.RenameScript(session.mailboxID, args[0], args[1]); err != nil {
+			session.writeError(err)
+			return
+		}
+		session.writeOK("", "Renamescript completed")
+	case "HAVESPACE":
+		if len(args) != 2 {
+			session.writeNO("", "HAVESPACE requires script name and size")
+			return
+		}
+		size, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || size < 0 {
+			session.writeNO("", "Invalid script size")
+			return
+		}
+		if !sieve.ValidScriptName(args[0]) {
+			session.writeError(sieve.ErrInvalidName)
+			return
+		}
+		if err := service.HaveSpace(session.mailboxID, args[0], size); err != nil {
+			session.writeError(err)
+			return
+		}
+		session.writeOK("", "Putscript would succeed")
+	case "UNAUTHENTICATE":
+		log.Printf("ManageSieve退出登录: %s", session.mailbox)
+		session.mailbox = ""
+		session.mailboxID = 0
+		session.writeOK("", "Unauthenticate completed")
+	default:
+		session.writeNO("", "Unknown command")
+	}
+}
+
+// capabilities 当前状态下的能力列表
+func (session *ManageSieveSession) capabilities() []string {
+	_, _, maxRedirects := config.GetSieveLimits()
+
+	sasl := "PLAIN"
+	if session.loginDisabled() {
+		sasl = ""
+	}
+
+	capabilities := []string{
+		`"IMPLEMENTATION" "Miko Email ManageSieve"`,
+		`"SASL" ` + quoteSieveString(sasl),
+		`"SIEVE" ` + quoteSieveString(strings.Join(sieve.Capabilities, " ")),
+	}
+	if !session.tlsEnabled && session.mailboxID == 0 {
+		capabilities = append(capabilities, `"STARTTLS"`)
+	}
+	capabilities = append(capabilities,
+		fmt.Sprintf(`"MAXREDIRECTS" "%d"`, maxRedirects),
+		`"VERSION" "1.0"`,
+	)
+	if session.mailboxID != 0 {
+		capabilities = append(capabilities, `"OWNER" `+quoteSieveString(session.mailbox))
+	}
+	return capabilities
+}
+
+// writeCapabilities 发送能力列表（不含结尾的OK）
+func (session *ManageSieveSession) writeCapabilities() {
+	for _, capability := range session.capabilities() {
+		session.writeLine(capability)
+	}
+}
+
+// loginDisabled 未加密的连接上是否禁止认证
+func (session *ManageSieveSession) loginDisabled() bool {
+	return !session.tlsEnabled && config.IsPlaintextAuthDisabled()
+}
+
+// handleStartTLS 处理STARTTLS命令，升级为TLS后重新发送能力列表
+func (session *ManageSieveSession) handleStartTLS() {
+	if session.tlsEnabled {
+		session.writeNO("", "TLS already active")
+		return
+	}
+	if session.mailboxID != 0 {
+		session.writeNO("", "Already authenticated")
+		return
+	}
+
+	session.writeOK("", "Begin TLS negotiation now")
+
+	tlsConn := tls.Server(session.conn, session.server.serverTLSConfig())
+	if err := tlsConn.Handshake(); err != nil {
+		log.Printf("ManageSieve TLS握手失败: %v", err)
+		session.conn.Close()
+		return
+	}
+
+	log.Printf("ManageSieve TLS连接建立成功: %s", session.conn.RemoteAddr())
+
+	session.conn = tlsConn
+	session.reader = bufio.NewReader(tlsConn)
+	session.writer = bufio.NewWriter(tlsConn)
+	session.tlsEnabled = true
+
+	session.writeCapabilities()
+	session.writeOK("", "TLS negotiation successful")
+}
+
+// handleAuthenticate 处理AUTHENTICATE命令（只支持PLAIN，使用邮箱地址和邮箱密码）
+func (session *ManageSieveSession) handleAuthenticate(args []string) {
+	if session.mailboxID != 0 {
+		session.writeNO("", "Already authenticated")
+		return
+	}
+	if session.loginDisabled() {
+		session.writeNO("ENCRYPT-NEEDED", "Authentication is disabled, use STARTTLS")
+		return
+	}
+	if len(args) < 1 {
+		session.writeNO("", "AUTHENTICATE requires mechanism")
+		return
+	}
+	if !strings.EqualFold(args[0], "PLAIN") {
+		session.writeNO("", "Unsupported authentication mechanism")
+		return
+	}
+
+	var response string
+	if len(args) > 1 {
+		response = args[1]
+	} else {
+		// 没有初始响应时发送空的继续请求
+		session.writeLine(`""`)
+		continuation, err := session.readCommand()
+		if err != nil || len(continuation) != 1 {
+			session.writeNO("", "Invalid authentication response")
+			return
+		}
+		if continuation[0] == "*" {
+			session.writeNO("", "Authentication cancelled")
+			return
+		}
+		response = continuation[0]
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		session.writeNO("", "Invalid base64 data")
+		return
+	}
+	// PLAIN认证格式: authzid\0username\0password，authzid 必须为空或与用户名相同
+	parts := strings.Split(string(decoded), "\x00")
+	if len(parts) != 3 || (parts[0] != "" && !strings.EqualFold(parts[0], parts[1])) {
+		session.writeNO("", "Invalid credentials format")
+		return
+	}
+
+	mailbox, err := session.server.svcCtx.MailboxModel.GetByEmailAndPassword(parts[1], parts[2])
+	if err != nil || mailbox == nil || !mailbox.IsActive {
+		log.Printf("ManageSieve登录失败: %s", parts[1])
+		session.writeNO("", "Authentication failed")
+		return
+	}
+
+	session.mailbox = mailbox.Email
+	session.mailboxID = mailbox.Id
+	log.Printf("ManageSieve登录成功: %s", mailbox.Email)
+	session.writeOK("", "Authenticated")
+}
+
+// writeError 按错误类型返回对应的响应码
+func (session *ManageSieveSession) writeError(err error) {
+	var scriptErr *sieve.Error
+	switch {
+	case errors.As(err, &scriptErr):
+		session.writeNO("", scriptErr.Error())
+	case errors.Is(err, sieve.ErrScriptNotFound):
+		session.writeNO("NONEXISTENT", "Script does not exist")
+	case errors.Is(err, sieve.ErrScriptExists):
+		session.writeNO("ALREADYEXISTS", "Script already exists")
+	case errors.Is(err, sieve.ErrScriptActive):
+		session.writeNO("ACTIVE", "Cannot delete the active script")
+	case errors.Is(err, sieve.ErrTooManyScripts):
+		session.writeNO("QUOTA/MAXSCRIPTS", "Too many scripts")
+	case errors.Is(err, sieve.ErrScriptTooLarge):
+		session.writeNO("QUOTA/MAXSIZE", "Script is too large")
+	case errors.Is(err, sieve.ErrInvalidName):
+		session.writeNO("", "Invalid script name")
+	default:
+		log.Printf("ManageSieve命令失败: %v", err)
+		session.writeNO("TRYLATER", "Internal server error")
+	}
+}
+
+// writeOK 发送OK响应，code 为空时不带响应码
+func (session *ManageSieveSession) writeOK(code, message string) {
+	session.writeResult("OK", code, message)
+}
+
+// writeNO 发送NO响应，code 为空时不带响应码
+func (session *ManageSieveSession) writeNO(code, message string) {
+	session.writeResult("NO", code, message)
+}
+
+func (session *ManageSieveSession) writeResult(result, code, message string) {
+	if code != "" {
+		result += " (" + code + ")"
+	}
+	session.writeLine(result + " " + quoteSieveString(message))
+}
+
+// writeLine 发送一行响应
+func (session *ManageSieveSession) writeLine(line string) {
+	session.writer.WriteString(line + "\r\n")
+	session.writer.Flush()
+}
+
+// quoteSieveString 将字符串编码为带引号的字符串，包含换行时使用字面量
+func quoteSieveString(s string) string {
+	if strings.ContainsAny(s, "\r\n") {
+		return fmt.Sprintf("{%d}\r\n%s", len(s), s)
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// readCommand 读取一条命令，返回命令名和参数（原子、带引号的字符串、字面量 {n} 或 {n+}）
+func (session *ManageSieveSession) readCommand() ([]string, error) {
+	_, maxSize, _ := config.GetSieveLimits()
+
+	var args []string
+	tooLarge := false
+	for {
+		line, err := session.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		literal := -1
+		for pos := 0; pos < len(line); {
+			switch c := line[pos]; {
+			case c == ' ':
+				pos++
+			case c == '"':
+				var value strings.Builder
+				pos++
+				closed := false
+				for pos < len(line) {
+					if line[pos] == '\\' && pos+1 < len(line) {
+						value.WriteByte(line[pos+1])
+						pos += 2
+						continue
+					}
+					if line[pos] == '"' {
+						closed = true
+						pos++
+						break
+					}
+					value.WriteByte(line[pos])
+					pos++
+				}
+				if !closed {
+					return nil, errManageSieveSyntax
+				}
+				args = append(args, value.String())
+			case c == '{':
+				// 字面量必须在行尾
+				end := strings.IndexByte(line[pos:], '}')
+				if end < 0 || pos+end != len(line)-1 {
+					return nil, errManageSieveSyntax
+				}
+				size, err := strconv.Atoi(strings.TrimSuffix(line[pos+1:pos+end], "+"))
+				if err != nil || size < 0 {
+					return nil, errManageSieveSyntax
+				}
+				literal = size
+				pos = len(line)
+			default:
+				end := strings.IndexByte(line[pos:], ' ')
+				if end < 0 {
+					end = len(line) - pos
+				}
+				args = append(args, line[pos:pos+end])
+				pos += end
+			}
+		}
+
+		if literal < 0 {
+			break
+		}
+
+		// 超过脚本大小限制的字面量读取后丢弃，命令返回 QUOTA/MAXSIZE
+		if int64(literal) > maxSize {
+			if _, err := io.CopyN(io.Discard, session.reader, int64(literal)); err != nil {
+				return nil, err
+			}
+			tooLarge = true
+			args = append(args, "")
+			continue
+		}
+		data := make([]byte, literal)
+		if _, err := io.ReadFull(session.reader, data); err != nil {
+			return nil, err
+		}
+		args = append(args, string(data))
+	}
+
+	if tooLarge {
+		return nil, errManageSieveLiteralTooLarge
+	}
+	return args, nil
+}
@@ -0,0 +1,392 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+	"miko-email/internal/services/smtp"
+)
+
+const (
+	// outboundPollInterval 没有入队通知时检查到期重试的间隔
+	outboundPollInterval = 30 * time.Second
+	// outboundClaimBatch 每次领取的收件人数量
+	outboundClaimBatch = 100
+	// outboundRetryBase / outboundRetryMax 重试间隔：从5分钟开始每次翻倍，最长4小时
+	outboundRetryBase = 5 * time.Minute
+	outboundRetryMax  = 4 * time.Hour
+)
+
+// StartOutboundQueue 启动出站队列的投递协程（进程内只应启动一次）
+func (s *Service) StartOutboundQueue() {
+	// 上次退出时正在投递的收件人重新排队
+	if err := s.svcCtx.OutboundQueueModel.ResetSending(); err != nil {
+		log.Printf("恢复出站队列失败: %v", err)
+	}
+
+	workers := config.GetQueueWorkers()
+	jobs := make(chan *model.OutboundRecipient)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for recipient := range jobs {
+				s.deliverQueued(recipient)
+			}
+		}()
+	}
+
+	go s.dispatchOutboundQueue(jobs)
+	log.Printf("出站队列已启动，投递协程数量: %d", workers)
+}
+
+// dispatchOutboundQueue 领取到期的收件人交给投递协程，入队时立即唤醒，否则定时检查
+func (s *Service) dispatchOutboundQueue(jobs chan<- *model.OutboundRecipient) {
+	ticker := time.NewTicker(outboundPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			claimed, err := s.svcCtx.OutboundQueueModel.ClaimDue(time.Now(), outboundClaimBatch)
+			if err != nil {
+				log.Printf("领取出站队列失败: %v", err)
+			}
+			for _, recipient := range claimed {
+				jobs <- recipient
+			}
+			if err != nil || len(claimed) < outboundClaimBatch {
+				break
+			}
+		}
+
+		select {
+		case <-s.svcCtx.QueueNotifier.C():
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverQueued 投递一个收件人并记录结果：成功、临时失败（按退避时间重试）或永久失败
+func (s *Service) deliverQueued(recipient *model.OutboundRecipient) {
+	message, err := s.svcCtx.OutboundQueueModel.GetMessage(recipient.QueueId)
+	if err != nil {
+		log.Printf("获取出站邮件失败 #%d: %v", recipient.QueueId, err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			recipient.Status = model.OutboundStatusFailed
+			recipient.LastError = "队列邮件不存在"
+		} else {
+			recipient.Status = model.OutboundStatusDeferred
+			recipient.NextAttemptAt = time.Now().Add(outboundRetryBase)
+		}
+		if err := s.svcCtx.OutboundQueueModel.SaveRecipient(nil, recipient); err != nil {
+			log.Printf("更新出站队列状态失败: %v", err)
+		}
+		return
+	}
+
+	now := time.Now()
+	remoteMTA, err := s.smtpClient.Deliver(message.Sender, recipient.Recipient, message.Content)
+	recipient.Attempts++
+	recipient.LastAttemptAt = &now
+	recipient.RemoteMta = remoteMTA
+
+	if err == nil {
+		recipient.Status = model.OutboundStatusDelivered
+		recipient.StatusCode = "2.0.0"
+		recipient.LastError = ""
+		recipient.DeliveredAt = &now
+	} else {
+		deliveryErr := &smtp.DeliveryError{Status: "4.0.0", Err: err}
+		errors.As(err, &deliveryErr)
+		recipient.StatusCode = deliveryErr.Status
+		recipient.LastError = err.Error()
+
+		switch {
+		case deliveryErr.Permanent:
+			recipient.Status = model.OutboundStatusFailed
+		case now.Sub(message.CreatedAt) >= config.GetQueueLifetime():
+			// 超过最长重试时间，按RFC 3463使用 4.4.7 并退信
+			recipient.Status = model.OutboundStatusFailed
+			recipient.StatusCode = "4.4.7"
+			recipient.LastError = "超过最长重试时间，最后一次错误: " + err.Error()
+		default:
+			recipient.Status = model.OutboundStatusDeferred
+			recipient.NextAttemptAt = now.Add(outboundRetryDelay(recipient.Attempts))
+		}
+	}
+
+	if err := s.svcCtx.OutboundQueueModel.SaveRecipient(nil, recipient); err != nil {
+		log.Printf("更新出站队列状态失败: %v", err)
+		return
+	}
+
+	switch recipient.Status {
+	case model.OutboundStatusDelivered:
+		log.Printf("✅ 出站邮件投递成功 #%d: %s -> %s", message.Id, message.Sender, recipient.Recipient)
+	case model.OutboundStatusDeferred:
+		log.Printf("出站邮件投递临时失败 #%d: %s -> %s，第%d次，%s 后重试: %s",
+			message.Id, message.Sender, recipient.Recipient, recipient.Attempts,
+			recipient.NextAttemptAt.Format("2006-01-02 15:04:05"), recipient.LastError)
+		return
+	default:
+		log.Printf("❌ 出站邮件投递失败 #%d: %s -> %s: %s", message.Id, message.Sender, recipient.Recipient, recipient.LastError)
+	}
+
+	s.finishOutboundMessage(message)
+}
+
+// outboundRetryDelay 第n次失败后的重试间隔（指数退避）
+func outboundRetryDelay(attempts int) time.Duration {
+	delay := outboundRetryBase
+	for i := 1; i < attempts && delay < outboundRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > outboundRetryMax {
+		delay = outboundRetryMax
+	}
+	return delay
+}
+
+// finishOutboundMessage 所有收件人都有最终结果后更新邮件状态，有失败的收件人时给发件人发送退信
+func (s *Service) finishOutboundMessage(message *model.OutboundMessage) {
+	recipients, err := s.svcCtx.OutboundQueueModel.GetRecipients(message.Id)
+	if err != nil {
+		log.Printf("获取出站邮件收件人失败 #%d: %v", message.Id, err)
+		return
+	}
+
+	var failed []*model.OutboundRecipient
+	for _, recipient := range recipients {
+		switch recipient.Status {
+		case model.OutboundStatusDelivered:
+		case model.OutboundStatusFailed:
+			failed = append(failed, recipient)
+		default:
+			// 还有收件人在等待投递
+			return
+		}
+	}
+
+	status := model.OutboundStatusDelivered
+	if len(failed) > 0 {
+		status = model.OutboundStatusFailed
+	}
+	finished, err := s.svcCtx.OutboundQueueModel.FinishMessage(message.Id, status)
+	if err != nil {
+		log.Printf("更新出站邮件状态失败 #%d: %v", message.Id, err)
+		return
+	}
+	if !finished || len(failed) == 0 {
+		return
+	}
+
+	if err := s.sendBounce(message, failed); err != nil {
+		log.Printf("发送退信失败 #%d: %v", message.Id, err)
+		return
+	}
+	if err := s.svcCtx.OutboundQueueModel.MarkBounceSent(message.Id); err != nil {
+		log.Printf("更新退信状态失败 #%d: %v", message.Id, err)
+	}
+}
+
+// sendBounce 生成RFC 3464投递状态通知（DSN）并放入发件人的收件箱
+func (s *Service) sendBounce(message *model.OutboundMessage, failed []*model.OutboundRecipient) error {
+	// 空信封发件人的邮件（退信本身）不再产生退信，避免循环
+	if message.Sender == "" {
+		log.Printf("空发件人的邮件投递失败，不发送退信 #%d", message.Id)
+		return nil
+	}
+
+	// 转发的邮件信封发件人为SRS地址，退信返回还原出的原发件人
+	bounceTo := message.Sender
+	if original, ok, err := s.reverseSRS(message.Sender); ok {
+		if err != nil {
+			log.Printf("发件人 %s 无法还原，不发送退信 #%d: %v", message.Sender, message.Id, err)
+			return nil
+		}
+		bounceTo = original
+	} else if _, err := s.svcCtx.MailboxModel.GetIdByEmail(message.Sender); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("发件人 %s 不是本地邮箱，不发送退信 #%d", message.Sender, message.Id)
+			return nil
+		}
+		return err
+	}
+
+	reportingMTA := bounceReportingMTA(message.Sender)
+	from := "MAILER-DAEMON@" + strings.TrimPrefix(reportingMTA, "mail.")
+	subject := "退信：邮件投递失败"
+	if message.Subject != "" {
+		subject += " - " + message.Subject
+	}
+	text := buildBounceText(message, failed)
+	raw := buildDSNMessage(from, bounceTo, subject, text, reportingMTA, message, failed)
+
+	// 本地邮箱直接放入收件箱，外部地址以空信封发件人加入队列
+	if err := s.deliverSystemMessage(from, bounceTo, subject, text, raw); err != nil {
+		return err
+	}
+
+	log.Printf("已发送退信给 %s (#%d，失败收件人 %d 个)", bounceTo, message.Id, len(failed))
+	return nil
+}
+
+// bounceReportingMTA DSN中的 Reporting-MTA：优先使用配置的 smtp_hostname，否则使用 mail.<发件域名>
+func bounceReportingMTA(sender string) string {
+	if hostname := config.GetSMTPHostname(); hostname != "" {
+		return hostname
+	}
+	return "mail." + domainOf(sender)
+}
+
+// buildBounceText 退信中给用户阅读的说明
+func buildBounceText(message *model.OutboundMessage, failed []*model.OutboundRecipient) string {
+	var text strings.Builder
+	text.WriteString("这是邮件系统自动生成的退信通知。\r\n\r\n")
+	text.WriteString(fmt.Sprintf("您于 %s 发送的邮件「%s」无法投递给以下收件人：\r\n\r\n",
+		message.CreatedAt.Format("2006-01-02 15:04:05"), message.Subject))
+	for _, recipient := range failed {
+		text.WriteString(fmt.Sprintf("<%s>\r\n    %s\r\n\r\n", recipient.Recipient, recipient.LastError))
+	}
+	text.WriteString("原邮件的邮件头附在本通知之后。\r\n")
+	return text.String()
+}
+
+// buildDSNMessage 构建 multipart/report 格式的投递状态通知（RFC 3464）
+func buildDSNMessage(from, to, subject, text, reportingMTA string, message *model.OutboundMessage, failed []*model.OutboundRecipient) []byte {
+	boundary := fmt.Sprintf("----=_DSN_%d", time.Now().UnixNano())
+
+	var dsn bytes.Buffer
+	dsn.WriteString(fmt.Sprintf("From: Mail Delivery System <%s>\r\n", from))
+	dsn.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	dsn.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject)))
+	dsn.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	dsn.WriteString(fmt.Sprintf("Message-ID: <%d.dsn@%s>\r\n", time.Now().UnixNano(), reportingMTA))
+	dsn.WriteString("Auto-Submitted: auto-replied\r\n")
+	dsn.WriteString("MIME-Version: 1.0\r\n")
+	dsn.WriteString(fmt.Sprintf("Content-Type: multipart/report; report-type=delivery-status; boundary=\"%s\"\r\n", boundary))
+	dsn.WriteString("\r\n")
+
+	// 说明部分
+	dsn.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	dsn.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	dsn.WriteString("Content-Transfer-Encoding: base64\r\n")
+	dsn.WriteString("\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(text))
+	for i := 0; i < len(encoded); i += 76 {
+		end := i + 76
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		dsn.WriteString(encoded[i:end])
+		dsn.WriteString("\r\n")
+	}
+
+	// 机器可读的投递状态
+	dsn.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	dsn.WriteString("Content-Type: message/delivery-status\r\n")
+	dsn.WriteString("\r\n")
+	dsn.WriteString(fmt.Sprintf("Reporting-MTA: dns; %s\r\n", reportingMTA))
+	dsn.WriteString(fmt.Sprintf("Arrival-Date: %s\r\n", message.CreatedAt.Format(time.RFC1123Z)))
+	for _, recipient := range failed {
+		dsn.WriteString("\r\n")
+		dsn.WriteString(fmt.Sprintf("Final-Recipient: rfc822; %s\r\n", recipient.Recipient))
+		dsn.WriteString("Action: failed\r\n")
+		dsn.WriteString(fmt.Sprintf("Status: %s\r\n", dsnStatus(recipient.StatusCode)))
+		if recipient.RemoteMta != "" {
+			dsn.WriteString(fmt.Sprintf("Remote-MTA: dns; %s\r\n", recipient.RemoteMta))
+		}
+		if recipient.LastError != "" {
+			// 远程服务器的响应使用 smtp 类型，本地错误（DNS查询失败等）使用 x-local
+			diagnosticType := "x-local"
+			if recipient.RemoteMta != "" {
+				diagnosticType = "smtp"
+			}
+			dsn.WriteString(fmt.Sprintf("Diagnostic-Code: %s; %s\r\n", diagnosticType, strings.Join(strings.Fields(recipient.LastError), " ")))
+		}
+		if recipient.LastAttemptAt != nil {
+			dsn.WriteString(fmt.Sprintf("Last-Attempt-Date: %s\r\n", recipient.LastAttemptAt.Format(time.RFC1123Z)))
+		}
+	}
+	dsn.WriteString("\r\n")
+
+	// 原邮件的邮件头
+	header, _ := splitRawMessage(message.Content)
+	dsn.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	dsn.WriteString("Content-Type: text/rfc822-headers\r\n")
+	dsn.WriteString("\r\n")
+	dsn.Write(toCRLF(bytes.TrimRight(header, "\r\n")))
+	dsn.WriteString("\r\n")
+
+	dsn.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+
+	return dsn.Bytes()
+}
+
+// dsnStatus 退信中的状态码，失败的收件人状态码必须以5或4开头
+func dsnStatus(code string) string {
+	if code == "" || (code[0] != '5' && code[0] != '4') {
+		return "5.0.0"
+	}
+	return code
+}
+
+// RetryOutboundMessage 立即重试队列邮件中等待投递的收件人，返回重试的收件人数量
+func (s *Service) RetryOutboundMessage(id int64) (int64, error) {
+	if _, err := s.svcCtx.OutboundQueueModel.GetMessage(id); err != nil {
+		return 0, err
+	}
+
+	count, err := s.svcCtx.OutboundQueueModel.RetryNow(id)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		s.svcCtx.QueueNotifier.Notify()
+	}
+	return count, nil
+}
+
+// BounceOutboundMessage 放弃投递队列邮件中等待投递的收件人并立即给发件人发送退信，返回放弃的收件人数量
+func (s *Service) BounceOutboundMessage(id int64) (int64, error) {
+	message, err := s.svcCtx.OutboundQueueModel.GetMessage(id)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := s.svcCtx.OutboundQueueModel.FailPending(id, "5.0.0", "管理员取消投递")
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		log.Printf("管理员取消投递出站邮件 #%d，收件人 %d 个", id, count)
+		// 仍有收件人正在投递时，由投递协程在结束后发送退信
+		s.finishOutboundMessage(message)
+	}
+	return count, nil
+}
+
+// DeleteOutboundMessage 从出站队列中删除邮件（不发送退信），正在投递的邮件不能删除
+func (s *Service) DeleteOutboundMessage(id int64) error {
+	if _, err := s.svcCtx.OutboundQueueModel.GetMessage(id); err != nil {
+		return err
+	}
+
+	return s.svcCtx.DB.Transaction(func(tx *gorm.DB) error {
+		sending, err := s.svcCtx.OutboundQueueModel.CountSending(tx, id)
+		if err != nil {
+			return err
+		}
+		if sending > 0 {
+			return fmt.Errorf("邮件正在投递中，请稍后再试")
+		}
+		return s.svcCtx.OutboundQueueModel.DeleteMessage(tx, id)
+	})
+}
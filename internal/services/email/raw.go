@@ -0,0 +1,256 @@
+package email
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"miko-email/internal/model"
+)
+
+// newEmailRaw 根据原始报文构建原文记录（统一为CRLF换行，记录大小和SHA-256）
+func newEmailRaw(emailID int64, raw []byte) *model.EmailRaw {
+	raw = toCRLF(raw)
+	sum := sha256.Sum256(raw)
+	return &model.EmailRaw{
+		EmailId:   emailID,
+		Size:      int64(len(raw)),
+		Sha256:    hex.EncodeToString(sum[:]),
+		Content:   raw,
+		CreatedAt: time.Now(),
+	}
+}
+
+// saveEmailWithRaw 在同一事务中保存邮件记录及其原始报文
+func (s *Service) saveEmailWithRaw(email *model.Email, raw []byte) error {
+	tx := s.svcCtx.DB.Begin()
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := s.svcCtx.EmailModel.Create(tx, email); err != nil {
+		return fmt.Errorf("插入邮件记录失败: %w", err)
+	}
+
+	if len(raw) > 0 {
+		if err := s.svcCtx.EmailRawModel.Create(tx, newEmailRaw(email.Id, raw)); err != nil {
+			return fmt.Errorf("保存邮件原文失败: %w", err)
+		}
+
+		// 提取附件失败不影响邮件投递
+		if _, err := s.attachmentService.SaveFromRaw(tx, email.Id, raw); err != nil {
+			log.Printf("提取邮件附件失败: %v", err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	tx = nil
+
+	s.notifyMailbox(email.MailboxId)
+
+	return nil
+}
+
+// GetRawMessage 获取邮件的完整RFC 5322原文
+// 对于没有保存原文的历史邮件（以及网页端写入的已发送邮件），根据数据库字段重建报文
+func (s *Service) GetRawMessage(email *model.Email) ([]byte, error) {
+	raw, err := s.svcCtx.EmailRawModel.GetByEmailId(email.Id)
+	if err == nil {
+		return raw.Content, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询邮件原文失败: %w", err)
+	}
+	return buildRFC822Message(email), nil
+}
+
+// GetRawMessageSize 获取邮件原文大小
+func (s *Service) GetRawMessageSize(email *model.Email) int64 {
+	raw, err := s.svcCtx.EmailRawModel.GetMetaByEmailId(email.Id)
+	if err == nil {
+		return raw.Size
+	}
+	return int64(len(buildRFC822Message(email)))
+}
+
+// deleteEmailWithRaw 删除邮件及其原文和附件
+func (s *Service) deleteEmailWithRaw(email *model.Email) error {
+	paths, err := s.svcCtx.AttachmentModel.GetStoragePathsByEmailId(email.Id)
+	if err != nil {
+		return err
+	}
+
+	tx := s.svcCtx.DB.Begin()
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := s.svcCtx.AttachmentModel.DeleteByEmailId(tx, email.Id); err != nil {
+		return err
+	}
+	if err := s.svcCtx.EmailRawModel.DeleteByEmailId(tx, email.Id); err != nil {
+		return err
+	}
+	if err := s.svcCtx.EmailModel.Delete(tx, email); err != nil {
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	tx = nil
+
+	s.attachmentService.RemoveUnreferencedFiles(paths)
+	s.notifyMailbox(email.MailboxId)
+
+	return nil
+}
+
+// GetAttachments 获取邮件附件列表
+func (s *Service) GetAttachments(emailID int64) ([]*model.EmailAttachment, error) {
+	return s.attachmentService.GetAttachments(emailID)
+}
+
+// GetAttachment 获取邮件附件及内容
+func (s *Service) GetAttachment(emailID, attachmentID int64) (*model.EmailAttachment, []byte, error) {
+	return s.attachmentService.GetAttachment(emailID, attachmentID)
+}
+
+// buildRFC822Message 根据数据库中的邮件字段重建RFC 5322报文
+func buildRFC822Message(email *model.Email) []byte {
+	var message bytes.Buffer
+
+	message.WriteString(fmt.Sprintf("From: %s\r\n", email.FromAddr))
+	message.WriteString(fmt.Sprintf("To: %s\r\n", email.ToAddr))
+	message.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", email.Subject)))
+	message.WriteString(fmt.Sprintf("Date: %s\r\n", email.CreatedAt.Format(time.RFC1123Z)))
+	message.WriteString(fmt.Sprintf("Message-ID: <%d.%d@%s>\r\n", email.Id, email.CreatedAt.Unix(), domainOf(email.FromAddr)))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: base64\r\n")
+	message.WriteString("\r\n")
+
+	// Base64编码正文，每76个字符换行
+	encoded := base64.StdEncoding.EncodeToString([]byte(email.Body))
+	for i := 0; i < len(encoded); i += 76 {
+		end := i + 76
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		message.WriteString(encoded[i:end])
+		message.WriteString("\r\n")
+	}
+
+	return message.Bytes()
+}
+
+// splitRawMessage 将原文拆分为头部和正文（头部包含结尾的空行）
+func splitRawMessage(raw []byte) (header, body []byte) {
+	if idx := bytes.Index(raw, []byte("\r\n\r\n")); idx >= 0 {
+		return raw[:idx+4], raw[idx+4:]
+	}
+	if idx := bytes.Index(raw, []byte("\n\n")); idx >= 0 {
+		return raw[:idx+2], raw[idx+2:]
+	}
+	return raw, nil
+}
+
+// toCRLF 统一换行符为CRLF（IMAP/POP3要求）
+func toCRLF(raw []byte) []byte {
+	normalized := bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(normalized, []byte("\n"), []byte("\r\n"))
+}
+
+// dotUnstuff 去除SMTP DATA中的点填充（RFC 5321 4.5.2）
+func dotUnstuff(line string) string {
+	if strings.HasPrefix(line, ".") {
+		return line[1:]
+	}
+	return line
+}
+
+// dotStuff 为POP3多行响应添加点填充（RFC 1939）
+func dotStuff(content []byte) []byte {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	var out bytes.Buffer
+	for _, line := range lines {
+		if len(line) > 0 && line[0] == '.' {
+			out.WriteByte('.')
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+// domainOf 提取邮箱地址的域名部分
+func domainOf(address string) string {
+	if idx := strings.LastIndex(address, "@"); idx >= 0 {
+		return strings.Trim(address[idx+1:], "<> ")
+	}
+	return "localhost"
+}
+
+// buildForwardMessage 构建转发报文
+// 正文为转发说明，original 不为空时作为 message/rfc822 附件原样附带，为空时只有正文；
+// trace 为转发跟踪头部（原邮件的Received头等），放在报文开头，用于检测转发循环
+func buildForwardMessage(from, to, subject, body string, original []byte, trace []string) []byte {
+	boundary := fmt.Sprintf("----=_Forward_%d", time.Now().UnixNano())
+
+	var message bytes.Buffer
+	for _, line := range trace {
+		message.WriteString(line + "\r\n")
+	}
+	message.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	message.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	message.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject)))
+	message.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	message.WriteString(fmt.Sprintf("Message-ID: <%d.forward@%s>\r\n", time.Now().UnixNano(), domainOf(from)))
+	message.WriteString("MIME-Version: 1.0\r\n")
+
+	// 不附带原文时只有转发说明
+	if len(original) == 0 {
+		message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		message.WriteString("Content-Transfer-Encoding: base64\r\n")
+		message.WriteString("\r\n")
+		writeBase64Lines(&message, []byte(body))
+		return message.Bytes()
+	}
+
+	message.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", boundary))
+	message.WriteString("\r\n")
+
+	// 转发说明部分
+	message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: base64\r\n")
+	message.WriteString("\r\n")
+	writeBase64Lines(&message, []byte(body))
+
+	// 原始邮件部分
+	message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	message.WriteString("Content-Type: message/rfc822\r\n")
+	message.WriteString("Content-Disposition: attachment; filename=\"original.eml\"\r\n")
+	message.WriteString("\r\n")
+	message.Write(toCRLF(original))
+	if !bytes.HasSuffix(original, []byte("\n")) {
+		message.WriteString("\r\n")
+	}
+
+	message.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+
+	return message.Bytes()
+}
@@ -0,0 +1,167 @@
+package email
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+	"miko-email/internal/model"
+)
+
+// 收件人检查结果
+const (
+	rcptLocal    = iota // 本地邮箱（包括别名、群组和投递到 catch-all 邮箱的）
+	rcptExternal        // 外部邮箱
+	rcptUnknown         // 本地域名下不存在的邮箱
+	rcptDisabled        // 本地域名下已停用的邮箱或别名
+	rcptError           // 查询出错
+)
+
+// maxGroupDepth 群组嵌套的最大层数
+const maxGroupDepth = 3
+
+// recipientTarget 本地收件人实际投递的位置
+type recipientTarget struct {
+	mailboxes []string // 投递的本地邮箱地址
+	external  []string // 群组中的外部成员
+}
+
+// resolveRecipient 检查收件人，本地收件人返回实际投递的位置
+// 子地址 user+tag@domain 投递到 user@domain，别名投递到对应的邮箱，群组展开为所有成员，
+// 邮箱不存在时投递到域名的 catch-all 邮箱（已停用的邮箱和别名不使用 catch-all），
+// 本地域名的SRS地址投递给还原出的原发件人
+func (session *SMTPSession) resolveRecipient(to string) (*recipientTarget, int) {
+	if target, status, ok := session.resolveSRS(to); ok {
+		return target, status
+	}
+	return session.resolveAddress(to, 0, make(map[string]bool))
+}
+
+func (session *SMTPSession) resolveAddress(to string, depth int, visited map[string]bool) (*recipientTarget, int) {
+	svcCtx := session.server.svcCtx
+	base, _ := svcCtx.MailboxModel.SplitSubaddress(to)
+
+	mailbox, err := svcCtx.MailboxModel.GetByEmail(to)
+	if errors.Is(err, gorm.ErrRecordNotFound) && base != to {
+		// 子地址 user+tag@domain 投递到 user@domain
+		mailbox, err = svcCtx.MailboxModel.GetByEmail(base)
+	}
+	if err == nil {
+		if !mailbox.IsActive {
+			return nil, rcptDisabled
+		}
+		return &recipientTarget{mailboxes: []string{mailbox.Email}}, rcptLocal
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("查询邮箱失败: %v", err)
+		return nil, rcptError
+	}
+
+	alias, err := svcCtx.MailAliasModel.GetByEmail(strings.ToLower(to))
+	if errors.Is(err, gorm.ErrRecordNotFound) && base != to {
+		alias, err = svcCtx.MailAliasModel.GetByEmail(strings.ToLower(base))
+	}
+	if err == nil {
+		return session.resolveAlias(alias, depth, visited)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("查询别名失败: %v", err)
+		return nil, rcptError
+	}
+
+	domainName := recipientDomain(to)
+	if !session.server.isLocalDomain(domainName) {
+		return nil, rcptExternal
+	}
+
+	domain, err := svcCtx.DomainModel.GetByName(domainName)
+	if err != nil || domain.CatchAll == "" {
+		return nil, rcptUnknown
+	}
+	if _, err := svcCtx.MailboxModel.GetIdByEmail(domain.CatchAll); err != nil {
+		log.Printf("域名 %s 的 catch-all 邮箱 %s 不可用: %v", domainName, domain.CatchAll, err)
+		return nil, rcptUnknown
+	}
+	log.Printf("收件人 %s 不存在，投递到 catch-all 邮箱 %s", to, domain.CatchAll)
+	return &recipientTarget{mailboxes: []string{domain.CatchAll}}, rcptLocal
+}
+
+// resolveAlias 获取别名投递的邮箱，或展开群组的成员（嵌套的群组也展开，忽略不存在的成员）
+func (session *SMTPSession) resolveAlias(alias *model.MailAlias, depth int, visited map[string]bool) (*recipientTarget, int) {
+	if !alias.IsActive {
+		return nil, rcptDisabled
+	}
+
+	if alias.Type == model.AliasTypeAlias {
+		mailbox, err := session.server.svcCtx.MailboxModel.GetById(alias.MailboxId)
+		if err != nil || !mailbox.IsActive {
+			return nil, rcptDisabled
+		}
+		return &recipientTarget{mailboxes: []string{mailbox.Email}}, rcptLocal
+	}
+
+	if visited[alias.Email] || depth >= maxGroupDepth {
+		log.Printf("群组 %s 嵌套过深或循环引用，忽略", alias.Email)
+		return nil, rcptUnknown
+	}
+	visited[alias.Email] = true
+
+	target := &recipientTarget{}
+	for _, member := range alias.MemberList() {
+		memberTarget, status := session.resolveAddress(member, depth+1, visited)
+		switch status {
+		case rcptLocal:
+			target.mailboxes = append(target.mailboxes, memberTarget.mailboxes...)
+			target.external = append(target.external, memberTarget.external...)
+		case rcptExternal:
+			target.external = append(target.external, member)
+		default:
+			log.Printf("群组 %s 的成员 %s 无法投递，忽略", alias.Email, member)
+		}
+	}
+	if len(target.mailboxes) == 0 && len(target.external) == 0 {
+		return nil, rcptUnknown
+	}
+	return target, rcptLocal
+}
+
+// aliasMailbox 获取别名投递的邮箱，不是别名（或是群组）时返回nil
+func (session *SMTPSession) aliasMailbox(address string) *model.Mailbox {
+	svcCtx := session.server.svcCtx
+	alias, err := svcCtx.MailAliasModel.GetByEmail(strings.ToLower(address))
+	if err != nil || alias.Type != model.AliasTypeAlias || !alias.IsActive {
+		return nil
+	}
+	mailbox, err := svcCtx.MailboxModel.GetById(alias.MailboxId)
+	if err != nil || !mailbox.IsActive {
+		return nil
+	}
+	return mailbox
+}
+
+// recipientTarget 获取本地收件人实际投递的位置，外部收件人返回nil
+func (session *SMTPSession) recipientTarget(to string) *recipientTarget {
+	return session.targets[strings.ToLower(to)]
+}
+
+// addRecipient 添加收件人，target 为本地收件人实际投递的位置（外部收件人为nil）
+func (session *SMTPSession) addRecipient(to string, target *recipientTarget) {
+	session.to = append(session.to, to)
+	if target == nil {
+		return
+	}
+	if session.targets == nil {
+		session.targets = make(map[string]*recipientTarget)
+	}
+	session.targets[strings.ToLower(to)] = target
+}
+
+// recipientTag 获取收件人地址的子地址标签，收件人就是邮箱地址时为空
+func (session *SMTPSession) recipientTag(to, mailbox string) string {
+	if strings.EqualFold(to, mailbox) {
+		return ""
+	}
+	_, tag := session.server.svcCtx.MailboxModel.SplitSubaddress(to)
+	return tag
+}
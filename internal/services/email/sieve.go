@@ -0,0 +1,467 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+	"miko-email/internal/services/sieve"
+)
+
+// sieveRejection 被Sieve脚本拒收的本地投递
+type sieveRejection struct {
+	to      string // 原始收件人地址
+	mailbox string // 拒收的邮箱
+	reason  string // 拒收原因
+}
+
+// sieveRejectError 所有收件人的Sieve脚本都拒收时返回，在SMTP会话中直接拒收（RFC 5429 2.1）
+type sieveRejectError struct {
+	reason string
+}
+
+func (e *sieveRejectError) Error() string {
+	return "邮件被收件人的Sieve脚本拒收: " + e.reason
+}
+
+// smtpReply 拒收原因用于SMTP响应：合并为一行，含非ASCII字符时使用通用说明
+func (e *sieveRejectError) smtpReply() string {
+	reason := strings.Join(strings.Fields(e.reason), " ")
+	for i := 0; i < len(reason); i++ {
+		if reason[i] >= 0x80 {
+			reason = ""
+			break
+		}
+	}
+	if reason == "" {
+		return "Message rejected by recipient's filter"
+	}
+	if len(reason) > 200 {
+		reason = reason[:200]
+	}
+	return reason
+}
+
+// runSieve 执行邮箱启用的Sieve脚本，没有启用的脚本或执行失败时返回nil（按隐式 keep 投递）
+func (session *SMTPSession) runSieve(to, mailbox string, mailboxID int64) (*sieve.Result, *sieve.Message) {
+	script, err := session.server.sieveService.ActiveScript(mailboxID)
+	if err != nil {
+		log.Printf("加载邮箱 %s 的Sieve脚本失败: %v", mailbox, err)
+		return nil, nil
+	}
+	if script == nil {
+		return nil, nil
+	}
+
+	// 脚本可以检查垃圾邮件评分添加的 X-Spam-Status 头
+	raw := session.data
+	if verdict := session.spamVerdict(to); verdict != nil {
+		raw = append([]byte(verdict.Header()), raw...)
+	}
+	msg := sieve.NewMessage(raw, session.from, to)
+
+	_, _, maxRedirects := config.GetSieveLimits()
+	result, err := script.Execute(msg, sieve.Options{MaxRedirects: maxRedirects})
+	if err != nil {
+		log.Printf("邮箱 %s 的Sieve脚本执行失败，放入收件箱: %v", mailbox, err)
+		return nil, nil
+	}
+	return result, msg
+}
+
+// deliverLocal 按Sieve脚本的执行结果投递到本地邮箱，result 为nil时放入默认文件夹
+// keepInbox 为false时（转发规则不保留原邮件）不放入默认文件夹，fileinto 仍然执行
+// 返回邮件是否因此没有放入默认文件夹（转发失败时需要补充保存）
+func (session *SMTPSession) deliverLocal(to, mailbox string, mailboxID int64, subject, body string, keepInbox bool, result *sieve.Result, msg *sieve.Message) (bool, error) {
+	if !keepInbox && (result == nil || result.Keep) {
+		log.Printf("转发规则不保留原邮件，暂不放入邮箱 %s", mailbox)
+	}
+	if result == nil {
+		if !keepInbox {
+			return true, nil
+		}
+		_, err := session.saveToMailbox(to, mailbox, mailboxID, "", nil, subject, body)
+		return false, err
+	}
+
+	junk := session.isJunk(to)
+	stored := false
+	withheld := result.Keep && !keepInbox
+
+	// 同一文件夹只保存一次
+	saved := make(map[string]bool)
+	if result.Keep && keepInbox {
+		if _, err := session.saveToMailbox(to, mailbox, mailboxID, "", result.KeepFlags, subject, body); err != nil {
+			return false, err
+		}
+		stored = true
+		if junk {
+			saved["junk"] = true
+		} else {
+			saved["inbox"] = true
+		}
+	}
+	for _, fileinto := range result.FileInto {
+		folder := session.sieveFolder(mailboxID, fileinto)
+		if saved[folder] {
+			continue
+		}
+		saved[folder] = true
+		if _, err := session.saveToMailbox(to, mailbox, mailboxID, folder, fileinto.Flags, subject, body); err != nil {
+			return false, err
+		}
+		stored = true
+	}
+	// fileinto 放入了收件箱时无需补充保存
+	if saved["inbox"] {
+		withheld = false
+	}
+	if !stored && !withheld {
+		log.Printf("邮件被邮箱 %s 的Sieve脚本丢弃", mailbox)
+	}
+
+	// 放入垃圾邮件的不转发、不自动回复
+	if junk {
+		if len(result.Redirects) > 0 || result.Vacation != nil {
+			log.Printf("邮件被判定为垃圾邮件，不执行邮箱 %s 的Sieve转发和自动回复", mailbox)
+		}
+		return withheld, nil
+	}
+	for _, address := range result.Redirects {
+		session.sieveRedirect(mailbox, address, subject, body)
+	}
+	if result.Vacation != nil {
+		session.sieveVacation(to, mailbox, mailboxID, subject, result.Vacation, msg)
+	}
+	return withheld, nil
+}
+
+// sieveFolder 将 fileinto 的IMAP文件夹名转换为 email.folder
+// 文件夹不存在时按 :create 创建，无法创建或未指定 :create 时放入收件箱
+func (session *SMTPSession) sieveFolder(mailboxID int64, fileinto sieve.FileInto) string {
+	if special := findSpecialFolder(fileinto.Folder); special != nil {
+		return special.folder
+	}
+
+	name := imapFolderName(fileinto.Folder)
+	if _, err := session.server.svcCtx.FolderModel.GetByName(mailboxID, name); err == nil {
+		return name
+	}
+	if !fileinto.Create || !validFolderName(name) {
+		log.Printf("Sieve文件夹 %s 不存在，放入收件箱", name)
+		return "inbox"
+	}
+
+	err := session.server.svcCtx.DB.Transaction(func(tx *gorm.DB) error {
+		return session.server.createFolders(tx, mailboxID, name)
+	})
+	if err != nil {
+		log.Printf("创建Sieve文件夹 %s 失败，放入收件箱: %v", name, err)
+		return "inbox"
+	}
+	return name
+}
+
+// applySieveFlags 设置Sieve脚本指定的IMAP标志，没有对应字段的关键字忽略
+func applySieveFlags(email *model.Email, flags []string) {
+	for _, flag := range flags {
+		switch imapFlagColumns[strings.ToLower(flag)] {
+		case "is_read":
+			email.IsRead = true
+		case "is_answered":
+			email.IsAnswered = true
+		case "is_flagged":
+			email.IsFlagged = true
+		case "is_deleted":
+			email.IsDeleted = true
+		case "is_draft":
+			email.IsDraft = true
+		}
+	}
+}
+
+// sieveRedirect 将邮件原样转发到指定地址，本地邮箱直接保存，外部地址加入出站队列（信封发件人使用邮箱地址）
+func (session *SMTPSession) sieveRedirect(mailbox, address, subject, body string) {
+	if strings.EqualFold(address, mailbox) {
+		log.Printf("Sieve转发地址与邮箱 %s 相同，忽略", mailbox)
+		return
+	}
+
+	mailboxID, err := session.server.svcCtx.MailboxModel.GetIdByEmail(address)
+	if err == nil {
+		err = session.server.saveEmailWithRaw(&model.Email{
+			MailboxId: mailboxID,
+			FromAddr:  session.from,
+			ToAddr:    address,
+			Subject:   subject,
+			Body:      body,
+			Folder:    "inbox",
+			IsRead:    false,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}, session.data)
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		envelope := session.server.forwardEnvelope(session.from, mailbox)
+		_, err = session.server.smtpClient.QueueMIMEEmail(envelope, []string{address}, session.data)
+	}
+	if err != nil {
+		log.Printf("Sieve转发 %s -> %s 失败: %v", mailbox, address, err)
+		return
+	}
+	log.Printf("✅ Sieve转发: %s -> %s", mailbox, address)
+}
+
+// sieveVacation 发送自动回复（RFC 5230），同一发件人在 :days 内只回复一次
+func (session *SMTPSession) sieveVacation(to, mailbox string, mailboxID int64, subject string, vacation *sieve.Vacation, msg *sieve.Message) {
+	sender := session.from
+	if !shouldSendVacation(sender, to, mailbox, vacation, msg) {
+		return
+	}
+
+	period := time.Duration(vacation.Days) * 24 * time.Hour
+	reply, err := session.server.svcCtx.SieveScriptModel.RecordVacation(mailboxID, strings.ToLower(sender), vacation.Handle, period)
+	if err != nil {
+		log.Printf("记录自动回复失败: %v", err)
+		return
+	}
+	if !reply {
+		log.Printf("邮箱 %s 已在 %d 天内自动回复过 %s", mailbox, vacation.Days, sender)
+		return
+	}
+
+	from := vacationFrom(mailbox, vacation)
+	replySubject := vacation.Subject
+	if replySubject == "" {
+		replySubject = "Auto: " + subject
+	}
+	message := buildVacationMessage(from, sender, replySubject, vacation, msg)
+
+	// 自动回复使用空信封发件人，避免对方的自动回复或退信形成循环
+	if err := session.server.deliverSystemMessage(from, sender, replySubject, vacation.Reason, message); err != nil {
+		log.Printf("发送自动回复失败: %v", err)
+		return
+	}
+	log.Printf("✅ 已发送自动回复: %s -> %s", mailbox, sender)
+}
+
+// shouldSendVacation 检查是否应该自动回复（RFC 5230 4.5、4.6）：
+// 发件人不能为空或邮件列表、系统地址，邮件不能是自动发送或群发的，且必须直接发给该邮箱
+func shouldSendVacation(sender, to, mailbox string, vacation *sieve.Vacation, msg *sieve.Message) bool {
+	if sender == "" || strings.EqualFold(sender, mailbox) {
+		return false
+	}
+
+	local := strings.ToLower(sender)
+	if at := strings.LastIndexByte(local, '@'); at >= 0 {
+		local = local[:at]
+	}
+	switch {
+	case local == "mailer-daemon", local == "postmaster", local == "listserv", local == "majordomo",
+		strings.HasPrefix(local, "owner-"), strings.HasSuffix(local, "-request"), strings.HasSuffix(local, "-owner"):
+		log.Printf("发件人 %s 是系统或邮件列表地址，不自动回复", sender)
+		return false
+	}
+
+	for _, value := range msg.HeaderValues("Auto-Submitted") {
+		if !strings.EqualFold(value, "no") {
+			log.Printf("邮件是自动发送的（Auto-Submitted: %s），不自动回复", value)
+			return false
+		}
+	}
+	for _, value := range msg.HeaderValues("Precedence") {
+		switch strings.ToLower(value) {
+		case "bulk", "list", "junk":
+			log.Printf("邮件是群发邮件（Precedence: %s），不自动回复", value)
+			return false
+		}
+	}
+	if msg.HasHeader("List-Id") || msg.HasHeader("List-Unsubscribe") || msg.HasHeader("List-Post") {
+		log.Printf("邮件来自邮件列表，不自动回复")
+		return false
+	}
+
+	// 只回复直接发给自己的邮件（密送和邮件列表不回复）
+	mine := append([]string{mailbox, to}, vacation.Addresses...)
+	for _, name := range []string{"To", "Cc", "Bcc", "Resent-To", "Resent-Cc"} {
+		for _, address := range msg.Addresses(name) {
+			for _, own := range mine {
+				if strings.EqualFold(address, own) {
+					return true
+				}
+			}
+		}
+	}
+	log.Printf("邮件没有直接发给 %s，不自动回复", mailbox)
+	return false
+}
+
+// vacationFrom 自动回复的发件人：:from 必须是邮箱自己或 :addresses 中的地址，否则使用邮箱地址
+func vacationFrom(mailbox string, vacation *sieve.Vacation) string {
+	if vacation.From == "" {
+		return mailbox
+	}
+	addr, err := mail.ParseAddress(vacation.From)
+	if err != nil {
+		return mailbox
+	}
+	for _, own := range append([]string{mailbox}, vacation.Addresses...) {
+		if strings.EqualFold(addr.Address, own) {
+			return addr.String()
+		}
+	}
+	log.Printf("自动回复的 :from 地址 %s 不属于邮箱 %s，使用邮箱地址", addr.Address, mailbox)
+	return mailbox
+}
+
+// buildVacationMessage 构建自动回复报文，:mime 时回复内容为完整的MIME实体
+func buildVacationMessage(from, to, subject string, vacation *sieve.Vacation, msg *sieve.Message) []byte {
+	var message bytes.Buffer
+	message.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	message.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	message.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject)))
+	message.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	message.WriteString(fmt.Sprintf("Message-ID: <%d.vacation@%s>\r\n", time.Now().UnixNano(), domainOf(from)))
+	if ids := msg.HeaderValues("Message-ID"); len(ids) > 0 && ids[0] != "" {
+		message.WriteString(fmt.Sprintf("In-Reply-To: %s\r\n", ids[0]))
+		references := ids[0]
+		if refs := msg.HeaderValues("References"); len(refs) > 0 && refs[0] != "" {
+			references = refs[0] + " " + ids[0]
+		}
+		message.WriteString(fmt.Sprintf("References: %s\r\n", references))
+	}
+	message.WriteString("Auto-Submitted: auto-replied (vacation)\r\n")
+	message.WriteString("MIME-Version: 1.0\r\n")
+
+	if vacation.Mime {
+		// 回复内容包含 Content-Type 等MIME头和正文
+		message.Write(toCRLF([]byte(vacation.Reason)))
+		return message.Bytes()
+	}
+
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: base64\r\n")
+	message.WriteString("\r\n")
+	writeBase64Lines(&message, []byte(vacation.Reason))
+	return message.Bytes()
+}
+
+// sendRejectNotices 部分收件人拒收时，向发件人发送拒收通知（RFC 5429 2.1.1 的MDN）
+func (session *SMTPSession) sendRejectNotices(rejections []sieveRejection, subject string) {
+	if session.from == "" {
+		log.Printf("空发件人的邮件被Sieve脚本拒收，不发送拒收通知")
+		return
+	}
+
+	messageID := ""
+	if original, err := mail.ReadMessage(bytes.NewReader(session.data)); err == nil {
+		messageID = original.Header.Get("Message-ID")
+	}
+
+	for _, rejection := range rejections {
+		noticeSubject := "邮件被拒收"
+		if subject != "" {
+			noticeSubject += " - " + subject
+		}
+		text := fmt.Sprintf("您发送给 <%s> 的邮件「%s」已被收件人拒收。\r\n\r\n原因：%s\r\n",
+			rejection.to, subject, rejection.reason)
+		message := buildRejectMDN(rejection.mailbox, session.from, noticeSubject, text, messageID, session.data)
+		if err := session.server.deliverSystemMessage(rejection.mailbox, session.from, noticeSubject, text, message); err != nil {
+			log.Printf("发送拒收通知失败: %v", err)
+			continue
+		}
+		log.Printf("已向 %s 发送拒收通知 (%s)", session.from, rejection.mailbox)
+	}
+}
+
+// buildRejectMDN 构建 multipart/report 格式的拒收通知（RFC 3798、RFC 5429）
+func buildRejectMDN(from, to, subject, text, originalMessageID string, original []byte) []byte {
+	boundary := fmt.Sprintf("----=_MDN_%d", time.Now().UnixNano())
+
+	var mdn bytes.Buffer
+	mdn.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	mdn.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	mdn.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject)))
+	mdn.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	mdn.WriteString(fmt.Sprintf("Message-ID: <%d.mdn@%s>\r\n", time.Now().UnixNano(), domainOf(from)))
+	mdn.WriteString("Auto-Submitted: auto-replied\r\n")
+	mdn.WriteString("MIME-Version: 1.0\r\n")
+	mdn.WriteString(fmt.Sprintf("Content-Type: multipart/report; report-type=disposition-notification; boundary=\"%s\"\r\n", boundary))
+	mdn.WriteString("\r\n")
+
+	// 说明部分
+	mdn.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	mdn.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	mdn.WriteString("Content-Transfer-Encoding: base64\r\n")
+	mdn.WriteString("\r\n")
+	writeBase64Lines(&mdn, []byte(text))
+
+	// 机器可读的处理结果
+	mdn.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	mdn.WriteString("Content-Type: message/disposition-notification\r\n")
+	mdn.WriteString("\r\n")
+	mdn.WriteString(fmt.Sprintf("Reporting-UA: %s; Miko Email Sieve\r\n", smtpServerHostname()))
+	mdn.WriteString(fmt.Sprintf("Final-Recipient: rfc822; %s\r\n", from))
+	if originalMessageID != "" {
+		mdn.WriteString(fmt.Sprintf("Original-Message-ID: %s\r\n", originalMessageID))
+	}
+	mdn.WriteString("Disposition: automatic-action/MDN-sent-automatically; deleted\r\n")
+	mdn.WriteString("\r\n")
+
+	// 原邮件的邮件头
+	header, _ := splitRawMessage(original)
+	mdn.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	mdn.WriteString("Content-Type: text/rfc822-headers\r\n")
+	mdn.WriteString("\r\n")
+	mdn.Write(toCRLF(bytes.TrimRight(header, "\r\n")))
+	mdn.WriteString("\r\n")
+
+	mdn.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+
+	return mdn.Bytes()
+}
+
+// deliverSystemMessage 投递自动生成的邮件（自动回复、拒收通知），收件人是本地邮箱时直接保存，
+// 否则以空信封发件人加入出站队列（投递失败不再产生退信）
+func (s *Service) deliverSystemMessage(from, to, subject, body string, message []byte) error {
+	mailboxID, err := s.svcCtx.MailboxModel.GetIdByEmail(to)
+	if err == nil {
+		return s.saveEmailWithRaw(&model.Email{
+			MailboxId: mailboxID,
+			FromAddr:  from,
+			ToAddr:    to,
+			Subject:   subject,
+			Body:      body,
+			Folder:    "inbox",
+			IsRead:    false,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}, message)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	_, err = s.smtpClient.QueueMIMEEmail("", []string{to}, message)
+	return err
+}
+
+// writeBase64Lines 以每行76个字符写入base64编码的内容
+func writeBase64Lines(buf *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for i := 0; i < len(encoded); i += 76 {
+		end := i + 76
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		buf.WriteString(encoded[i:end])
+		buf.WriteString("\r\n")
+	}
+}
@@ -0,0 +1,120 @@
+package email
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+	"miko-email/internal/services/spam"
+)
+
+// scoreSpam 对外部投递到本地邮箱的邮件进行垃圾邮件评分，按收件人域名的设置分别计算得分
+// 任一收件人域名的得分达到拒收阈值时返回错误
+func (session *SMTPSession) scoreSpam() error {
+	session.spamVerdicts = nil
+
+	// 已认证的提交和本机投递不评分
+	if !config.IsSpamFilterEnabled() || session.authenticated || session.isLoopback() {
+		return nil
+	}
+
+	msg := spam.NewMessage(session.data)
+	msg.ClientIP = session.remoteIP()
+	msg.Helo = session.helo
+	msg.MailFrom = session.from
+	msg.Auth = session.authResult
+	msg.DNSBL = session.dnsbl
+
+	domains := make(map[string]*model.Domain)
+	for _, to := range session.to {
+		target := session.recipientTarget(to)
+		if target == nil {
+			continue
+		}
+		msg.Recipients = append(msg.Recipients, to)
+		for _, mailbox := range target.mailboxes {
+			if mailboxID, err := session.server.svcCtx.MailboxModel.GetIdByEmail(mailbox); err == nil {
+				msg.MailboxIds = append(msg.MailboxIds, mailboxID)
+			}
+		}
+
+		name := recipientDomain(to)
+		if _, ok := domains[name]; !ok {
+			domain, err := session.server.svcCtx.DomainModel.GetByName(name)
+			if err != nil {
+				domain = nil
+			}
+			domains[name] = domain
+		}
+	}
+	if len(msg.Recipients) == 0 {
+		return nil
+	}
+
+	hits := session.server.spamEngine.Evaluate(msg)
+	session.spamVerdicts = make(map[string]*spam.Verdict)
+	for name, domain := range domains {
+		verdict := session.server.spamEngine.Score(hits, domain)
+		session.spamVerdicts[name] = verdict
+		log.Printf("垃圾邮件评分: %s -> @%s 得分 %.1f [%s]，处理: %s",
+			session.from, name, verdict.Score, strings.Join(verdict.Rules, ","), verdict.Action)
+
+		if verdict.Action == spam.ActionReject {
+			return fmt.Errorf("垃圾邮件得分 %.1f 达到域名 %s 的拒收阈值 %.1f", verdict.Score, name, verdict.RejectThreshold)
+		}
+	}
+	return nil
+}
+
+// stripSpamHeaders 删除外部投递的邮件中已有的 X-Spam-* 头，避免发件人伪造评分结果
+// （Sieve脚本和邮件客户端按 X-Spam-Status 过滤），已认证的提交和本机投递保留
+func (session *SMTPSession) stripSpamHeaders() {
+	if session.authenticated || session.isLoopback() {
+		return
+	}
+	session.data = stripHeaders(session.data, func(name, value string) bool {
+		if !strings.HasPrefix(strings.ToLower(name), "x-spam-") {
+			return false
+		}
+		log.Printf("删除发件人添加的垃圾邮件评分头: %s: %s", name, strings.TrimSpace(value))
+		return true
+	})
+}
+
+// spamVerdict 获取收件人所在域名的评分结果，未评分时返回nil
+func (session *SMTPSession) spamVerdict(to string) *spam.Verdict {
+	return session.spamVerdicts[recipientDomain(to)]
+}
+
+// applySpamVerdict 将评分结果写入邮件记录，返回在原文顶部添加了 X-Spam-Status 头的邮件原文
+func (session *SMTPSession) applySpamVerdict(email *model.Email, raw []byte) []byte {
+	verdict := session.spamVerdict(email.ToAddr)
+	if verdict == nil {
+		return raw
+	}
+
+	email.SpamScore = verdict.Score
+	email.SpamRules = strings.Join(verdict.Rules, ",")
+	if verdict.Action == spam.ActionJunk {
+		email.Folder = "junk"
+	}
+	return append([]byte(verdict.Header()), raw...)
+}
+
+// isJunk 发给该收件人的邮件是否放入垃圾邮件（DMARC隔离或垃圾邮件评分）
+func (session *SMTPSession) isJunk(to string) bool {
+	if session.quarantine {
+		return true
+	}
+	verdict := session.spamVerdict(to)
+	return verdict != nil && verdict.Action == spam.ActionJunk
+}
+
+func recipientDomain(addr string) string {
+	if at := strings.LastIndexByte(addr, '@'); at >= 0 {
+		return strings.ToLower(addr[at+1:])
+	}
+	return ""
+}
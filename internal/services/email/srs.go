@@ -0,0 +1,88 @@
+package email
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+	"miko-email/internal/config"
+	"miko-email/internal/services/srs"
+)
+
+// srsRewriter 按当前配置创建SRS改写器，密钥不可用时返回错误
+func srsRewriter() (*srs.Rewriter, error) {
+	secret, err := config.GetSRSSecret()
+	if err != nil {
+		return nil, err
+	}
+	return srs.NewRewriter(secret, config.GetSRSMaxAgeDays()), nil
+}
+
+// forwardEnvelope 转发到外部邮箱时使用的信封发件人
+// 转发地址的域名启用SRS时将原发件人改写为该域名下的SRS地址，退信返回原发件人；
+// 关闭SRS或改写失败时使用转发地址（退信返回转发的邮箱）。空信封发件人始终保持为空
+func (s *Service) forwardEnvelope(sender, forwarder string) string {
+	// 退信和自动回复不能改为普通邮件，否则可能产生退信循环（RFC 5321 4.5.5）
+	if sender == "" {
+		return ""
+	}
+
+	forwarder = strings.ToLower(forwarder)
+	domainName := domainOf(forwarder)
+
+	domain, err := s.svcCtx.DomainModel.GetByName(domainName)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("查询域名 %s 失败: %v", domainName, err)
+		}
+		return forwarder
+	}
+	if domain.DisableSRS {
+		return forwarder
+	}
+
+	rewriter, err := srsRewriter()
+	if err != nil {
+		log.Printf("SRS不可用，使用 %s 作为信封发件人: %v", forwarder, err)
+		return forwarder
+	}
+	rewritten, err := rewriter.Forward(sender, domain.Name)
+	if err != nil {
+		log.Printf("SRS改写发件人 %s 失败，使用 %s: %v", sender, forwarder, err)
+		return forwarder
+	}
+	return rewritten
+}
+
+// reverseSRS 还原发送到本地域名SRS地址的退信收件人，不是SRS地址时 ok 为false
+func (s *Service) reverseSRS(address string) (original string, ok bool, err error) {
+	if !srs.IsSRS(address) || !s.isLocalDomain(domainOf(address)) {
+		return "", false, nil
+	}
+	rewriter, err := srsRewriter()
+	if err != nil {
+		return "", true, err
+	}
+	original, err = rewriter.Reverse(address)
+	return original, true, err
+}
+
+// resolveSRS 检查RCPT TO是否为本地域名的SRS地址，有效的地址投递给还原出的原发件人
+// SRS地址只接收空信封发件人（MAIL FROM:<>）的退信，其他邮件以550拒收，避免被用作开放中继
+func (session *SMTPSession) resolveSRS(to string) (*recipientTarget, int, bool) {
+	original, ok, err := session.server.reverseSRS(to)
+	if !ok {
+		return nil, 0, false
+	}
+	if !session.hasMail || session.from != "" {
+		log.Printf("拒绝非退信发送到SRS地址 %s (发件人 %s，来自 %s)", to, session.from, session.conn.RemoteAddr())
+		return nil, rcptUnknown, true
+	}
+	if err != nil {
+		log.Printf("无效的SRS地址 %s: %v (来自 %s)", to, err, session.conn.RemoteAddr())
+		return nil, rcptUnknown, true
+	}
+	log.Printf("SRS地址 %s 还原为 %s", to, original)
+	return &recipientTarget{external: []string{original}}, rcptLocal, true
+}
@@ -0,0 +1,342 @@
+package forward
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jhillyerd/enmime/v2"
+)
+
+// 匹配条件的组合方式
+const (
+	MatchModeAll = "all" // 所有条件都满足
+	MatchModeAny = "any" // 任一条件满足
+)
+
+// maxConditions 每条规则最多的条件数
+const maxConditions = 20
+
+// ForwardCondition 转发规则的匹配条件
+type ForwardCondition struct {
+	Field  string `json:"field"`            // from/subject/to/cc/header/has_attachment/size
+	Op     string `json:"op"`               // contains/not_contains/equals/regex/is/gt/lt
+	Header string `json:"header,omitempty"` // field为header时的邮件头名称
+	Value  string `json:"value"`            // 匹配值
+}
+
+// ConditionResult 单个条件的匹配结果
+type ConditionResult struct {
+	Index     int    `json:"index"`
+	Condition string `json:"condition"`
+	Actual    string `json:"actual"`
+	Matched   bool   `json:"matched"`
+}
+
+// MatchResult 规则的匹配结果
+type MatchResult struct {
+	Matched     bool              `json:"matched"`
+	MatchMode   string            `json:"match_mode"`
+	Conditions  []ConditionResult `json:"conditions"`
+	Explanation string            `json:"explanation"`
+}
+
+// MatchMessage 用于匹配的邮件信息
+type MatchMessage struct {
+	From          string
+	To            string
+	Cc            string
+	Subject       string
+	Size          int64
+	HasAttachment bool
+	envelope      *enmime.Envelope
+}
+
+// 各字段允许的操作
+var conditionOps = map[string][]string{
+	"from":           {"contains", "not_contains", "equals", "regex"},
+	"subject":        {"contains", "not_contains", "equals", "regex"},
+	"to":             {"contains", "not_contains", "equals", "regex"},
+	"cc":             {"contains", "not_contains", "equals", "regex"},
+	"header":         {"contains", "not_contains", "equals", "regex"},
+	"has_attachment": {"is"},
+	"size":           {"gt", "lt"},
+}
+
+// NewMatchMessage 解析邮件原文，解析失败时只保留大小
+func NewMatchMessage(raw []byte) *MatchMessage {
+	msg := &MatchMessage{Size: int64(len(raw))}
+	envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		return msg
+	}
+	msg.envelope = envelope
+	msg.From = envelope.GetHeader("From")
+	msg.To = envelope.GetHeader("To")
+	msg.Cc = envelope.GetHeader("Cc")
+	msg.Subject = envelope.GetHeader("Subject")
+	msg.HasAttachment = len(envelope.Attachments) > 0
+	return msg
+}
+
+// header 获取邮件头的所有值（已解码）
+func (m *MatchMessage) header(name string) []string {
+	if m.envelope == nil {
+		return nil
+	}
+	return m.envelope.GetHeaderValues(name)
+}
+
+// ParseConditions 解析数据库中保存的条件
+func ParseConditions(data string) []ForwardCondition {
+	conditions := []ForwardCondition{}
+	if strings.TrimSpace(data) == "" {
+		return conditions
+	}
+	if err := json.Unmarshal([]byte(data), &conditions); err != nil {
+		log.Printf("解析转发规则条件失败: %v", err)
+		return []ForwardCondition{}
+	}
+	return conditions
+}
+
+// normalizeConditions 检查条件并统一大小写，返回保存到数据库的JSON
+func normalizeConditions(conditions []ForwardCondition, matchMode string) (string, string, error) {
+	switch matchMode {
+	case "":
+		matchMode = MatchModeAll
+	case MatchModeAll, MatchModeAny:
+	default:
+		return "", "", fmt.Errorf("条件组合方式只能是 all 或 any")
+	}
+
+	if len(conditions) > maxConditions {
+		return "", "", fmt.Errorf("每条规则最多 %d 个条件", maxConditions)
+	}
+
+	normalized := make([]ForwardCondition, 0, len(conditions))
+	for i, cond := range conditions {
+		cond.Field = strings.ToLower(strings.TrimSpace(cond.Field))
+		cond.Op = strings.ToLower(strings.TrimSpace(cond.Op))
+		cond.Header = strings.TrimSpace(cond.Header)
+
+		ops, ok := conditionOps[cond.Field]
+		if !ok {
+			return "", "", fmt.Errorf("条件%d: 不支持的字段 %s", i+1, cond.Field)
+		}
+		if !containsString(ops, cond.Op) {
+			return "", "", fmt.Errorf("条件%d: 字段 %s 不支持操作 %s", i+1, cond.Field, cond.Op)
+		}
+
+		switch cond.Field {
+		case "header":
+			if cond.Header == "" {
+				return "", "", fmt.Errorf("条件%d: 缺少邮件头名称", i+1)
+			}
+		case "has_attachment":
+			if _, err := strconv.ParseBool(cond.Value); err != nil {
+				return "", "", fmt.Errorf("条件%d: 附件条件的值只能是 true 或 false", i+1)
+			}
+		case "size":
+			if _, err := parseSize(cond.Value); err != nil {
+				return "", "", fmt.Errorf("条件%d: 无效的大小 %s", i+1, cond.Value)
+			}
+		}
+
+		if cond.Op == "regex" {
+			if _, err := regexp.Compile(cond.Value); err != nil {
+				return "", "", fmt.Errorf("条件%d: 正则表达式错误: %v", i+1, err)
+			}
+		} else if cond.Value == "" && cond.Field != "size" {
+			return "", "", fmt.Errorf("条件%d: 匹配值不能为空", i+1)
+		}
+
+		normalized = append(normalized, cond)
+	}
+
+	if len(normalized) == 0 {
+		return "", matchMode, nil
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", "", err
+	}
+	return string(data), matchMode, nil
+}
+
+// Match 检查邮件是否满足规则的条件，没有条件的规则匹配所有邮件
+func (r *ForwardRule) Match(msg *MatchMessage) *MatchResult {
+	res := &MatchResult{
+		MatchMode:  r.MatchMode,
+		Conditions: []ConditionResult{},
+	}
+	if res.MatchMode != MatchModeAny {
+		res.MatchMode = MatchModeAll
+	}
+
+	if len(r.Conditions) == 0 {
+		res.Matched = true
+		res.Explanation = "规则没有设置条件，匹配所有邮件"
+		return res
+	}
+
+	// 逐个检查所有条件，便于测试时说明每个条件的结果
+	matchedCount := 0
+	for i, cond := range r.Conditions {
+		matched, actual := cond.match(msg)
+		if matched {
+			matchedCount++
+		}
+		res.Conditions = append(res.Conditions, ConditionResult{
+			Index:     i + 1,
+			Condition: cond.String(),
+			Actual:    actual,
+			Matched:   matched,
+		})
+	}
+
+	if res.MatchMode == MatchModeAny {
+		res.Matched = matchedCount > 0
+	} else {
+		res.Matched = matchedCount == len(r.Conditions)
+	}
+
+	var explain []string
+	for _, cr := range res.Conditions {
+		if res.Matched == cr.Matched {
+			explain = append(explain, fmt.Sprintf("条件%d（%s）", cr.Index, cr.Condition))
+		}
+	}
+	switch {
+	case res.Matched && res.MatchMode == MatchModeAny:
+		res.Explanation = "满足" + strings.Join(explain, "、") + "，规则匹配"
+	case res.Matched:
+		res.Explanation = "所有条件都满足，规则匹配"
+	case res.MatchMode == MatchModeAny:
+		res.Explanation = "所有条件都不满足，规则不匹配"
+	default:
+		res.Explanation = "不满足" + strings.Join(explain, "、") + "，规则不匹配"
+	}
+	return res
+}
+
+// String 条件的可读描述
+func (c ForwardCondition) String() string {
+	field := c.Field
+	if c.Field == "header" {
+		field = "header " + c.Header
+	}
+	return fmt.Sprintf("%s %s %q", field, c.Op, c.Value)
+}
+
+// match 检查单个条件，同时返回参与比较的实际值
+func (c ForwardCondition) match(msg *MatchMessage) (bool, string) {
+	switch c.Field {
+	case "has_attachment":
+		want, _ := strconv.ParseBool(c.Value)
+		return msg.HasAttachment == want, strconv.FormatBool(msg.HasAttachment)
+	case "size":
+		limit, err := parseSize(c.Value)
+		if err != nil {
+			return false, strconv.FormatInt(msg.Size, 10)
+		}
+		actual := strconv.FormatInt(msg.Size, 10)
+		if c.Op == "gt" {
+			return msg.Size > limit, actual
+		}
+		return msg.Size < limit, actual
+	case "header":
+		values := msg.header(c.Header)
+		if c.Op == "not_contains" {
+			// 所有值都不包含时才满足
+			for _, v := range values {
+				if !c.matchText(v) {
+					return false, v
+				}
+			}
+			return true, strings.Join(values, ", ")
+		}
+		for _, v := range values {
+			if c.matchText(v) {
+				return true, v
+			}
+		}
+		return false, strings.Join(values, ", ")
+	}
+
+	var value string
+	switch c.Field {
+	case "from":
+		value = msg.From
+	case "subject":
+		value = msg.Subject
+	case "to":
+		value = msg.To
+	case "cc":
+		value = msg.Cc
+	}
+
+	// 地址字段的 equals 比较任一地址
+	if c.Op == "equals" && c.Field != "subject" {
+		if addrs, err := mail.ParseAddressList(value); err == nil {
+			for _, addr := range addrs {
+				if strings.EqualFold(addr.Address, strings.TrimSpace(c.Value)) {
+					return true, value
+				}
+			}
+		}
+	}
+	return c.matchText(value), value
+}
+
+// matchText 文本比较，contains/equals 不区分大小写
+func (c ForwardCondition) matchText(value string) bool {
+	switch c.Op {
+	case "contains":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(c.Value))
+	case "not_contains":
+		return !strings.Contains(strings.ToLower(value), strings.ToLower(c.Value))
+	case "equals":
+		return strings.EqualFold(strings.TrimSpace(value), strings.TrimSpace(c.Value))
+	case "regex":
+		re, err := regexp.Compile(c.Value)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(value)
+	}
+	return false
+}
+
+// parseSize 解析大小，支持 K/M 后缀
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1024
+		value = strings.TrimSuffix(value, "K")
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1024 * 1024
+		value = strings.TrimSuffix(value, "M")
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的大小")
+	}
+	return n * multiplier, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"miko-email/internal/config"
 	"miko-email/internal/model"
 	"miko-email/internal/svc"
 )
@@ -20,30 +21,41 @@ func NewService(svcCtx *svc.ServiceContext) *Service {
 
 // ForwardRule 转发规则结构（与model.EmailForward保持一致）
 type ForwardRule struct {
-	ID                 int64      `json:"id"`
-	MailboxID          int64      `json:"mailbox_id"`
-	SourceEmail        string     `json:"source_email"`
-	TargetEmail        string     `json:"target_email"`
-	Enabled            bool       `json:"enabled"`
-	KeepOriginal       bool       `json:"keep_original"`
-	ForwardAttachments bool       `json:"forward_attachments"`
-	SubjectPrefix      string     `json:"subject_prefix"`
-	Description        string     `json:"description"`
-	ForwardCount       int64      `json:"forward_count"`
-	LastForwardAt      *time.Time `json:"last_forward_at"`
-	CreatedAt          time.Time  `json:"created_at"`
-	UpdatedAt          time.Time  `json:"updated_at"`
+	ID                 int64              `json:"id"`
+	MailboxID          int64              `json:"mailbox_id"`
+	SourceEmail        string             `json:"source_email"`
+	TargetEmail        string             `json:"target_email"`
+	Enabled            bool               `json:"enabled"`
+	KeepOriginal       bool               `json:"keep_original"`
+	ForwardAttachments bool               `json:"forward_attachments"`
+	SubjectPrefix      string             `json:"subject_prefix"`
+	Description        string             `json:"description"`
+	Conditions         []ForwardCondition `json:"conditions"`
+	MatchMode          string             `json:"match_mode"`
+	StopProcessing     bool               `json:"stop_processing"`
+	Priority           int                `json:"priority"`
+	RateLimit          int                `json:"rate_limit"`
+	DisabledReason     string             `json:"disabled_reason"`
+	ForwardCount       int64              `json:"forward_count"`
+	LastForwardAt      *time.Time         `json:"last_forward_at"`
+	CreatedAt          time.Time          `json:"created_at"`
+	UpdatedAt          time.Time          `json:"updated_at"`
 }
 
 // CreateForwardRuleRequest 创建转发规则请求
 type CreateForwardRuleRequest struct {
-	SourceEmail        string `json:"source_email" binding:"required"`
-	TargetEmail        string `json:"target_email" binding:"required"`
-	Enabled            bool   `json:"enabled"`
-	KeepOriginal       bool   `json:"keep_original"`
-	ForwardAttachments bool   `json:"forward_attachments"`
-	SubjectPrefix      string `json:"subject_prefix"`
-	Description        string `json:"description"`
+	SourceEmail        string             `json:"source_email" binding:"required"`
+	TargetEmail        string             `json:"target_email" binding:"required"`
+	Enabled            bool               `json:"enabled"`
+	KeepOriginal       bool               `json:"keep_original"`
+	ForwardAttachments bool               `json:"forward_attachments"`
+	SubjectPrefix      string             `json:"subject_prefix"`
+	Description        string             `json:"description"`
+	Conditions         []ForwardCondition `json:"conditions"`      // 匹配条件，为空时转发所有邮件
+	MatchMode          string             `json:"match_mode"`      // 条件组合方式 all/any，默认all
+	StopProcessing     bool               `json:"stop_processing"` // 匹配后不再执行后续规则
+	Priority           int                `json:"priority"`        // 执行顺序，越小越先执行
+	RateLimit          int                `json:"rate_limit"`      // 每小时最多转发次数，0使用全局配置
 }
 
 // convertToForwardRule 将model.EmailForward转换为ForwardRule
@@ -58,6 +70,12 @@ func convertToForwardRule(ef *model.EmailForward) ForwardRule {
 		ForwardAttachments: ef.ForwardAttachments,
 		SubjectPrefix:      ef.SubjectPrefix,
 		Description:        ef.Description,
+		Conditions:         ParseConditions(ef.Conditions),
+		MatchMode:          ef.MatchMode,
+		StopProcessing:     ef.StopProcessing,
+		Priority:           ef.Priority,
+		RateLimit:          ef.RateLimit,
+		DisabledReason:     ef.DisabledReason,
 		ForwardCount:       ef.ForwardCount,
 		LastForwardAt:      ef.LastForwardAt,
 		CreatedAt:          ef.CreatedAt,
@@ -105,6 +123,14 @@ func (s *Service) CreateForwardRule(userID int64, req CreateForwardRuleRequest)
 		return nil, fmt.Errorf("查询邮箱失败: %w", err)
 	}
 
+	conditions, matchMode, err := normalizeConditions(req.Conditions, req.MatchMode)
+	if err != nil {
+		return nil, err
+	}
+	if req.RateLimit < 0 {
+		return nil, fmt.Errorf("每小时转发次数不能为负数")
+	}
+
 	// 检查是否已存在相同的转发规则
 	exists, err := s.svcCtx.EmailForwardModel.CheckForwardRuleExistByTarget(mailbox.Id, req.TargetEmail)
 	if err != nil {
@@ -125,6 +151,11 @@ func (s *Service) CreateForwardRule(userID int64, req CreateForwardRuleRequest)
 		ForwardAttachments: req.ForwardAttachments,
 		SubjectPrefix:      req.SubjectPrefix,
 		Description:        req.Description,
+		Conditions:         conditions,
+		MatchMode:          matchMode,
+		StopProcessing:     req.StopProcessing,
+		Priority:           req.Priority,
+		RateLimit:          req.RateLimit,
 		ForwardCount:       0,
 		CreatedAt:          now,
 		UpdatedAt:          now,
@@ -155,6 +186,14 @@ func (s *Service) UpdateForwardRule(ruleID int64, userID int64, req CreateForwar
 		return fmt.Errorf("查询邮箱失败: %w", err)
 	}
 
+	conditions, matchMode, err := normalizeConditions(req.Conditions, req.MatchMode)
+	if err != nil {
+		return err
+	}
+	if req.RateLimit < 0 {
+		return fmt.Errorf("每小时转发次数不能为负数")
+	}
+
 	// 更新转发规则
 	updateData := map[string]interface{}{
 		"mailbox_id":          mailbox.Id,
@@ -165,6 +204,13 @@ func (s *Service) UpdateForwardRule(ruleID int64, userID int64, req CreateForwar
 		"forward_attachments": req.ForwardAttachments,
 		"subject_prefix":      req.SubjectPrefix,
 		"description":         req.Description,
+		"conditions":          conditions,
+		"match_mode":          matchMode,
+		"stop_processing":     req.StopProcessing,
+		"priority":            req.Priority,
+		"rate_limit":          req.RateLimit,
+		"disabled_reason":     "",
+		"rate_window_count":   0,
 		"updated_at":          time.Now(),
 	}
 
@@ -224,6 +270,27 @@ func (s *Service) IncrementForwardCount(ruleID int64) error {
 	return nil
 }
 
+// TakeForwardQuota 占用规则本小时的一次转发次数，返回是否允许转发及使用的限制
+func (s *Service) TakeForwardQuota(rule ForwardRule) (bool, int, error) {
+	limit := rule.RateLimit
+	if limit <= 0 {
+		_, _, limit = config.GetForwardLimits()
+	}
+	allowed, err := s.svcCtx.EmailForwardModel.TakeForwardQuota(rule.ID, limit, time.Hour)
+	if err != nil {
+		return false, limit, fmt.Errorf("检查转发次数失败: %w", err)
+	}
+	return allowed, limit, nil
+}
+
+// AutoDisableForwardRule 自动停用转发规则，用户重新启用后恢复
+func (s *Service) AutoDisableForwardRule(ruleID int64, reason string) error {
+	if err := s.svcCtx.EmailForwardModel.AutoDisable(nil, ruleID, reason); err != nil {
+		return fmt.Errorf("停用转发规则失败: %w", err)
+	}
+	return nil
+}
+
 // GetActiveForwardRules 获取指定邮箱的活跃转发规则
 func (s *Service) GetActiveForwardRules(sourceEmail string) ([]ForwardRule, error) {
 	emailForwards, err := s.svcCtx.EmailForwardModel.GetForwardsBySourceEmail(sourceEmail)
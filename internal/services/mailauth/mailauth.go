@@ -0,0 +1,301 @@
+package mailauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-msgauth/authres"
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/emersion/go-msgauth/dmarc"
+	"golang.org/x/net/publicsuffix"
+)
+
+// DKIM/DMARC检查结果（RFC 8601 2.7）
+const (
+	ResultNone      = "none"
+	ResultPass      = "pass"
+	ResultFail      = "fail"
+	ResultTempError = "temperror"
+	ResultPermError = "permerror"
+)
+
+// 单封邮件最多验证的DKIM签名数量
+const maxDKIMSignatures = 5
+
+// verifyTimeout 一封邮件全部DNS查询的最长时间
+const verifyTimeout = 20 * time.Second
+
+// Service 收信认证服务（SPF、DKIM、DMARC）
+type Service struct {
+	resolver *net.Resolver
+}
+
+// NewService 创建收信认证服务
+func NewService() *Service {
+	return &Service{
+		resolver: net.DefaultResolver,
+	}
+}
+
+// Params 需要验证的邮件
+type Params struct {
+	IP       net.IP // 客户端IP
+	Helo     string // HELO/EHLO主机名
+	MailFrom string // 信封发件人（MAIL FROM），空表示空信封
+	Message  []byte // 邮件原文
+}
+
+// Result 验证结果
+type Result struct {
+	SPF         string // MAIL FROM的SPF结果（空信封时为HELO的结果）
+	SPFDomain   string // SPF检查的域名
+	DKIM        string // 有一个签名通过即为pass
+	DKIMDomains []string
+	DMARC       string
+	DMARCPolicy string // 应执行的DMARC策略（none/quarantine/reject），DMARC未通过时有效
+	FromDomain  string // 邮件头From的域名
+	Aligned     bool   // SPF或DKIM通过且与From域名对齐（不论发件域名是否发布了DMARC记录）
+
+	results []authres.Result
+}
+
+// Verify 验证邮件的SPF、DKIM和DMARC
+func (s *Service) Verify(params *Params) *Result {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	r := &Result{}
+	s.verifySPF(ctx, params, r)
+	s.verifyDKIM(ctx, params, r)
+	s.verifyDMARC(ctx, params, r)
+	return r
+}
+
+// Header 生成Authentication-Results头（RFC 8601），authservID 为本服务器的主机名
+func (r *Result) Header(authservID string) string {
+	return "Authentication-Results: " + strings.ReplaceAll(r.HeaderValue(authservID), "; ", ";\r\n\t") + "\r\n"
+}
+
+// HeaderValue 返回Authentication-Results头的值（不折行），保存到数据库
+func (r *Result) HeaderValue(authservID string) string {
+	// 没有参数的结果（如 dkim=none）后面会多一个空格
+	return strings.ReplaceAll(strings.TrimSpace(authres.Format(authservID, r.results)), " ;", ";")
+}
+
+// Authenticates 判断发件人地址的域名是否通过认证：SPF通过且检查的就是该域名，
+// 或者SPF/DKIM与From域名对齐且该地址与From域名对齐（伪造的信封发件人两者都不满足）
+func (r *Result) Authenticates(address string) bool {
+	at := strings.LastIndexByte(address, '@')
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(strings.TrimSuffix(address[at+1:], "."))
+	if r.SPF == SPFPass && r.SPFDomain == domain {
+		return true
+	}
+	return r.Aligned && r.FromDomain != "" && isAligned(r.FromDomain, domain, dmarc.AlignmentRelaxed)
+}
+
+// verifySPF 依次检查HELO和MAIL FROM（RFC 7208 2.3、2.4）
+func (s *Service) verifySPF(ctx context.Context, params *Params, r *Result) {
+	helo := strings.ToLower(strings.TrimSuffix(params.Helo, "."))
+
+	heloResult := SPFNone
+	if isValidDomain(helo) {
+		var reason string
+		heloResult, reason = s.CheckSPF(ctx, params.IP, helo, "postmaster@"+helo, helo)
+		r.results = append(r.results, &authres.SPFResult{Value: authres.ResultValue(heloResult), Reason: reason, Helo: helo})
+	}
+
+	if params.MailFrom == "" {
+		r.SPF, r.SPFDomain = heloResult, helo
+		return
+	}
+
+	domain := params.MailFrom
+	if at := strings.LastIndexByte(domain, '@'); at >= 0 {
+		domain = domain[at+1:]
+	}
+	domain = strings.ToLower(domain)
+
+	result, reason := s.CheckSPF(ctx, params.IP, domain, params.MailFrom, helo)
+	r.SPF, r.SPFDomain = result, domain
+	r.results = append(r.results, &authres.SPFResult{Value: authres.ResultValue(result), Reason: reason, From: params.MailFrom})
+}
+
+// verifyDKIM 验证邮件中的所有DKIM签名
+func (s *Service) verifyDKIM(ctx context.Context, params *Params, r *Result) {
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(params.Message), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return s.resolver.LookupTXT(ctx, domain)
+		},
+		MaxVerifications: maxDKIMSignatures,
+	})
+	if err != nil && !errors.Is(err, dkim.ErrTooManySignatures) {
+		r.DKIM = ResultPermError
+		r.results = append(r.results, &authres.DKIMResult{Value: authres.ResultPermError, Reason: err.Error()})
+		return
+	}
+
+	r.DKIM = ResultNone
+	if len(verifications) == 0 {
+		r.results = append(r.results, &authres.DKIMResult{Value: authres.ResultNone})
+		return
+	}
+
+	for _, v := range verifications {
+		value := ResultPass
+		reason := ""
+		switch {
+		case v.Err == nil:
+			r.DKIMDomains = append(r.DKIMDomains, strings.ToLower(v.Domain))
+		case dkim.IsTempFail(v.Err):
+			value, reason = ResultTempError, v.Err.Error()
+		case dkim.IsPermFail(v.Err):
+			value, reason = ResultPermError, v.Err.Error()
+		default:
+			value, reason = ResultFail, v.Err.Error()
+		}
+
+		if r.DKIM != ResultPass && (value == ResultPass || r.DKIM == ResultNone) {
+			r.DKIM = value
+		}
+		r.results = append(r.results, &authres.DKIMResult{
+			Value:      authres.ResultValue(value),
+			Reason:     reason,
+			Domain:     v.Domain,
+			Identifier: v.Identifier,
+		})
+	}
+}
+
+// verifyDMARC 检查SPF/DKIM与From域名是否对齐，并查询From域名的DMARC策略（RFC 7489）
+func (s *Service) verifyDMARC(ctx context.Context, params *Params, r *Result) {
+	fromDomain, err := headerFromDomain(params.Message)
+	if err != nil {
+		r.DMARC = ResultPermError
+		r.results = append(r.results, &authres.DMARCResult{Value: authres.ResultPermError, Reason: err.Error()})
+		return
+	}
+	r.FromDomain = fromDomain
+
+	lookup := &dmarc.LookupOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return s.resolver.LookupTXT(ctx, domain)
+		},
+	}
+
+	orgDomain := organizationalDomain(fromDomain)
+	record, err := dmarc.LookupWithOptions(fromDomain, lookup)
+	policy := dmarc.PolicyNone
+	if err == nil {
+		policy = record.Policy
+	} else if errors.Is(err, dmarc.ErrNoPolicy) && orgDomain != fromDomain {
+		// 子域名没有记录时使用组织域名的记录，优先使用 sp=
+		record, err = dmarc.LookupWithOptions(orgDomain, lookup)
+		if err == nil {
+			policy = record.Policy
+			if record.SubdomainPolicy != "" {
+				policy = record.SubdomainPolicy
+			}
+		}
+	}
+
+	var spfAlign, dkimAlign dmarc.AlignmentMode = dmarc.AlignmentRelaxed, dmarc.AlignmentRelaxed
+	if record != nil {
+		if record.SPFAlignment != "" {
+			spfAlign = record.SPFAlignment
+		}
+		if record.DKIMAlignment != "" {
+			dkimAlign = record.DKIMAlignment
+		}
+	}
+
+	if r.SPF == SPFPass && isAligned(fromDomain, r.SPFDomain, spfAlign) {
+		r.Aligned = true
+	}
+	for _, domain := range r.DKIMDomains {
+		if isAligned(fromDomain, domain, dkimAlign) {
+			r.Aligned = true
+		}
+	}
+
+	switch {
+	case err != nil && errors.Is(err, dmarc.ErrNoPolicy):
+		r.DMARC = ResultNone
+	case err != nil && dmarc.IsTempFail(err):
+		r.DMARC = ResultTempError
+	case err != nil:
+		r.DMARC = ResultPermError
+	case r.Aligned:
+		r.DMARC = ResultPass
+	default:
+		r.DMARC = ResultFail
+		r.DMARCPolicy = string(policy)
+		// pct 未抽中的邮件执行低一级的策略（RFC 7489 6.6.4）
+		if record.Percent != nil && *record.Percent < 100 && rand.Intn(100) >= *record.Percent {
+			switch policy {
+			case dmarc.PolicyReject:
+				r.DMARCPolicy = string(dmarc.PolicyQuarantine)
+			case dmarc.PolicyQuarantine:
+				r.DMARCPolicy = string(dmarc.PolicyNone)
+			}
+		}
+	}
+
+	reason := ""
+	if err != nil && !errors.Is(err, dmarc.ErrNoPolicy) {
+		reason = err.Error()
+	}
+	r.results = append(r.results, &authres.DMARCResult{Value: authres.ResultValue(r.DMARC), Reason: reason, From: fromDomain})
+}
+
+// headerFromDomain 获取邮件头From中唯一发件人的域名（错误信息写入Authentication-Results头）
+func headerFromDomain(message []byte) (string, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		return "", errors.New("cannot parse message header")
+	}
+
+	froms := msg.Header["From"]
+	if len(froms) != 1 {
+		return "", errors.New("message must have exactly one From header")
+	}
+	addrs, err := mail.ParseAddressList(froms[0])
+	if err != nil || len(addrs) != 1 {
+		return "", errors.New("From header must contain exactly one valid address")
+	}
+
+	at := strings.LastIndexByte(addrs[0].Address, '@')
+	if at < 0 {
+		return "", errors.New("From address has no domain")
+	}
+	return strings.ToLower(addrs[0].Address[at+1:]), nil
+}
+
+// organizationalDomain 获取组织域名（公共后缀下一级），如 mail.example.co.uk -> example.co.uk
+func organizationalDomain(domain string) string {
+	org, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+	return org
+}
+
+// isAligned 判断认证通过的域名是否与From域名对齐（严格模式要求完全相同，宽松模式要求组织域名相同）
+func isAligned(fromDomain, authDomain string, mode dmarc.AlignmentMode) bool {
+	authDomain = strings.ToLower(strings.TrimSuffix(authDomain, "."))
+	if authDomain == "" {
+		return false
+	}
+	if mode == dmarc.AlignmentStrict {
+		return authDomain == fromDomain
+	}
+	return organizationalDomain(authDomain) == organizationalDomain(fromDomain)
+}
@@ -0,0 +1,270 @@
+package mailauth
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dmarc"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNS 测试用的DNS服务器，只回答配置的TXT、A、AAAA和MX记录，其他名称返回NXDOMAIN
+type fakeDNS struct {
+	txt  map[string][]string
+	ip   map[string][]net.IP
+	mx   map[string][]string
+	conn net.PacketConn
+}
+
+// newTestService 启动fakeDNS并返回使用它查询的认证服务
+func newTestService(t *testing.T, dns *fakeDNS) *Service {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动测试DNS服务器失败: %v", err)
+	}
+	dns.conn = conn
+	t.Cleanup(func() { conn.Close() })
+	go dns.serve()
+
+	return &Service{
+		resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "udp", conn.LocalAddr().String())
+			},
+		},
+	}
+}
+
+func (d *fakeDNS) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp, err := d.answer(buf[:n]); err == nil {
+			d.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (d *fakeDNS) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+	header.Response = true
+	header.Authoritative = true
+	header.RCode = dnsmessage.RCodeSuccess
+	if !d.exists(name) {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, header)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(question); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	rh := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	switch question.Type {
+	case dnsmessage.TypeTXT:
+		for _, txt := range d.txt[name] {
+			if err := b.TXTResource(rh, dnsmessage.TXTResource{TXT: []string{txt}}); err != nil {
+				return nil, err
+			}
+		}
+	case dnsmessage.TypeA:
+		for _, ip := range d.ip[name] {
+			if ip4 := ip.To4(); ip4 != nil {
+				var a dnsmessage.AResource
+				copy(a.A[:], ip4)
+				if err := b.AResource(rh, a); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case dnsmessage.TypeAAAA:
+		for _, ip := range d.ip[name] {
+			if ip.To4() == nil {
+				var aaaa dnsmessage.AAAAResource
+				copy(aaaa.AAAA[:], ip.To16())
+				if err := b.AAAAResource(rh, aaaa); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case dnsmessage.TypeMX:
+		for i, host := range d.mx[name] {
+			mx := dnsmessage.MXResource{Pref: uint16(10 * (i + 1)), MX: dnsmessage.MustNewName(host + ".")}
+			if err := b.MXResource(rh, mx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+func (d *fakeDNS) exists(name string) bool {
+	_, txt := d.txt[name]
+	_, ip := d.ip[name]
+	_, mx := d.mx[name]
+	return txt || ip || mx
+}
+
+func TestIsAligned(t *testing.T) {
+	tests := []struct {
+		name       string
+		fromDomain string
+		authDomain string
+		mode       dmarc.AlignmentMode
+		want       bool
+	}{
+		{"宽松模式相同域名", "example.com", "example.com", dmarc.AlignmentRelaxed, true},
+		{"宽松模式子域名", "example.com", "mail.example.com", dmarc.AlignmentRelaxed, true},
+		{"宽松模式From为子域名", "news.example.com", "example.com", dmarc.AlignmentRelaxed, true},
+		{"宽松模式不同组织域名", "example.com", "example.net", dmarc.AlignmentRelaxed, false},
+		{"宽松模式公共后缀", "example.co.uk", "other.co.uk", dmarc.AlignmentRelaxed, false},
+		{"宽松模式多级公共后缀子域名", "example.co.uk", "mail.example.co.uk", dmarc.AlignmentRelaxed, true},
+		{"严格模式相同域名", "example.com", "example.com", dmarc.AlignmentStrict, true},
+		{"严格模式子域名", "example.com", "mail.example.com", dmarc.AlignmentStrict, false},
+		{"忽略大小写和结尾的点", "example.com", "Mail.Example.COM.", dmarc.AlignmentRelaxed, true},
+		{"认证域名为空", "example.com", "", dmarc.AlignmentRelaxed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isAligned(tt.fromDomain, tt.authDomain, tt.mode); got != tt.want {
+				t.Errorf("isAligned(%q, %q, %q) = %v，期望 %v", tt.fromDomain, tt.authDomain, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderFromDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{"单个地址", "From: Alice <alice@Example.COM>\r\n", "example.com", false},
+		{"没有From头", "To: bob@example.net\r\n", "", true},
+		{"两个From头", "From: alice@example.com\r\nFrom: mallory@evil.test\r\n", "", true},
+		{"一个From头中有两个地址", "From: alice@example.com, mallory@evil.test\r\n", "", true},
+		{"无法解析的地址", "From: not an address\r\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := headerFromDomain([]byte(tt.header + "Subject: test\r\n\r\nbody\r\n"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("headerFromDomain 错误 = %v，期望出错 %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("headerFromDomain = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDMARC(t *testing.T) {
+	dns := &fakeDNS{
+		txt: map[string][]string{
+			"example.com":             {"v=spf1 ip4:192.0.2.0/24 -all"},
+			"mail.example.com":        {"v=spf1 ip4:192.0.2.0/24 -all"},
+			"_dmarc.example.com":      {"v=DMARC1; p=reject"},
+			"strict.test":             {"v=spf1 ip4:192.0.2.0/24 -all"},
+			"mail.strict.test":        {"v=spf1 ip4:192.0.2.0/24 -all"},
+			"_dmarc.strict.test":      {"v=DMARC1; p=reject; aspf=s"},
+			"pct0.test":               {"v=spf1 -all"},
+			"_dmarc.pct0.test":        {"v=DMARC1; p=reject; pct=0"},
+			"quarantine0.test":        {"v=spf1 -all"},
+			"_dmarc.quarantine0.test": {"v=DMARC1; p=quarantine; pct=0"},
+			"pct100.test":             {"v=spf1 -all"},
+			"_dmarc.pct100.test":      {"v=DMARC1; p=quarantine; pct=100"},
+			"parent.test":             {"v=spf1 -all"},
+			"_dmarc.parent.test":      {"v=DMARC1; p=none; sp=reject"},
+			"nopolicy.test":           {"v=spf1 ip4:192.0.2.0/24 -all"},
+		},
+	}
+	s := newTestService(t, dns)
+	ip := net.ParseIP("192.0.2.10")
+
+	tests := []struct {
+		name       string
+		mailFrom   string
+		from       string
+		wantDMARC  string
+		wantPolicy string
+		wantAlign  bool
+	}{
+		{"SPF通过且对齐", "bounce@example.com", "alice@example.com", ResultPass, "", true},
+		{"宽松模式SPF子域名对齐", "bounce@mail.example.com", "alice@example.com", ResultPass, "", true},
+		{"严格模式SPF子域名不对齐", "bounce@mail.strict.test", "alice@strict.test", ResultFail, "reject", false},
+		{"SPF通过但域名不对齐", "bounce@nopolicy.test", "alice@example.com", ResultFail, "reject", false},
+		{"pct=0时reject降为quarantine", "bounce@nopolicy.test", "alice@pct0.test", ResultFail, "quarantine", false},
+		{"pct=0时quarantine降为none", "bounce@nopolicy.test", "alice@quarantine0.test", ResultFail, "none", false},
+		{"pct=100时执行原策略", "bounce@nopolicy.test", "alice@pct100.test", ResultFail, "quarantine", false},
+		{"子域名使用组织域名的sp策略", "bounce@nopolicy.test", "alice@news.parent.test", ResultFail, "reject", false},
+		{"没有DMARC记录", "bounce@example.com", "alice@nopolicy.test", ResultNone, "", false},
+		{"没有DMARC记录但对齐", "bounce@nopolicy.test", "alice@nopolicy.test", ResultNone, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := "From: " + tt.from + "\r\nTo: bob@local.test\r\nSubject: test\r\n\r\nbody\r\n"
+			r := s.Verify(&Params{IP: ip, Helo: "mx.sender.test", MailFrom: tt.mailFrom, Message: []byte(message)})
+			if r.DMARC != tt.wantDMARC || r.DMARCPolicy != tt.wantPolicy || r.Aligned != tt.wantAlign {
+				t.Errorf("dmarc=%s policy=%q aligned=%v，期望 dmarc=%s policy=%q aligned=%v",
+					r.DMARC, r.DMARCPolicy, r.Aligned, tt.wantDMARC, tt.wantPolicy, tt.wantAlign)
+			}
+		})
+	}
+
+	// From头无效时为permerror，不设置From域名
+	r := s.Verify(&Params{IP: ip, MailFrom: "bounce@example.com",
+		Message: []byte("From: alice@example.com\r\nFrom: mallory@evil.test\r\n\r\nbody\r\n")})
+	if r.DMARC != ResultPermError || r.FromDomain != "" {
+		t.Errorf("两个From头: dmarc=%s from=%q，期望 permerror 且From域名为空", r.DMARC, r.FromDomain)
+	}
+}
+
+func TestAuthenticates(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  Result
+		address string
+		want    bool
+	}{
+		{"SPF通过的域名", Result{SPF: SPFPass, SPFDomain: "example.com"}, "alice@example.com", true},
+		{"SPF通过但不是该域名", Result{SPF: SPFPass, SPFDomain: "evil.test"}, "alice@example.com", false},
+		{"SPF未通过", Result{SPF: SPFFail, SPFDomain: "example.com"}, "alice@example.com", false},
+		{"DKIM与From对齐且地址与From对齐", Result{SPF: SPFSoftFail, FromDomain: "example.com", Aligned: true}, "bounce@mail.example.com", true},
+		{"From对齐但地址是其他域名", Result{SPF: SPFFail, FromDomain: "evil.test", Aligned: true}, "alice@example.com", false},
+		{"未对齐", Result{SPF: SPFNone, FromDomain: "example.com"}, "alice@example.com", false},
+		{"没有域名", Result{SPF: SPFPass, SPFDomain: "example.com"}, "alice", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.result.Authenticates(tt.address); got != tt.want {
+				t.Errorf("Authenticates(%q) = %v，期望 %v", tt.address, got, tt.want)
+			}
+		})
+	}
+}
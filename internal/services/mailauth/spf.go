@@ -0,0 +1,549 @@
+package mailauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SPF检查结果（RFC 7208 2.6）
+const (
+	SPFNone      = "none"
+	SPFNeutral   = "neutral"
+	SPFPass      = "pass"
+	SPFFail      = "fail"
+	SPFSoftFail  = "softfail"
+	SPFTempError = "temperror"
+	SPFPermError = "permerror"
+)
+
+// RFC 7208 4.6.4：DNS查询次数和空结果查询次数的上限
+const (
+	spfMaxLookups     = 10
+	spfMaxVoidLookups = 2
+	spfMaxMXHosts     = 10
+)
+
+// spfError 评估过程中需要立即终止的错误（temperror/permerror）
+// reason 会写入Authentication-Results头，只能使用ASCII字符
+type spfError struct {
+	result string
+	reason string
+}
+
+func (e *spfError) Error() string {
+	return e.result + ": " + e.reason
+}
+
+// spfChecker 一次SPF检查（包括include和redirect）的状态
+type spfChecker struct {
+	ctx      context.Context
+	resolver *net.Resolver
+	ip       net.IP
+	sender   string // MAIL FROM（空信封时为 postmaster@HELO）
+	helo     string
+	lookups  int
+	voids    int
+}
+
+// CheckSPF 检查IP是否被允许以 sender 的身份发送邮件（RFC 7208 check_host）
+// domain 为被检查的域名（MAIL FROM的域名，或HELO），返回结果和原因说明
+func (s *Service) CheckSPF(ctx context.Context, ip net.IP, domain, sender, helo string) (string, string) {
+	c := &spfChecker{
+		ctx:      ctx,
+		resolver: s.resolver,
+		ip:       ip,
+		sender:   sender,
+		helo:     helo,
+	}
+
+	result, err := c.checkHost(strings.TrimSuffix(strings.ToLower(domain), "."))
+	if err != nil {
+		var e *spfError
+		if errors.As(err, &e) {
+			return e.result, e.reason
+		}
+		return SPFTempError, err.Error()
+	}
+	return result, ""
+}
+
+// checkHost 评估域名的SPF记录
+func (c *spfChecker) checkHost(domain string) (string, error) {
+	if !isValidDomain(domain) {
+		return SPFNone, nil
+	}
+
+	record, err := c.lookupRecord(domain)
+	if err != nil {
+		return "", err
+	}
+	if record == "" {
+		return SPFNone, nil
+	}
+
+	terms := strings.Fields(record)[1:]
+	var redirect string
+	for _, term := range terms {
+		if name, value, ok := parseModifier(term); ok {
+			if name == "redirect" {
+				if redirect != "" {
+					return "", &spfError{SPFPermError, "duplicate redirect modifier"}
+				}
+				redirect = value
+			}
+			// exp 和未知修饰符忽略
+			continue
+		}
+
+		qualifier := SPFPass
+		switch term[0] {
+		case '+':
+			term = term[1:]
+		case '-':
+			qualifier, term = SPFFail, term[1:]
+		case '~':
+			qualifier, term = SPFSoftFail, term[1:]
+		case '?':
+			qualifier, term = SPFNeutral, term[1:]
+		}
+
+		matched, err := c.matchMechanism(domain, term)
+		if err != nil {
+			return "", err
+		}
+		if matched {
+			return qualifier, nil
+		}
+	}
+
+	if redirect != "" {
+		if err := c.countLookup(); err != nil {
+			return "", err
+		}
+		target, err := c.expand(redirect, domain)
+		if err != nil {
+			return "", err
+		}
+		result, err := c.checkHost(target)
+		if err != nil {
+			return "", err
+		}
+		if result == SPFNone {
+			return "", &spfError{SPFPermError, "no SPF record at redirect target " + target}
+		}
+		return result, nil
+	}
+
+	return SPFNeutral, nil
+}
+
+// matchMechanism 判断IP是否匹配一个机制
+func (c *spfChecker) matchMechanism(domain, term string) (bool, error) {
+	name, arg := term, ""
+	if i := strings.IndexAny(term, ":/"); i >= 0 {
+		name, arg = term[:i], term[i:]
+	}
+	name = strings.ToLower(name)
+
+	switch name {
+	case "all":
+		if arg != "" {
+			return false, &spfError{SPFPermError, "invalid mechanism " + term}
+		}
+		return true, nil
+
+	case "include":
+		if err := c.countLookup(); err != nil {
+			return false, err
+		}
+		target, err := c.targetDomain(arg, domain, true)
+		if err != nil {
+			return false, err
+		}
+		result, err := c.checkHost(target)
+		if err != nil {
+			return false, err
+		}
+		switch result {
+		case SPFPass:
+			return true, nil
+		case SPFNone:
+			return false, &spfError{SPFPermError, "no SPF record at include target " + target}
+		}
+		return false, nil
+
+	case "a", "mx":
+		if err := c.countLookup(); err != nil {
+			return false, err
+		}
+		spec, cidr4, cidr6, err := splitCIDR(arg)
+		if err != nil {
+			return false, err
+		}
+		target, err := c.targetDomain(spec, domain, false)
+		if err != nil {
+			return false, err
+		}
+
+		hosts := []string{target}
+		if name == "mx" {
+			mxs, err := c.resolver.LookupMX(c.ctx, target)
+			if err != nil {
+				if err := c.voidOrTemp(err); err != nil {
+					return false, err
+				}
+				return false, nil
+			}
+			if len(mxs) > spfMaxMXHosts {
+				return false, &spfError{SPFPermError, "too many MX records for " + target}
+			}
+			hosts = hosts[:0]
+			for _, mx := range mxs {
+				hosts = append(hosts, strings.TrimSuffix(mx.Host, "."))
+			}
+		}
+
+		for _, host := range hosts {
+			matched, err := c.matchHost(host, cidr4, cidr6)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+
+	case "ptr":
+		if err := c.countLookup(); err != nil {
+			return false, err
+		}
+		target, err := c.targetDomain(arg, domain, false)
+		if err != nil {
+			return false, err
+		}
+		names, err := c.resolver.LookupAddr(c.ctx, c.ip.String())
+		if err != nil {
+			return false, nil
+		}
+		for i, ptr := range names {
+			if i >= spfMaxLookups {
+				break
+			}
+			ptr = strings.ToLower(strings.TrimSuffix(ptr, "."))
+			if ptr != target && !strings.HasSuffix(ptr, "."+target) {
+				continue
+			}
+			if matched, _ := c.matchHost(ptr, 32, 128); matched {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case "ip4", "ip6":
+		if !strings.HasPrefix(arg, ":") {
+			return false, &spfError{SPFPermError, "invalid mechanism " + term}
+		}
+		network := arg[1:]
+		if !strings.Contains(network, "/") {
+			if name == "ip4" {
+				network += "/32"
+			} else {
+				network += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil || (name == "ip4") != (ipNet.IP.To4() != nil) {
+			return false, &spfError{SPFPermError, "invalid network in " + term}
+		}
+		return ipNet.Contains(c.ip), nil
+
+	case "exists":
+		if err := c.countLookup(); err != nil {
+			return false, err
+		}
+		target, err := c.targetDomain(arg, domain, true)
+		if err != nil {
+			return false, err
+		}
+		ips, err := c.resolver.LookupIP(c.ctx, "ip4", target)
+		if err != nil {
+			return false, c.voidOrTemp(err)
+		}
+		return len(ips) > 0, nil
+	}
+
+	return false, &spfError{SPFPermError, "unknown mechanism " + term}
+}
+
+// matchHost 判断IP是否属于主机的A/AAAA记录（按CIDR前缀长度比较）
+func (c *spfChecker) matchHost(host string, cidr4, cidr6 int) (bool, error) {
+	network, bits, size := "ip6", cidr6, 128
+	if c.ip.To4() != nil {
+		network, bits, size = "ip4", cidr4, 32
+	}
+
+	ips, err := c.resolver.LookupIP(c.ctx, network, host)
+	if err != nil {
+		return false, c.voidOrTemp(err)
+	}
+
+	mask := net.CIDRMask(bits, size)
+	for _, ip := range ips {
+		if c.ip.Mask(mask).Equal(ip.Mask(mask)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// lookupRecord 查询域名的SPF记录，没有时返回空字符串
+func (c *spfChecker) lookupRecord(domain string) (string, error) {
+	txts, err := c.resolver.LookupTXT(c.ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return "", nil
+		}
+		return "", &spfError{SPFTempError, "TXT lookup failed: " + err.Error()}
+	}
+
+	var record string
+	for _, txt := range txts {
+		lower := strings.ToLower(txt)
+		if lower != "v=spf1" && !strings.HasPrefix(lower, "v=spf1 ") {
+			continue
+		}
+		if record != "" {
+			return "", &spfError{SPFPermError, "multiple SPF records for " + domain}
+		}
+		record = txt
+	}
+	return record, nil
+}
+
+// targetDomain 解析机制中的 :domain-spec，省略时使用当前域名
+func (c *spfChecker) targetDomain(arg, domain string, required bool) (string, error) {
+	if arg == "" {
+		if required {
+			return "", &spfError{SPFPermError, "missing domain-spec"}
+		}
+		return domain, nil
+	}
+	if !strings.HasPrefix(arg, ":") || len(arg) == 1 {
+		return "", &spfError{SPFPermError, "invalid domain-spec " + arg}
+	}
+	return c.expand(arg[1:], domain)
+}
+
+func (c *spfChecker) countLookup() error {
+	c.lookups++
+	if c.lookups > spfMaxLookups {
+		return &spfError{SPFPermError, "too many DNS lookups"}
+	}
+	return nil
+}
+
+// voidOrTemp 查询不到记录时计入空查询次数，其他DNS错误返回temperror
+func (c *spfChecker) voidOrTemp(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		c.voids++
+		if c.voids > spfMaxVoidLookups {
+			return &spfError{SPFPermError, "too many void DNS lookups"}
+		}
+		return nil
+	}
+	return &spfError{SPFTempError, err.Error()}
+}
+
+// expand 展开域名中的宏（RFC 7208 7）
+func (c *spfChecker) expand(spec, domain string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			b.WriteByte(spec[i])
+			continue
+		}
+		if i+1 >= len(spec) {
+			return "", &spfError{SPFPermError, "invalid macro in " + spec}
+		}
+		i++
+		switch spec[i] {
+		case '%':
+			b.WriteByte('%')
+		case '_':
+			b.WriteByte(' ')
+		case '-':
+			b.WriteString("%20")
+		case '{':
+			end := strings.IndexByte(spec[i:], '}')
+			if end < 0 {
+				return "", &spfError{SPFPermError, "invalid macro in " + spec}
+			}
+			value, err := c.expandMacro(spec[i+1:i+end], domain)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			i += end
+		default:
+			return "", &spfError{SPFPermError, "invalid macro in " + spec}
+		}
+	}
+
+	expanded := strings.ToLower(strings.TrimSuffix(b.String(), "."))
+	// 超过253个字符时从左侧截断标签
+	for len(expanded) > 253 {
+		dot := strings.IndexByte(expanded, '.')
+		if dot < 0 {
+			break
+		}
+		expanded = expanded[dot+1:]
+	}
+	return expanded, nil
+}
+
+// expandMacro 展开单个宏，如 {ir}、{d2}、{l-}
+func (c *spfChecker) expandMacro(macro, domain string) (string, error) {
+	if macro == "" {
+		return "", &spfError{SPFPermError, "empty macro"}
+	}
+
+	local, senderDomain := "postmaster", c.sender
+	if at := strings.LastIndexByte(c.sender, '@'); at >= 0 {
+		local, senderDomain = c.sender[:at], c.sender[at+1:]
+	}
+
+	var value string
+	switch macro[0] | 0x20 {
+	case 's':
+		value = c.sender
+	case 'l':
+		value = local
+	case 'o':
+		value = senderDomain
+	case 'd':
+		value = domain
+	case 'i':
+		value = spfIPMacro(c.ip)
+	case 'p':
+		value = "unknown"
+	case 'v':
+		value = "in-addr"
+		if c.ip.To4() == nil {
+			value = "ip6"
+		}
+	case 'h':
+		value = c.helo
+	default:
+		return "", &spfError{SPFPermError, "unknown macro " + macro}
+	}
+
+	rest := macro[1:]
+	digits := 0
+	for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+		digits++
+	}
+	keep := 0
+	if digits > 0 {
+		n, err := strconv.Atoi(rest[:digits])
+		if err != nil || n == 0 {
+			return "", &spfError{SPFPermError, "invalid macro in " + macro}
+		}
+		keep = n
+	}
+	rest = rest[digits:]
+	reverse := false
+	if rest != "" && (rest[0]|0x20) == 'r' {
+		reverse = true
+		rest = rest[1:]
+	}
+	delimiters := "."
+	if rest != "" {
+		if strings.Trim(rest, ".-+,/_=") != "" {
+			return "", &spfError{SPFPermError, "invalid macro delimiter in " + macro}
+		}
+		delimiters = rest
+	}
+
+	if keep == 0 && !reverse && delimiters == "." {
+		return value, nil
+	}
+
+	parts := strings.FieldsFunc(value, func(r rune) bool {
+		return strings.ContainsRune(delimiters, r)
+	})
+	if reverse {
+		for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+			parts[i], parts[j] = parts[j], parts[i]
+		}
+	}
+	if keep > 0 && keep < len(parts) {
+		parts = parts[len(parts)-keep:]
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// spfIPMacro IPv4为点分十进制，IPv6为点分隔的半字节（RFC 7208 7.3）
+func spfIPMacro(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	ip16 := ip.To16()
+	nibbles := make([]string, 0, 32)
+	for _, b := range ip16 {
+		nibbles = append(nibbles, fmt.Sprintf("%x", b>>4), fmt.Sprintf("%x", b&0x0f))
+	}
+	return strings.Join(nibbles, ".")
+}
+
+// parseModifier 解析 name=value 形式的修饰符
+func parseModifier(term string) (string, string, bool) {
+	eq := strings.IndexByte(term, '=')
+	if eq <= 0 {
+		return "", "", false
+	}
+	name := term[:eq]
+	for i, r := range name {
+		isAlpha := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isAlpha && (i == 0 || !((r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.')) {
+			return "", "", false
+		}
+	}
+	return strings.ToLower(name), term[eq+1:], true
+}
+
+// splitCIDR 拆分 a/mx 机制中的 :domain/cidr4//cidr6
+func splitCIDR(arg string) (string, int, int, error) {
+	cidr4, cidr6 := 32, 128
+	if i := strings.Index(arg, "//"); i >= 0 {
+		n, err := strconv.Atoi(arg[i+2:])
+		if err != nil || n < 0 || n > 128 {
+			return "", 0, 0, &spfError{SPFPermError, "invalid IPv6 prefix length in " + arg}
+		}
+		cidr6, arg = n, arg[:i]
+	}
+	if i := strings.IndexByte(arg, '/'); i >= 0 {
+		n, err := strconv.Atoi(arg[i+1:])
+		if err != nil || n < 0 || n > 32 {
+			return "", 0, 0, &spfError{SPFPermError, "invalid IPv4 prefix length in " + arg}
+		}
+		cidr4, arg = n, arg[:i]
+	}
+	return arg, cidr4, cidr6, nil
+}
+
+// isValidDomain 检查是否为可以查询的完整域名
+func isValidDomain(domain string) bool {
+	if domain == "" || len(domain) > 253 || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package mailauth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestSPFMacroExpand(t *testing.T) {
+	// RFC 7208 7.4 的示例
+	c := &spfChecker{
+		ip:     net.ParseIP("192.0.2.3"),
+		sender: "strong-bad@email.example.com",
+		helo:   "mx.example.org",
+	}
+	c6 := &spfChecker{
+		ip:     net.ParseIP("2001:db8::cb01"),
+		sender: "strong-bad@email.example.com",
+	}
+
+	tests := []struct {
+		name    string
+		checker *spfChecker
+		spec    string
+		want    string
+	}{
+		{"sender", c, "%{s}", "strong-bad@email.example.com"},
+		{"sender域名", c, "%{o}", "email.example.com"},
+		{"当前域名", c, "%{d}", "email.example.com"},
+		{"保留的标签数多于实际", c, "%{d4}", "email.example.com"},
+		{"保留全部标签", c, "%{d3}", "email.example.com"},
+		{"保留右侧两个标签", c, "%{d2}", "example.com"},
+		{"保留右侧一个标签", c, "%{d1}", "com"},
+		{"反转", c, "%{dr}", "com.example.email"},
+		{"反转后保留两个标签", c, "%{d2r}", "example.email"},
+		{"用户名", c, "%{l}", "strong-bad"},
+		{"按-拆分用户名", c, "%{l-}", "strong.bad"},
+		{"按.反转用户名", c, "%{lr}", "strong-bad"},
+		{"按-反转用户名", c, "%{lr-}", "bad.strong"},
+		{"按-反转后保留一个标签", c, "%{l1r-}", "strong"},
+		{"IPv4反转", c, "%{ir}.%{v}._spf.%{d2}", "3.2.0.192.in-addr._spf.example.com"},
+		{"用户名组合", c, "%{lr-}.lp._spf.%{d2}", "bad.strong.lp._spf.example.com"},
+		{"多个宏", c, "%{lr-}.lp.%{ir}.%{v}._spf.%{d2}", "bad.strong.lp.3.2.0.192.in-addr._spf.example.com"},
+		{"IP宏", c, "%{ir}.%{v}.%{l1r-}.lp._spf.%{d2}", "3.2.0.192.in-addr.strong.lp._spf.example.com"},
+		{"按.反转域名", c, "%{d2}.trusted-domains.example.net", "example.com.trusted-domains.example.net"},
+		{"大写宏", c, "%{D2}", "example.com"},
+		{"HELO", c, "%{h}", "mx.example.org"},
+		{"转义字符", c, "a%%b%_c%-d", "a%b c%20d"},
+		{"IPv6反转", c6, "%{ir}.%{v}._spf.%{d2}", "1.0.b.c.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6._spf.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.checker.expand(tt.spec, "email.example.com")
+			if err != nil {
+				t.Fatalf("expand(%q) 失败: %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("expand(%q) = %q，期望 %q", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSPFMacroExpandInvalid(t *testing.T) {
+	c := &spfChecker{ip: net.ParseIP("192.0.2.3"), sender: "user@example.com"}
+
+	for _, spec := range []string{"%", "%{", "%{}", "%{x}", "%{d0}", "%{d2x}", "%{l:}", "%a"} {
+		_, err := c.expand(spec, "example.com")
+		var e *spfError
+		if !errors.As(err, &e) || e.result != SPFPermError {
+			t.Errorf("expand(%q) 错误 = %v，期望 permerror", spec, err)
+		}
+	}
+}
+
+func TestCheckSPF(t *testing.T) {
+	dns := &fakeDNS{
+		txt: map[string][]string{
+			// include：被包含的记录pass时匹配，fail/softfail/neutral时继续
+			"include.test":       {"v=spf1 include:_spf.provider.test -all"},
+			"_spf.provider.test": {"v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 -all"},
+			"softinclude.test":   {"v=spf1 include:_spf.provider.test ~all"},
+			"nested.test":        {"v=spf1 include:include.test -all"},
+			"missing.test":       {"v=spf1 include:_spf.none.test -all"},
+			"failinclude.test":   {"v=spf1 include:_spf.deny.test ?all"},
+			"_spf.deny.test":     {"v=spf1 -all"},
+
+			// 宏：按IP查询exists，按域名include
+			"exists.test":            {"v=spf1 exists:%{ir}.%{l1r-}.allow.exists.test -all"},
+			"macroinclude.test":      {"v=spf1 include:_spf.%{d2} -all"},
+			"_spf.macroinclude.test": {"v=spf1 ip4:198.51.100.7 -all"},
+			"redirect.test":          {"v=spf1 redirect=_spf.provider.test"},
+			"redirectnone.test":      {"v=spf1 redirect=_spf.none.test"},
+			"a.test":                 {"v=spf1 a/24 -all"},
+			"mx.test":                {"v=spf1 mx -all"},
+			"multiple.test":          {"v=spf1 -all", "v=spf1 +all"},
+			"unknown.test":           {"v=spf1 foo:bar -all"},
+			"loop.test":              {"v=spf1 include:loop.test -all"},
+			"badmacro.test":          {"v=spf1 include:%{x} -all"},
+			"other.txt.test":         {"google-site-verification=abc"},
+		},
+		ip: map[string][]net.IP{
+			"10.2.0.192.strong.allow.exists.test": {net.ParseIP("127.0.0.2")},
+			"a.test":                              {net.ParseIP("203.0.113.1")},
+			"mail.mx.test":                        {net.ParseIP("203.0.113.50")},
+		},
+		mx: map[string][]string{
+			"mx.test": {"mail.mx.test"},
+		},
+	}
+	s := newTestService(t, dns)
+
+	tests := []struct {
+		name   string
+		ip     string
+		domain string
+		sender string
+		want   string
+	}{
+		{"include匹配", "192.0.2.10", "include.test", "", SPFPass},
+		{"include的IPv6匹配", "2001:db8::1", "include.test", "", SPFPass},
+		{"include不匹配时继续", "198.51.100.1", "include.test", "", SPFFail},
+		{"include不匹配时softfail", "198.51.100.1", "softinclude.test", "", SPFSoftFail},
+		{"嵌套include", "192.0.2.10", "nested.test", "", SPFPass},
+		{"include目标fail时不匹配", "192.0.2.10", "failinclude.test", "", SPFNeutral},
+		{"include目标没有记录", "192.0.2.10", "missing.test", "", SPFPermError},
+		{"exists宏匹配", "192.0.2.10", "exists.test", "strong-bad@exists.test", SPFPass},
+		{"exists宏用户名不匹配", "192.0.2.10", "exists.test", "weak-bad@exists.test", SPFFail},
+		{"exists宏IP不匹配", "192.0.2.11", "exists.test", "strong-bad@exists.test", SPFFail},
+		{"include宏", "198.51.100.7", "macroinclude.test", "", SPFPass},
+		{"redirect", "192.0.2.10", "redirect.test", "", SPFPass},
+		{"redirect不匹配", "198.51.100.1", "redirect.test", "", SPFFail},
+		{"redirect目标没有记录", "192.0.2.10", "redirectnone.test", "", SPFPermError},
+		{"a机制CIDR", "203.0.113.200", "a.test", "", SPFPass},
+		{"a机制不匹配", "203.0.114.1", "a.test", "", SPFFail},
+		{"mx机制", "203.0.113.50", "mx.test", "", SPFPass},
+		{"mx机制不匹配", "203.0.113.51", "mx.test", "", SPFFail},
+		{"多条SPF记录", "192.0.2.10", "multiple.test", "", SPFPermError},
+		{"未知机制", "192.0.2.10", "unknown.test", "", SPFPermError},
+		{"include循环超过查询次数", "192.0.2.10", "loop.test", "", SPFPermError},
+		{"无效的宏", "192.0.2.10", "badmacro.test", "", SPFPermError},
+		{"没有SPF记录", "192.0.2.10", "other.txt.test", "", SPFNone},
+		{"域名不存在", "192.0.2.10", "nxdomain.test", "", SPFNone},
+		{"无效的域名", "192.0.2.10", "not_a_domain", "", SPFNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := tt.sender
+			if sender == "" {
+				sender = "postmaster@" + tt.domain
+			}
+			got, reason := s.CheckSPF(context.Background(), net.ParseIP(tt.ip), tt.domain, sender, "mx.sender.test")
+			if got != tt.want {
+				t.Errorf("CheckSPF(%s, %s) = %s (%s)，期望 %s", tt.ip, tt.domain, got, reason, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package mailbox
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+)
+
+// maxGroupMembers 群组最多的成员数量
+const maxGroupMembers = 50
+
+// AliasRequest 创建或更新别名的参数
+type AliasRequest struct {
+	Type      string   // alias/group
+	MailboxID int64    // 别名投递的邮箱ID
+	Members   []string // 群组成员
+}
+
+// GetAliases 获取用户的别名和群组
+func (s *Service) GetAliases(userID int64, isAdmin bool) ([]*model.MailAlias, error) {
+	aliases, err := s.svcCtx.MailAliasModel.GetByOwner(userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if aliases == nil {
+		aliases = []*model.MailAlias{}
+	}
+	return aliases, nil
+}
+
+// CreateAlias 创建别名或群组
+func (s *Service) CreateAlias(userID int64, isAdmin bool, prefix string, domainID int64, req *AliasRequest) (*model.MailAlias, error) {
+	domain, err := s.svcCtx.DomainModel.GetById(domainID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("域名不存在或已禁用")
+		}
+		return nil, err
+	}
+	if !domain.IsActive {
+		return nil, fmt.Errorf("域名不存在或已禁用")
+	}
+
+	fullEmail := strings.ToLower(fmt.Sprintf("%s@%s", prefix, domain.Name))
+	if err := s.checkAddressAvailable(fullEmail); err != nil {
+		return nil, err
+	}
+	if err := s.checkMailboxQuota(userID, isAdmin, 1); err != nil {
+		return nil, err
+	}
+
+	alias := &model.MailAlias{
+		Email:     fullEmail,
+		DomainId:  domainID,
+		Type:      req.Type,
+		IsActive:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if isAdmin {
+		alias.AdminId = &userID
+	} else {
+		alias.UserId = &userID
+	}
+	if err := s.applyAliasRequest(alias, userID, isAdmin, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.svcCtx.MailAliasModel.Create(nil, alias); err != nil {
+		return nil, err
+	}
+	return alias, nil
+}
+
+// UpdateAlias 修改别名投递的邮箱或群组成员（类型不能修改）
+func (s *Service) UpdateAlias(aliasID, userID int64, isAdmin bool, req *AliasRequest) (*model.MailAlias, error) {
+	alias, err := s.getOwnedAlias(aliasID, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Type = alias.Type
+	if err := s.applyAliasRequest(alias, userID, isAdmin, req); err != nil {
+		return nil, err
+	}
+
+	alias.UpdatedAt = time.Now()
+	if err := s.svcCtx.MailAliasModel.MapUpdate(nil, alias.Id, map[string]interface{}{
+		"mailbox_id": alias.MailboxId,
+		"members":    alias.Members,
+		"updated_at": alias.UpdatedAt,
+	}); err != nil {
+		return nil, err
+	}
+	return alias, nil
+}
+
+// DeleteAlias 删除别名或群组
+func (s *Service) DeleteAlias(aliasID, userID int64, isAdmin bool) error {
+	if _, err := s.getOwnedAlias(aliasID, userID, isAdmin); err != nil {
+		return err
+	}
+	return s.svcCtx.MailAliasModel.Delete(nil, aliasID)
+}
+
+// GetAllAliases 获取所有别名和群组（管理员）
+func (s *Service) GetAllAliases() ([]*model.MailAlias, error) {
+	aliases, err := s.svcCtx.MailAliasModel.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if aliases == nil {
+		aliases = []*model.MailAlias{}
+	}
+	return aliases, nil
+}
+
+// UpdateAliasStatus 启用或停用别名（管理员）
+func (s *Service) UpdateAliasStatus(aliasID int64, isActive bool) error {
+	if _, err := s.getAlias(aliasID); err != nil {
+		return err
+	}
+	return s.svcCtx.MailAliasModel.MapUpdate(nil, aliasID, map[string]interface{}{
+		"is_active":  isActive,
+		"updated_at": time.Now(),
+	})
+}
+
+// DeleteAliasAdmin 删除别名或群组（管理员）
+func (s *Service) DeleteAliasAdmin(aliasID int64) error {
+	if _, err := s.getAlias(aliasID); err != nil {
+		return err
+	}
+	return s.svcCtx.MailAliasModel.Delete(nil, aliasID)
+}
+
+// applyAliasRequest 校验并设置别名投递的邮箱（必须是自己的邮箱）或群组成员
+func (s *Service) applyAliasRequest(alias *model.MailAlias, userID int64, isAdmin bool, req *AliasRequest) error {
+	switch req.Type {
+	case model.AliasTypeAlias:
+		mailbox, err := s.svcCtx.MailboxModel.GetById(req.MailboxID)
+		if err != nil || !mailbox.IsActive {
+			return fmt.Errorf("邮箱不存在")
+		}
+		if !ownsMailbox(mailbox, userID, isAdmin) {
+			return fmt.Errorf("无权限使用此邮箱")
+		}
+		alias.MailboxId = mailbox.Id
+		alias.Members = ""
+	case model.AliasTypeGroup:
+		members, err := normalizeGroupMembers(alias.Email, req.Members)
+		if err != nil {
+			return err
+		}
+		alias.MailboxId = 0
+		alias.Members = strings.Join(members, ",")
+	default:
+		return fmt.Errorf("无效的类型: %s", req.Type)
+	}
+	return nil
+}
+
+// normalizeGroupMembers 校验群组成员地址，转为小写并去重
+func normalizeGroupMembers(group string, members []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	for _, member := range members {
+		member = strings.ToLower(strings.TrimSpace(member))
+		if member == "" || seen[member] {
+			continue
+		}
+		at := strings.LastIndexByte(member, '@')
+		if at <= 0 || !strings.Contains(member[at+1:], ".") || strings.ContainsAny(member, " ,<>") {
+			return nil, fmt.Errorf("无效的成员地址: %s", member)
+		}
+		if member == group {
+			return nil, fmt.Errorf("群组不能包含自己")
+		}
+		seen[member] = true
+		result = append(result, member)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("群组至少需要一个成员")
+	}
+	if len(result) > maxGroupMembers {
+		return nil, fmt.Errorf("群组成员不能超过%d个", maxGroupMembers)
+	}
+	return result, nil
+}
+
+// checkAddressAvailable 检查地址是否已被邮箱或别名使用
+func (s *Service) checkAddressAvailable(email string) error {
+	exists, err := s.svcCtx.MailboxModel.CheckEmailExist(email)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		exists, err = s.svcCtx.MailAliasModel.CheckEmailExist(email)
+		if err != nil {
+			return err
+		}
+	}
+	if exists {
+		return fmt.Errorf("邮箱已存在")
+	}
+	return nil
+}
+
+// checkMailboxQuota 检查普通用户再创建 adding 个邮箱或别名后是否超过 email.max_mailboxes_per_user
+func (s *Service) checkMailboxQuota(userID int64, isAdmin bool, adding int) error {
+	if isAdmin {
+		return nil
+	}
+
+	mailboxes, err := s.svcCtx.MailboxModel.CountMailboxesByUserId(userID)
+	if err != nil {
+		return err
+	}
+	aliases, err := s.svcCtx.MailAliasModel.CountByUserId(userID)
+	if err != nil {
+		return err
+	}
+
+	limit := config.GetMaxMailboxesPerUser()
+	if mailboxes+aliases+int64(adding) > int64(limit) {
+		return fmt.Errorf("邮箱数量（包括别名）已达到上限 %d 个", limit)
+	}
+	return nil
+}
+
+func (s *Service) getAlias(aliasID int64) (*model.MailAlias, error) {
+	alias, err := s.svcCtx.MailAliasModel.GetById(aliasID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("别名不存在")
+		}
+		return nil, err
+	}
+	return alias, nil
+}
+
+func (s *Service) getOwnedAlias(aliasID, userID int64, isAdmin bool) (*model.MailAlias, error) {
+	alias, err := s.getAlias(aliasID)
+	if err != nil {
+		return nil, err
+	}
+
+	if isAdmin {
+		if alias.AdminId == nil || *alias.AdminId != userID {
+			return nil, fmt.Errorf("无权限访问此别名")
+		}
+	} else {
+		if alias.UserId == nil || *alias.UserId != userID {
+			return nil, fmt.Errorf("无权限访问此别名")
+		}
+	}
+	return alias, nil
+}
+
+func ownsMailbox(mailbox *model.Mailbox, userID int64, isAdmin bool) bool {
+	if isAdmin {
+		return mailbox.AdminId != nil && *mailbox.AdminId == userID
+	}
+	return mailbox.UserId != nil && *mailbox.UserId == userID
+}
@@ -3,11 +3,13 @@ package mailbox
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"miko-email/internal/model"
+	"miko-email/internal/services/attachment"
 	"miko-email/internal/svc"
 )
 
@@ -111,13 +113,12 @@ func (s *Service) CreateMailboxWithPassword(userID int64, prefix string, passwor
 
 	fullEmail := fmt.Sprintf("%s@%s", prefix, domain.Name)
 
-	// 检查邮箱是否已存在
-	exists, err := s.svcCtx.MailboxModel.CheckEmailExist(fullEmail)
-	if err != nil {
+	// 检查邮箱（或别名）是否已存在
+	if err := s.checkAddressAvailable(fullEmail); err != nil {
 		return nil, err
 	}
-	if exists {
-		return nil, fmt.Errorf("邮箱已存在")
+	if err := s.checkMailboxQuota(userID, isAdmin, 1); err != nil {
+		return nil, err
 	}
 
 	// 创建邮箱
@@ -175,9 +176,18 @@ func (s *Service) BatchCreateMailboxes(userID int64, prefixes []string, domainID
 		if err != nil {
 			return nil, err
 		}
+		if !exists {
+			exists, err = s.svcCtx.MailAliasModel.CheckEmailExist(fullEmail)
+			if err != nil {
+				return nil, err
+			}
+		}
 		if exists {
 			continue // 跳过已存在的邮箱
 		}
+		if err := s.checkMailboxQuota(userID, isAdmin, len(mailboxes)+1); err != nil {
+			return nil, err
+		}
 
 		// 生成邮箱密码
 		password := uuid.New().String()[:8]
@@ -230,6 +240,56 @@ func (s *Service) GetMailboxByEmail(email string) (*model.Mailbox, error) {
 	return mailbox, nil
 }
 
+// GetSenderMailbox 获取可以使用指定发件地址的邮箱：邮箱本身，或别名投递到的邮箱（群组不能作为发件地址）
+func (s *Service) GetSenderMailbox(email string) (*model.Mailbox, error) {
+	mailbox, err := s.GetMailboxByEmail(email)
+	if err == nil {
+		return mailbox, nil
+	}
+
+	alias, aliasErr := s.svcCtx.MailAliasModel.GetByEmail(strings.ToLower(email))
+	if aliasErr != nil || alias.Type != model.AliasTypeAlias || !alias.IsActive {
+		return nil, err
+	}
+	mailbox, err = s.svcCtx.MailboxModel.GetById(alias.MailboxId)
+	if err != nil || !mailbox.IsActive {
+		return nil, fmt.Errorf("邮箱不存在")
+	}
+	return mailbox, nil
+}
+
+// IsLocalAddress 是否为本系统可以接收的地址（邮箱、子地址、别名或群组）
+func (s *Service) IsLocalAddress(email string) bool {
+	if _, _, err := s.GetMailboxBySubaddress(email); err == nil {
+		return true
+	}
+	base, _ := s.svcCtx.MailboxModel.SplitSubaddress(strings.ToLower(email))
+	for _, address := range []string{strings.ToLower(email), base} {
+		if alias, err := s.svcCtx.MailAliasModel.GetByEmail(address); err == nil && alias.IsActive {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMailboxBySubaddress 根据邮箱地址获取邮箱，支持子地址 user+tag@domain（返回 user@domain 的邮箱和标签 tag）
+func (s *Service) GetMailboxBySubaddress(email string) (*model.Mailbox, string, error) {
+	mailbox, err := s.GetMailboxByEmail(email)
+	if err == nil {
+		return mailbox, "", nil
+	}
+
+	base, tag := s.svcCtx.MailboxModel.SplitSubaddress(email)
+	if base == email {
+		return nil, "", err
+	}
+	mailbox, err = s.GetMailboxByEmail(base)
+	if err != nil {
+		return nil, "", err
+	}
+	return mailbox, tag, nil
+}
+
 // GetMailboxPassword 获取邮箱密码
 func (s *Service) GetMailboxPassword(mailboxID int64, userID int64, isAdmin bool) (string, error) {
 	// 获取邮箱信息
@@ -285,6 +345,12 @@ func (s *Service) DeleteMailbox(mailboxID int64, userID int64, isAdmin bool) err
 		}
 	}
 
+	// 记录附件文件位置，事务提交后清理
+	attachmentPaths, err := s.svcCtx.AttachmentModel.GetStoragePathsByMailboxId(mailboxID)
+	if err != nil {
+		return err
+	}
+
 	// 开始事务
 	tx := s.svcCtx.DB.Begin()
 	defer func() {
@@ -293,6 +359,17 @@ func (s *Service) DeleteMailbox(mailboxID int64, userID int64, isAdmin bool) err
 		}
 	}()
 
+	// 删除相关邮件附件和原文
+	if err := s.svcCtx.AttachmentModel.DeleteByMailboxId(tx, mailboxID); err != nil {
+		return err
+	}
+	if err := s.svcCtx.EmailRawModel.DeleteByMailboxId(tx, mailboxID); err != nil {
+		return err
+	}
+	if err := s.svcCtx.FolderModel.DeleteByMailboxId(tx, mailboxID); err != nil {
+		return err
+	}
+
 	// 删除相关邮件
 	if err := tx.Where("mailbox_id = ?", mailboxID).Delete(&model.Email{}).Error; err != nil {
 		return err
@@ -303,6 +380,16 @@ func (s *Service) DeleteMailbox(mailboxID int64, userID int64, isAdmin bool) err
 		return err
 	}
 
+	// 删除投递到该邮箱的别名
+	if err := s.svcCtx.MailAliasModel.DeleteByMailboxId(tx, mailboxID); err != nil {
+		return err
+	}
+
+	// 删除Sieve脚本
+	if err := s.svcCtx.SieveScriptModel.DeleteByMailboxId(tx, mailboxID); err != nil {
+		return err
+	}
+
 	// 删除邮箱
 	if err := s.svcCtx.MailboxModel.Delete(tx, mailbox); err != nil {
 		return err
@@ -313,6 +400,8 @@ func (s *Service) DeleteMailbox(mailboxID int64, userID int64, isAdmin bool) err
 	}
 	tx = nil
 
+	attachment.NewService(s.svcCtx).RemoveUnreferencedFiles(attachmentPaths)
+
 	return nil
 }
 
@@ -380,6 +469,12 @@ func (s *Service) UpdateMailboxStatus(mailboxID int64, status string) error {
 
 // DeleteMailboxAdmin 删除邮箱（管理员）
 func (s *Service) DeleteMailboxAdmin(mailboxID int64) error {
+	// 记录附件文件位置，事务提交后清理
+	attachmentPaths, err := s.svcCtx.AttachmentModel.GetStoragePathsByMailboxId(mailboxID)
+	if err != nil {
+		return err
+	}
+
 	// 开始事务
 	tx := s.svcCtx.DB.Begin()
 	defer func() {
@@ -388,6 +483,17 @@ func (s *Service) DeleteMailboxAdmin(mailboxID int64) error {
 		}
 	}()
 
+	// 删除相关邮件附件和原文
+	if err := s.svcCtx.AttachmentModel.DeleteByMailboxId(tx, mailboxID); err != nil {
+		return err
+	}
+	if err := s.svcCtx.EmailRawModel.DeleteByMailboxId(tx, mailboxID); err != nil {
+		return err
+	}
+	if err := s.svcCtx.FolderModel.DeleteByMailboxId(tx, mailboxID); err != nil {
+		return err
+	}
+
 	// 删除相关邮件
 	if err := tx.Where("mailbox_id = ?", mailboxID).Delete(&model.Email{}).Error; err != nil {
 		return err
@@ -398,6 +504,16 @@ func (s *Service) DeleteMailboxAdmin(mailboxID int64) error {
 		return err
 	}
 
+	// 删除投递到该邮箱的别名
+	if err := s.svcCtx.MailAliasModel.DeleteByMailboxId(tx, mailboxID); err != nil {
+		return err
+	}
+
+	// 删除Sieve脚本
+	if err := s.svcCtx.SieveScriptModel.DeleteByMailboxId(tx, mailboxID); err != nil {
+		return err
+	}
+
 	// 删除邮箱
 	if err := s.svcCtx.MailboxModel.HardDelete(tx, mailboxID); err != nil {
 		return err
@@ -408,6 +524,8 @@ func (s *Service) DeleteMailboxAdmin(mailboxID int64) error {
 	}
 	tx = nil
 
+	attachment.NewService(s.svcCtx).RemoveUnreferencedFiles(attachmentPaths)
+
 	return nil
 }
 
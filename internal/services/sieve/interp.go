@@ -0,0 +1,472 @@
+package sieve
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxVariableSize 变量值的最大长度（字节，RFC 5229 要求至少支持4000）
+const maxVariableSize = 4096
+
+// FileInto 放入指定文件夹
+type FileInto struct {
+	Folder string   // 文件夹名（IMAP名称，如 INBOX、Junk、Work/Reports）
+	Create bool     // 文件夹不存在时创建（:create）
+	Flags  []string // IMAP标志
+}
+
+// Vacation 自动回复
+type Vacation struct {
+	Days      int64    // 同一发件人多少天内只回复一次
+	Subject   string   // 回复主题，为空时使用 "Auto: 原主题"
+	From      string   // 回复的发件人，为空时使用收件邮箱
+	Addresses []string // 收件邮箱的其他地址（判断邮件是否直接发给自己）
+	Mime      bool     // Reason 是否为完整的MIME实体
+	Handle    string   // 区分不同自动回复的标识
+	Reason    string   // 回复内容
+}
+
+// Result 脚本执行结果
+type Result struct {
+	Keep      bool       // 放入默认文件夹（显式 keep 或隐式 keep）
+	KeepFlags []string   // 放入默认文件夹时设置的IMAP标志
+	FileInto  []FileInto // 放入的其他文件夹
+	Redirects []string   // 转发的地址
+	Reject    bool       // 是否拒收
+	Reason    string     // 拒收原因
+	Vacation  *Vacation  // 自动回复，没有时为nil
+}
+
+// Options 执行选项
+type Options struct {
+	MaxRedirects int // 最多转发的地址数量，0表示不限制
+}
+
+// runtime 执行脚本的状态
+type runtime struct {
+	script    *Script
+	msg       *Message
+	opts      Options
+	result    *Result
+	implicit  bool              // 隐式 keep 是否仍然有效
+	vars      map[string]string // 变量（名称已转为小写）
+	matchVars []string          // 最近一次 :matches 成功的匹配变量
+	flags     []string          // imap4flags 的内部标志变量
+}
+
+// errStop stop 命令结束执行
+var errStop = fmt.Errorf("stop")
+
+// Execute 对邮件执行脚本，出错时返回错误（调用方应执行隐式 keep）
+func (s *Script) Execute(msg *Message, opts Options) (*Result, error) {
+	r := &runtime{
+		script:   s,
+		msg:      msg,
+		opts:     opts,
+		result:   &Result{},
+		implicit: true,
+		vars:     make(map[string]string),
+	}
+	if err := r.run(s.commands); err != nil && err != errStop {
+		return nil, err
+	}
+
+	if r.implicit {
+		r.result.Keep = true
+		if r.result.KeepFlags == nil {
+			r.result.KeepFlags = r.flags
+		}
+	}
+	if r.result.Reject && (r.result.Keep || len(r.result.FileInto) > 0 || len(r.result.Redirects) > 0 || r.result.Vacation != nil) {
+		return nil, fmt.Errorf("reject cannot be combined with keep, fileinto, redirect or vacation")
+	}
+	return r.result, nil
+}
+
+func (r *runtime) run(commands []command) error {
+	for _, cmd := range commands {
+		if err := r.execute(cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *runtime) execute(cmd command) error {
+	switch cmd := cmd.(type) {
+	case *cmdIf:
+		for i, t := range cmd.tests {
+			ok, err := r.evaluate(t)
+			if err != nil {
+				return err
+			}
+			if ok {
+				return r.run(cmd.blocks[i])
+			}
+		}
+		return r.run(cmd.orElse)
+	case *cmdStop:
+		return errStop
+	case *cmdDiscard:
+		r.implicit = false
+	case *cmdKeep:
+		r.result.Keep = true
+		r.result.KeepFlags = r.flagsFor(cmd.flags)
+		r.implicit = false
+	case *cmdFileInto:
+		folder := r.expand(cmd.folder)
+		if folder == "" {
+			return fmt.Errorf("fileinto: empty folder name")
+		}
+		flags := r.flagsFor(cmd.flags)
+		for i := range r.result.FileInto {
+			// 同一文件夹只放入一次
+			if strings.EqualFold(r.result.FileInto[i].Folder, folder) {
+				r.result.FileInto[i].Flags = flags
+				r.result.FileInto[i].Create = r.result.FileInto[i].Create || cmd.create
+				folder = ""
+				break
+			}
+		}
+		if folder != "" {
+			r.result.FileInto = append(r.result.FileInto, FileInto{Folder: folder, Create: cmd.create, Flags: flags})
+		}
+		if !cmd.copy {
+			r.implicit = false
+		}
+	case *cmdRedirect:
+		address := r.expand(cmd.address)
+		if !validAddress(address) {
+			return fmt.Errorf("redirect: invalid address %q", address)
+		}
+		duplicate := false
+		for _, existing := range r.result.Redirects {
+			if strings.EqualFold(existing, address) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			if r.opts.MaxRedirects > 0 && len(r.result.Redirects) >= r.opts.MaxRedirects {
+				return fmt.Errorf("redirect: too many redirects (max %d)", r.opts.MaxRedirects)
+			}
+			r.result.Redirects = append(r.result.Redirects, address)
+		}
+		if !cmd.copy {
+			r.implicit = false
+		}
+	case *cmdReject:
+		r.result.Reject = true
+		r.result.Reason = r.expand(cmd.reason)
+		r.implicit = false
+	case *cmdVacation:
+		if r.result.Vacation != nil {
+			return fmt.Errorf("vacation: only one vacation action is allowed")
+		}
+		v := &Vacation{
+			Days:    cmd.days,
+			Subject: r.expand(cmd.subject),
+			From:    r.expand(cmd.from),
+			Mime:    cmd.mime,
+			Handle:  r.expand(cmd.handle),
+			Reason:  r.expand(cmd.reason),
+		}
+		for _, address := range cmd.addresses {
+			v.Addresses = append(v.Addresses, r.expand(address))
+		}
+		if v.Handle == "" {
+			// 没有 :handle 时按回复参数生成（RFC 5230 4.2），修改回复内容后重新回复
+			sum := sha256.Sum256([]byte(v.Subject + "\x00" + v.From + "\x00" + v.Reason + "\x00" + strconv.FormatBool(v.Mime)))
+			v.Handle = hex.EncodeToString(sum[:16])
+		}
+		r.result.Vacation = v
+	case *cmdSet:
+		value := r.expand(cmd.value)
+		for _, modifier := range cmd.modifiers {
+			value = applyModifier(modifier, value)
+		}
+		r.setVariable(cmd.name, value)
+	case *cmdFlag:
+		current := r.flags
+		if cmd.variable != "" {
+			current = parseFlags([]string{r.vars[cmd.variable]})
+		}
+		flags := parseFlags(r.expandList(cmd.flags))
+		switch cmd.action {
+		case "setflag":
+			current = flags
+		case "addflag":
+			current = parseFlags(append(append([]string{}, current...), flags...))
+		case "removeflag":
+			current = removeFlags(current, flags)
+		}
+		if cmd.variable != "" {
+			r.setVariable(cmd.variable, strings.Join(current, " "))
+		} else {
+			r.flags = current
+		}
+	default:
+		return fmt.Errorf("unknown command %T", cmd)
+	}
+	return nil
+}
+
+func (r *runtime) evaluate(t test) (bool, error) {
+	switch t := t.(type) {
+	case *testTrue:
+		return true, nil
+	case *testFalse:
+		return false, nil
+	case *testNot:
+		ok, err := r.evaluate(t.test)
+		return !ok, err
+	case *testAllOf:
+		for _, child := range t.tests {
+			if ok, err := r.evaluate(child); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case *testAnyOf:
+		for _, child := range t.tests {
+			if ok, err := r.evaluate(child); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case *testAddress:
+		var values []string
+		for _, header := range r.expandList(t.headers) {
+			for _, address := range r.msg.Addresses(header) {
+				values = append(values, addressPart(address, t.part))
+			}
+		}
+		return r.matchAny(t.matcher, values, t.keys), nil
+	case *testEnvelope:
+		var values []string
+		for _, part := range r.expandList(t.parts) {
+			switch strings.ToLower(part) {
+			case "from":
+				// 空信封发件人只匹配空字符串
+				values = append(values, addressPart(r.msg.EnvelopeFrom, t.part))
+			case "to":
+				values = append(values, addressPart(r.msg.EnvelopeTo, t.part))
+			}
+		}
+		return r.matchAny(t.matcher, values, t.keys), nil
+	case *testHeader:
+		var values []string
+		for _, header := range r.expandList(t.headers) {
+			values = append(values, r.msg.HeaderValues(header)...)
+		}
+		return r.matchAny(t.matcher, values, t.keys), nil
+	case *testExists:
+		for _, header := range r.expandList(t.headers) {
+			if !r.msg.HasHeader(header) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case *testSize:
+		if t.over {
+			return r.msg.Size() > t.limit, nil
+		}
+		return r.msg.Size() < t.limit, nil
+	case *testBody:
+		var values []string
+		switch t.transform {
+		case "raw":
+			values = []string{r.msg.RawBody()}
+		case "content":
+			values = r.msg.ContentParts(r.expandList(t.contentTypes))
+		default:
+			values = []string{r.msg.TextBody()}
+		}
+		return r.matchAny(t.matcher, values, t.keys), nil
+	case *testString:
+		return r.matchAny(t.matcher, r.expandList(t.sources), t.keys), nil
+	case *testHasFlag:
+		flags := r.flags
+		if len(t.variables) > 0 {
+			var values []string
+			for _, name := range t.variables {
+				values = append(values, r.vars[name])
+			}
+			flags = parseFlags(values)
+		}
+		return r.matchAny(t.matcher, flags, t.keys), nil
+	}
+	return false, fmt.Errorf("unknown test %T", t)
+}
+
+// matchAny 任意值匹配任意关键字时为真，:matches 成功时更新匹配变量
+func (r *runtime) matchAny(m matcher, values, keys []string) bool {
+	keys = r.expandList(keys)
+	for _, value := range values {
+		for _, key := range keys {
+			if ok, vars := m.match(value, key); ok {
+				if m.matchType == matchMatches {
+					r.matchVars = vars
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expand 展开字符串中的 ${name} 和 ${0}-${9}（需要 require "variables"），未定义的变量展开为空
+func (r *runtime) expand(s string) string {
+	if !r.script.variables || !strings.Contains(s, "${") {
+		return s
+	}
+
+	var sb strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			sb.WriteString(s)
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			sb.WriteString(s)
+			break
+		}
+		name := s[start+2 : start+end]
+
+		value, ok := r.lookup(name)
+		if !ok {
+			// 不是合法的变量引用，原样保留 "${" 继续查找
+			sb.WriteString(s[:start+2])
+			s = s[start+2:]
+			continue
+		}
+		sb.WriteString(s[:start])
+		sb.WriteString(value)
+		s = s[start+end+1:]
+	}
+	return truncate(sb.String(), maxVariableSize)
+}
+
+// lookup 获取变量的值，name 不是合法的变量名时返回false
+func (r *runtime) lookup(name string) (string, bool) {
+	if name != "" && strings.Trim(name, "0123456789") == "" {
+		n, err := strconv.Atoi(name)
+		if err != nil {
+			return "", true
+		}
+		if n < len(r.matchVars) {
+			return r.matchVars[n], true
+		}
+		return "", true
+	}
+	if !validVariableName(name) {
+		return "", false
+	}
+	return r.vars[strings.ToLower(name)], true
+}
+
+func (r *runtime) expandList(list []string) []string {
+	if !r.script.variables {
+		return list
+	}
+	expanded := make([]string, len(list))
+	for i, s := range list {
+		expanded[i] = r.expand(s)
+	}
+	return expanded
+}
+
+func (r *runtime) setVariable(name, value string) {
+	r.vars[name] = truncate(value, maxVariableSize)
+}
+
+// flagsFor 获取 :flags 指定的标志，没有 :flags 时使用内部标志变量
+func (r *runtime) flagsFor(flags []string) []string {
+	if flags == nil {
+		return r.flags
+	}
+	return parseFlags(r.expandList(flags))
+}
+
+// parseFlags 拆分空格分隔的标志并去重（不区分大小写，保留第一次出现的写法）
+func parseFlags(values []string) []string {
+	flags := []string{}
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, flag := range strings.Fields(value) {
+			if key := strings.ToLower(flag); !seen[key] {
+				seen[key] = true
+				flags = append(flags, flag)
+			}
+		}
+	}
+	return flags
+}
+
+func removeFlags(current, remove []string) []string {
+	flags := []string{}
+	for _, flag := range current {
+		removed := false
+		for _, r := range remove {
+			if strings.EqualFold(flag, r) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+// applyModifier 应用 set 命令的修饰符
+func applyModifier(modifier, value string) string {
+	switch modifier {
+	case "lower":
+		return strings.ToLower(value)
+	case "upper":
+		return strings.ToUpper(value)
+	case "lowerfirst", "upperfirst":
+		r, size := utf8.DecodeRuneInString(value)
+		if size == 0 {
+			return value
+		}
+		if modifier == "lowerfirst" {
+			r = unicode.ToLower(r)
+		} else {
+			r = unicode.ToUpper(r)
+		}
+		return string(r) + value[size:]
+	case "quotewildcard":
+		var sb strings.Builder
+		for _, r := range value {
+			if r == '*' || r == '?' || r == '\\' {
+				sb.WriteByte('\\')
+			}
+			sb.WriteRune(r)
+		}
+		return sb.String()
+	case "length":
+		return strconv.Itoa(utf8.RuneCountInString(value))
+	}
+	return value
+}
+
+// truncate 截断到最大长度（不截断UTF-8字符）
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
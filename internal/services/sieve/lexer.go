@@ -0,0 +1,241 @@
+package sieve
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 词法单元类型（RFC 5228 8.1）
+const (
+	tokenEOF        = iota
+	tokenIdentifier // 命令或测试名
+	tokenTag        // :is、:contains 等标记参数
+	tokenNumber     // 数字（支持K、M、G后缀）
+	tokenString     // 字符串（引号字符串或 text: 多行字符串）
+	tokenSpecial    // [ ] ( ) { } , ;
+)
+
+type token struct {
+	kind   int
+	value  string
+	number int64
+	line   int
+}
+
+// Error 脚本语法或语义错误，带有出错的行号
+type Error struct {
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+func errorf(line int, format string, args ...interface{}) error {
+	return &Error{Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// lexer Sieve脚本的词法分析器
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+// tokenize 将脚本拆分为词法单元
+func tokenize(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1}
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipWhitespace(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, line: l.line}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("[](){},;", c) >= 0:
+		l.pos++
+		return token{kind: tokenSpecial, value: string(c), line: l.line}, nil
+	case c == '"':
+		return l.quotedString()
+	case c == ':':
+		l.pos++
+		name := l.identifier()
+		if name == "" {
+			return token{}, errorf(l.line, "invalid tag")
+		}
+		return token{kind: tokenTag, value: strings.ToLower(name), line: l.line}, nil
+	case c >= '0' && c <= '9':
+		return l.number()
+	case isIdentifierStart(c):
+		line := l.line
+		name := l.identifier()
+		if strings.EqualFold(name, "text") && l.pos < len(l.src) && l.src[l.pos] == ':' {
+			l.pos++
+			return l.multilineString(line)
+		}
+		return token{kind: tokenIdentifier, value: strings.ToLower(name), line: line}, nil
+	}
+	return token{}, errorf(l.line, "unexpected character %q", c)
+}
+
+// skipWhitespace 跳过空白和注释（# 单行注释、/* */ 块注释）
+func (l *lexer) skipWhitespace() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return errorf(l.line, "unterminated comment")
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (l *lexer) identifier() string {
+	start := l.pos
+	if l.pos < len(l.src) && isIdentifierStart(l.src[l.pos]) {
+		l.pos++
+		for l.pos < len(l.src) && (isIdentifierStart(l.src[l.pos]) || (l.src[l.pos] >= '0' && l.src[l.pos] <= '9')) {
+			l.pos++
+		}
+	}
+	return l.src[start:l.pos]
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.pos
+	for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+		l.pos++
+	}
+	n, err := strconv.ParseInt(l.src[start:l.pos], 10, 64)
+	if err != nil {
+		return token{}, errorf(l.line, "invalid number %s", l.src[start:l.pos])
+	}
+	if l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case 'K', 'k':
+			n <<= 10
+			l.pos++
+		case 'M', 'm':
+			n <<= 20
+			l.pos++
+		case 'G', 'g':
+			n <<= 30
+			l.pos++
+		}
+	}
+	return token{kind: tokenNumber, number: n, line: l.line}, nil
+}
+
+// quotedString 引号字符串，只有 \" 和 \\ 是有效的转义，其他反斜杠被忽略
+func (l *lexer) quotedString() (token, error) {
+	line := l.line
+	l.pos++
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return token{kind: tokenString, value: sb.String(), line: line}, nil
+		case '\\':
+			l.pos++
+			if l.pos < len(l.src) {
+				c = l.src[l.pos]
+				if c == '\n' {
+					l.line++
+				}
+				sb.WriteByte(c)
+				l.pos++
+			}
+		default:
+			if c == '\n' {
+				l.line++
+			}
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, errorf(line, "unterminated string")
+}
+
+// multilineString text: 多行字符串，以单独一行的 "." 结束，以 "." 开头的行去掉一个 "."
+func (l *lexer) multilineString(line int) (token, error) {
+	// text: 之后到行尾只能有空白或注释
+	for l.pos < len(l.src) && (l.src[l.pos] == ' ' || l.src[l.pos] == '\t') {
+		l.pos++
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '#' {
+		for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+			l.pos++
+		}
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos >= len(l.src) || l.src[l.pos] != '\n' {
+		return token{}, errorf(l.line, "text: must be followed by a line break")
+	}
+	l.pos++
+	l.line++
+
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		end := strings.IndexByte(l.src[l.pos:], '\n')
+		var text string
+		if end < 0 {
+			text = l.src[l.pos:]
+			l.pos = len(l.src)
+		} else {
+			text = l.src[l.pos : l.pos+end]
+			l.pos += end + 1
+		}
+		l.line++
+
+		text = strings.TrimSuffix(text, "\r")
+		if text == "." {
+			return token{kind: tokenString, value: sb.String(), line: line}, nil
+		}
+		text = strings.TrimPrefix(text, ".")
+		sb.WriteString(text)
+		sb.WriteString("\r\n")
+	}
+	return token{}, errorf(line, "unterminated multi-line string")
+}
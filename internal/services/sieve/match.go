@@ -0,0 +1,176 @@
+package sieve
+
+import (
+	"strings"
+)
+
+// 匹配类型
+const (
+	matchIs       = "is"
+	matchContains = "contains"
+	matchMatches  = "matches"
+)
+
+// 比较器（RFC 4790），i;octet 区分大小写，i;ascii-casemap 不区分ASCII字母大小写
+const (
+	comparatorOctet     = "i;octet"
+	comparatorCaseMap   = "i;ascii-casemap"
+	defaultComparator   = comparatorCaseMap
+	defaultMatchType    = matchIs
+	defaultAddressPart  = "all"
+	maxMatchVariables   = 10 // ${0} 到 ${9}
+	maxWildcardAttempts = 100000
+)
+
+// matcher 匹配类型和比较器
+type matcher struct {
+	matchType  string
+	comparator string
+}
+
+// match 判断 value 是否匹配 key，:matches 匹配成功时返回匹配变量（${0} 为整个值）
+func (m matcher) match(value, key string) (bool, []string) {
+	fold := m.comparator == comparatorCaseMap
+	switch m.matchType {
+	case matchContains:
+		if fold {
+			return strings.Contains(asciiLower(value), asciiLower(key)), nil
+		}
+		return strings.Contains(value, key), nil
+	case matchMatches:
+		return wildcardMatch(value, key, fold)
+	}
+	if fold {
+		return asciiLower(value) == asciiLower(key), nil
+	}
+	return value == key, nil
+}
+
+// asciiLowerRune 只转换ASCII字母为小写（i;ascii-casemap）
+func asciiLowerRune(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
+
+// asciiLower 只转换ASCII字母为小写（i;ascii-casemap）
+func asciiLower(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 'A' && s[i] <= 'Z' {
+			b := []byte(s)
+			for j := i; j < len(b); j++ {
+				if b[j] >= 'A' && b[j] <= 'Z' {
+					b[j] += 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
+
+// wildcardMatch :matches 通配符匹配，"*" 匹配任意个字符，"?" 匹配一个字符，"\" 转义
+// 每个通配符尽可能少地匹配（RFC 5229 3.2），返回 ${0} 和各通配符匹配的原文
+func wildcardMatch(value, pattern string, fold bool) (bool, []string) {
+	text := []rune(value)
+
+	// 预处理模式：区分通配符和普通字符
+	type element struct {
+		r        rune
+		wildcard bool
+	}
+	var elems []element
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				elems = append(elems, element{r: runes[i]})
+			}
+		case '*', '?':
+			elems = append(elems, element{r: runes[i], wildcard: true})
+		default:
+			elems = append(elems, element{r: runes[i]})
+		}
+	}
+
+	// failed 记录已知无法匹配的 (模式位置, 文本位置)，避免回溯时重复计算
+	failed := make(map[[2]int]bool)
+	captures := make([]string, 0, maxMatchVariables)
+	attempts := 0
+
+	var try func(p, t int) bool
+	try = func(p, t int) bool {
+		if attempts++; attempts > maxWildcardAttempts || failed[[2]int{p, t}] {
+			return false
+		}
+		if p == len(elems) {
+			return t == len(text)
+		}
+
+		elem := elems[p]
+		switch {
+		case elem.wildcard && elem.r == '*':
+			for end := t; end <= len(text); end++ {
+				n := len(captures)
+				captures = append(captures, string(text[t:end]))
+				if try(p+1, end) {
+					return true
+				}
+				captures = captures[:n]
+			}
+		case elem.wildcard:
+			if t < len(text) {
+				n := len(captures)
+				captures = append(captures, string(text[t]))
+				if try(p+1, t+1) {
+					return true
+				}
+				captures = captures[:n]
+			}
+		default:
+			if t < len(text) && equalRune(text[t], elem.r, fold) && try(p+1, t+1) {
+				return true
+			}
+		}
+
+		failed[[2]int{p, t}] = true
+		return false
+	}
+
+	if !try(0, 0) {
+		return false, nil
+	}
+	vars := append([]string{value}, captures...)
+	if len(vars) > maxMatchVariables {
+		vars = vars[:maxMatchVariables]
+	}
+	return true, vars
+}
+
+func equalRune(a, b rune, fold bool) bool {
+	if fold {
+		return asciiLowerRune(a) == asciiLowerRune(b)
+	}
+	return a == b
+}
+
+// addressPart 获取地址的指定部分（:all、:localpart、:domain）
+func addressPart(address, part string) string {
+	at := strings.LastIndexByte(address, '@')
+	switch part {
+	case "localpart":
+		if at < 0 {
+			return address
+		}
+		return address[:at]
+	case "domain":
+		if at < 0 {
+			return ""
+		}
+		return address[at+1:]
+	}
+	return address
+}
@@ -0,0 +1,129 @@
+package sieve
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"github.com/jhillyerd/enmime/v2"
+)
+
+// headerDecoder 解码RFC 2047编码的邮件头
+var headerDecoder = new(mime.WordDecoder)
+
+// Message 执行脚本的邮件
+type Message struct {
+	EnvelopeFrom string // 信封发件人（MAIL FROM，退信为空）
+	EnvelopeTo   string // 信封收件人（RCPT TO 的原始地址）
+	Raw          []byte // 邮件原文
+
+	header   textproto.MIMEHeader
+	envelope *enmime.Envelope // 解析失败时为nil
+}
+
+// NewMessage 解析邮件原文
+func NewMessage(raw []byte, envelopeFrom, envelopeTo string) *Message {
+	msg := &Message{
+		EnvelopeFrom: envelopeFrom,
+		EnvelopeTo:   envelopeTo,
+		Raw:          raw,
+	}
+	if envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw)); err == nil {
+		msg.envelope = envelope
+	}
+	if header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw))).ReadMIMEHeader(); err == nil || len(header) > 0 {
+		msg.header = header
+	}
+	return msg
+}
+
+// Size 邮件大小（字节）
+func (m *Message) Size() int64 {
+	return int64(len(m.Raw))
+}
+
+// HeaderValues 获取邮件头的所有值（已解码RFC 2047编码，去掉首尾空白）
+func (m *Message) HeaderValues(name string) []string {
+	values := m.header.Values(name)
+	decoded := make([]string, 0, len(values))
+	for _, value := range values {
+		if text, err := headerDecoder.DecodeHeader(value); err == nil {
+			value = text
+		}
+		decoded = append(decoded, strings.TrimSpace(value))
+	}
+	return decoded
+}
+
+// HasHeader 邮件头是否存在
+func (m *Message) HasHeader(name string) bool {
+	return len(m.header.Values(name)) > 0
+}
+
+// Addresses 获取地址类邮件头中的所有邮箱地址，无法解析的值整体作为一个地址
+func (m *Message) Addresses(name string) []string {
+	var addresses []string
+	for _, value := range m.header.Values(name) {
+		list, err := mail.ParseAddressList(value)
+		if err != nil {
+			if value = strings.TrimSpace(value); value != "" {
+				addresses = append(addresses, value)
+			}
+			continue
+		}
+		for _, addr := range list {
+			addresses = append(addresses, addr.Address)
+		}
+	}
+	return addresses
+}
+
+// RawBody 未解码的邮件正文（body :raw）
+func (m *Message) RawBody() string {
+	raw := m.Raw
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		return string(raw[i+4:])
+	}
+	if i := bytes.Index(raw, []byte("\n\n")); i >= 0 {
+		return string(raw[i+2:])
+	}
+	return ""
+}
+
+// TextBody 解码后的文本正文（body :text），只有HTML时转换为纯文本
+func (m *Message) TextBody() string {
+	if m.envelope == nil {
+		return m.RawBody()
+	}
+	return m.envelope.Text
+}
+
+// ContentParts 获取类型匹配的MIME部分解码后的内容（body :content）
+// 类型为 "text" 时匹配所有 text/*，为 "text/plain" 时精确匹配，为空时匹配所有非multipart部分
+func (m *Message) ContentParts(types []string) []string {
+	if m.envelope == nil || m.envelope.Root == nil {
+		return nil
+	}
+
+	var contents []string
+	parts := m.envelope.Root.DepthMatchAll(func(part *enmime.Part) bool {
+		return !strings.HasPrefix(strings.ToLower(part.ContentType), "multipart/")
+	})
+	for _, part := range parts {
+		contentType := strings.ToLower(part.ContentType)
+		if contentType == "" {
+			contentType = "text/plain"
+		}
+		for _, want := range types {
+			want = strings.ToLower(want)
+			if want == "" || want == contentType || (!strings.Contains(want, "/") && strings.HasPrefix(contentType, want+"/")) {
+				contents = append(contents, string(part.Content))
+				break
+			}
+		}
+	}
+	return contents
+}
@@ -0,0 +1,251 @@
+package sieve
+
+// 语法树（RFC 5228 8.2），命令和测试的参数在编译阶段按各自的语法检查
+
+// argument 命令或测试的参数：标记、数字或字符串列表（单个字符串视为只有一项的列表）
+type argument struct {
+	kind    int // tokenTag、tokenNumber 或 tokenString
+	tag     string
+	number  int64
+	strings []string
+	list    bool // 是否使用 [...] 写法
+	line    int
+}
+
+// testNode 测试
+type testNode struct {
+	name  string
+	args  []argument
+	tests []*testNode
+	line  int
+}
+
+// commandNode 命令
+type commandNode struct {
+	name  string
+	args  []argument
+	tests []*testNode
+	block []*commandNode
+	line  int
+}
+
+// maxNesting 块和测试的最大嵌套层数
+const maxNesting = 32
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+// parse 解析脚本为命令列表
+func parse(src string) ([]*commandNode, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	commands, err := p.commands()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, errorf(tok.line, "unexpected %s", describe(tok))
+	}
+	return commands, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isSpecial(value string) bool {
+	tok := p.peek()
+	return tok.kind == tokenSpecial && tok.value == value
+}
+
+func (p *parser) expect(value string) error {
+	tok := p.advance()
+	if tok.kind != tokenSpecial || tok.value != value {
+		return errorf(tok.line, "expected %q, got %s", value, describe(tok))
+	}
+	return nil
+}
+
+func describe(tok token) string {
+	switch tok.kind {
+	case tokenEOF:
+		return "end of script"
+	case tokenIdentifier:
+		return "identifier " + tok.value
+	case tokenTag:
+		return "tag :" + tok.value
+	case tokenNumber:
+		return "number"
+	case tokenString:
+		return "string"
+	}
+	return "\"" + tok.value + "\""
+}
+
+// commands 解析命令序列，直到文件结束或 "}"
+func (p *parser) commands() ([]*commandNode, error) {
+	var commands []*commandNode
+	for {
+		tok := p.peek()
+		if tok.kind == tokenEOF || (tok.kind == tokenSpecial && tok.value == "}") {
+			return commands, nil
+		}
+		cmd, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, cmd)
+	}
+}
+
+func (p *parser) command() (*commandNode, error) {
+	tok := p.advance()
+	if tok.kind != tokenIdentifier {
+		return nil, errorf(tok.line, "expected command, got %s", describe(tok))
+	}
+
+	cmd := &commandNode{name: tok.value, line: tok.line}
+	args, tests, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+	cmd.args, cmd.tests = args, tests
+
+	if p.isSpecial(";") {
+		p.advance()
+		return cmd, nil
+	}
+	if !p.isSpecial("{") {
+		next := p.peek()
+		return nil, errorf(next.line, "expected \";\" or block after %s, got %s", cmd.name, describe(next))
+	}
+
+	p.advance()
+	if p.depth++; p.depth > maxNesting {
+		return nil, errorf(tok.line, "blocks nested too deeply")
+	}
+	block, err := p.commands()
+	if err != nil {
+		return nil, err
+	}
+	p.depth--
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	// 空块与没有块区分开（if 必须有块）
+	if block == nil {
+		block = []*commandNode{}
+	}
+	cmd.block = block
+	return cmd, nil
+}
+
+// arguments 解析参数以及可选的测试或测试列表
+func (p *parser) arguments() ([]argument, []*testNode, error) {
+	var args []argument
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokenTag:
+			p.advance()
+			args = append(args, argument{kind: tokenTag, tag: tok.value, line: tok.line})
+		case tok.kind == tokenNumber:
+			p.advance()
+			args = append(args, argument{kind: tokenNumber, number: tok.number, line: tok.line})
+		case tok.kind == tokenString:
+			p.advance()
+			args = append(args, argument{kind: tokenString, strings: []string{tok.value}, line: tok.line})
+		case tok.kind == tokenSpecial && tok.value == "[":
+			list, err := p.stringList()
+			if err != nil {
+				return nil, nil, err
+			}
+			args = append(args, argument{kind: tokenString, strings: list, list: true, line: tok.line})
+		case tok.kind == tokenIdentifier:
+			test, err := p.test()
+			if err != nil {
+				return nil, nil, err
+			}
+			return args, []*testNode{test}, nil
+		case tok.kind == tokenSpecial && tok.value == "(":
+			tests, err := p.testList()
+			if err != nil {
+				return nil, nil, err
+			}
+			return args, tests, nil
+		default:
+			return args, nil, nil
+		}
+	}
+}
+
+func (p *parser) stringList() ([]string, error) {
+	p.advance()
+	var list []string
+	for {
+		tok := p.advance()
+		if tok.kind != tokenString {
+			return nil, errorf(tok.line, "expected string in list, got %s", describe(tok))
+		}
+		list = append(list, tok.value)
+		if p.isSpecial("]") {
+			p.advance()
+			return list, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) test() (*testNode, error) {
+	tok := p.advance()
+	if tok.kind != tokenIdentifier {
+		return nil, errorf(tok.line, "expected test, got %s", describe(tok))
+	}
+	if p.depth++; p.depth > maxNesting {
+		return nil, errorf(tok.line, "tests nested too deeply")
+	}
+	defer func() { p.depth-- }()
+
+	test := &testNode{name: tok.value, line: tok.line}
+	args, tests, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+	test.args, test.tests = args, tests
+	return test, nil
+}
+
+func (p *parser) testList() ([]*testNode, error) {
+	p.advance()
+	var tests []*testNode
+	for {
+		test, err := p.test()
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, test)
+		if p.isSpecial(")") {
+			p.advance()
+			return tests, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,811 @@
+package sieve
+
+import (
+	"strings"
+)
+
+// Capabilities 支持的扩展（ManageSieve 的 SIEVE 能力和 require 检查使用）
+var Capabilities = []string{
+	"fileinto", "reject", "ereject", "envelope", "body", "variables",
+	"vacation", "imap4flags", "copy", "mailbox",
+	"comparator-i;octet", "comparator-i;ascii-casemap",
+}
+
+// Script 编译后的Sieve脚本
+type Script struct {
+	commands  []command
+	variables bool // 是否启用了 variables 扩展（字符串中的 ${...} 才会展开）
+}
+
+// Parse 解析并检查脚本，返回的错误为 *Error（带行号）
+func Parse(src string) (*Script, error) {
+	nodes, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{requires: make(map[string]bool)}
+	commands, err := c.block(nodes, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Script{commands: commands, variables: c.requires["variables"]}, nil
+}
+
+// 编译后的命令
+type (
+	command interface{}
+
+	cmdIf struct {
+		tests  []test // if 和各 elsif 的测试
+		blocks [][]command
+		orElse []command // else 块，没有时为nil
+	}
+	cmdStop    struct{}
+	cmdDiscard struct{}
+	cmdKeep    struct {
+		flags []string // nil 表示使用内部标志变量
+	}
+	cmdFileInto struct {
+		folder string
+		copy   bool
+		create bool
+		flags  []string
+	}
+	cmdRedirect struct {
+		address string
+		copy    bool
+	}
+	cmdReject struct {
+		reason string
+	}
+	cmdVacation struct {
+		days      int64
+		subject   string
+		from      string
+		addresses []string
+		mime      bool
+		handle    string
+		reason    string
+	}
+	cmdSet struct {
+		name      string
+		value     string
+		modifiers []string // 按优先级从高到低排列
+	}
+	cmdFlag struct {
+		action   string // setflag、addflag、removeflag
+		variable string // 为空时使用内部标志变量
+		flags    []string
+	}
+)
+
+// 编译后的测试
+type (
+	test interface{}
+
+	testTrue  struct{}
+	testFalse struct{}
+	testNot   struct{ test test }
+	testAllOf struct{ tests []test }
+	testAnyOf struct{ tests []test }
+
+	testAddress struct {
+		matcher
+		part    string
+		headers []string
+		keys    []string
+	}
+	testEnvelope struct {
+		matcher
+		part  string
+		parts []string // from、to
+		keys  []string
+	}
+	testHeader struct {
+		matcher
+		headers []string
+		keys    []string
+	}
+	testExists struct {
+		headers []string
+	}
+	testSize struct {
+		over  bool
+		limit int64
+	}
+	testBody struct {
+		matcher
+		transform    string // raw、text、content
+		contentTypes []string
+		keys         []string
+	}
+	testString struct {
+		matcher
+		sources []string
+		keys    []string
+	}
+	testHasFlag struct {
+		matcher
+		variables []string
+		keys      []string
+	}
+)
+
+type compiler struct {
+	requires map[string]bool
+}
+
+// need 检查是否已 require 扩展
+func (c *compiler) need(line int, extension, feature string) error {
+	if !c.requires[extension] {
+		return errorf(line, "%s requires the %q extension", feature, extension)
+	}
+	return nil
+}
+
+// block 编译命令序列，top 为 true 时允许开头的 require
+func (c *compiler) block(nodes []*commandNode, top bool) ([]command, error) {
+	var commands []command
+	allowRequire := top
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		if node.name == "require" {
+			if !allowRequire {
+				return nil, errorf(node.line, "require must come before any other command")
+			}
+			if err := c.require(node); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		allowRequire = false
+
+		switch node.name {
+		case "if":
+			cmd, next, err := c.ifChain(nodes, i)
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, cmd)
+			i = next - 1
+		case "elsif", "else":
+			return nil, errorf(node.line, "%s without if", node.name)
+		default:
+			cmd, err := c.command(node)
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, cmd)
+		}
+	}
+	return commands, nil
+}
+
+func (c *compiler) require(node *commandNode) error {
+	if len(node.args) != 1 || node.args[0].kind != tokenString || node.tests != nil || node.block != nil {
+		return errorf(node.line, "require expects a string list")
+	}
+	for _, ext := range node.args[0].strings {
+		ext = strings.ToLower(ext)
+		supported := false
+		for _, capability := range Capabilities {
+			if ext == capability {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return errorf(node.line, "unsupported extension %q", ext)
+		}
+		c.requires[ext] = true
+	}
+	return nil
+}
+
+// ifChain 编译 if/elsif/else，返回下一个未处理的命令下标
+func (c *compiler) ifChain(nodes []*commandNode, i int) (command, int, error) {
+	cmd := &cmdIf{}
+	for ; i < len(nodes); i++ {
+		node := nodes[i]
+		if len(cmd.tests) > 0 && node.name != "elsif" && node.name != "else" {
+			break
+		}
+		if node.block == nil {
+			return nil, 0, errorf(node.line, "%s requires a block", node.name)
+		}
+		block, err := c.block(node.block, false)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if node.name == "else" {
+			if len(node.args) > 0 || node.tests != nil {
+				return nil, 0, errorf(node.line, "else takes no arguments")
+			}
+			cmd.orElse = block
+			return cmd, i + 1, nil
+		}
+
+		if len(node.args) > 0 || len(node.tests) != 1 {
+			return nil, 0, errorf(node.line, "%s requires exactly one test", node.name)
+		}
+		t, err := c.test(node.tests[0])
+		if err != nil {
+			return nil, 0, err
+		}
+		cmd.tests = append(cmd.tests, t)
+		cmd.blocks = append(cmd.blocks, block)
+	}
+	return cmd, i, nil
+}
+
+func (c *compiler) command(node *commandNode) (command, error) {
+	if node.block != nil {
+		return nil, errorf(node.line, "%s does not take a block", node.name)
+	}
+	if node.tests != nil {
+		return nil, errorf(node.line, "%s does not take a test", node.name)
+	}
+
+	switch node.name {
+	case "stop":
+		if err := noArgs(node.name, node.line, node.args); err != nil {
+			return nil, err
+		}
+		return &cmdStop{}, nil
+	case "discard":
+		if err := noArgs(node.name, node.line, node.args); err != nil {
+			return nil, err
+		}
+		return &cmdDiscard{}, nil
+	case "keep":
+		args, err := c.splitArgs(node.name, node.line, node.args, map[string]string{"flags": "strings"})
+		if err != nil {
+			return nil, err
+		}
+		if err := args.positional(0); err != nil {
+			return nil, err
+		}
+		cmd := &cmdKeep{}
+		if flags, ok := args.tags["flags"]; ok {
+			if err := c.need(node.line, "imap4flags", ":flags"); err != nil {
+				return nil, err
+			}
+			cmd.flags = flags.strings
+		}
+		return cmd, nil
+	case "fileinto":
+		if err := c.need(node.line, "fileinto", "fileinto"); err != nil {
+			return nil, err
+		}
+		args, err := c.splitArgs(node.name, node.line, node.args, map[string]string{"copy": "", "create": "", "flags": "strings"})
+		if err != nil {
+			return nil, err
+		}
+		if err := args.positional(1); err != nil {
+			return nil, err
+		}
+		folder, err := args.string(0)
+		if err != nil {
+			return nil, err
+		}
+		cmd := &cmdFileInto{folder: folder}
+		if _, ok := args.tags["copy"]; ok {
+			if err := c.need(node.line, "copy", ":copy"); err != nil {
+				return nil, err
+			}
+			cmd.copy = true
+		}
+		if _, ok := args.tags["create"]; ok {
+			if err := c.need(node.line, "mailbox", ":create"); err != nil {
+				return nil, err
+			}
+			cmd.create = true
+		}
+		if flags, ok := args.tags["flags"]; ok {
+			if err := c.need(node.line, "imap4flags", ":flags"); err != nil {
+				return nil, err
+			}
+			cmd.flags = flags.strings
+		}
+		return cmd, nil
+	case "redirect":
+		args, err := c.splitArgs(node.name, node.line, node.args, map[string]string{"copy": ""})
+		if err != nil {
+			return nil, err
+		}
+		if err := args.positional(1); err != nil {
+			return nil, err
+		}
+		address, err := args.string(0)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(address, "${") && !validAddress(address) {
+			return nil, errorf(node.line, "invalid redirect address %q", address)
+		}
+		cmd := &cmdRedirect{address: address}
+		if _, ok := args.tags["copy"]; ok {
+			if err := c.need(node.line, "copy", ":copy"); err != nil {
+				return nil, err
+			}
+			cmd.copy = true
+		}
+		return cmd, nil
+	case "reject", "ereject":
+		if err := c.need(node.line, node.name, node.name); err != nil {
+			return nil, err
+		}
+		args, err := c.splitArgs(node.name, node.line, node.args, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := args.positional(1); err != nil {
+			return nil, err
+		}
+		reason, err := args.string(0)
+		if err != nil {
+			return nil, err
+		}
+		return &cmdReject{reason: reason}, nil
+	case "vacation":
+		return c.vacation(node)
+	case "set":
+		return c.set(node)
+	case "setflag", "addflag", "removeflag":
+		if err := c.need(node.line, "imap4flags", node.name); err != nil {
+			return nil, err
+		}
+		args, err := c.splitArgs(node.name, node.line, node.args, nil)
+		if err != nil {
+			return nil, err
+		}
+		cmd := &cmdFlag{action: node.name}
+		switch len(args.rest) {
+		case 1:
+		case 2:
+			if cmd.variable, err = args.string(0); err != nil {
+				return nil, err
+			}
+			if !validVariableName(cmd.variable) {
+				return nil, errorf(node.line, "invalid variable name %q", cmd.variable)
+			}
+			cmd.variable = strings.ToLower(cmd.variable)
+			args.rest = args.rest[1:]
+		default:
+			return nil, errorf(node.line, "%s expects an optional variable name and a flag list", node.name)
+		}
+		if args.rest[0].kind != tokenString {
+			return nil, errorf(node.line, "%s expects a flag list", node.name)
+		}
+		cmd.flags = args.rest[0].strings
+		return cmd, nil
+	}
+	return nil, errorf(node.line, "unknown command %q", node.name)
+}
+
+func (c *compiler) vacation(node *commandNode) (command, error) {
+	if err := c.need(node.line, "vacation", "vacation"); err != nil {
+		return nil, err
+	}
+	args, err := c.splitArgs(node.name, node.line, node.args, map[string]string{
+		"days": "number", "subject": "string", "from": "string", "addresses": "strings", "mime": "", "handle": "string",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := args.positional(1); err != nil {
+		return nil, err
+	}
+
+	cmd := &cmdVacation{days: 7}
+	if cmd.reason, err = args.string(0); err != nil {
+		return nil, err
+	}
+	if days, ok := args.tags["days"]; ok {
+		cmd.days = days.number
+		if cmd.days < 1 {
+			cmd.days = 1
+		}
+	}
+	if subject, ok := args.tags["subject"]; ok {
+		cmd.subject = subject.strings[0]
+	}
+	if from, ok := args.tags["from"]; ok {
+		cmd.from = from.strings[0]
+	}
+	if addresses, ok := args.tags["addresses"]; ok {
+		cmd.addresses = addresses.strings
+	}
+	if handle, ok := args.tags["handle"]; ok {
+		cmd.handle = handle.strings[0]
+	}
+	_, cmd.mime = args.tags["mime"]
+	return cmd, nil
+}
+
+// setModifiers set 命令的修饰符及其优先级（RFC 5229 4.1）
+var setModifiers = map[string]int{
+	"lower": 40, "upper": 40,
+	"lowerfirst": 30, "upperfirst": 30,
+	"quotewildcard": 20,
+	"length":        10,
+}
+
+func (c *compiler) set(node *commandNode) (command, error) {
+	if err := c.need(node.line, "variables", "set"); err != nil {
+		return nil, err
+	}
+
+	cmd := &cmdSet{}
+	var rest []argument
+	used := make(map[int]bool)
+	for i, arg := range node.args {
+		if arg.kind != tokenTag {
+			rest = node.args[i:]
+			break
+		}
+		precedence, ok := setModifiers[arg.tag]
+		if !ok {
+			return nil, errorf(arg.line, "unknown modifier :%s for set", arg.tag)
+		}
+		if used[precedence] {
+			return nil, errorf(arg.line, "conflicting modifier :%s for set", arg.tag)
+		}
+		used[precedence] = true
+		cmd.modifiers = append(cmd.modifiers, arg.tag)
+	}
+	if len(rest) != 2 || !isSingleString(rest[0]) || !isSingleString(rest[1]) {
+		return nil, errorf(node.line, "set expects a variable name and a value")
+	}
+	if !validVariableName(rest[0].strings[0]) {
+		return nil, errorf(node.line, "invalid variable name %q", rest[0].strings[0])
+	}
+	cmd.name = strings.ToLower(rest[0].strings[0])
+	cmd.value = rest[1].strings[0]
+
+	// 按优先级从高到低应用
+	for i := 0; i < len(cmd.modifiers); i++ {
+		for j := i + 1; j < len(cmd.modifiers); j++ {
+			if setModifiers[cmd.modifiers[j]] > setModifiers[cmd.modifiers[i]] {
+				cmd.modifiers[i], cmd.modifiers[j] = cmd.modifiers[j], cmd.modifiers[i]
+			}
+		}
+	}
+	return cmd, nil
+}
+
+func (c *compiler) test(node *testNode) (test, error) {
+	switch node.name {
+	case "true", "false":
+		if len(node.args) > 0 || node.tests != nil {
+			return nil, errorf(node.line, "%s takes no arguments", node.name)
+		}
+		if node.name == "true" {
+			return &testTrue{}, nil
+		}
+		return &testFalse{}, nil
+	case "not":
+		if len(node.args) > 0 || len(node.tests) != 1 {
+			return nil, errorf(node.line, "not requires exactly one test")
+		}
+		t, err := c.test(node.tests[0])
+		if err != nil {
+			return nil, err
+		}
+		return &testNot{test: t}, nil
+	case "allof", "anyof":
+		if len(node.args) > 0 || len(node.tests) == 0 {
+			return nil, errorf(node.line, "%s requires a test list", node.name)
+		}
+		var tests []test
+		for _, child := range node.tests {
+			t, err := c.test(child)
+			if err != nil {
+				return nil, err
+			}
+			tests = append(tests, t)
+		}
+		if node.name == "allof" {
+			return &testAllOf{tests: tests}, nil
+		}
+		return &testAnyOf{tests: tests}, nil
+	}
+
+	if node.tests != nil {
+		return nil, errorf(node.line, "%s does not take a test", node.name)
+	}
+
+	switch node.name {
+	case "address", "envelope":
+		if node.name == "envelope" {
+			if err := c.need(node.line, "envelope", "envelope"); err != nil {
+				return nil, err
+			}
+		}
+		args, err := c.splitArgs(node.name, node.line, node.args, matchTags(true))
+		if err != nil {
+			return nil, err
+		}
+		if err := args.positional(2); err != nil {
+			return nil, err
+		}
+		m, err := c.matcher(node.line, args)
+		if err != nil {
+			return nil, err
+		}
+		part := args.addressPart()
+		if node.name == "address" {
+			return &testAddress{matcher: m, part: part, headers: args.rest[0].strings, keys: args.rest[1].strings}, nil
+		}
+		for _, p := range args.rest[0].strings {
+			if p = strings.ToLower(p); p != "from" && p != "to" && !strings.Contains(p, "${") {
+				return nil, errorf(node.line, "unsupported envelope part %q", p)
+			}
+		}
+		return &testEnvelope{matcher: m, part: part, parts: args.rest[0].strings, keys: args.rest[1].strings}, nil
+	case "header":
+		args, err := c.splitArgs(node.name, node.line, node.args, matchTags(false))
+		if err != nil {
+			return nil, err
+		}
+		if err := args.positional(2); err != nil {
+			return nil, err
+		}
+		m, err := c.matcher(node.line, args)
+		if err != nil {
+			return nil, err
+		}
+		return &testHeader{matcher: m, headers: args.rest[0].strings, keys: args.rest[1].strings}, nil
+	case "exists":
+		args, err := c.splitArgs(node.name, node.line, node.args, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := args.positional(1); err != nil {
+			return nil, err
+		}
+		return &testExists{headers: args.rest[0].strings}, nil
+	case "size":
+		args, err := c.splitArgs(node.name, node.line, node.args, map[string]string{"over": "", "under": ""})
+		if err != nil {
+			return nil, err
+		}
+		_, over := args.tags["over"]
+		_, under := args.tags["under"]
+		if over == under || len(args.rest) != 1 || args.rest[0].kind != tokenNumber {
+			return nil, errorf(node.line, "size expects :over or :under and a number")
+		}
+		return &testSize{over: over, limit: args.rest[0].number}, nil
+	case "body":
+		if err := c.need(node.line, "body", "body"); err != nil {
+			return nil, err
+		}
+		tags := matchTags(false)
+		tags["raw"], tags["text"], tags["content"] = "", "", "strings"
+		args, err := c.splitArgs(node.name, node.line, node.args, tags)
+		if err != nil {
+			return nil, err
+		}
+		if err := args.positional(1); err != nil {
+			return nil, err
+		}
+		m, err := c.matcher(node.line, args)
+		if err != nil {
+			return nil, err
+		}
+		t := &testBody{matcher: m, transform: "text", keys: args.rest[0].strings}
+		count := 0
+		for _, transform := range []string{"raw", "text", "content"} {
+			if arg, ok := args.tags[transform]; ok {
+				t.transform = transform
+				t.contentTypes = arg.strings
+				count++
+			}
+		}
+		if count > 1 {
+			return nil, errorf(node.line, "only one body transform is allowed")
+		}
+		return t, nil
+	case "string":
+		if err := c.need(node.line, "variables", "string"); err != nil {
+			return nil, err
+		}
+		args, err := c.splitArgs(node.name, node.line, node.args, matchTags(false))
+		if err != nil {
+			return nil, err
+		}
+		if err := args.positional(2); err != nil {
+			return nil, err
+		}
+		m, err := c.matcher(node.line, args)
+		if err != nil {
+			return nil, err
+		}
+		return &testString{matcher: m, sources: args.rest[0].strings, keys: args.rest[1].strings}, nil
+	case "hasflag":
+		if err := c.need(node.line, "imap4flags", "hasflag"); err != nil {
+			return nil, err
+		}
+		args, err := c.splitArgs(node.name, node.line, node.args, matchTags(false))
+		if err != nil {
+			return nil, err
+		}
+		m, err := c.matcher(node.line, args)
+		if err != nil {
+			return nil, err
+		}
+		t := &testHasFlag{matcher: m}
+		switch len(args.rest) {
+		case 1:
+		case 2:
+			for _, name := range args.rest[0].strings {
+				if !validVariableName(name) {
+					return nil, errorf(node.line, "invalid variable name %q", name)
+				}
+				t.variables = append(t.variables, strings.ToLower(name))
+			}
+			args.rest = args.rest[1:]
+		default:
+			return nil, errorf(node.line, "hasflag expects an optional variable list and a flag list")
+		}
+		if args.rest[0].kind != tokenString {
+			return nil, errorf(node.line, "hasflag expects a flag list")
+		}
+		t.keys = args.rest[0].strings
+		return t, nil
+	}
+	return nil, errorf(node.line, "unknown test %q", node.name)
+}
+
+// matchTags 比较器、匹配类型（以及地址部分）标记
+func matchTags(address bool) map[string]string {
+	tags := map[string]string{"comparator": "string", matchIs: "", matchContains: "", matchMatches: ""}
+	if address {
+		tags["all"], tags["localpart"], tags["domain"] = "", "", ""
+	}
+	return tags
+}
+
+// matcher 获取匹配类型和比较器，检查是否冲突
+func (c *compiler) matcher(line int, args *splitArgs) (matcher, error) {
+	m := matcher{matchType: defaultMatchType, comparator: defaultComparator}
+	count := 0
+	for _, matchType := range []string{matchIs, matchContains, matchMatches} {
+		if _, ok := args.tags[matchType]; ok {
+			m.matchType = matchType
+			count++
+		}
+	}
+	if count > 1 {
+		return m, errorf(line, "only one match type is allowed")
+	}
+	// i;octet 和 i;ascii-casemap 不需要 require（RFC 5228 2.7.3）
+	if comparator, ok := args.tags["comparator"]; ok {
+		m.comparator = strings.ToLower(comparator.strings[0])
+		if m.comparator != comparatorOctet && m.comparator != comparatorCaseMap {
+			return m, errorf(line, "unsupported comparator %q", m.comparator)
+		}
+	}
+
+	count = 0
+	for _, part := range []string{"all", "localpart", "domain"} {
+		if _, ok := args.tags[part]; ok {
+			count++
+		}
+	}
+	if count > 1 {
+		return m, errorf(line, "only one address part is allowed")
+	}
+	return m, nil
+}
+
+// splitArgs 拆分后的参数：标记参数（带值的标记对应其值）和位置参数
+type splitArgs struct {
+	name string
+	line int
+	tags map[string]argument
+	rest []argument
+}
+
+// splitArgs 拆分标记参数和位置参数，spec 为允许的标记及其值的类型（""、"string"、"strings"、"number"）
+// 标记参数必须在位置参数之前
+func (c *compiler) splitArgs(name string, line int, args []argument, spec map[string]string) (*splitArgs, error) {
+	result := &splitArgs{name: name, line: line, tags: make(map[string]argument)}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg.kind != tokenTag {
+			result.rest = append(result.rest, arg)
+			continue
+		}
+		if len(result.rest) > 0 {
+			return nil, errorf(arg.line, "tag :%s must come before positional arguments of %s", arg.tag, name)
+		}
+		kind, ok := spec[arg.tag]
+		if !ok {
+			return nil, errorf(arg.line, "unknown tag :%s for %s", arg.tag, name)
+		}
+		if _, dup := result.tags[arg.tag]; dup {
+			return nil, errorf(arg.line, "duplicate tag :%s for %s", arg.tag, name)
+		}
+		if kind == "" {
+			result.tags[arg.tag] = arg
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return nil, errorf(arg.line, "tag :%s of %s requires a value", arg.tag, name)
+		}
+		value := args[i+1]
+		switch {
+		case kind == "number" && value.kind == tokenNumber:
+		case kind == "strings" && value.kind == tokenString:
+		case kind == "string" && isSingleString(value):
+		default:
+			return nil, errorf(arg.line, "invalid value for tag :%s of %s", arg.tag, name)
+		}
+		result.tags[arg.tag] = value
+		i++
+	}
+	return result, nil
+}
+
+// positional 检查位置参数数量，位置参数都必须是字符串（列表）
+func (a *splitArgs) positional(n int) error {
+	if len(a.rest) != n {
+		return errorf(a.line, "%s expects %d positional argument(s), got %d", a.name, n, len(a.rest))
+	}
+	for _, arg := range a.rest {
+		if arg.kind != tokenString {
+			return errorf(arg.line, "%s expects string arguments", a.name)
+		}
+	}
+	return nil
+}
+
+// string 获取单个字符串位置参数
+func (a *splitArgs) string(i int) (string, error) {
+	if !isSingleString(a.rest[i]) {
+		return "", errorf(a.rest[i].line, "%s expects a single string", a.name)
+	}
+	return a.rest[i].strings[0], nil
+}
+
+func (a *splitArgs) addressPart() string {
+	for _, part := range []string{"localpart", "domain", "all"} {
+		if _, ok := a.tags[part]; ok {
+			return part
+		}
+	}
+	return defaultAddressPart
+}
+
+func noArgs(name string, line int, args []argument) error {
+	if len(args) > 0 {
+		return errorf(line, "%s takes no arguments", name)
+	}
+	return nil
+}
+
+func isSingleString(arg argument) bool {
+	return arg.kind == tokenString && !arg.list && len(arg.strings) == 1
+}
+
+// validVariableName 变量名：字母或下划线开头，由字母、数字、下划线组成（不支持命名空间）
+func validVariableName(name string) bool {
+	if name == "" || !isIdentifierStart(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isIdentifierStart(name[i]) && (name[i] < '0' || name[i] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// validAddress 简单检查邮箱地址格式
+func validAddress(address string) bool {
+	at := strings.LastIndexByte(address, '@')
+	return at > 0 && at < len(address)-1 && !strings.ContainsAny(address, " \t\r\n<>,")
+}
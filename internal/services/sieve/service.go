@@ -0,0 +1,236 @@
+package sieve
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+	"miko-email/internal/svc"
+)
+
+// maxScriptNameLength 脚本名的最大长度（字符）
+const maxScriptNameLength = 128
+
+// 脚本管理的错误，ManageSieve 按类型返回对应的响应码
+var (
+	ErrScriptNotFound = errors.New("脚本不存在")
+	ErrScriptExists   = errors.New("脚本名已存在")
+	ErrScriptActive   = errors.New("不能删除启用中的脚本")
+	ErrTooManyScripts = errors.New("脚本数量已达到上限")
+	ErrScriptTooLarge = errors.New("脚本大小超过限制")
+	ErrInvalidName    = errors.New("脚本名无效")
+)
+
+type Service struct {
+	svcCtx *svc.ServiceContext
+}
+
+func NewService(svcCtx *svc.ServiceContext) *Service {
+	return &Service{svcCtx: svcCtx}
+}
+
+// GetOwnedMailbox 获取属于当前用户的邮箱
+func (s *Service) GetOwnedMailbox(mailboxID, userID int64, isAdmin bool) (*model.Mailbox, error) {
+	mailbox, err := s.svcCtx.MailboxModel.GetById(mailboxID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("邮箱不存在")
+		}
+		return nil, err
+	}
+
+	if isAdmin {
+		if mailbox.AdminId == nil || *mailbox.AdminId != userID {
+			return nil, fmt.Errorf("无权限访问此邮箱")
+		}
+	} else {
+		if mailbox.UserId == nil || *mailbox.UserId != userID {
+			return nil, fmt.Errorf("无权限访问此邮箱")
+		}
+	}
+	return mailbox, nil
+}
+
+// ListScripts 获取邮箱的所有脚本
+func (s *Service) ListScripts(mailboxID int64) ([]*model.SieveScript, error) {
+	scripts, err := s.svcCtx.SieveScriptModel.GetByMailboxId(mailboxID)
+	if err != nil {
+		return nil, err
+	}
+	if scripts == nil {
+		scripts = []*model.SieveScript{}
+	}
+	return scripts, nil
+}
+
+// GetScript 获取邮箱的指定脚本
+func (s *Service) GetScript(mailboxID int64, name string) (*model.SieveScript, error) {
+	script, err := s.svcCtx.SieveScriptModel.GetByName(mailboxID, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScriptNotFound
+		}
+		return nil, err
+	}
+	return script, nil
+}
+
+// CheckScript 检查脚本语法和大小，语法错误时返回 *Error
+func (s *Service) CheckScript(content string) error {
+	_, maxSize, _ := config.GetSieveLimits()
+	if int64(len(content)) > maxSize {
+		return ErrScriptTooLarge
+	}
+	_, err := Parse(content)
+	return err
+}
+
+// HaveSpace 检查邮箱是否还能保存指定名称和大小的脚本（同名脚本会被替换）
+func (s *Service) HaveSpace(mailboxID int64, name string, size int64) error {
+	maxScripts, maxSize, _ := config.GetSieveLimits()
+	if size > maxSize {
+		return ErrScriptTooLarge
+	}
+
+	if _, err := s.svcCtx.SieveScriptModel.GetByName(mailboxID, name); err == nil {
+		return nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	count, err := s.svcCtx.SieveScriptModel.CountByMailboxId(mailboxID)
+	if err != nil {
+		return err
+	}
+	if count >= int64(maxScripts) {
+		return ErrTooManyScripts
+	}
+	return nil
+}
+
+// PutScript 检查并保存脚本，同名脚本存在时替换内容（保持启用状态）
+func (s *Service) PutScript(mailboxID int64, name, content string) (*model.SieveScript, error) {
+	if !ValidScriptName(name) {
+		return nil, ErrInvalidName
+	}
+	if err := s.HaveSpace(mailboxID, name, int64(len(content))); err != nil {
+		return nil, err
+	}
+	if _, err := Parse(content); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	script, err := s.svcCtx.SieveScriptModel.GetByName(mailboxID, name)
+	if err == nil {
+		if err := s.svcCtx.SieveScriptModel.MapUpdate(nil, script.Id, map[string]interface{}{
+			"content":    content,
+			"updated_at": now,
+		}); err != nil {
+			return nil, err
+		}
+		script.Content = content
+		script.UpdatedAt = now
+		return script, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	script = &model.SieveScript{
+		MailboxId: mailboxID,
+		Name:      name,
+		Content:   content,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.svcCtx.SieveScriptModel.Create(nil, script); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// SetActive 启用指定脚本（同时停用其他脚本），名称为空时停用所有脚本
+func (s *Service) SetActive(mailboxID int64, name string) error {
+	if name == "" {
+		return s.svcCtx.SieveScriptModel.SetActive(mailboxID, 0)
+	}
+
+	script, err := s.GetScript(mailboxID, name)
+	if err != nil {
+		return err
+	}
+	// 启用前重新检查，避免启用旧版本保存的无效脚本
+	if _, err := Parse(script.Content); err != nil {
+		return err
+	}
+	return s.svcCtx.SieveScriptModel.SetActive(mailboxID, script.Id)
+}
+
+// DeleteScript 删除脚本，启用中的脚本不能删除
+func (s *Service) DeleteScript(mailboxID int64, name string) error {
+	script, err := s.GetScript(mailboxID, name)
+	if err != nil {
+		return err
+	}
+	if script.IsActive {
+		return ErrScriptActive
+	}
+	return s.svcCtx.SieveScriptModel.Delete(nil, script.Id)
+}
+
+// RenameScript 重命名脚本
+func (s *Service) RenameScript(mailboxID int64, oldName, newName string) error {
+	if !ValidScriptName(newName) {
+		return ErrInvalidName
+	}
+
+	script, err := s.GetScript(mailboxID, oldName)
+	if err != nil {
+		return err
+	}
+	if oldName == newName {
+		return nil
+	}
+
+	if _, err := s.svcCtx.SieveScriptModel.GetByName(mailboxID, newName); err == nil {
+		return ErrScriptExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return s.svcCtx.SieveScriptModel.MapUpdate(nil, script.Id, map[string]interface{}{
+		"name":       newName,
+		"updated_at": time.Now(),
+	})
+}
+
+// ActiveScript 获取并编译邮箱启用的脚本，没有启用的脚本时返回nil
+func (s *Service) ActiveScript(mailboxID int64) (*Script, error) {
+	script, err := s.svcCtx.SieveScriptModel.GetActive(mailboxID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return Parse(script.Content)
+}
+
+// ValidScriptName 检查脚本名（RFC 5804：非空，不含控制字符）
+func ValidScriptName(name string) bool {
+	if name == "" || !utf8.ValidString(name) || utf8.RuneCountInString(name) > maxScriptNameLength {
+		return false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,322 @@
+package sieve
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMessage = "From: \"Alice Example\" <alice@example.org>\r\n" +
+	"To: bob@local.test, \"Carol\" <carol+lists@local.test>\r\n" +
+	"Cc: dave@other.test\r\n" +
+	"Subject: [Project-X] Weekly report\r\n" +
+	"List-Id: <project-x.lists.example.org>\r\n" +
+	"X-Priority: 1\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"\r\n" +
+	"Hello Bob,\r\n" +
+	"the quarterly numbers are attached.\r\n"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"空脚本", ""},
+		{"只有注释", "# comment\r\n/* block\r\n comment */\r\n"},
+		{"keep", "keep;"},
+		{"if/elsif/else", `require "fileinto";
+if header :contains "subject" "a" { fileinto "A"; }
+elsif header :is "subject" "b" { fileinto "B"; }
+else { keep; }`},
+		{"字符串列表和多行字符串", `require ["fileinto", "reject"];
+if address :domain :is ["from", "sender"] ["example.org", "example.net"] {
+  reject text:
+Go away.
+..with a leading dot
+.
+;
+}`},
+		{"测试列表", `if anyof (not exists "x-spam", allof (size :under 10K, true)) { stop; }`},
+		{"数字单位", `if size :over 1M { discard; } if size :under 1G { keep; }`},
+		{"扩展", `require ["fileinto", "variables", "imap4flags", "copy", "mailbox", "vacation", "envelope", "body"];
+set :lower :upperfirst "name" "${1}";
+addflag "\\Seen";
+fileinto :copy :create :flags ["\\Flagged"] "Archive";
+vacation :days 3 :subject "Away" :addresses ["bob@local.test"] "I am away";
+if envelope :all :is "from" "" { stop; }
+if body :text :contains "numbers" { keep; }`},
+		{"比较器", `if header :comparator "i;octet" :is "subject" "X" { keep; }`},
+		{"大小写不敏感的命令和标签", `IF HEADER :CONTAINS "Subject" "x" { KEEP; }`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.script); err != nil {
+				t.Fatalf("Parse 失败: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		line   int
+	}{
+		{"缺少分号", "keep", 1},
+		{"未知命令", "\nfoo;", 2},
+		{"未require扩展", `fileinto "A";`, 1},
+		{"不支持的扩展", `require "notify";`, 1},
+		{"require不在开头", "keep;\nrequire \"fileinto\";", 2},
+		{"else没有if", "else { keep; }", 1},
+		{"if没有块", `if true;`, 1},
+		{"if没有测试", `if { keep; }`, 1},
+		{"未结束的块", "if true {\n keep;\n", 3},
+		{"未结束的字符串", "reject \"abc;", 1},
+		{"未结束的注释", "/* abc", 1},
+		{"未结束的多行字符串", "require \"reject\";\nreject text:\nabc\n", 2},
+		{"未知测试", `if spam { keep; }`, 1},
+		{"未知比较器", `if header :comparator "i;unicode-casemap" :is "subject" "x" { keep; }`, 1},
+		{"重复的匹配类型", `if header :is :contains "subject" "x" { keep; }`, 1},
+		{"header缺少参数", `if header :is "subject" { keep; }`, 1},
+		{"无效的转发地址", `redirect "not an address";`, 1},
+		{"无效的变量名", "require \"variables\";\nset \"1abc\" \"x\";", 2},
+		{"冲突的set修饰符", "require \"variables\";\nset :lower :upper \"a\" \"b\";", 2},
+		{"keep不接受块", `keep { stop; }`, 1},
+		{"数字超出范围", `if size :over 99999999999999999999 { keep; }`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.script)
+			var sieveErr *Error
+			if !errors.As(err, &sieveErr) {
+				t.Fatalf("Parse 错误 = %v，期望 *Error", err)
+			}
+			if sieveErr.Line != tt.line {
+				t.Errorf("错误行号 = %d，期望 %d (%v)", sieveErr.Line, tt.line, err)
+			}
+		})
+	}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       string
+		envelopeFrom string
+		want         Result
+	}{
+		{
+			name:   "隐式keep",
+			script: ``,
+			want:   Result{Keep: true},
+		},
+		{
+			name:   "discard取消隐式keep",
+			script: `discard;`,
+			want:   Result{},
+		},
+		{
+			name:   "header contains 不区分大小写",
+			script: `require "fileinto"; if header :contains "subject" "project-x" { fileinto "Projects"; }`,
+			want:   Result{FileInto: []FileInto{{Folder: "Projects"}}},
+		},
+		{
+			name:   "i;octet 区分大小写",
+			script: `require "fileinto"; if header :comparator "i;octet" :contains "subject" "project-x" { fileinto "Projects"; }`,
+			want:   Result{Keep: true},
+		},
+		{
+			name:   "header matches 通配符",
+			script: `require "fileinto"; if header :matches "subject" "[*] Weekly ?eport" { fileinto "Weekly"; }`,
+			want:   Result{FileInto: []FileInto{{Folder: "Weekly"}}},
+		},
+		{
+			name: "elsif",
+			script: `require "fileinto";
+if header :is "subject" "nothing" { fileinto "A"; }
+elsif exists "list-id" { fileinto "Lists"; }
+else { fileinto "B"; }`,
+			want: Result{FileInto: []FileInto{{Folder: "Lists"}}},
+		},
+		{
+			name:   "address domain 匹配多个收件人头",
+			script: `require "fileinto"; if address :domain :is ["to", "cc"] "other.test" { fileinto "Other"; }`,
+			want:   Result{FileInto: []FileInto{{Folder: "Other"}}},
+		},
+		{
+			name:   "address localpart",
+			script: `require "fileinto"; if address :localpart :is "from" "alice" { fileinto "Alice"; }`,
+			want:   Result{FileInto: []FileInto{{Folder: "Alice"}}},
+		},
+		{
+			name:   "address all 不含显示名",
+			script: `if address :all :is "from" "Alice Example" { discard; }`,
+			want:   Result{Keep: true},
+		},
+		{
+			name:   "anyof 和 not",
+			script: `if anyof (not exists "x-priority", header :is "x-priority" "1") { discard; }`,
+			want:   Result{},
+		},
+		{
+			name:   "allof 短路",
+			script: `if allof (false, header :is "x-priority" "1") { discard; }`,
+			want:   Result{Keep: true},
+		},
+		{
+			name:   "size",
+			script: `if size :under 1K { discard; }`,
+			want:   Result{},
+		},
+		{
+			name:   "stop 之后不再执行",
+			script: `require "fileinto"; fileinto "A"; stop; fileinto "B";`,
+			want:   Result{FileInto: []FileInto{{Folder: "A"}}},
+		},
+		{
+			name:   "fileinto copy 保留隐式keep",
+			script: `require ["fileinto", "copy"]; fileinto :copy "Archive";`,
+			want:   Result{Keep: true, FileInto: []FileInto{{Folder: "Archive"}}},
+		},
+		{
+			name:   "同一文件夹只放入一次",
+			script: `require "fileinto"; fileinto "A"; fileinto "a";`,
+			want:   Result{FileInto: []FileInto{{Folder: "A"}}},
+		},
+		{
+			name:   "redirect 去重",
+			script: `redirect "x@remote.test"; redirect "X@remote.test";`,
+			want:   Result{Redirects: []string{"x@remote.test"}},
+		},
+		{
+			name:   "reject",
+			script: `require "reject"; if header :contains "subject" "report" { reject "no reports"; }`,
+			want:   Result{Reject: true, Reason: "no reports"},
+		},
+		{
+			name:         "envelope from",
+			script:       `require ["envelope", "fileinto"]; if envelope :domain :is "from" "bounces.example.org" { fileinto "Bounces"; }`,
+			envelopeFrom: "list-bounce@bounces.example.org",
+			want:         Result{FileInto: []FileInto{{Folder: "Bounces"}}},
+		},
+		{
+			name:   "空信封发件人",
+			script: `require "envelope"; if envelope :is "from" "" { discard; }`,
+			want:   Result{},
+		},
+		{
+			name:   "body text",
+			script: `require ["body", "fileinto"]; if body :text :contains "quarterly" { fileinto "Finance"; }`,
+			want:   Result{FileInto: []FileInto{{Folder: "Finance"}}},
+		},
+		{
+			name: "matches 变量",
+			script: `require ["variables", "fileinto"];
+if header :matches "list-id" "<*.lists.example.org>" { fileinto "Lists/${1}"; }`,
+			want: Result{FileInto: []FileInto{{Folder: "Lists/project-x"}}},
+		},
+		{
+			name: "set 修饰符",
+			script: `require ["variables", "fileinto"];
+set :upperfirst :lower "folder" "ARCHIVE";
+set :length "len" "${folder}";
+fileinto "${folder}-${len}";`,
+			want: Result{FileInto: []FileInto{{Folder: "Archive-7"}}},
+		},
+		{
+			name:   "未require variables 时不展开",
+			script: `require "fileinto"; fileinto "${folder}";`,
+			want:   Result{FileInto: []FileInto{{Folder: "${folder}"}}},
+		},
+		{
+			name: "imap4flags",
+			script: `require ["imap4flags", "fileinto"];
+setflag "\\Seen \\Flagged";
+removeflag "\\Seen";
+addflag ["$Work", "\\Flagged"];
+if hasflag :is "$work" { fileinto "Work"; }`,
+			want: Result{FileInto: []FileInto{{Folder: "Work", Flags: []string{`\Flagged`, "$Work"}}}},
+		},
+		{
+			name:   "隐式keep使用内部标志",
+			script: `require "imap4flags"; addflag "\\Seen";`,
+			want:   Result{Keep: true, KeepFlags: []string{`\Seen`}},
+		},
+		{
+			name:   "vacation",
+			script: `require "vacation"; vacation :days 0 :subject "Away" :handle "h1" "Back on Monday";`,
+			want: Result{Keep: true, Vacation: &Vacation{
+				Days: 1, Subject: "Away", Handle: "h1", Reason: "Back on Monday",
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := Parse(tt.script)
+			if err != nil {
+				t.Fatalf("Parse 失败: %v", err)
+			}
+			got, err := script.Execute(NewMessage([]byte(testMessage), tt.envelopeFrom, "bob@local.test"), Options{})
+			if err != nil {
+				t.Fatalf("Execute 失败: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("结果 = %+v，期望 %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		opts   Options
+		want   string
+	}{
+		{"reject 不能与 keep 同时使用", `require "reject"; keep; reject "no";`, Options{}, "reject cannot be combined"},
+		{"reject 不能与 fileinto 同时使用", `require ["reject", "fileinto"]; fileinto "A"; reject "no";`, Options{}, "reject cannot be combined"},
+		{"只能有一个 vacation", `require "vacation"; vacation "a"; vacation "b";`, Options{}, "only one vacation"},
+		{"转发数量超过限制", `redirect "a@remote.test"; redirect "b@remote.test";`, Options{MaxRedirects: 1}, "too many redirects"},
+		{"变量展开后的转发地址无效", `require "variables"; set "to" "nobody"; redirect "${to}";`, Options{}, "invalid address"},
+		{"变量展开后的文件夹为空", `require ["variables", "fileinto"]; fileinto "${none}";`, Options{}, "empty folder"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := Parse(tt.script)
+			if err != nil {
+				t.Fatalf("Parse 失败: %v", err)
+			}
+			_, err = script.Execute(NewMessage([]byte(testMessage), "", "bob@local.test"), tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Execute 错误 = %v，期望包含 %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVacationDefaultHandle(t *testing.T) {
+	handle := func(src string) string {
+		t.Helper()
+		script, err := Parse(src)
+		if err != nil {
+			t.Fatalf("Parse 失败: %v", err)
+		}
+		result, err := script.Execute(NewMessage([]byte(testMessage), "alice@example.org", "bob@local.test"), Options{})
+		if err != nil {
+			t.Fatalf("Execute 失败: %v", err)
+		}
+		return result.Vacation.Handle
+	}
+
+	a := handle(`require "vacation"; vacation "Back on Monday";`)
+	if a == "" || a != handle(`require "vacation"; vacation "Back on Monday";`) {
+		t.Errorf("相同的回复内容应生成相同的标识")
+	}
+	if a == handle(`require "vacation"; vacation "Back on Tuesday";`) {
+		t.Errorf("修改回复内容后应生成不同的标识")
+	}
+}
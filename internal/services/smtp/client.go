@@ -5,6 +5,8 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"miko-email/internal/config"
+	"miko-email/internal/model"
 	"miko-email/internal/services/dkim"
 	"miko-email/internal/svc"
 	"net"
@@ -33,7 +35,7 @@ func NewOutboundClient(domain string) *OutboundClient {
 func NewOutboundClientWithDB(db *sql.DB, svcCtx *svc.ServiceContext) *OutboundClient {
 	return &OutboundClient{
 		db:          db,
-		dkimService: dkim.NewService("./dkim_keys"),
+		dkimService: dkim.NewService(svcCtx, "./dkim_keys"),
 		svcCtx:      svcCtx,
 	}
 }
@@ -42,129 +44,82 @@ func NewOutboundClientWithDB(db *sql.DB, svcCtx *svc.ServiceContext) *OutboundCl
 func NewOutboundClientWithSvcCtx(svcCtx *svc.ServiceContext) *OutboundClient {
 	return &OutboundClient{
 		svcCtx:      svcCtx,
-		dkimService: dkim.NewService("./dkim_keys"),
+		dkimService: dkim.NewService(svcCtx, "./dkim_keys"),
 	}
 }
 
-// SendEmail 通过MX记录直接发送邮件
-func (c *OutboundClient) SendEmail(from, to, subject, body string) error {
-	// 验证发件人是否为本域名邮箱
-	if !c.isLocalEmail(from) {
-		return fmt.Errorf("发件人必须是本域名邮箱: %s", from)
-	}
-
-	// 提取收件人域名
-	toDomain := extractDomain(to)
-	if toDomain == "" {
-		return fmt.Errorf("无效的收件人邮箱地址: %s", to)
-	}
-
-	log.Printf("开始MX直接发送: %s -> %s", from, to)
-
-	// 检查是否为本地域名，如果是，使用本地MX服务器
-	if c.isLocalDomain(toDomain) {
-		log.Printf("本地域名邮件，使用本地MX服务器: %s", toDomain)
-		return c.sendToLocalMX(from, to, subject, body)
-	}
-
-	// 查询收件人域名的MX记录
-	mxRecords, err := net.LookupMX(toDomain)
-	if err != nil {
-		return fmt.Errorf("查询MX记录失败 (%s): %v", toDomain, err)
-	}
-
-	if len(mxRecords) == 0 {
-		return fmt.Errorf("域名 %s 没有MX记录", toDomain)
-	}
-
-	// 按优先级排序，选择优先级最高的MX记录
-	var bestMX *net.MX
-	for _, mx := range mxRecords {
-		if bestMX == nil || mx.Pref < bestMX.Pref {
-			bestMX = mx
-		}
-	}
-
-	mxHost := strings.TrimSuffix(bestMX.Host, ".")
-	log.Printf("使用MX服务器: %s (优先级: %d)", mxHost, bestMX.Pref)
-
-	// 构建邮件内容
-	message := c.buildMessage(from, to, subject, body)
-
-	// 尝试连接到MX服务器的25端口
-	addr := fmt.Sprintf("%s:25", mxHost)
-
-	// 使用重试机制
-	maxRetries := 3
-	for i := 0; i < maxRetries; i++ {
-		log.Printf("尝试连接MX服务器 %s (第%d次)", addr, i+1)
-
-		err = c.sendDirectSMTP(addr, from, to, message, mxHost)
-		if err == nil {
-			log.Printf("✅ MX直接发送成功: %s -> %s", from, to)
-			return nil
-		}
-
-		log.Printf("MX发送失败 (第%d次): %v", i+1, err)
-
-		// 如果不是最后一次重试，等待一段时间再重试
-		if i < maxRetries-1 {
-			time.Sleep(time.Duration(i+1) * 2 * time.Second)
-		}
-	}
-
-	return fmt.Errorf("MX直接发送失败，已重试%d次: %v", maxRetries, err)
+// QueueEmail 构建纯文本邮件并加入出站队列，由后台协程投递
+func (c *OutboundClient) QueueEmail(from string, to []string, subject, body string) (*model.OutboundMessage, error) {
+	message := c.buildMessage(from, strings.Join(to, ", "), subject, body)
+	return c.QueueMIMEEmail(from, to, message)
 }
 
-// sendDirectSMTP 直接SMTP发送（无认证）
+// sendDirectSMTP 直接SMTP发送（无认证），远程服务器的响应错误以 *textproto.Error 返回
 func (c *OutboundClient) sendDirectSMTP(addr, from, to string, message []byte, hostname string) error {
 	// 连接到SMTP服务器
 	conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
 	if err != nil {
-		return fmt.Errorf("连接失败: %v", err)
+		return fmt.Errorf("连接失败: %w", err)
 	}
 	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(smtpSessionTimeout))
 
 	// 创建SMTP客户端
 	client, err := smtp.NewClient(conn, hostname)
 	if err != nil {
-		return fmt.Errorf("创建SMTP客户端失败: %v", err)
+		return fmt.Errorf("创建SMTP客户端失败: %w", err)
 	}
 	defer client.Close()
 
+	if err = client.Hello(c.heloName(from)); err != nil {
+		return fmt.Errorf("EHLO失败: %w", err)
+	}
+
 	// 设置发件人
 	log.Printf("设置发件人: %s", from)
 	if err = client.Mail(from); err != nil {
-		return fmt.Errorf("设置发件人失败: %v", err)
+		return fmt.Errorf("设置发件人失败: %w", err)
 	}
 
 	// 设置收件人
 	log.Printf("设置收件人: %s", to)
 	if err = client.Rcpt(to); err != nil {
-		return fmt.Errorf("设置收件人失败: %v", err)
+		return fmt.Errorf("设置收件人失败: %w", err)
 	}
 
 	// 发送邮件内容
 	log.Printf("开始发送邮件内容")
 	w, err := client.Data()
 	if err != nil {
-		return fmt.Errorf("开始发送邮件内容失败: %v", err)
+		return fmt.Errorf("开始发送邮件内容失败: %w", err)
 	}
 
 	_, err = w.Write(message)
 	if err != nil {
-		return fmt.Errorf("写入邮件内容失败: %v", err)
+		return fmt.Errorf("写入邮件内容失败: %w", err)
 	}
 
 	err = w.Close()
 	if err != nil {
-		return fmt.Errorf("关闭数据写入器失败: %v", err)
+		return fmt.Errorf("关闭数据写入器失败: %w", err)
 	}
 
 	log.Printf("邮件内容发送完成")
 	return client.Quit()
 }
 
+// heloName 对外投递时EHLO使用的主机名：优先使用配置的 smtp_hostname，否则使用 mail.<发件域名>
+func (c *OutboundClient) heloName(from string) string {
+	if hostname := config.GetSMTPHostname(); hostname != "" {
+		return hostname
+	}
+	domain := c.getDomainForSender(extractDomain(from))
+	if strings.HasPrefix(domain, "mail.") {
+		return domain
+	}
+	return "mail." + domain
+}
+
 // buildMessage 构建邮件消息
 func (c *OutboundClient) buildMessage(from, to, subject, body string) []byte {
 	// 清理HTML标签，确保发送纯文本邮件
@@ -234,21 +189,7 @@ func (c *OutboundClient) buildMessage(from, to, subject, body string) []byte {
 	message.WriteString("\r\n")
 	message.WriteString(encodedBody)
 
-	emailContent := []byte(message.String())
-
-	// 如果有DKIM服务，对邮件进行签名
-	if c.dkimService != nil && fromDomain != "" {
-		signedContent, err := c.dkimService.SignEmail(fromDomain, "default", emailContent)
-		if err != nil {
-			log.Printf("DKIM签名失败: %v", err)
-			// 签名失败时返回原始邮件
-			return emailContent
-		}
-		log.Printf("邮件已进行DKIM签名，域名: %s", fromDomain)
-		return signedContent
-	}
-
-	return emailContent
+	return []byte(message.String())
 }
 
 // isLocalEmail 检查是否为本地域名邮箱
@@ -302,40 +243,6 @@ func (c *OutboundClient) isLocalDomain(domain string) bool {
 	return domain == c.domain
 }
 
-// sendToLocalMX 发送邮件到本地MX服务器
-func (c *OutboundClient) sendToLocalMX(from, to, subject, body string) error {
-	// 构建邮件内容
-	message := c.buildMessage(from, to, subject, body)
-
-	// 根据发件人邮箱获取域名
-	fromDomain := extractDomain(from)
-	localDomain := c.getDomainForSender(fromDomain)
-
-	// 本地MX服务器地址和端口
-	localMXServers := []string{
-		"127.0.0.1:25",
-		"127.0.0.1:587",
-		"127.0.0.1:465",
-	}
-
-	// 尝试连接到本地MX服务器
-	var lastErr error
-	for _, addr := range localMXServers {
-		log.Printf("尝试连接本地MX服务器: %s (域名: %s)", addr, localDomain)
-
-		err := c.sendDirectSMTP(addr, from, to, message, localDomain)
-		if err == nil {
-			log.Printf("✅ 本地MX发送成功: %s -> %s (通过 %s, 域名: %s)", from, to, addr, localDomain)
-			return nil
-		}
-
-		log.Printf("本地MX服务器 %s 连接失败: %v", addr, err)
-		lastErr = err
-	}
-
-	return fmt.Errorf("所有本地MX服务器连接失败，最后错误: %v", lastErr)
-}
-
 // getDomainForSender 根据发件人域名获取对应的域名配置
 func (c *OutboundClient) getDomainForSender(senderDomain string) string {
 	// 如果发件人域名不为空且不是localhost，直接使用发件人域名
@@ -469,161 +376,3 @@ func stripHTMLTags(html string) string {
 
 	return text
 }
-
-// LogSendAttempt 记录发送尝试
-func (c *OutboundClient) LogSendAttempt(from, to, subject string, err error) {
-	if err != nil {
-		log.Printf("❌ MX发送失败 - From: %s, To: %s, Subject: %s, Error: %v", from, to, subject, err)
-	} else {
-		log.Printf("✅ MX发送成功 - From: %s, To: %s, Subject: %s", from, to, subject)
-	}
-}
-
-// SendMIMEEmail 发送MIME格式邮件（支持附件）
-func (c *OutboundClient) SendMIMEEmail(from, to, mimeContent string) error {
-	// 验证发件人是否为本域名邮箱
-	if !c.isLocalEmail(from) {
-		return fmt.Errorf("发件人必须是本域名邮箱: %s", from)
-	}
-
-	// 提取收件人域名
-	toDomain := extractDomain(to)
-	if toDomain == "" {
-		return fmt.Errorf("无效的收件人邮箱地址: %s", to)
-	}
-
-	log.Printf("开始MX直接发送MIME邮件: %s -> %s", from, to)
-
-	// 检查是否为本地域名，如果是，使用本地MX服务器
-	if c.isLocalDomain(toDomain) {
-		return c.sendMIMEToLocalMX(from, to, mimeContent)
-	}
-
-	// 外部域名，通过MX记录发送
-	return c.sendMIMEToExternalMX(from, to, toDomain, mimeContent)
-}
-
-// sendMIMEToLocalMX 发送MIME邮件到本地MX服务器
-func (c *OutboundClient) sendMIMEToLocalMX(from, to, mimeContent string) error {
-	fromDomain := extractDomain(from)
-	localDomain := c.getDomainForSender(fromDomain)
-
-	log.Printf("本地域名邮件，使用本地MX服务器: %s (域名: %s)", extractDomain(to), localDomain)
-	log.Printf("尝试连接本地MX服务器: 127.0.0.1:25")
-
-	// 连接本地SMTP服务器
-	conn, err := net.Dial("tcp", "127.0.0.1:25")
-	if err != nil {
-		return fmt.Errorf("连接本地MX服务器失败: %w", err)
-	}
-	defer conn.Close()
-
-	client, err := smtp.NewClient(conn, localDomain)
-	if err != nil {
-		return fmt.Errorf("创建SMTP客户端失败: %w", err)
-	}
-	defer client.Quit()
-
-	// 设置发件人
-	if err := client.Mail(from); err != nil {
-		return fmt.Errorf("设置发件人失败: %w", err)
-	}
-
-	// 设置收件人
-	if err := client.Rcpt(to); err != nil {
-		return fmt.Errorf("设置收件人失败: %w", err)
-	}
-
-	// 发送邮件内容
-	w, err := client.Data()
-	if err != nil {
-		return fmt.Errorf("开始发送邮件内容失败: %w", err)
-	}
-
-	_, err = w.Write([]byte(mimeContent))
-	if err != nil {
-		return fmt.Errorf("写入邮件内容失败: %w", err)
-	}
-
-	err = w.Close()
-	if err != nil {
-		return fmt.Errorf("完成邮件内容发送失败: %w", err)
-	}
-
-	log.Printf("✅ 本地MX发送成功: %s -> %s (通过 %s:25)", from, to, localDomain)
-	return nil
-}
-
-// sendMIMEToExternalMX 发送MIME邮件到外部MX服务器
-func (c *OutboundClient) sendMIMEToExternalMX(from, to, domain, mimeContent string) error {
-	// 查询MX记录
-	mxRecords, err := net.LookupMX(domain)
-	if err != nil {
-		return fmt.Errorf("查询MX记录失败: %w", err)
-	}
-
-	if len(mxRecords) == 0 {
-		return fmt.Errorf("域名 %s 没有MX记录", domain)
-	}
-
-	// 按优先级排序并尝试连接
-	for i, mx := range mxRecords {
-		log.Printf("使用MX服务器: %s (优先级: %d)", mx.Host, mx.Pref)
-
-		err = c.sendMIMEToMXServer(from, to, mx.Host, mimeContent, i+1)
-		if err == nil {
-			log.Printf("✅ MX直接发送成功: %s -> %s", from, to)
-			return nil
-		}
-
-		log.Printf("MX服务器 %s 发送失败: %v", mx.Host, err)
-	}
-
-	return fmt.Errorf("所有MX服务器都发送失败")
-}
-
-// sendMIMEToMXServer 发送MIME邮件到指定MX服务器
-func (c *OutboundClient) sendMIMEToMXServer(from, to, mxHost, mimeContent string, attempt int) error {
-	log.Printf("尝试连接MX服务器 %s:25 (第%d次)", mxHost, attempt)
-
-	// 连接MX服务器
-	conn, err := net.DialTimeout("tcp", mxHost+":25", 30*time.Second)
-	if err != nil {
-		return fmt.Errorf("连接MX服务器失败: %w", err)
-	}
-	defer conn.Close()
-
-	client, err := smtp.NewClient(conn, mxHost)
-	if err != nil {
-		return fmt.Errorf("创建SMTP客户端失败: %w", err)
-	}
-	defer client.Quit()
-
-	// 设置发件人
-	if err := client.Mail(from); err != nil {
-		return fmt.Errorf("设置发件人失败: %w", err)
-	}
-
-	// 设置收件人
-	if err := client.Rcpt(to); err != nil {
-		return fmt.Errorf("设置收件人失败: %w", err)
-	}
-
-	// 发送邮件内容
-	w, err := client.Data()
-	if err != nil {
-		return fmt.Errorf("开始发送邮件内容失败: %w", err)
-	}
-
-	_, err = w.Write([]byte(mimeContent))
-	if err != nil {
-		return fmt.Errorf("写入邮件内容失败: %w", err)
-	}
-
-	err = w.Close()
-	if err != nil {
-		return fmt.Errorf("完成邮件内容发送失败: %w", err)
-	}
-
-	return nil
-}
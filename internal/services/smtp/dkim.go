@@ -0,0 +1,47 @@
+package smtp
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+	"miko-email/internal/services/dkim"
+)
+
+// signMessage 使用发件人域名当前的DKIM密钥对邮件签名（同时有RSA和Ed25519密钥时双重签名）
+// 已验证的域名没有签名密钥或签名失败时返回错误，不发送未签名的邮件
+func (c *OutboundClient) signMessage(from string, message []byte) ([]byte, error) {
+	fromDomain := extractDomain(from)
+	if fromDomain == "" || c.dkimService == nil || c.svcCtx == nil {
+		return message, nil
+	}
+
+	domain, err := c.svcCtx.DomainModel.GetByName(fromDomain)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return message, nil
+		}
+		return nil, fmt.Errorf("查询发件域名失败: %w", err)
+	}
+
+	headerKeys, err := dkim.ParseSignedHeaders(domain.DKIMHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("域名 %s 的DKIM签名邮件头配置无效: %w", fromDomain, err)
+	}
+
+	signed, selectors, err := c.dkimService.Sign(domain, headerKeys, message)
+	if err != nil {
+		if errors.Is(err, dkim.ErrNoSigningKey) && !domain.IsVerified {
+			log.Printf("域名 %s 没有DKIM密钥，邮件未签名", fromDomain)
+			return message, nil
+		}
+		if errors.Is(err, dkim.ErrNoSigningKey) {
+			return nil, fmt.Errorf("域名 %s 已验证但没有DKIM签名密钥，拒绝发送未签名的邮件", fromDomain)
+		}
+		return nil, err
+	}
+	log.Printf("邮件已进行DKIM签名，域名: %s，选择器: %s", fromDomain, strings.Join(selectors, ", "))
+	return signed, nil
+}
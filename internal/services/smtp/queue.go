@@ -0,0 +1,244 @@
+package smtp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"miko-email/internal/model"
+)
+
+// smtpSessionTimeout 单次SMTP投递会话的最长时间
+const smtpSessionTimeout = 5 * time.Minute
+
+// enhancedStatusPattern 匹配SMTP响应中的增强状态码（RFC 3463）
+var enhancedStatusPattern = regexp.MustCompile(`^([245]\.\d{1,3}\.\d{1,3})\b`)
+
+// DeliveryError 投递失败的详细信息
+type DeliveryError struct {
+	Permanent bool   // 是否为永久失败（5xx响应、域名不存在等），永久失败不再重试
+	RemoteMTA string // 远程服务器
+	Status    string // 增强状态码（RFC 3463），如 5.1.1
+	Err       error
+}
+
+func (e *DeliveryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// QueueMIMEEmail 将完整的邮件报文加入出站队列，由后台协程按收件人分别投递
+// from 为空表示空信封发件人（退信等系统邮件），这类邮件投递失败时不会再产生退信
+func (c *OutboundClient) QueueMIMEEmail(from string, to []string, message []byte) (*model.OutboundMessage, error) {
+	if c.svcCtx == nil {
+		return nil, fmt.Errorf("出站队列不可用")
+	}
+
+	// 验证发件人是否为本域名邮箱
+	if from != "" && !c.isLocalEmail(from) {
+		return nil, fmt.Errorf("发件人必须是本域名邮箱: %s", from)
+	}
+
+	var recipients []string
+	seen := make(map[string]bool)
+	for _, recipient := range to {
+		recipient = strings.TrimSpace(recipient)
+		if recipient == "" || seen[strings.ToLower(recipient)] {
+			continue
+		}
+		if extractDomain(recipient) == "" {
+			return nil, fmt.Errorf("无效的收件人邮箱地址: %s", recipient)
+		}
+		seen[strings.ToLower(recipient)] = true
+		recipients = append(recipients, recipient)
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("没有有效的收件人")
+	}
+
+	// 投递时才进行DKIM签名（每次重试重新签名），这里提前检查，无法签名时直接拒绝
+	if _, err := c.signMessage(from, message); err != nil {
+		return nil, fmt.Errorf("DKIM签名失败: %w", err)
+	}
+
+	messageID, subject := parseQueuedHeaders(message)
+	queued := &model.OutboundMessage{
+		MessageId: messageID,
+		Sender:    from,
+		Subject:   subject,
+		Content:   message,
+	}
+	if from != "" {
+		if mailboxID, err := c.svcCtx.MailboxModel.GetIdByEmail(from); err == nil {
+			queued.MailboxId = mailboxID
+		}
+	}
+
+	if _, err := c.svcCtx.OutboundQueueModel.Enqueue(queued, recipients); err != nil {
+		return nil, fmt.Errorf("加入出站队列失败: %w", err)
+	}
+
+	log.Printf("邮件已加入出站队列: #%d %s -> %s", queued.Id, from, strings.Join(recipients, ", "))
+	c.svcCtx.QueueNotifier.Notify()
+
+	return queued, nil
+}
+
+// Deliver 将邮件投递给一个收件人：本地域名投递到本机SMTP服务，外部域名按MX记录投递
+// 返回接收邮件的服务器；失败时返回 *DeliveryError
+func (c *OutboundClient) Deliver(from, to string, message []byte) (string, error) {
+	toDomain := extractDomain(to)
+	if toDomain == "" {
+		return "", &DeliveryError{Permanent: true, Status: "5.1.3", Err: fmt.Errorf("无效的收件人邮箱地址: %s", to)}
+	}
+
+	signed, err := c.signMessage(from, message)
+	if err != nil {
+		// 签名失败（如密钥缺失）由管理员修复后可以继续投递，按临时失败处理
+		return "", &DeliveryError{Status: "4.7.0", Err: fmt.Errorf("DKIM签名失败: %w", err)}
+	}
+	message = signed
+
+	if c.isLocalDomain(toDomain) {
+		return c.deliverLocal(from, to, message)
+	}
+
+	hosts, err := lookupMXHosts(toDomain)
+	if err != nil {
+		return "", err
+	}
+
+	var lastErr *DeliveryError
+	for _, host := range hosts {
+		log.Printf("尝试投递到MX服务器: %s (%s -> %s)", host, from, to)
+		err := c.sendDirectSMTP(net.JoinHostPort(host, "25"), from, to, message, host)
+		if err == nil {
+			log.Printf("✅ MX投递成功: %s -> %s (通过 %s)", from, to, host)
+			return host, nil
+		}
+
+		lastErr = classifyDeliveryError(err)
+		lastErr.RemoteMTA = host
+		log.Printf("MX服务器 %s 投递失败: %v", host, err)
+
+		// 服务器明确拒绝，不再尝试其他MX
+		if lastErr.Permanent {
+			return host, lastErr
+		}
+	}
+
+	return lastErr.RemoteMTA, lastErr
+}
+
+// deliverLocal 投递到本机SMTP服务（本地域名的收件人）
+func (c *OutboundClient) deliverLocal(from, to string, message []byte) (string, error) {
+	ports := []string{"25"}
+	if c.svcCtx != nil {
+		ports = []string{c.svcCtx.Config.SMTPPort, c.svcCtx.Config.SMTPPort587}
+	}
+	hostname := c.getDomainForSender(extractDomain(from))
+
+	var lastErr *DeliveryError
+	for _, port := range ports {
+		if port == "" || port == "0" {
+			continue
+		}
+		addr := net.JoinHostPort("127.0.0.1", port)
+		err := c.sendDirectSMTP(addr, from, to, message, hostname)
+		if err == nil {
+			log.Printf("✅ 本地投递成功: %s -> %s (通过 %s)", from, to, addr)
+			return "localhost", nil
+		}
+
+		lastErr = classifyDeliveryError(err)
+		lastErr.RemoteMTA = "localhost"
+		log.Printf("本地SMTP服务 %s 投递失败: %v", addr, err)
+		if lastErr.Permanent {
+			break
+		}
+	}
+
+	if lastErr == nil {
+		return "", &DeliveryError{Status: "4.3.0", Err: fmt.Errorf("没有可用的本地SMTP端口")}
+	}
+	return lastErr.RemoteMTA, lastErr
+}
+
+// lookupMXHosts 查询收件人域名的MX服务器（已按优先级排序），没有MX记录时使用域名本身（RFC 5321 5.1）
+func lookupMXHosts(domain string) ([]string, error) {
+	mxRecords, err := net.LookupMX(domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			if _, err := net.LookupHost(domain); err == nil {
+				return []string{domain}, nil
+			}
+			return nil, &DeliveryError{Permanent: true, Status: "5.1.2", Err: fmt.Errorf("收件人域名不存在: %s", domain)}
+		}
+		return nil, &DeliveryError{Status: "4.4.3", Err: fmt.Errorf("查询MX记录失败 (%s): %w", domain, err)}
+	}
+
+	var hosts []string
+	for _, mx := range mxRecords {
+		host := strings.TrimSuffix(mx.Host, ".")
+		// Null MX（RFC 7505）：域名不接收邮件
+		if host == "" {
+			return nil, &DeliveryError{Permanent: true, Status: "5.1.10", Err: fmt.Errorf("域名 %s 不接收邮件 (Null MX)", domain)}
+		}
+		hosts = append(hosts, host)
+	}
+	if len(hosts) == 0 {
+		return nil, &DeliveryError{Status: "4.4.3", Err: fmt.Errorf("域名 %s 没有MX记录", domain)}
+	}
+	return hosts, nil
+}
+
+// classifyDeliveryError 根据SMTP响应区分永久失败（5xx）和临时失败（4xx、网络错误）
+func classifyDeliveryError(err error) *DeliveryError {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		status := ""
+		if m := enhancedStatusPattern.FindStringSubmatch(protoErr.Msg); m != nil {
+			status = m[1]
+		}
+		if protoErr.Code >= 500 {
+			if status == "" || status[0] != '5' {
+				status = "5.0.0"
+			}
+			return &DeliveryError{Permanent: true, Status: status, Err: err}
+		}
+		if status == "" || status[0] != '4' {
+			status = "4.0.0"
+		}
+		return &DeliveryError{Status: status, Err: err}
+	}
+
+	// 连接失败、超时等网络错误
+	return &DeliveryError{Status: "4.4.1", Err: err}
+}
+
+// parseQueuedHeaders 从邮件原文中提取Message-ID和主题
+func parseQueuedHeaders(message []byte) (messageID, subject string) {
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		return "", ""
+	}
+
+	messageID = strings.TrimSpace(msg.Header.Get("Message-ID"))
+	subject = msg.Header.Get("Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	return messageID, subject
+}
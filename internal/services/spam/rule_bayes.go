@@ -0,0 +1,30 @@
+package spam
+
+import "fmt"
+
+// Classifier 贝叶斯分类器，返回邮件是垃圾邮件的概率，训练数据不足时 ok 为false
+type Classifier interface {
+	SpamProbability(msg *Message) (probability float64, ok bool)
+}
+
+// SetClassifier 注册贝叶斯分类器规则
+func (e *Engine) SetClassifier(classifier Classifier) {
+	e.Register(&bayesRule{classifier: classifier})
+}
+
+// bayesRule 按分类器给出的概率评分
+type bayesRule struct {
+	classifier Classifier
+}
+
+func (r *bayesRule) Name() string {
+	return "bayes"
+}
+
+func (r *bayesRule) Check(msg *Message) []Hit {
+	probability, ok := r.classifier.SpamProbability(msg)
+	if !ok {
+		return nil
+	}
+	return []Hit{{Name: "BAYES", Factor: probability*2 - 1, Detail: fmt.Sprintf("%.3f", probability)}}
+}
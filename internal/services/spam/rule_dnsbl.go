@@ -0,0 +1,25 @@
+package spam
+
+import "fmt"
+
+// dnsblRule 将连接时查询到的DNS黑名单结果（action 为 score 的黑名单）计入评分
+type dnsblRule struct{}
+
+func (r *dnsblRule) Name() string {
+	return "dnsbl"
+}
+
+func (r *dnsblRule) Check(msg *Message) []Hit {
+	var hits []Hit
+	for _, listing := range msg.DNSBL {
+		if listing.Action != "score" {
+			continue
+		}
+		name := "RCVD_IN_DNSBL"
+		if listing.Type == "domain" {
+			name = "HELO_IN_DNSBL"
+		}
+		hits = append(hits, Hit{Name: name, Factor: 1, Detail: fmt.Sprintf("%s (%s)", listing.Zone, listing.Code)})
+	}
+	return hits
+}
@@ -0,0 +1,59 @@
+package spam
+
+import (
+	"log"
+	"time"
+
+	"miko-email/internal/svc"
+)
+
+// 发件人信誉统计的时间范围和最少邮件数
+const (
+	reputationWindow   = 90 * 24 * time.Hour
+	reputationMinCount = 3
+)
+
+// reputationRule 根据历史邮件评估发件人信誉
+type reputationRule struct {
+	svcCtx *svc.ServiceContext
+}
+
+func (r *reputationRule) Name() string {
+	return "reputation"
+}
+
+func (r *reputationRule) Check(msg *Message) []Hit {
+	// 信封发件人可以伪造，只对SPF通过或与DMARC对齐的发件人使用历史记录，避免冒充熟人降低得分
+	if msg.MailFrom == "" || msg.Auth == nil || !msg.Auth.Authenticates(msg.MailFrom) {
+		return nil
+	}
+
+	var hits []Hit
+
+	// 收件人给发件人发过邮件，视为熟人
+	for _, mailboxID := range msg.MailboxIds {
+		count, err := r.svcCtx.EmailModel.CountSentTo(mailboxID, msg.MailFrom)
+		if err != nil {
+			log.Printf("查询发件人往来记录失败: %v", err)
+			break
+		}
+		if count > 0 {
+			hits = append(hits, Hit{Name: "SENDER_KNOWN", Factor: 1})
+			break
+		}
+	}
+
+	// 发件人最近的邮件中被放入垃圾邮件的比例：全部正常为-1，全部垃圾为1
+	total, junk, err := r.svcCtx.EmailModel.CountReceivedFrom(msg.MailFrom, time.Now().Add(-reputationWindow))
+	if err != nil {
+		log.Printf("查询发件人信誉失败: %v", err)
+		return hits
+	}
+	if total >= reputationMinCount {
+		factor := float64(junk)/float64(total)*2 - 1
+		if factor != 0 {
+			hits = append(hits, Hit{Name: "SENDER_REPUTATION", Factor: factor})
+		}
+	}
+	return hits
+}
@@ -0,0 +1,90 @@
+package spam
+
+import (
+	"html"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	urlPattern    = regexp.MustCompile(`(?i)https?://[^\s"'<>()]+`)
+	anchorPattern = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']?(https?://[^"'\s>]+)[^>]*>(.*?)</a>`)
+	tagPattern    = regexp.MustCompile(`<[^>]*>`)
+	domainPattern = regexp.MustCompile(`(?i)^(https?://)?(www\.)?([a-z0-9-]+\.)+[a-z]{2,}(/\S*)?$`)
+)
+
+// urlShorteners 常见的短链接域名
+var urlShorteners = map[string]bool{
+	"bit.ly": true, "t.co": true, "tinyurl.com": true, "goo.gl": true, "ow.ly": true, "is.gd": true,
+	"buff.ly": true, "rebrand.ly": true, "cutt.ly": true, "t.ly": true, "shorturl.at": true, "rb.gy": true,
+}
+
+// 链接数量超过该值时计为 URI_MANY
+const manyURLs = 20
+
+// urlRule 检查正文中的可疑链接
+type urlRule struct{}
+
+func (r *urlRule) Name() string {
+	return "url"
+}
+
+func (r *urlRule) Check(msg *Message) []Hit {
+	if msg.Envelope == nil {
+		return nil
+	}
+
+	var hits []Hit
+	urls := urlPattern.FindAllString(msg.Envelope.Text+"\n"+msg.Envelope.HTML, -1)
+
+	var ipHost, shortener string
+	for _, raw := range urls {
+		host := urlHost(raw)
+		if host == "" {
+			continue
+		}
+		if ipHost == "" && net.ParseIP(strings.Trim(host, "[]")) != nil {
+			ipHost = host
+		}
+		if shortener == "" && urlShorteners[strings.TrimPrefix(host, "www.")] {
+			shortener = host
+		}
+	}
+	if ipHost != "" {
+		hits = append(hits, Hit{Name: "URI_IP_HOST", Factor: 1, Detail: ipHost})
+	}
+	if shortener != "" {
+		hits = append(hits, Hit{Name: "URI_SHORTENER", Factor: 1, Detail: shortener})
+	}
+	if len(urls) > manyURLs {
+		hits = append(hits, Hit{Name: "URI_MANY", Factor: 1})
+	}
+
+	// 链接文字显示的域名与实际链接不同，如 <a href="http://evil.com">https://bank.com</a>
+	for _, m := range anchorPattern.FindAllStringSubmatch(msg.Envelope.HTML, -1) {
+		text := strings.TrimSpace(html.UnescapeString(tagPattern.ReplaceAllString(m[2], "")))
+		if !domainPattern.MatchString(text) {
+			continue
+		}
+		if !strings.Contains(text, "://") {
+			text = "http://" + text
+		}
+		shown, actual := urlHost(text), urlHost(m[1])
+		if shown != "" && actual != "" && strings.TrimPrefix(shown, "www.") != strings.TrimPrefix(actual, "www.") {
+			hits = append(hits, Hit{Name: "URI_MISMATCH", Factor: 1, Detail: shown + " -> " + actual})
+			break
+		}
+	}
+	return hits
+}
+
+// urlHost 获取链接的主机名（小写）
+func urlHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,189 @@
+package spam
+
+import (
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+
+	"miko-email/internal/services/mailauth"
+)
+
+// DefaultWeights 内置规则的默认分数，可以在配置文件和域名设置中覆盖（设为0表示禁用）
+var DefaultWeights = map[string]float64{
+	// 收信认证
+	"SPF_FAIL":      3.0,
+	"SPF_SOFTFAIL":  1.5,
+	"SPF_PERMERROR": 1.0,
+	"SPF_NONE":      0.5,
+	"DKIM_FAIL":     1.5,
+	"DKIM_VALID":    -0.5,
+	"DMARC_FAIL":    3.5,
+	"DMARC_PASS":    -1.0,
+
+	// DNS黑名单（每命中一个黑名单计一次）
+	"RCVD_IN_DNSBL": 3.0,
+	"HELO_IN_DNSBL": 2.0,
+
+	// 邮件头异常
+	"MISSING_FROM":       2.5,
+	"MISSING_DATE":       1.0,
+	"MISSING_MESSAGE_ID": 1.0,
+	"MISSING_SUBJECT":    0.5,
+	"DATE_IN_FUTURE":     1.5,
+	"DATE_IN_PAST":       1.0,
+	"HELO_NOT_FQDN":      1.0,
+	"HELO_BARE_IP":       1.0,
+	"SUBJECT_ALL_CAPS":   1.0,
+	"FROM_NAME_SPOOF":    2.0,
+	"REPLYTO_DIFFERENT":  0.5,
+	"EMPTY_BODY":         1.0,
+
+	// 可疑链接
+	"URI_IP_HOST":   1.5,
+	"URI_SHORTENER": 1.0,
+	"URI_MISMATCH":  2.0,
+	"URI_MANY":      0.5,
+
+	// 贝叶斯分类（得分 = 权重 × (2×垃圾邮件概率-1)，概率低于0.5时降低得分）
+	"BAYES": 4.0,
+
+	// 发件人信誉
+	"SENDER_KNOWN":      -2.0,
+	"SENDER_REPUTATION": 2.0,
+}
+
+// authRule 根据SPF/DKIM/DMARC结果评分
+type authRule struct{}
+
+func (r *authRule) Name() string {
+	return "auth"
+}
+
+func (r *authRule) Check(msg *Message) []Hit {
+	if msg.Auth == nil {
+		return nil
+	}
+
+	var hits []Hit
+	switch msg.Auth.SPF {
+	case mailauth.SPFFail:
+		hits = append(hits, Hit{Name: "SPF_FAIL", Factor: 1})
+	case mailauth.SPFSoftFail:
+		hits = append(hits, Hit{Name: "SPF_SOFTFAIL", Factor: 1})
+	case mailauth.SPFPermError:
+		hits = append(hits, Hit{Name: "SPF_PERMERROR", Factor: 1})
+	case mailauth.SPFNone:
+		hits = append(hits, Hit{Name: "SPF_NONE", Factor: 1})
+	}
+
+	switch msg.Auth.DKIM {
+	case mailauth.ResultPass:
+		hits = append(hits, Hit{Name: "DKIM_VALID", Factor: 1})
+	case mailauth.ResultFail, mailauth.ResultPermError:
+		hits = append(hits, Hit{Name: "DKIM_FAIL", Factor: 1})
+	}
+
+	switch msg.Auth.DMARC {
+	case mailauth.ResultPass:
+		hits = append(hits, Hit{Name: "DMARC_PASS", Factor: 1})
+	case mailauth.ResultFail:
+		hits = append(hits, Hit{Name: "DMARC_FAIL", Factor: 1, Detail: msg.Auth.FromDomain})
+	}
+	return hits
+}
+
+// headerRule 检查邮件头和HELO的异常
+type headerRule struct{}
+
+func (r *headerRule) Name() string {
+	return "header"
+}
+
+func (r *headerRule) Check(msg *Message) []Hit {
+	var hits []Hit
+	h := msg.Header
+
+	from := h.Get("From")
+	if from == "" {
+		hits = append(hits, Hit{Name: "MISSING_FROM", Factor: 1})
+	}
+	if h.Get("Message-Id") == "" {
+		hits = append(hits, Hit{Name: "MISSING_MESSAGE_ID", Factor: 1})
+	}
+
+	if h.Get("Date") == "" {
+		hits = append(hits, Hit{Name: "MISSING_DATE", Factor: 1})
+	} else if date, err := h.Date(); err == nil {
+		if time.Until(date) > 24*time.Hour {
+			hits = append(hits, Hit{Name: "DATE_IN_FUTURE", Factor: 1})
+		} else if time.Since(date) > 30*24*time.Hour {
+			hits = append(hits, Hit{Name: "DATE_IN_PAST", Factor: 1})
+		}
+	}
+
+	subject := h.Get("Subject")
+	if msg.Envelope != nil {
+		subject = msg.Envelope.GetHeader("Subject")
+	}
+	if strings.TrimSpace(subject) == "" {
+		hits = append(hits, Hit{Name: "MISSING_SUBJECT", Factor: 1})
+	} else if isAllCaps(subject) {
+		hits = append(hits, Hit{Name: "SUBJECT_ALL_CAPS", Factor: 1})
+	}
+
+	helo := strings.Trim(msg.Helo, "[]")
+	if net.ParseIP(helo) != nil {
+		hits = append(hits, Hit{Name: "HELO_BARE_IP", Factor: 1, Detail: msg.Helo})
+	} else if helo != "" && !strings.Contains(helo, ".") {
+		hits = append(hits, Hit{Name: "HELO_NOT_FQDN", Factor: 1, Detail: msg.Helo})
+	}
+
+	if addr, err := mail.ParseAddress(from); err == nil {
+		fromDomain := addressDomain(addr.Address)
+		// 显示名中包含其他域名的邮箱地址，如 "service@bank.com" <x@evil.com>
+		if strings.Contains(addr.Name, "@") {
+			for _, word := range strings.Fields(addr.Name) {
+				word = strings.Trim(word, "<>\"'()")
+				if strings.Contains(word, "@") && addressDomain(word) != fromDomain {
+					hits = append(hits, Hit{Name: "FROM_NAME_SPOOF", Factor: 1, Detail: addr.Name})
+					break
+				}
+			}
+		}
+
+		if replyTo, err := mail.ParseAddress(h.Get("Reply-To")); err == nil {
+			if addressDomain(replyTo.Address) != fromDomain {
+				hits = append(hits, Hit{Name: "REPLYTO_DIFFERENT", Factor: 1})
+			}
+		}
+	}
+
+	if msg.Envelope != nil && strings.TrimSpace(msg.Envelope.Text) == "" && strings.TrimSpace(msg.Envelope.HTML) == "" &&
+		len(msg.Envelope.Attachments) == 0 {
+		hits = append(hits, Hit{Name: "EMPTY_BODY", Factor: 1})
+	}
+	return hits
+}
+
+// isAllCaps 主题中的英文字母全部为大写（至少10个字母）
+func isAllCaps(s string) bool {
+	letters := 0
+	for _, r := range s {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsUpper(r) {
+			letters++
+		}
+	}
+	return letters >= 10
+}
+
+func addressDomain(address string) string {
+	if at := strings.LastIndexByte(address, '@'); at >= 0 {
+		return strings.ToLower(address[at+1:])
+	}
+	return ""
+}
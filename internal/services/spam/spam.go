@@ -0,0 +1,216 @@
+package spam
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"sort"
+	"strings"
+
+	"github.com/jhillyerd/enmime/v2"
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+	"miko-email/internal/services/mailauth"
+	"miko-email/internal/svc"
+)
+
+// 处理结果
+const (
+	ActionInbox  = "inbox"  // 正常投递
+	ActionJunk   = "junk"   // 放入垃圾邮件
+	ActionReject = "reject" // 拒收（550）
+)
+
+// Message 需要评分的邮件
+type Message struct {
+	ClientIP   net.IP
+	Helo       string
+	MailFrom   string
+	Recipients []string           // 本地收件人
+	MailboxIds []int64            // 本地收件人的邮箱ID
+	Raw        []byte             // 邮件原文
+	Auth       *mailauth.Result   // 收信认证结果，未验证时为nil
+	DNSBL      []svc.DNSBLListing // 连接和HELO时命中的DNS黑名单
+
+	Header   mail.Header
+	Envelope *enmime.Envelope // 解析失败时为nil
+}
+
+// Hit 命中的规则
+// 得分 = 规则权重 × Factor，Factor 默认为1，贝叶斯等按概率给分的规则可以为负数（降低得分）
+type Hit struct {
+	Name   string  `json:"name"`
+	Factor float64 `json:"factor"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+// Rule 评分规则，Check 返回命中的规则（一个规则可以返回多个名称）
+type Rule interface {
+	Name() string
+	Check(msg *Message) []Hit
+}
+
+// Verdict 按域名设置计算出的评分结果
+type Verdict struct {
+	Score           float64  `json:"score"`
+	Rules           []string `json:"rules"`
+	Action          string   `json:"action"`
+	JunkThreshold   float64  `json:"junk_threshold"`
+	RejectThreshold float64  `json:"reject_threshold"`
+}
+
+// Settings 域名的垃圾邮件设置（保存在 domain.spam_settings，未设置的项使用全局配置）
+type Settings struct {
+	JunkThreshold   float64            `json:"junk_threshold,omitempty"`
+	RejectThreshold float64            `json:"reject_threshold,omitempty"`
+	Weights         map[string]float64 `json:"weights,omitempty"`
+}
+
+// Engine 垃圾邮件评分引擎
+type Engine struct {
+	svcCtx *svc.ServiceContext
+	rules  []Rule
+}
+
+// NewEngine 创建评分引擎并注册内置规则
+func NewEngine(svcCtx *svc.ServiceContext) *Engine {
+	e := &Engine{svcCtx: svcCtx}
+	e.Register(&authRule{})
+	e.Register(&dnsblRule{})
+	e.Register(&headerRule{})
+	e.Register(&urlRule{})
+	e.Register(&reputationRule{svcCtx: svcCtx})
+	return e
+}
+
+// Register 注册评分规则
+func (e *Engine) Register(rule Rule) {
+	e.rules = append(e.rules, rule)
+}
+
+// NewMessage 解析邮件原文，生成评分用的邮件
+func NewMessage(raw []byte) *Message {
+	msg := &Message{Raw: raw, Header: mail.Header{}}
+	if parsed, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		msg.Header = parsed.Header
+	}
+	if envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw)); err == nil {
+		msg.Envelope = envelope
+	}
+	return msg
+}
+
+// Evaluate 执行所有规则，返回命中的规则（与域名设置无关，可以按不同域名的权重计算得分）
+func (e *Engine) Evaluate(msg *Message) []Hit {
+	var hits []Hit
+	for _, rule := range e.rules {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("垃圾邮件规则 %s 执行失败: %v", rule.Name(), r)
+				}
+			}()
+			hits = append(hits, rule.Check(msg)...)
+		}()
+	}
+	return hits
+}
+
+// Score 按域名设置计算得分和处理结果，domain 为nil时使用全局配置
+func (e *Engine) Score(hits []Hit, domain *model.Domain) *Verdict {
+	settings := DomainSettings(domain)
+	junk, reject := config.GetSpamThresholds()
+	if settings.JunkThreshold > 0 {
+		junk = settings.JunkThreshold
+	}
+	if settings.RejectThreshold > 0 {
+		reject = settings.RejectThreshold
+	}
+
+	verdict := &Verdict{JunkThreshold: junk, RejectThreshold: reject, Rules: []string{}}
+	globalWeights := config.GetSpamWeights()
+	for _, hit := range hits {
+		weight, ok := settings.Weights[hit.Name]
+		if !ok {
+			weight, ok = globalWeights[hit.Name]
+		}
+		if !ok {
+			weight = DefaultWeights[hit.Name]
+		}
+		if weight == 0 {
+			continue
+		}
+		verdict.Score += weight * hit.Factor
+		verdict.Rules = append(verdict.Rules, hit.Name)
+	}
+	// 保留一位小数，避免浮点误差影响阈值比较
+	verdict.Score = float64(int64(verdict.Score*10+sign(verdict.Score)*0.5)) / 10
+
+	switch {
+	case reject > 0 && verdict.Score >= reject:
+		verdict.Action = ActionReject
+	case verdict.Score >= junk:
+		verdict.Action = ActionJunk
+	default:
+		verdict.Action = ActionInbox
+	}
+	return verdict
+}
+
+// Header 生成 X-Spam-Status 头
+func (v *Verdict) Header() string {
+	flag := "No"
+	if v.Action != ActionInbox {
+		flag = "Yes"
+	}
+	return fmt.Sprintf("X-Spam-Status: %s, score=%.1f required=%.1f\r\n\ttests=%s\r\n",
+		flag, v.Score, v.JunkThreshold, strings.Join(v.Rules, ","))
+}
+
+// DomainSettings 解析域名的垃圾邮件设置
+func DomainSettings(domain *model.Domain) *Settings {
+	settings := &Settings{}
+	if domain == nil || domain.SpamSettings == "" {
+		return settings
+	}
+	if err := json.Unmarshal([]byte(domain.SpamSettings), settings); err != nil {
+		log.Printf("域名 %s 的垃圾邮件设置无效: %v", domain.Name, err)
+	}
+	return settings
+}
+
+// ValidateSettings 检查域名的垃圾邮件设置
+func ValidateSettings(settings *Settings) error {
+	if settings.JunkThreshold < 0 || settings.RejectThreshold < 0 {
+		return fmt.Errorf("阈值不能为负数")
+	}
+	if settings.JunkThreshold > 0 && settings.RejectThreshold > 0 && settings.RejectThreshold <= settings.JunkThreshold {
+		return fmt.Errorf("拒收阈值必须大于垃圾邮件阈值")
+	}
+	for name := range settings.Weights {
+		if _, ok := DefaultWeights[name]; !ok {
+			return fmt.Errorf("未知的规则: %s", name)
+		}
+	}
+	return nil
+}
+
+// RuleNames 获取所有内置规则名称（已排序）
+func RuleNames() []string {
+	names := make([]string, 0, len(DefaultWeights))
+	for name := range DefaultWeights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sign(f float64) float64 {
+	if f < 0 {
+		return -1
+	}
+	return 1
+}
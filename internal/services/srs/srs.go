@@ -0,0 +1,194 @@
+// Package srs 实现发件人重写（Sender Rewriting Scheme）
+//
+// 转发外部邮件时，信封发件人改写为转发域名下的地址，使目标服务器的SPF检查通过：
+//
+//	SRS0=HHHH=TT=原域名=原用户名@转发域名
+//
+// 转发已经过SRS改写的邮件时使用SRS1，保留第一个转发者，退信直接返回给它：
+//
+//	SRS1=HHHH=第一个转发域名==HHHH=TT=原域名=原用户名@转发域名
+//
+// HHHH 为HMAC-SHA1哈希的前4个字符，TT 为天数时间戳，退信只接受哈希正确且未过期的地址。
+package srs
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	hashLength = 4
+	// 时间戳按天计算，取1024天的周期，用两个base32字符表示
+	timePrecision = 24 * 60 * 60
+	timeSlots     = 1024
+	base32Chars   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+)
+
+var (
+	ErrNotSRS      = errors.New("不是SRS地址")
+	ErrMalformed   = errors.New("SRS地址格式错误")
+	ErrInvalidHash = errors.New("SRS地址哈希校验失败")
+	ErrExpired     = errors.New("SRS地址已过期")
+)
+
+// Rewriter 使用密钥改写和还原地址
+type Rewriter struct {
+	secret []byte
+	maxAge int // 退信地址的有效天数
+	now    func() time.Time
+}
+
+// NewRewriter 创建改写器，maxAgeDays 为SRS地址的有效天数
+func NewRewriter(secret string, maxAgeDays int) *Rewriter {
+	return &Rewriter{secret: []byte(secret), maxAge: maxAgeDays, now: time.Now}
+}
+
+// IsSRS 检查地址是否为SRS格式（不校验哈希）
+func IsSRS(address string) bool {
+	local, _ := splitAddress(address)
+	return srsPrefix(local, "SRS0") || srsPrefix(local, "SRS1")
+}
+
+// Forward 将发件人改写为转发域名下的SRS地址
+// 空发件人（退信）保持为空，已经属于转发域名的地址不改写
+func (r *Rewriter) Forward(sender, forwarder string) (string, error) {
+	if sender == "" {
+		return "", nil
+	}
+	local, domain := splitAddress(sender)
+	if local == "" || domain == "" {
+		return "", ErrMalformed
+	}
+	if strings.EqualFold(domain, forwarder) {
+		return sender, nil
+	}
+
+	switch {
+	case srsPrefix(local, "SRS0"):
+		// 其他转发者生成的SRS0，改写为SRS1，保留原分隔符及之后的内容
+		rest := local[4:]
+		hash := r.hash(domain, rest)
+		return "SRS1=" + hash + "=" + domain + "=" + rest + "@" + forwarder, nil
+	case srsPrefix(local, "SRS1"):
+		// 已经是SRS1，保留第一个转发者，重新计算哈希
+		parts := strings.SplitN(local[5:], "=", 3)
+		if len(parts) != 3 || parts[1] == "" || !validRest(parts[2]) {
+			return "", ErrMalformed
+		}
+		host, rest := parts[1], parts[2]
+		hash := r.hash(host, rest)
+		return "SRS1=" + hash + "=" + host + "=" + rest + "@" + forwarder, nil
+	}
+
+	timestamp := encodeTimestamp(r.now())
+	hash := r.hash(timestamp, domain, local)
+	return "SRS0=" + hash + "=" + timestamp + "=" + domain + "=" + local + "@" + forwarder, nil
+}
+
+// Reverse 还原SRS地址：SRS0返回原发件人，SRS1返回第一个转发者的SRS0地址
+func (r *Rewriter) Reverse(address string) (string, error) {
+	local, _ := splitAddress(address)
+
+	switch {
+	case srsPrefix(local, "SRS0"):
+		parts := strings.SplitN(local[5:], "=", 4)
+		if len(parts) != 4 || parts[2] == "" || parts[3] == "" {
+			return "", ErrMalformed
+		}
+		hash, timestamp, domain, user := parts[0], parts[1], parts[2], parts[3]
+		if !r.checkHash(hash, timestamp, domain, user) {
+			return "", ErrInvalidHash
+		}
+		if err := r.checkTimestamp(timestamp); err != nil {
+			return "", err
+		}
+		return user + "@" + domain, nil
+	case srsPrefix(local, "SRS1"):
+		parts := strings.SplitN(local[5:], "=", 3)
+		if len(parts) != 3 || parts[1] == "" || !validRest(parts[2]) {
+			return "", ErrMalformed
+		}
+		hash, host, rest := parts[0], parts[1], parts[2]
+		if !r.checkHash(hash, host, rest) {
+			return "", ErrInvalidHash
+		}
+		return "SRS0" + rest + "@" + host, nil
+	}
+	return "", ErrNotSRS
+}
+
+// hash 计算各部分（不区分大小写）的HMAC，取base64的前4个字符
+func (r *Rewriter) hash(parts ...string) string {
+	mac := hmac.New(sha1.New, r.secret)
+	for _, part := range parts {
+		mac.Write([]byte(strings.ToLower(part)))
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))[:hashLength]
+}
+
+// checkHash 校验哈希，邮件系统可能改变地址的大小写，比较时不区分大小写
+func (r *Rewriter) checkHash(hash string, parts ...string) bool {
+	if len(hash) != hashLength {
+		return false
+	}
+	expected := r.hash(parts...)
+	return hmac.Equal([]byte(strings.ToLower(hash)), []byte(strings.ToLower(expected)))
+}
+
+// checkTimestamp 检查时间戳是否在有效期内
+func (r *Rewriter) checkTimestamp(timestamp string) error {
+	if len(timestamp) != 2 {
+		return ErrMalformed
+	}
+	high := strings.IndexByte(base32Chars, toUpper(timestamp[0]))
+	low := strings.IndexByte(base32Chars, toUpper(timestamp[1]))
+	if high < 0 || low < 0 {
+		return ErrMalformed
+	}
+	then := high<<5 | low
+	today := int(r.now().Unix()/timePrecision) % timeSlots
+	if (today-then+timeSlots)%timeSlots > r.maxAge {
+		return ErrExpired
+	}
+	return nil
+}
+
+// encodeTimestamp 将日期编码为两个base32字符
+func encodeTimestamp(t time.Time) string {
+	days := int(t.Unix()/timePrecision) % timeSlots
+	return string([]byte{base32Chars[days>>5&31], base32Chars[days&31]})
+}
+
+// srsPrefix 检查用户名是否以 SRS0/SRS1 加分隔符（= + -）开头
+func srsPrefix(local, tag string) bool {
+	if len(local) < 5 || !strings.EqualFold(local[:4], tag) {
+		return false
+	}
+	return strings.IndexByte("=+-", local[4]) >= 0
+}
+
+// validRest SRS1中保留的原SRS0部分，以原分隔符开头
+func validRest(rest string) bool {
+	return len(rest) > 1 && strings.IndexByte("=+-", rest[0]) >= 0
+}
+
+// splitAddress 按最后一个@拆分地址
+func splitAddress(address string) (local, domain string) {
+	address = strings.Trim(strings.TrimSpace(address), "<>")
+	idx := strings.LastIndex(address, "@")
+	if idx < 0 {
+		return address, ""
+	}
+	return address[:idx], address[idx+1:]
+}
+
+func toUpper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
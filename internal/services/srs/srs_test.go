@@ -0,0 +1,218 @@
+package srs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedRewriter 创建时间固定的改写器
+func fixedRewriter(secret string, now time.Time) *Rewriter {
+	r := NewRewriter(secret, 21)
+	r.now = func() time.Time { return now }
+	return r
+}
+
+func TestForwardReverseSRS0(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	r := fixedRewriter("secret", now)
+
+	tests := []struct {
+		name   string
+		sender string
+	}{
+		{"普通地址", "alice@example.org"},
+		{"用户名带等号", "a=b@example.org"},
+		{"用户名带加号", "bob+tag@example.org"},
+		{"大写域名", "Carol@Example.ORG"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewritten, err := r.Forward(tt.sender, "forward.test")
+			if err != nil {
+				t.Fatalf("Forward(%q) 失败: %v", tt.sender, err)
+			}
+			if !strings.HasPrefix(rewritten, "SRS0=") || !strings.HasSuffix(rewritten, "@forward.test") {
+				t.Fatalf("Forward(%q) = %q，不是转发域名下的SRS0地址", tt.sender, rewritten)
+			}
+			if !IsSRS(rewritten) {
+				t.Errorf("IsSRS(%q) = false", rewritten)
+			}
+
+			original, err := r.Reverse(rewritten)
+			if err != nil {
+				t.Fatalf("Reverse(%q) 失败: %v", rewritten, err)
+			}
+			if original != tt.sender {
+				t.Errorf("Reverse(%q) = %q，期望 %q", rewritten, original, tt.sender)
+			}
+
+			// 邮件系统可能改变地址的大小写
+			original, err = r.Reverse(strings.ToLower(rewritten))
+			if err != nil {
+				t.Fatalf("Reverse(小写 %q) 失败: %v", rewritten, err)
+			}
+			if !strings.EqualFold(original, tt.sender) {
+				t.Errorf("Reverse(小写 %q) = %q，期望 %q", rewritten, original, tt.sender)
+			}
+		})
+	}
+}
+
+func TestForwardReverseSRS1(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	first := fixedRewriter("first-secret", now)
+	second := fixedRewriter("second-secret", now)
+
+	srs0, err := first.Forward("alice@example.org", "first.test")
+	if err != nil {
+		t.Fatalf("第一次转发失败: %v", err)
+	}
+	srs1, err := second.Forward(srs0, "second.test")
+	if err != nil {
+		t.Fatalf("第二次转发失败: %v", err)
+	}
+	if !strings.HasPrefix(srs1, "SRS1=") || !strings.Contains(srs1, "=first.test==") || !strings.HasSuffix(srs1, "@second.test") {
+		t.Fatalf("第二次转发 = %q，期望保留第一个转发者的SRS1地址", srs1)
+	}
+
+	// 再次转发时保留第一个转发者
+	srs1Again, err := fixedRewriter("third-secret", now).Forward(srs1, "third.test")
+	if err != nil {
+		t.Fatalf("第三次转发失败: %v", err)
+	}
+	if !strings.HasPrefix(srs1Again, "SRS1=") || !strings.Contains(srs1Again, "=first.test==") || !strings.HasSuffix(srs1Again, "@third.test") {
+		t.Fatalf("第三次转发 = %q，期望保留第一个转发者", srs1Again)
+	}
+
+	// 第二个转发者还原出第一个转发者的SRS0地址，第一个转发者再还原出原发件人
+	back, err := second.Reverse(srs1)
+	if err != nil {
+		t.Fatalf("还原SRS1失败: %v", err)
+	}
+	if back != srs0 {
+		t.Fatalf("还原SRS1 = %q，期望 %q", back, srs0)
+	}
+	original, err := first.Reverse(back)
+	if err != nil {
+		t.Fatalf("还原SRS0失败: %v", err)
+	}
+	if original != "alice@example.org" {
+		t.Errorf("还原SRS0 = %q，期望 alice@example.org", original)
+	}
+}
+
+func TestForwardUnchanged(t *testing.T) {
+	r := NewRewriter("secret", 21)
+
+	tests := []struct {
+		name   string
+		sender string
+		want   string
+	}{
+		{"空发件人保持为空", "", ""},
+		{"转发域名的地址不改写", "user@forward.test", "user@forward.test"},
+		{"转发域名不区分大小写", "user@FORWARD.test", "user@FORWARD.test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Forward(tt.sender, "forward.test")
+			if err != nil {
+				t.Fatalf("Forward(%q) 失败: %v", tt.sender, err)
+			}
+			if got != tt.want {
+				t.Errorf("Forward(%q) = %q，期望 %q", tt.sender, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := r.Forward("no-domain", "forward.test"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Forward(没有域名) 错误 = %v，期望 ErrMalformed", err)
+	}
+}
+
+func TestReverseRejects(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	r := fixedRewriter("secret", now)
+
+	valid, err := r.Forward("alice@example.org", "forward.test")
+	if err != nil {
+		t.Fatalf("Forward 失败: %v", err)
+	}
+	// SRS0=HHHH=TT=example.org=alice@forward.test
+	parts := strings.SplitN(strings.TrimSuffix(valid, "@forward.test"), "=", 5)
+	hash, timestamp := parts[1], parts[2]
+
+	otherHash := "AAAA"
+	if strings.EqualFold(hash, otherHash) {
+		otherHash = "BBBB"
+	}
+	expiredStamp := encodeTimestamp(now.Add(-30 * 24 * time.Hour))
+	expiredHash := r.hash(expiredStamp, "example.org", "alice")
+	futureStamp := encodeTimestamp(now.Add(30 * 24 * time.Hour))
+	futureHash := r.hash(futureStamp, "example.org", "alice")
+
+	tests := []struct {
+		name    string
+		address string
+		want    error
+	}{
+		{"不是SRS地址", "alice@forward.test", ErrNotSRS},
+		{"哈希错误", "SRS0=" + otherHash + "=" + timestamp + "=example.org=alice@forward.test", ErrInvalidHash},
+		{"哈希长度错误", "SRS0=" + hash + "X=" + timestamp + "=example.org=alice@forward.test", ErrInvalidHash},
+		{"改动原域名", "SRS0=" + hash + "=" + timestamp + "=example.net=alice@forward.test", ErrInvalidHash},
+		{"改动原用户名", "SRS0=" + hash + "=" + timestamp + "=example.org=mallory@forward.test", ErrInvalidHash},
+		{"改动时间戳", "SRS0=" + hash + "=" + expiredStamp + "=example.org=alice@forward.test", ErrInvalidHash},
+		{"其他密钥生成", mustForward(t, fixedRewriter("other", now), "alice@example.org"), ErrInvalidHash},
+		{"已过期", "SRS0=" + expiredHash + "=" + expiredStamp + "=example.org=alice@forward.test", ErrExpired},
+		{"超出有效期的未来时间戳", "SRS0=" + futureHash + "=" + futureStamp + "=example.org=alice@forward.test", ErrExpired},
+		{"时间戳格式错误", "SRS0=" + r.hash("1!", "example.org", "alice") + "=1!=example.org=alice@forward.test", ErrMalformed},
+		{"SRS0缺少部分", "SRS0=" + hash + "=" + timestamp + "=example.org@forward.test", ErrMalformed},
+		{"SRS1缺少原SRS0部分", "SRS1=" + hash + "=first.test=@forward.test", ErrMalformed},
+		{"SRS1哈希错误", "SRS1=" + otherHash + "=first.test==" + hash + "=" + timestamp + "=example.org=alice@forward.test", ErrInvalidHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := r.Reverse(tt.address); !errors.Is(err, tt.want) {
+				t.Errorf("Reverse(%q) 错误 = %v，期望 %v", tt.address, err, tt.want)
+			}
+		})
+	}
+
+	// 有效期内的地址可以还原
+	later := fixedRewriter("secret", now.Add(20*24*time.Hour))
+	if _, err := later.Reverse(valid); err != nil {
+		t.Errorf("20天后还原 %q 失败: %v", valid, err)
+	}
+}
+
+func TestIsSRS(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"SRS0=abcd=AB=example.org=alice@forward.test", true},
+		{"srs0+abcd=AB=example.org=alice@forward.test", true},
+		{"SRS1=abcd=first.test==abcd=AB=example.org=alice@forward.test", true},
+		{"<SRS0=abcd=AB=example.org=alice@forward.test>", true},
+		{"SRS0@forward.test", false},
+		{"SRS2=abcd@forward.test", false},
+		{"srsuser@forward.test", false},
+		{"alice@example.org", false},
+	}
+	for _, tt := range tests {
+		if got := IsSRS(tt.address); got != tt.want {
+			t.Errorf("IsSRS(%q) = %v，期望 %v", tt.address, got, tt.want)
+		}
+	}
+}
+
+func mustForward(t *testing.T, r *Rewriter, sender string) string {
+	t.Helper()
+	rewritten, err := r.Forward(sender, "forward.test")
+	if err != nil {
+		t.Fatalf("Forward(%q) 失败: %v", sender, err)
+	}
+	return rewritten
+}
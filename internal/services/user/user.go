@@ -6,6 +6,7 @@ import (
 
 	"gorm.io/gorm"
 	"miko-email/internal/model"
+	"miko-email/internal/services/attachment"
 	"miko-email/internal/svc"
 )
 
@@ -117,6 +118,16 @@ func (s *Service) DeleteUser(userID int64) error {
 		return err
 	}
 
+	// 记录附件文件位置，事务提交后清理
+	var attachmentPaths []string
+	for _, mailbox := range mailboxes {
+		paths, err := s.svcCtx.AttachmentModel.GetStoragePathsByMailboxId(mailbox.Id)
+		if err != nil {
+			return err
+		}
+		attachmentPaths = append(attachmentPaths, paths...)
+	}
+
 	// 删除每个邮箱的相关数据
 	for _, mailbox := range mailboxes {
 		// 1. 删除邮件转发规则
@@ -124,17 +135,37 @@ func (s *Service) DeleteUser(userID int64) error {
 			return err
 		}
 
-		// 2. 删除邮件
+		// 2. 删除邮件附件、原文和邮件
+		if err := s.svcCtx.AttachmentModel.DeleteByMailboxId(tx, mailbox.Id); err != nil {
+			return err
+		}
+		if err := s.svcCtx.EmailRawModel.DeleteByMailboxId(tx, mailbox.Id); err != nil {
+			return err
+		}
+		if err := s.svcCtx.FolderModel.DeleteByMailboxId(tx, mailbox.Id); err != nil {
+			return err
+		}
+		if err := s.svcCtx.SieveScriptModel.DeleteByMailboxId(tx, mailbox.Id); err != nil {
+			return err
+		}
 		if err := s.svcCtx.EmailModel.DeleteEmailsByMailboxId(tx, mailbox.Id); err != nil {
 			return err
 		}
 
-		// 3. 删除邮箱
+		// 3. 删除邮箱及投递到该邮箱的别名
+		if err := s.svcCtx.MailAliasModel.DeleteByMailboxId(tx, mailbox.Id); err != nil {
+			return err
+		}
 		if err := s.svcCtx.MailboxModel.HardDelete(tx, mailbox.Id); err != nil {
 			return err
 		}
 	}
 
+	// 删除用户的群组
+	if err := s.svcCtx.MailAliasModel.DeleteByUserId(tx, userID); err != nil {
+		return err
+	}
+
 	// 4. 删除用户记录
 	if err := s.svcCtx.UserModel.HardDelete(tx, userID); err != nil {
 		return err
@@ -146,5 +177,7 @@ func (s *Service) DeleteUser(userID int64) error {
 	}
 	tx = nil
 
+	attachment.NewService(s.svcCtx).RemoveUnreferencedFiles(attachmentPaths)
+
 	return nil
 }
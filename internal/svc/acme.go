@@ -0,0 +1,448 @@
+package svc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"gorm.io/gorm"
+
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+)
+
+const (
+	// acmeStartupDelay 启动后首次检查证书前的等待时间（等待Web服务开始监听，HTTP-01验证才能访问到）
+	acmeStartupDelay = 10 * time.Second
+	// acmeCheckInterval 检查证书是否需要续期的间隔
+	acmeCheckInterval = 12 * time.Hour
+	// acmeRetryInterval 申请失败后，定时检查时再次尝试的最短间隔
+	acmeRetryInterval = time.Hour
+	// acmeIssueTimeout 单次申请证书的超时时间
+	acmeIssueTimeout = 5 * time.Minute
+)
+
+// ACMEHostname 返回域名对应的证书主机名（Web、SMTP、IMAP、POP3统一使用 mail.<域名>）
+func ACMEHostname(domain string) string {
+	return "mail." + strings.ToLower(domain)
+}
+
+// ACMEManager ACME证书管理（RFC 8555），为每个激活的域名申请和续期 mail.<域名> 的证书
+// 使用HTTP-01验证，验证文件由Web服务的 /.well-known/acme-challenge/ 提供；账户和证书保存在数据库中，
+// 签发后通知证书提供者重新加载
+type ACMEManager struct {
+	acmeModel    *model.AcmeModel
+	domainModel  *model.DomainModel
+	certificates *CertificateProvider
+
+	startOnce sync.Once
+	requests  chan string // 需要立即申请证书的域名
+
+	clientMu sync.Mutex
+	client   *acme.Client
+
+	challengeMu sync.RWMutex
+	challenges  map[string]string // token -> key authorization
+}
+
+// NewACMEManager 创建ACME证书管理
+func NewACMEManager(acmeModel *model.AcmeModel, domainModel *model.DomainModel, certificates *CertificateProvider) *ACMEManager {
+	return &ACMEManager{
+		acmeModel:    acmeModel,
+		domainModel:  domainModel,
+		certificates: certificates,
+		requests:     make(chan string, 64),
+		challenges:   make(map[string]string),
+	}
+}
+
+// Start 启动后台申请和续期（未启用ACME时不做任何事）
+func (m *ACMEManager) Start() {
+	if !config.IsACMEEnabled() {
+		return
+	}
+	m.startOnce.Do(func() {
+		log.Printf("ACME自动证书已启用: %s", config.GetACMEDirectoryURL())
+		go m.run()
+	})
+}
+
+// Request 立即为域名申请（或续期）证书，在后台执行
+func (m *ACMEManager) Request(domain string) {
+	if !config.IsACMEEnabled() {
+		return
+	}
+	select {
+	case m.requests <- strings.ToLower(domain):
+	default:
+		log.Printf("ACME申请队列已满，稍后定时检查时再申请: %s", domain)
+	}
+}
+
+// HTTPChallengeResponse 返回HTTP-01验证的响应内容
+func (m *ACMEManager) HTTPChallengeResponse(token string) (string, bool) {
+	m.challengeMu.RLock()
+	defer m.challengeMu.RUnlock()
+	keyAuth, ok := m.challenges[token]
+	return keyAuth, ok
+}
+
+// run 串行处理申请请求和定时续期
+func (m *ACMEManager) run() {
+	timer := time.NewTimer(acmeStartupDelay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case domain := <-m.requests:
+			m.issue(domain)
+		case <-timer.C:
+			m.checkAll()
+			timer.Reset(acmeCheckInterval)
+		}
+	}
+}
+
+// checkAll 检查所有激活的域名，为没有证书或即将到期的域名申请证书
+func (m *ACMEManager) checkAll() {
+	domains, err := m.domainModel.GetActiveDomains()
+	if err != nil {
+		log.Printf("ACME获取域名列表失败: %v", err)
+		return
+	}
+
+	for _, domain := range domains {
+		name := strings.ToLower(domain.Name)
+		record, err := m.acmeModel.GetCertificate(name)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("ACME获取证书记录失败: %s: %v", name, err)
+			continue
+		}
+		if record != nil && !m.needsIssue(record) {
+			continue
+		}
+		m.issue(name)
+	}
+}
+
+// needsIssue 判断证书是否需要申请：没有证书或即将到期，且距离上次失败已超过重试间隔
+func (m *ACMEManager) needsIssue(record *model.AcmeCertificate) bool {
+	if record.Status == model.AcmeStatusFailed && record.LastAttemptAt != nil && time.Since(*record.LastAttemptAt) < acmeRetryInterval {
+		return false
+	}
+	if record.Certificate == "" || record.NotAfter == nil {
+		return true
+	}
+	return time.Until(*record.NotAfter) < config.GetACMERenewBefore()
+}
+
+// issue 为域名申请证书并保存结果
+func (m *ACMEManager) issue(domain string) {
+	record, err := m.acmeModel.GetCertificate(domain)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("ACME获取证书记录失败: %s: %v", domain, err)
+			return
+		}
+		record = &model.AcmeCertificate{
+			Domain:    domain,
+			Status:    model.AcmeStatusPending,
+			CreatedAt: time.Now(),
+		}
+	}
+	record.Hostname = ACMEHostname(domain)
+	now := time.Now()
+	record.LastAttemptAt = &now
+
+	log.Printf("ACME开始申请证书: %s", record.Hostname)
+
+	ctx, cancel := context.WithTimeout(context.Background(), acmeIssueTimeout)
+	defer cancel()
+
+	certPEM, keyPEM, notAfter, err := m.obtain(ctx, record.Hostname)
+	if err != nil {
+		log.Printf("ACME申请证书失败: %s: %v", record.Hostname, err)
+		record.Status = model.AcmeStatusFailed
+		record.LastError = err.Error()
+		if err := m.acmeModel.SaveCertificate(nil, record); err != nil {
+			log.Printf("ACME保存证书记录失败: %s: %v", domain, err)
+		}
+		return
+	}
+
+	record.Certificate = certPEM
+	record.PrivateKey = keyPEM
+	record.NotAfter = &notAfter
+	record.Status = model.AcmeStatusValid
+	record.LastError = ""
+	if err := m.acmeModel.SaveCertificate(nil, record); err != nil {
+		log.Printf("ACME保存证书失败: %s: %v", domain, err)
+		return
+	}
+
+	log.Printf("ACME证书申请成功: %s (到期时间 %s)", record.Hostname, notAfter.Format("2006-01-02"))
+	m.certificates.Reload()
+}
+
+// obtain 通过ACME下单、完成HTTP-01验证并签发证书，返回PEM格式的证书链和私钥
+func (m *ACMEManager) obtain(ctx context.Context, hostname string) (certPEM, keyPEM string, notAfter time.Time, err error) {
+	client, err := m.getClient(ctx)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(hostname))
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("创建订单失败: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, authzURL); err != nil {
+			return "", "", time.Time{}, err
+		}
+	}
+
+	// 订单就绪后才有可靠的 finalize 地址
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("等待订单就绪失败: %w", err)
+	}
+
+	// 证书私钥，每次签发都重新生成
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("生成证书私钥失败: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: hostname},
+		DNSNames: []string{hostname},
+	}, certKey)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("生成CSR失败: %w", err)
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("签发证书失败: %w", err)
+	}
+	if len(chain) == 0 {
+		return "", "", time.Time{}, fmt.Errorf("ACME服务器没有返回证书")
+	}
+
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("解析证书失败: %w", err)
+	}
+	if err := leaf.VerifyHostname(hostname); err != nil {
+		return "", "", time.Time{}, fmt.Errorf("证书与主机名不匹配: %w", err)
+	}
+
+	var certBuf strings.Builder
+	for _, der := range chain {
+		if err := pem.Encode(&certBuf, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return "", "", time.Time{}, err
+		}
+	}
+	keyPEM, err = encodePrivateKey(certKey)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	return certBuf.String(), keyPEM, leaf.NotAfter, nil
+}
+
+// authorize 完成一个授权的HTTP-01验证
+func (m *ACMEManager) authorize(ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("获取授权失败: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("ACME服务器没有提供HTTP-01验证: %s", authz.Identifier.Value)
+	}
+
+	keyAuth, err := client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return fmt.Errorf("生成验证内容失败: %w", err)
+	}
+
+	m.challengeMu.Lock()
+	m.challenges[challenge.Token] = keyAuth
+	m.challengeMu.Unlock()
+	defer func() {
+		m.challengeMu.Lock()
+		delete(m.challenges, challenge.Token)
+		m.challengeMu.Unlock()
+	}()
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("提交验证失败: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("域名验证失败: %w", err)
+	}
+	return nil
+}
+
+// getClient 获取ACME客户端，数据库中没有当前目录地址的账户时注册新账户
+func (m *ACMEManager) getClient(ctx context.Context) (*acme.Client, error) {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+
+	directoryURL := config.GetACMEDirectoryURL()
+	if m.client != nil && m.client.DirectoryURL == directoryURL {
+		return m.client, nil
+	}
+
+	httpClient, err := acmeHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := m.acmeModel.GetAccount(directoryURL)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("获取ACME账户失败: %w", err)
+	}
+
+	if account != nil {
+		key, err := decodePrivateKey(account.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("解析ACME账户私钥失败: %w", err)
+		}
+		m.client = &acme.Client{
+			Key:          key,
+			KID:          acme.KeyID(account.AccountUrl),
+			DirectoryURL: directoryURL,
+			HTTPClient:   httpClient,
+		}
+		return m.client, nil
+	}
+
+	// 注册新账户
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成ACME账户私钥失败: %w", err)
+	}
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: directoryURL,
+		HTTPClient:   httpClient,
+	}
+
+	acct := &acme.Account{}
+	if email := config.GetACMEEmail(); email != "" {
+		acct.Contact = []string{"mailto:" + email}
+	}
+	registered, err := client.Register(ctx, acct, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("注册ACME账户失败: %w", err)
+	}
+	accountURL := ""
+	if registered != nil {
+		accountURL = registered.URI
+	} else if existing, err := client.GetReg(ctx, ""); err == nil {
+		accountURL = existing.URI
+	}
+
+	keyPEM, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	account = &model.AcmeAccount{
+		DirectoryUrl: directoryURL,
+		Email:        config.GetACMEEmail(),
+		AccountUrl:   accountURL,
+		PrivateKey:   keyPEM,
+		CreatedAt:    time.Now(),
+	}
+	if err := m.acmeModel.SaveAccount(nil, account); err != nil {
+		return nil, fmt.Errorf("保存ACME账户失败: %w", err)
+	}
+	log.Printf("ACME账户注册成功: %s", accountURL)
+
+	m.client = client
+	return m.client, nil
+}
+
+// acmeHTTPClient 访问ACME目录使用的HTTP客户端，配置了ca_file时额外信任该CA
+func acmeHTTPClient() (*http.Client, error) {
+	caFile := config.GetACMECAFile()
+	if caFile == "" {
+		return http.DefaultClient, nil
+	}
+
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取ACME CA证书失败: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("ACME CA证书文件中没有可用的证书: %s", caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}, nil
+}
+
+// encodePrivateKey 将ECDSA私钥编码为PEM
+func encodePrivateKey(key *ecdsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("编码私钥失败: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), nil
+}
+
+// decodePrivateKey 解析PEM格式的私钥
+func decodePrivateKey(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("私钥不是PEM格式")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("不支持的私钥类型")
+		}
+		return signer, nil
+	}
+}
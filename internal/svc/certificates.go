@@ -0,0 +1,302 @@
+package svc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"miko-email/internal/config"
+	"miko-email/internal/model"
+)
+
+// certificateReloadInterval 检查证书文件变化的间隔
+const certificateReloadInterval = 30 * time.Second
+
+// domainCertFile / domainKeyFile 每个域名的证书文件名（位于 cert_dir/<域名>/ 下）
+const (
+	domainCertFile = "fullchain.pem"
+	domainKeyFile  = "privkey.pem"
+)
+
+// loadedCertificate 已加载的证书及其文件状态
+type loadedCertificate struct {
+	certFile string
+	keyFile  string
+	modTime  time.Time // 证书和私钥文件中较新的修改时间
+	cert     *tls.Certificate
+}
+
+// CertificateProvider TLS证书提供者，Web(HTTPS)、SMTPS/STARTTLS、IMAPS、POP3S共用
+// 默认证书来自 security.ssl_cert/ssl_key，域名证书来自 cert_dir/<域名>/，没有时使用ACME签发的 mail.<域名> 证书，按SNI选择；
+// 文件变化后自动重新加载；什么都没有配置时才使用自签名证书
+type CertificateProvider struct {
+	domainModel *model.DomainModel
+	acmeModel   *model.AcmeModel
+
+	mu          sync.RWMutex
+	defaultCert *loadedCertificate
+	domainCerts map[string]*loadedCertificate // 域名 -> 证书
+
+	selfSignedOnce sync.Once
+	selfSigned     *tls.Certificate
+	selfSignedErr  error
+}
+
+// NewCertificateProvider 创建证书提供者并启动文件变化检测
+func NewCertificateProvider(domainModel *model.DomainModel, acmeModel *model.AcmeModel) *CertificateProvider {
+	p := &CertificateProvider{
+		domainModel: domainModel,
+		acmeModel:   acmeModel,
+		domainCerts: make(map[string]*loadedCertificate),
+	}
+	p.Reload()
+
+	go func() {
+		ticker := time.NewTicker(certificateReloadInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			p.Reload()
+		}
+	}()
+
+	return p
+}
+
+// TLSConfig 返回使用本提供者选择证书的TLS配置
+func (p *CertificateProvider) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: p.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// Reload 重新检查证书文件和ACME证书，只重新解析发生变化的证书
+func (p *CertificateProvider) Reload() {
+	certFile, keyFile := config.GetTLSCertFiles()
+
+	p.mu.RLock()
+	current := p.defaultCert
+	p.mu.RUnlock()
+
+	var defaultCert *loadedCertificate
+	if certFile != "" && keyFile != "" {
+		defaultCert = loadCertificate(current, certFile, keyFile)
+	}
+
+	// 每个域名的证书
+	domainCerts := make(map[string]*loadedCertificate)
+	domains, err := p.domainModel.GetActiveDomains()
+	if err != nil {
+		log.Printf("获取域名列表失败: %v", err)
+	}
+	certDir := config.GetCertDir()
+	active := make(map[string]bool)
+	for _, domain := range domains {
+		name := strings.ToLower(domain.Name)
+		active[name] = true
+		dir := filepath.Join(certDir, name)
+		p.mu.RLock()
+		previous := p.domainCerts[name]
+		p.mu.RUnlock()
+		if loaded := loadCertificate(previous, filepath.Join(dir, domainCertFile), filepath.Join(dir, domainKeyFile)); loaded != nil {
+			domainCerts[name] = loaded
+		}
+	}
+
+	// ACME签发的证书（手动放置的域名证书优先）
+	issued, err := p.acmeModel.ListIssuedCertificates()
+	if err != nil {
+		log.Printf("获取ACME证书失败: %v", err)
+	}
+	for _, record := range issued {
+		if !active[record.Domain] || domainCerts[record.Domain] != nil {
+			continue
+		}
+		p.mu.RLock()
+		previous := p.domainCerts[record.Hostname]
+		p.mu.RUnlock()
+		if loaded := loadStoredCertificate(previous, record); loaded != nil {
+			domainCerts[record.Hostname] = loaded
+		}
+	}
+
+	p.mu.Lock()
+	p.defaultCert = defaultCert
+	p.domainCerts = domainCerts
+	p.mu.Unlock()
+}
+
+// loadCertificate 加载证书文件，文件未变化时复用之前的结果，加载失败时保留旧证书
+func loadCertificate(previous *loadedCertificate, certFile, keyFile string) *loadedCertificate {
+	certInfo, err := os.Stat(certFile)
+	if err != nil {
+		if previous != nil {
+			log.Printf("证书文件不可用: %s: %v", certFile, err)
+		}
+		return nil
+	}
+	keyInfo, err := os.Stat(keyFile)
+	if err != nil {
+		log.Printf("私钥文件不可用: %s: %v", keyFile, err)
+		return previous
+	}
+
+	modTime := certInfo.ModTime()
+	if keyInfo.ModTime().After(modTime) {
+		modTime = keyInfo.ModTime()
+	}
+	if previous != nil && previous.certFile == certFile && previous.keyFile == keyFile && previous.modTime.Equal(modTime) {
+		return previous
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		// 可能是证书正在被替换，下次检查时再加载
+		log.Printf("加载证书失败: %s: %v", certFile, err)
+		return previous
+	}
+	if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+		cert.Leaf = leaf
+		names := leaf.DNSNames
+		if len(names) == 0 {
+			names = []string{leaf.Subject.CommonName}
+		}
+		log.Printf("已加载TLS证书: %s (%s, 到期时间 %s)", certFile, strings.Join(names, ","), leaf.NotAfter.Format("2006-01-02"))
+	}
+
+	return &loadedCertificate{
+		certFile: certFile,
+		keyFile:  keyFile,
+		modTime:  modTime,
+		cert:     &cert,
+	}
+}
+
+// loadStoredCertificate 加载数据库中保存的ACME证书，证书未变化时复用之前的结果
+func loadStoredCertificate(previous *loadedCertificate, record *model.AcmeCertificate) *loadedCertificate {
+	source := "acme:" + record.Hostname
+	block, _ := pem.Decode([]byte(record.Certificate))
+	if block == nil {
+		log.Printf("ACME证书格式错误: %s", record.Hostname)
+		return nil
+	}
+	if previous != nil && previous.certFile == source && bytes.Equal(previous.cert.Certificate[0], block.Bytes) {
+		return previous
+	}
+
+	cert, err := tls.X509KeyPair([]byte(record.Certificate), []byte(record.PrivateKey))
+	if err != nil {
+		log.Printf("加载ACME证书失败: %s: %v", record.Hostname, err)
+		return previous
+	}
+	if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+		cert.Leaf = leaf
+		log.Printf("已加载ACME证书: %s (到期时间 %s)", record.Hostname, leaf.NotAfter.Format("2006-01-02"))
+	}
+
+	return &loadedCertificate{
+		certFile: source,
+		cert:     &cert,
+	}
+}
+
+// GetCertificate 根据SNI选择证书：域名证书（含上级域名）> 默认证书 > 任一域名证书 > 自签名证书
+func (p *CertificateProvider) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// mail.example.com 依次尝试 mail.example.com、example.com
+	for name != "" {
+		if loaded, ok := p.domainCerts[name]; ok {
+			return loaded.cert, nil
+		}
+		idx := strings.Index(name, ".")
+		if idx < 0 {
+			break
+		}
+		name = name[idx+1:]
+	}
+
+	if p.defaultCert != nil {
+		return p.defaultCert.cert, nil
+	}
+	for _, loaded := range p.domainCerts {
+		return loaded.cert, nil
+	}
+
+	return p.selfSignedCertificate()
+}
+
+// selfSignedCertificate 生成自签名证书（仅在没有配置任何证书时使用，进程内只生成一次）
+func (p *CertificateProvider) selfSignedCertificate() (*tls.Certificate, error) {
+	p.selfSignedOnce.Do(func() {
+		log.Printf("警告：未配置TLS证书，使用自签名证书")
+		p.selfSigned, p.selfSignedErr = p.generateSelfSignedCert()
+	})
+	return p.selfSigned, p.selfSignedErr
+}
+
+// generateSelfSignedCert 生成自签名证书
+func (p *CertificateProvider) generateSelfSignedCert() (*tls.Certificate, error) {
+	// 加载配置
+	cfg := config.Load()
+
+	// 生成私钥
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	dnsNames := []string{"localhost"}
+	if cfg.Domain != "" && cfg.Domain != "localhost" {
+		dnsNames = append(dnsNames, cfg.Domain, "*."+cfg.Domain)
+	}
+	if domains, err := p.domainModel.GetActiveDomains(); err == nil {
+		for _, domain := range domains {
+			if domain.Name != cfg.Domain {
+				dnsNames = append(dnsNames, domain.Name, "*."+domain.Name)
+			}
+		}
+	}
+
+	// 创建证书模板
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject: pkix.Name{
+			Organization: []string{"Miko Email System"},
+			Country:      []string{"CN"},
+		},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().Add(365 * 24 * time.Hour), // 1年有效期
+		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:    dnsNames,
+	}
+
+	// 生成证书
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, fmt.Errorf("生成自签名证书失败: %w", err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{certDER},
+		PrivateKey:  priv,
+	}, nil
+}
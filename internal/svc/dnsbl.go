@@ -0,0 +1,239 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"miko-email/internal/config"
+)
+
+// dnsblTimeout 一次检查（所有黑名单并发查询）的最长时间
+const dnsblTimeout = 5 * time.Second
+
+// DNSBLResolver 查询黑名单使用的解析器，net.Resolver 实现了该接口，测试时可以替换为本地的DNS
+type DNSBLResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNSBLListing 命中的黑名单
+type DNSBLListing struct {
+	Zone   string `json:"zone"`   // 黑名单域名
+	Type   string `json:"type"`   // ip/domain
+	Action string `json:"action"` // reject/score
+	Target string `json:"target"` // 查询的IP或HELO域名
+	Code   string `json:"code"`   // 黑名单返回的地址，如 127.0.0.2
+}
+
+// DNSBLEntry 缓存的查询结果
+type DNSBLEntry struct {
+	Zone      string    `json:"zone"`
+	Type      string    `json:"type"`
+	Target    string    `json:"target"`
+	Listed    bool      `json:"listed"`
+	Code      string    `json:"code"`
+	Hits      int64     `json:"hits"`     // 缓存期间被查询的次数
+	Rejected  int64     `json:"rejected"` // 因此拒收的次数
+	CheckedAt time.Time `json:"checked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// DNSBLChecker 查询客户端IP和HELO域名是否在DNS黑名单中，结果按 dnsbl.cache_minutes 缓存（进程内共享）
+type DNSBLChecker struct {
+	mu          sync.Mutex
+	resolver    DNSBLResolver
+	cache       map[string]*DNSBLEntry
+	lastCleanup time.Time
+}
+
+// NewDNSBLChecker 创建DNS黑名单检查，配置了 dnsbl.resolver 时使用指定的DNS服务器
+func NewDNSBLChecker() *DNSBLChecker {
+	var resolver DNSBLResolver = net.DefaultResolver
+	if addr := config.GetDNSBLResolver(); addr != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	return &DNSBLChecker{
+		resolver: resolver,
+		cache:    make(map[string]*DNSBLEntry),
+	}
+}
+
+// SetResolver 替换解析器并清空缓存
+func (c *DNSBLChecker) SetResolver(resolver DNSBLResolver) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resolver = resolver
+	c.cache = make(map[string]*DNSBLEntry)
+}
+
+// CheckIP 查询客户端IP命中的黑名单
+func (c *DNSBLChecker) CheckIP(ip net.IP) []DNSBLListing {
+	if ip == nil {
+		return nil
+	}
+	return c.check("ip", ip.String(), reverseIP(ip))
+}
+
+// CheckDomain 查询HELO域名命中的黑名单（IP地址和不带点的名称不查询）
+func (c *DNSBLChecker) CheckDomain(domain string) []DNSBLListing {
+	domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" || !strings.Contains(domain, ".") || strings.HasPrefix(domain, "[") || net.ParseIP(domain) != nil {
+		return nil
+	}
+	return c.check("domain", domain, domain)
+}
+
+// check 并发查询指定类型的所有黑名单，query 为拼接在黑名单域名前的部分
+func (c *DNSBLChecker) check(kind, target, query string) []DNSBLListing {
+	var zones []config.DNSBLZone
+	for _, zone := range config.GetDNSBLZones() {
+		if zone.Type == kind {
+			zones = append(zones, zone)
+		}
+	}
+	if len(zones) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dnsblTimeout)
+	defer cancel()
+
+	results := make([]*DNSBLEntry, len(zones))
+	var wg sync.WaitGroup
+	for i, zone := range zones {
+		wg.Add(1)
+		go func(i int, zone config.DNSBLZone) {
+			defer wg.Done()
+			results[i] = c.lookup(ctx, zone, target, query)
+		}(i, zone)
+	}
+	wg.Wait()
+
+	var listings []DNSBLListing
+	for i, entry := range results {
+		if entry == nil || !entry.Listed {
+			continue
+		}
+		listings = append(listings, DNSBLListing{
+			Zone:   zones[i].Zone,
+			Type:   kind,
+			Action: zones[i].Action,
+			Target: target,
+			Code:   entry.Code,
+		})
+	}
+	return listings
+}
+
+// lookup 查询单个黑名单，优先使用缓存；查询失败（超时等）时返回nil且不缓存
+func (c *DNSBLChecker) lookup(ctx context.Context, zone config.DNSBLZone, target, query string) *DNSBLEntry {
+	key := zone.Zone + "|" + target
+	now := time.Now()
+
+	c.mu.Lock()
+	if entry, ok := c.cache[key]; ok && now.Before(entry.ExpiresAt) {
+		entry.Hits++
+		copied := *entry
+		c.mu.Unlock()
+		return &copied
+	}
+	resolver := c.resolver
+	c.mu.Unlock()
+
+	entry := &DNSBLEntry{Zone: zone.Zone, Type: zone.Type, Target: target, Hits: 1, CheckedAt: now}
+	addrs, err := resolver.LookupHost(ctx, query+"."+zone.Zone)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			log.Printf("查询DNS黑名单 %s 失败 (%s): %v", zone.Zone, target, err)
+			return nil
+		}
+	}
+	for _, addr := range addrs {
+		// 127.255.255.x 为黑名单的错误码（如通过公共DNS查询被拒绝），不表示已列入
+		if strings.HasPrefix(addr, "127.255.255.") {
+			log.Printf("DNS黑名单 %s 拒绝查询 (%s)，请通过 dnsbl.resolver 使用自己的DNS服务器", zone.Zone, addr)
+			return nil
+		}
+		if strings.HasPrefix(addr, "127.") {
+			entry.Listed = true
+			entry.Code = addr
+			break
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.ExpiresAt = now.Add(config.GetDNSBLCacheTTL())
+	c.cache[key] = entry
+	c.cleanup(now)
+
+	copied := *entry
+	return &copied
+}
+
+// RecordReject 记录因黑名单拒收
+func (c *DNSBLChecker) RecordReject(listing DNSBLListing) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.cache[listing.Zone+"|"+listing.Target]; ok {
+		entry.Rejected++
+	}
+}
+
+// Entries 获取未过期的缓存结果，listedOnly 为 true 时只返回已列入黑名单的
+func (c *DNSBLChecker) Entries(listedOnly bool) []DNSBLEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	entries := make([]DNSBLEntry, 0, len(c.cache))
+	for _, entry := range c.cache {
+		if now.After(entry.ExpiresAt) || (listedOnly && !entry.Listed) {
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CheckedAt.After(entries[j].CheckedAt)
+	})
+	return entries
+}
+
+// cleanup 定期删除过期的缓存（调用方需持有锁）
+func (c *DNSBLChecker) cleanup(now time.Time) {
+	if now.Sub(c.lastCleanup) < time.Minute {
+		return
+	}
+	c.lastCleanup = now
+	for key, entry := range c.cache {
+		if now.After(entry.ExpiresAt) {
+			delete(c.cache, key)
+		}
+	}
+}
+
+// reverseIP IPv4按字节反转，IPv6按半字节反转
+func reverseIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	ip16 := ip.To16()
+	nibbles := make([]string, 0, 32)
+	for i := len(ip16) - 1; i >= 0; i-- {
+		nibbles = append(nibbles, fmt.Sprintf("%x", ip16[i]&0x0f), fmt.Sprintf("%x", ip16[i]>>4))
+	}
+	return strings.Join(nibbles, ".")
+}
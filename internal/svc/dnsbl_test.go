@@ -0,0 +1,243 @@
+package svc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"miko-email/internal/config"
+)
+
+// fakeDNSBLResolver 测试用的解析器，只回答配置的名称，其他名称返回NXDOMAIN
+type fakeDNSBLResolver struct {
+	mu      sync.Mutex
+	answers map[string][]string
+	errors  map[string]error
+	queries map[string]int
+}
+
+func newFakeDNSBLResolver(answers map[string][]string) *fakeDNSBLResolver {
+	return &fakeDNSBLResolver{
+		answers: answers,
+		errors:  make(map[string]error),
+		queries: make(map[string]int),
+	}
+}
+
+func (r *fakeDNSBLResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries[host]++
+	if err, ok := r.errors[host]; ok {
+		return nil, err
+	}
+	if addrs, ok := r.answers[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r *fakeDNSBLResolver) count(host string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.queries[host]
+}
+
+// setDNSBLConfig 设置测试使用的黑名单配置，测试结束后恢复
+func setDNSBLConfig(t *testing.T, zones ...config.DNSBLZone) {
+	t.Helper()
+	previous := config.GlobalYAMLConfig
+	cfg := &config.YAMLConfig{}
+	cfg.DNSBL.Zones = zones
+	cfg.DNSBL.CacheMinutes = 10
+	config.GlobalYAMLConfig = cfg
+	t.Cleanup(func() { config.GlobalYAMLConfig = previous })
+}
+
+func newTestDNSBLChecker(resolver DNSBLResolver) *DNSBLChecker {
+	c := NewDNSBLChecker()
+	c.SetResolver(resolver)
+	return c
+}
+
+func TestDNSBLCheckIP(t *testing.T) {
+	setDNSBLConfig(t,
+		config.DNSBLZone{Zone: "reject.bl.test", Action: "reject"},
+		config.DNSBLZone{Zone: "score.bl.test"},
+		config.DNSBLZone{Zone: "dbl.bl.test", Type: "domain"},
+	)
+	resolver := newFakeDNSBLResolver(map[string][]string{
+		"2.0.0.127.reject.bl.test": {"127.0.0.2"},
+		"2.0.0.127.score.bl.test":  {"127.0.0.4"},
+		"10.2.0.192.score.bl.test": {"127.0.0.10"},
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.reject.bl.test": {"127.0.0.3"},
+		// 公共DNS被拒绝时返回的错误码
+		"3.0.0.127.reject.bl.test": {"127.255.255.254"},
+		"3.0.0.127.score.bl.test":  {"127.255.255.252"},
+		// 不是127.0.0.0/8的地址不表示已列入
+		"4.0.0.127.score.bl.test": {"192.0.2.1"},
+	})
+	c := newTestDNSBLChecker(resolver)
+
+	tests := []struct {
+		name string
+		ip   string
+		want []DNSBLListing
+	}{
+		{"两个黑名单都列入", "127.0.0.2", []DNSBLListing{
+			{Zone: "reject.bl.test", Type: "ip", Action: "reject", Target: "127.0.0.2", Code: "127.0.0.2"},
+			{Zone: "score.bl.test", Type: "ip", Action: "score", Target: "127.0.0.2", Code: "127.0.0.4"},
+		}},
+		{"只在计分黑名单中", "192.0.2.10", []DNSBLListing{
+			{Zone: "score.bl.test", Type: "ip", Action: "score", Target: "192.0.2.10", Code: "127.0.0.10"},
+		}},
+		{"IPv6按半字节反转", "2001:db8::1", []DNSBLListing{
+			{Zone: "reject.bl.test", Type: "ip", Action: "reject", Target: "2001:db8::1", Code: "127.0.0.3"},
+		}},
+		{"未列入", "192.0.2.11", nil},
+		{"IPv6未列入", "2001:db8::2", nil},
+		{"错误码不表示列入", "127.0.0.3", nil},
+		{"非127地址不表示列入", "127.0.0.4", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.CheckIP(net.ParseIP(tt.ip))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckIP(%s) = %+v，期望 %+v", tt.ip, got, tt.want)
+			}
+		})
+	}
+
+	// IP黑名单不查询域名，域名黑名单不查询IP
+	for host := range resolver.queries {
+		if strings.HasSuffix(host, ".dbl.bl.test") {
+			t.Errorf("IP检查查询了域名黑名单: %s", host)
+		}
+	}
+	if c.CheckIP(nil) != nil {
+		t.Error("IP为空时不应命中黑名单")
+	}
+}
+
+func TestDNSBLCheckDomain(t *testing.T) {
+	setDNSBLConfig(t,
+		config.DNSBLZone{Zone: "dbl.bl.test", Type: "domain", Action: "reject"},
+		config.DNSBLZone{Zone: "score.bl.test"},
+	)
+	resolver := newFakeDNSBLResolver(map[string][]string{
+		"spam.example.dbl.bl.test": {"127.0.1.2"},
+	})
+	c := newTestDNSBLChecker(resolver)
+
+	listed := []DNSBLListing{{Zone: "dbl.bl.test", Type: "domain", Action: "reject", Target: "spam.example", Code: "127.0.1.2"}}
+	tests := []struct {
+		name   string
+		helo   string
+		want   []DNSBLListing
+		lookup bool
+	}{
+		{"列入黑名单", "spam.example", listed, true},
+		{"忽略大小写和结尾的点", " SPAM.Example. ", listed, true},
+		{"未列入", "mail.example", nil, true},
+		{"不带点的名称", "localhost", nil, false},
+		{"地址字面量", "[192.0.2.1]", nil, false},
+		{"IP地址", "192.0.2.1", nil, false},
+		{"空", "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(resolver.queries)
+			got := c.CheckDomain(tt.helo)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckDomain(%q) = %+v，期望 %+v", tt.helo, got, tt.want)
+			}
+			if !tt.lookup && len(resolver.queries) != before {
+				t.Errorf("CheckDomain(%q) 不应查询黑名单", tt.helo)
+			}
+		})
+	}
+}
+
+func TestDNSBLCache(t *testing.T) {
+	setDNSBLConfig(t, config.DNSBLZone{Zone: "bl.test"})
+	listedHost := "2.0.0.127.bl.test"
+	failingHost := "5.0.0.127.bl.test"
+	resolver := newFakeDNSBLResolver(map[string][]string{listedHost: {"127.0.0.2"}})
+	resolver.errors[failingHost] = &net.DNSError{Err: "i/o timeout", Name: failingHost, IsTimeout: true}
+	c := newTestDNSBLChecker(resolver)
+
+	tests := []struct {
+		name  string
+		ip    string
+		host  string
+		calls int  // 两次检查后查询DNS的次数
+		cache bool // 是否缓存结果
+	}{
+		{"列入的结果被缓存", "127.0.0.2", listedHost, 1, true},
+		{"未列入的结果被缓存", "127.0.0.9", "9.0.0.127.bl.test", 1, true},
+		{"查询失败不缓存", "127.0.0.5", failingHost, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := c.CheckIP(net.ParseIP(tt.ip))
+			second := c.CheckIP(net.ParseIP(tt.ip))
+			if !reflect.DeepEqual(first, second) {
+				t.Errorf("缓存的结果 %+v 与第一次查询 %+v 不同", second, first)
+			}
+			if got := resolver.count(tt.host); got != tt.calls {
+				t.Errorf("查询了 %d 次 %s，期望 %d 次", got, tt.host, tt.calls)
+			}
+
+			entry, ok := c.cache["bl.test|"+tt.ip]
+			if ok != tt.cache {
+				t.Fatalf("缓存存在 = %v，期望 %v", ok, tt.cache)
+			}
+			if !ok {
+				return
+			}
+			if ttl := entry.ExpiresAt.Sub(entry.CheckedAt); ttl != config.GetDNSBLCacheTTL() {
+				t.Errorf("缓存时间 = %v，期望 %v", ttl, config.GetDNSBLCacheTTL())
+			}
+			if entry.Hits != 2 {
+				t.Errorf("缓存命中次数 = %d，期望 2", entry.Hits)
+			}
+
+			// 过期后重新查询
+			entry.ExpiresAt = time.Now().Add(-time.Second)
+			c.CheckIP(net.ParseIP(tt.ip))
+			if got := resolver.count(tt.host); got != tt.calls+1 {
+				t.Errorf("缓存过期后查询了 %d 次，期望 %d 次", got, tt.calls+1)
+			}
+		})
+	}
+
+	// 替换解析器时清空缓存
+	c.SetResolver(resolver)
+	if entries := c.Entries(false); len(entries) != 0 {
+		t.Errorf("替换解析器后缓存 = %+v，期望为空", entries)
+	}
+}
+
+func TestDNSBLRecordReject(t *testing.T) {
+	setDNSBLConfig(t, config.DNSBLZone{Zone: "bl.test", Action: "reject"})
+	c := newTestDNSBLChecker(newFakeDNSBLResolver(map[string][]string{"2.0.0.127.bl.test": {"127.0.0.2"}}))
+	c.CheckIP(net.ParseIP("127.0.0.9"))
+
+	listings := c.CheckIP(net.ParseIP("127.0.0.2"))
+	if len(listings) != 1 || listings[0].Action != "reject" {
+		t.Fatalf("CheckIP = %+v，期望命中拒收黑名单", listings)
+	}
+	c.RecordReject(listings[0])
+
+	entries := c.Entries(true)
+	if len(entries) != 1 || entries[0].Target != "127.0.0.2" || entries[0].Rejected != 1 {
+		t.Errorf("Entries(true) = %+v，期望只有 127.0.0.2 且拒收1次", entries)
+	}
+	if all := c.Entries(false); len(all) != 2 {
+		t.Errorf("Entries(false) 返回 %d 条，期望 2 条", len(all))
+	}
+}
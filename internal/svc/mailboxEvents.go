@@ -0,0 +1,51 @@
+package svc
+
+import "sync"
+
+// MailboxEvents 进程内的邮箱变更通知（新邮件、删除、标志变化），用于IMAP IDLE推送
+// 通知只携带邮箱ID，订阅方收到后自行刷新；未及时处理的多次通知会合并为一次
+type MailboxEvents struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[chan struct{}]struct{}
+}
+
+// NewMailboxEvents 创建邮箱变更通知
+func NewMailboxEvents() *MailboxEvents {
+	return &MailboxEvents{
+		subscribers: make(map[int64]map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe 订阅邮箱的变更，返回通知通道和取消订阅函数
+func (e *MailboxEvents) Subscribe(mailboxId int64) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	e.mu.Lock()
+	if e.subscribers[mailboxId] == nil {
+		e.subscribers[mailboxId] = make(map[chan struct{}]struct{})
+	}
+	e.subscribers[mailboxId][ch] = struct{}{}
+	e.mu.Unlock()
+
+	cancel := func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.subscribers[mailboxId], ch)
+		if len(e.subscribers[mailboxId]) == 0 {
+			delete(e.subscribers, mailboxId)
+		}
+	}
+	return ch, cancel
+}
+
+// Publish 通知邮箱发生了变更（不会阻塞）
+func (e *MailboxEvents) Publish(mailboxId int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subscribers[mailboxId] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package svc
+
+// OutboundQueueNotifier 出站队列的入队通知，唤醒投递协程立即处理（未及时处理的多次通知会合并为一次）
+type OutboundQueueNotifier struct {
+	ch chan struct{}
+}
+
+// NewOutboundQueueNotifier 创建出站队列的入队通知
+func NewOutboundQueueNotifier() *OutboundQueueNotifier {
+	return &OutboundQueueNotifier{
+		ch: make(chan struct{}, 1),
+	}
+}
+
+// Notify 通知有新邮件入队（不会阻塞）
+func (n *OutboundQueueNotifier) Notify() {
+	select {
+	case n.ch <- struct{}{}:
+	default:
+	}
+}
+
+// C 返回通知通道
+func (n *OutboundQueueNotifier) C() <-chan struct{} {
+	return n.ch
+}
@@ -14,14 +14,29 @@ import (
 )
 
 type ServiceContext struct {
-	Config            config.Config
-	DB                *gorm.DB
-	UserModel         *model.UserModel
-	AdminModel        *model.AdminModel
-	DomainModel       *model.DomainModel
-	MailboxModel      *model.MailboxModel
-	EmailModel        *model.EmailModel
-	EmailForwardModel *model.EmailForwardModel
+	Config             config.Config
+	DB                 *gorm.DB
+	UserModel          *model.UserModel
+	AdminModel         *model.AdminModel
+	DomainModel        *model.DomainModel
+	MailboxModel       *model.MailboxModel
+	EmailModel         *model.EmailModel
+	EmailForwardModel  *model.EmailForwardModel
+	EmailRawModel      *model.EmailRawModel
+	AttachmentModel    *model.EmailAttachmentModel
+	FolderModel        *model.MailboxFolderModel
+	AcmeModel          *model.AcmeModel
+	OutboundQueueModel *model.OutboundQueueModel
+	DkimKeyModel       *model.DkimKeyModel
+	BayesModel         *model.BayesModel
+	GreylistModel      *model.GreylistModel
+	MailAliasModel     *model.MailAliasModel
+	SieveScriptModel   *model.SieveScriptModel
+	MailboxEvents      *MailboxEvents
+	QueueNotifier      *OutboundQueueNotifier
+	DNSBL              *DNSBLChecker
+	Certificates       *CertificateProvider
+	ACME               *ACMEManager
 }
 
 func NewServiceContext(c config.Config) *ServiceContext {
@@ -52,15 +67,44 @@ func NewServiceContext(c config.Config) *ServiceContext {
 		log.Fatal("创建默认管理员失败", err)
 	}
 
+	// 填充旧邮件的发件人索引字段
+	emailModel := model.NewEmailModel(db)
+	if n, err := emailModel.BackfillSender(); err != nil {
+		log.Printf("填充邮件发件人字段失败: %v", err)
+	} else if n > 0 {
+		log.Printf("已填充 %d 封邮件的发件人字段", n)
+	}
+
+	domainModel := model.NewDomainModel(db)
+	mailboxModel := model.NewMailboxModel(db)
+	mailboxModel.SetSubaddressSeparator(config.GetSubaddressSeparator())
+	acmeModel := model.NewAcmeModel(db)
+	certificates := NewCertificateProvider(domainModel, acmeModel)
+
 	return &ServiceContext{
-		Config:            c,
-		DB:                db,
-		UserModel:         model.NewUserModel(db),
-		AdminModel:        model.NewAdminModel(db),
-		DomainModel:       model.NewDomainModel(db),
-		MailboxModel:      model.NewMailboxModel(db),
-		EmailModel:        model.NewEmailModel(db),
-		EmailForwardModel: model.NewEmailForwardModel(db),
+		Config:             c,
+		DB:                 db,
+		UserModel:          model.NewUserModel(db),
+		AdminModel:         model.NewAdminModel(db),
+		DomainModel:        domainModel,
+		MailboxModel:       mailboxModel,
+		EmailModel:         emailModel,
+		EmailForwardModel:  model.NewEmailForwardModel(db),
+		EmailRawModel:      model.NewEmailRawModel(db),
+		AttachmentModel:    model.NewEmailAttachmentModel(db),
+		FolderModel:        model.NewMailboxFolderModel(db),
+		AcmeModel:          acmeModel,
+		OutboundQueueModel: model.NewOutboundQueueModel(db),
+		DkimKeyModel:       model.NewDkimKeyModel(db),
+		BayesModel:         model.NewBayesModel(db),
+		GreylistModel:      model.NewGreylistModel(db),
+		MailAliasModel:     model.NewMailAliasModel(db),
+		SieveScriptModel:   model.NewSieveScriptModel(db),
+		MailboxEvents:      NewMailboxEvents(),
+		QueueNotifier:      NewOutboundQueueNotifier(),
+		DNSBL:              NewDNSBLChecker(),
+		Certificates:       certificates,
+		ACME:               NewACMEManager(acmeModel, domainModel, certificates),
 	}
 }
 
@@ -74,6 +118,21 @@ func autoMigrate(db *gorm.DB) error {
 		&model.Mailbox{},
 		&model.Email{},
 		&model.EmailForward{},
+		&model.EmailRaw{},
+		&model.EmailAttachment{},
+		&model.MailboxFolder{},
+		&model.AcmeAccount{},
+		&model.AcmeCertificate{},
+		&model.OutboundMessage{},
+		&model.OutboundRecipient{},
+		&model.DkimKey{},
+		&model.BayesToken{},
+		&model.BayesCorpus{},
+		&model.Greylist{},
+		&model.GreylistWhitelist{},
+		&model.MailAlias{},
+		&model.SieveScript{},
+		&model.SieveVacation{},
 	)
 }
 
@@ -15,6 +15,14 @@ func main() {
 	//初始化上下文
 	svcCtx := svc.NewServiceContext(*cfg)
 
+	// 检查SRS和DKIM私钥加密密钥，未配置时首次启动生成并保存
+	if _, err := config.GetSRSSecret(); err != nil {
+		log.Printf("⚠️ SRS不可用，转发时不改写信封发件人: %v", err)
+	}
+	if _, err := config.GetDKIMKeySecret(); err != nil {
+		log.Printf("⚠️ DKIM私钥加密密钥不可用，不能生成或导入DKIM密钥: %v", err)
+	}
+
 	// 从GORM获取原生SQL数据库连接
 	sqlDB, err := svcCtx.DB.DB()
 	if err != nil {
@@ -52,6 +60,35 @@ func main() {
 		}
 	}()
 
+	// 启动IMAPS/POP3S（隐式TLS）
+	if cfg.IMAPSPort != "" && cfg.IMAPSPort != "0" {
+		go func() {
+			if err := emailService.StartIMAPSServer(cfg.IMAPSPort); err != nil {
+				log.Printf("IMAPS server error: %v", err)
+			}
+		}()
+	}
+
+	if cfg.POP3SPort != "" && cfg.POP3SPort != "0" {
+		go func() {
+			if err := emailService.StartPOP3SServer(cfg.POP3SPort); err != nil {
+				log.Printf("POP3S server error: %v", err)
+			}
+		}()
+	}
+
+	// 启动ManageSieve（管理Sieve过滤脚本）
+	if cfg.ManageSievePort != "" && cfg.ManageSievePort != "0" {
+		go func() {
+			if err := emailService.StartManageSieveServer(cfg.ManageSievePort); err != nil {
+				log.Printf("ManageSieve server error: %v", err)
+			}
+		}()
+	}
+
+	// 启动出站队列投递
+	emailService.StartOutboundQueue()
+
 	// 启动Web服务器
 	webServer := server.New(sqlDB, cfg, svcCtx)
 	log.Printf("Starting web server on port %s", cfg.WebPort)